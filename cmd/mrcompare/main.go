@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian pipestance comparison tool.
+//
+// Pairs the stages of two pipestances by name, and reports which stage
+// outputs differ and how the wall time and memory usage of each stage
+// changed, for example to validate a pipeline upgrade against a run of the
+// previous version on the same inputs.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian pipestance comparison tool.
+
+Compares the outputs and performance of pipestance B to pipestance A.
+
+Usage:
+    mrcompare <pipestance_a> <pipestance_b> [options]
+    mrcompare -h | --help | --version
+
+Options:
+    --all       List every stage, not just stages with changed outputs.
+    --json      Print the full comparison as JSON.
+
+    -h --help   Show this message.
+    --version   Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	rt := config.NewRuntime()
+	oldp, err := rt.InspectPipestance(opts["<pipestance_a>"].(string),
+		context.Background())
+	util.DieIf(err)
+	newp, err := rt.InspectPipestance(opts["<pipestance_b>"].(string),
+		context.Background())
+	util.DieIf(err)
+	result, err := core.ComparePipestances(newp, oldp)
+	util.DieIf(err)
+
+	if opts["--json"].(bool) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		util.DieIf(enc.Encode(result))
+		return
+	}
+	printComparison(result, opts["--all"].(bool))
+}
+
+func seconds(s float64) time.Duration {
+	return (time.Duration(s * float64(time.Second))).Round(time.Second)
+}
+
+func delta(old, new float64) string {
+	if old <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.0f%%", 100*(new-old)/old)
+}
+
+func printComparison(result *core.PipestanceComparison, all bool) {
+	fmt.Printf("Stages compared:       %d\n", len(result.Stages))
+	fmt.Printf("With changed outputs:  %d\n", result.ChangedStages)
+	fmt.Printf("Wall time:             %v -> %v (%s)\n",
+		seconds(result.OldWallTime), seconds(result.NewWallTime),
+		delta(result.OldWallTime, result.NewWallTime))
+	for _, name := range result.Removed {
+		fmt.Printf("Only in A:             %s\n", name)
+	}
+	for _, name := range result.Added {
+		fmt.Printf("Only in B:             %s\n", name)
+	}
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tFORK\tWALL A\tWALL B\tDELTA\tMEM A\tMEM B\tDELTA\tOUTPUTS")
+	for _, stage := range result.Stages {
+		if !all && !stage.Changed {
+			continue
+		}
+		for _, fork := range stage.Forks {
+			fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%s\t%dMB\t%dMB\t%s\t%s\n",
+				stage.Stage, fork.Index,
+				seconds(fork.OldWallTime), seconds(fork.NewWallTime),
+				delta(fork.OldWallTime, fork.NewWallTime),
+				fork.OldMaxRssMB, fork.NewMaxRssMB,
+				delta(float64(fork.OldMaxRssMB), float64(fork.NewMaxRssMB)),
+				forkOutputs(fork))
+		}
+	}
+	tw.Flush()
+
+	if result.ChangedStages == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Changed outputs:")
+	for _, stage := range result.Stages {
+		for _, fork := range stage.Forks {
+			for _, out := range fork.Outputs {
+				if !out.Changed {
+					continue
+				}
+				name := fmt.Sprintf("%s.fork%d.%s", stage.Stage, fork.Index, out.Param)
+				if out.Error != "" {
+					fmt.Printf("    %s: could not compare: %s\n", name, out.Error)
+				} else if out.File && out.OldDigest != "" {
+					fmt.Printf("    %s: contents differ\n", name)
+				} else {
+					fmt.Printf("    %s: %s -> %s\n", name,
+						formatValue(out.Old), formatValue(out.New))
+				}
+			}
+		}
+	}
+}
+
+// Summarize whether the outputs of a fork changed.  Outputs which could not
+// be compared are reported as unknown, unless some other output changed.
+func forkOutputs(fork *core.ForkComparison) string {
+	result := "same"
+	for _, out := range fork.Outputs {
+		if out.Error != "" {
+			result = "unknown"
+		} else if out.Changed {
+			return "changed"
+		}
+	}
+	return result
+}
+
+func formatValue(v interface{}) string {
+	if b, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	} else if len(b) > 60 {
+		return string(b[:57]) + "..."
+	} else {
+		return string(b)
+	}
+}
@@ -0,0 +1,173 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian critical path analyzer.
+//
+// Reads the performance data for a pipestance, either from a running mrp or
+// from the pipestance metadata, and reports the chain of jobs which
+// determined the total wall time, how long jobs waited in queue, how many
+// core hours went unused, and which stages are worth optimizing.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian critical path analyzer.
+
+Usage:
+    mrcritpath <pipestance_path> [options]
+    mrcritpath -h | --help | --version
+
+Options:
+    --speedup=X     Factor by which to assume a stage is sped up when
+                    estimating savings.  Default 2.
+    --cores=N       Number of cores available to the pipestance.  Defaults
+                    to the peak number of threads reserved concurrently,
+                    or mrp's core limit if mrp is running in local mode.
+    --top=N         Number of stages to list.  Default 10.
+    --json          Print the full report as JSON.
+
+    -h --help       Show this message.
+    --version       Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	psPath := opts["<pipestance_path>"].(string)
+	speedup := 2.0
+	if value := opts["--speedup"]; value != nil {
+		if s, err := strconv.ParseFloat(value.(string), 64); err != nil || s <= 1 {
+			util.PrintInfo("mrcritpath", "Speedup must be a number greater than 1.")
+			os.Exit(1)
+		} else {
+			speedup = s
+		}
+	}
+	cores := 0
+	if value := opts["--cores"]; value != nil {
+		if c, err := strconv.Atoi(value.(string)); err != nil || c < 1 {
+			util.PrintInfo("mrcritpath", "Invalid core count %v.", value)
+			os.Exit(1)
+		} else {
+			cores = c
+		}
+	}
+	top := 10
+	if value := opts["--top"]; value != nil {
+		if n, err := strconv.Atoi(value.(string)); err != nil {
+			util.PrintInfo("mrcritpath", "Invalid stage count %v.", value)
+			os.Exit(1)
+		} else {
+			top = n
+		}
+	}
+
+	report := queryMrp(psPath, cores, speedup)
+	if report == nil {
+		config := core.DefaultRuntimeOptions()
+		config.VdrMode = "disable"
+		rt := config.NewRuntime()
+		pipestance, err := rt.InspectPipestance(psPath, context.Background())
+		util.DieIf(err)
+		report = pipestance.AnalyzeCriticalPath(cores, speedup)
+	}
+
+	if opts["--json"].(bool) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		util.DieIf(enc.Encode(report))
+		return
+	}
+	printReport(report, top)
+}
+
+// Get the report from a running mrp, if there is one.
+func queryMrp(psPath string, cores int, speedup float64) *core.CriticalPathReport {
+	mrpUrl, err := api.ReadMrpUrl(psPath, false)
+	if err != nil {
+		return nil
+	}
+	mrpUrl.Path = api.QueryGetCriticalPath
+	query := mrpUrl.Query()
+	query.Set("speedup", strconv.FormatFloat(speedup, 'g', -1, 64))
+	if cores > 0 {
+		query.Set("cores", strconv.Itoa(cores))
+	}
+	mrpUrl.RawQuery = query.Encode()
+	resp, err := api.MrpClient(psPath).Get(mrpUrl.String())
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	var report core.CriticalPathReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil
+	}
+	return &report
+}
+
+func seconds(s float64) time.Duration {
+	return (time.Duration(s) * time.Second).Round(time.Second)
+}
+
+func printReport(report *core.CriticalPathReport, top int) {
+	if len(report.Path) == 0 {
+		fmt.Println("No completed jobs found.")
+		return
+	}
+	fmt.Printf("Wall time:           %v\n", seconds(report.WallTime))
+	fmt.Printf("Critical path:       %v running, %v waiting (%d jobs)\n",
+		seconds(report.PathRunTime), seconds(report.PathQueueWait),
+		len(report.Path))
+	fmt.Printf("Cores:               %d (peak reserved %d)\n",
+		report.Cores, report.PeakThreads)
+	fmt.Printf("Core hours reserved: %.2f\n", report.ReservedCoreHours)
+	fmt.Printf("Core hours used:     %.2f\n", report.UsedCoreHours)
+	fmt.Printf("Core hours idle:     %.2f\n", report.IdleCoreHours)
+
+	fmt.Println()
+	fmt.Println("Critical path:")
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tTHREADS\tSTART\tWAIT\tRUN")
+	for _, job := range report.Path {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%v\t%v\n",
+			job.Name, job.Threads,
+			job.Start.Format(util.TIMEFMT),
+			seconds(job.QueueWait), seconds(job.RunTime))
+	}
+	tw.Flush()
+
+	fmt.Println()
+	fmt.Printf("Stages by estimated savings from a %gx speedup:\n", report.Speedup)
+	tw = tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tJOBS\tCRITICAL\tRUN\tWAIT\tCORE HOURS\tSAVINGS")
+	for i, st := range report.Stages {
+		if top >= 0 && i >= top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%v\t%.2f\t%v\n",
+			st.Stage, st.Jobs,
+			seconds(st.CriticalTime), seconds(st.RunTime),
+			seconds(st.QueueWait), st.CoreHours, seconds(st.Savings))
+	}
+	tw.Flush()
+}
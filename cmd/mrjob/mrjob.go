@@ -87,6 +87,7 @@ func (self *runner) Init() {
 		self.Fail(err, "Could not change to the correct working directory")
 	}
 	self.writeJobinfo()
+	self.setStageEnv()
 	util.LogInfo("time", "__start__")
 	if jErr := self.metadata.UpdateJournal(core.LogFile); jErr != nil {
 		util.PrintError(jErr, "monitor",
@@ -127,6 +128,17 @@ func (self *runner) writeJobinfo() {
 	}
 }
 
+// Set the stage's environment variables and PATH prefix, expanded against
+// the environment the job was started in, for the stage code to inherit.
+func (self *runner) setStageEnv() {
+	for k, v := range core.ExpandStageEnv(self.jobInfo.Env,
+		self.jobInfo.Path, os.Getenv) {
+		if err := os.Setenv(k, v); err != nil {
+			self.Fail(err, "Could not set the stage environment.")
+		}
+	}
+}
+
 func (self *runner) setRlimit() {
 	if err := core.MaximizeMaxFiles(); err != nil {
 		util.PrintError(err, "monitor", "Error setting the file rlimit.")
@@ -254,7 +266,27 @@ func (self *runner) makeErrorPipe() (*os.File, error) {
 	return writer, err
 }
 
+// Wrap the job command in a shell which limits its virtual memory to the
+// given number of gigabytes.
+func vmemLimitCommand(args []string, vmemGB int) []string {
+	return append([]string{
+		"/bin/sh", "-c", `ulimit -v "$0" && exec "$@"`,
+		strconv.Itoa(vmemGB * 1024 * 1024),
+	}, args...)
+}
+
 func (self *runner) StartJob(args []string) error {
+	if vmem := self.jobInfo.VMemGB; vmem > 0 {
+		util.LogInfo("monitor", "Limiting virtual memory to %d GB", vmem)
+		args = vmemLimitCommand(args, vmem)
+	}
+	if c := self.jobInfo.Container; c != nil {
+		var err error
+		if args, err = c.Command(args); err != nil {
+			return err
+		}
+		util.LogInfo("monitor", "Running in container %s", c.Image)
+	}
 	cmd := exec.Command(args[0], args[1:]...)
 	if writer, err := self.makeErrorPipe(); err != nil {
 		return err
@@ -264,6 +296,9 @@ func (self *runner) StartJob(args []string) error {
 	}
 	// We really don't want the child outliving the parent.
 	cmd.SysProcAttr = util.Pdeathsig(&syscall.SysProcAttr{}, syscall.SIGKILL)
+	// Normally there is nothing on stdin, but when a job is replayed
+	// interactively this lets debuggers work.
+	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if pc := self.jobInfo.ProfileConfig; pc != nil && len(pc.Env) > 0 {
@@ -0,0 +1,33 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Reporting of which overrides apply to each stage.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+func explainOverrides(w io.Writer, pipestance *core.Pipestance) {
+	explanations := pipestance.ExplainOverrides()
+	if len(explanations) == 0 {
+		fmt.Fprintln(w, "No overrides apply to any stage.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tKEY\tVALUE\tRULE")
+	for _, e := range explanations {
+		rule := e.Rule
+		if rule == "" {
+			rule = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\n", e.Stage, e.Key, e.Value, rule)
+	}
+	tw.Flush()
+}
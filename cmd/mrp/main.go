@@ -8,6 +8,7 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -43,14 +44,21 @@ type pipestanceHolder struct {
 	maxRetries       int
 	remainingRetries int
 	authKey          string
+	controlKey       string
 	enableUI         bool
 	showedFailed     bool
+	showedComplete   bool
+	showedPaused     bool
 	lastRegister     time.Time
 	cleanupLock      sync.Mutex
 	lock             sync.Mutex
 	readOnly         bool
 	retryWait        time.Duration
 	server           *http.Server
+	webhooks         *webhookNotifier
+
+	// The stages given with --until.
+	until []string
 }
 
 func (self *pipestanceHolder) getPipestance() *core.Pipestance {
@@ -80,6 +88,7 @@ func (self *pipestanceHolder) reset(ctx context.Context) error {
 	self.lock.Lock()
 	self.remainingRetries = self.maxRetries
 	self.showedFailed = false
+	self.showedPaused = false
 	self.lock.Unlock()
 	return self.restart(ctx)
 }
@@ -95,7 +104,10 @@ func (self *pipestanceHolder) restart(outerCtx context.Context) error {
 	defer self.lock.Unlock()
 	ps, err := self.factory.ReattachToPipestance(ctx)
 	if err == nil {
-		err = ps.Reset()
+		err = ps.SetTargets(self.until)
+		if err == nil {
+			err = ps.Reset()
+		}
 		if err != nil {
 			ps.Unlock()
 			return err
@@ -106,6 +118,42 @@ func (self *pipestanceHolder) restart(outerCtx context.Context) error {
 	return err
 }
 
+// Reset a stage and everything downstream of it, along with any other failed
+// stages, and restart the pipestance.  Returns the stages which were reset.
+func (self *pipestanceHolder) rerunFrom(outerCtx context.Context,
+	stage string) ([]string, error) {
+	ctx, task := trace.NewTask(outerCtx, "rerun")
+	defer task.End()
+	if self.readOnly {
+		return nil, fmt.Errorf("mrp instances started with --inspect cannot rerun stages.")
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	ps, err := self.factory.ReattachToPipestance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = ps.SetTargets(self.until)
+	var stages []string
+	if err == nil {
+		stages, err = ps.RerunFrom(stage)
+	}
+	if err == nil {
+		err = ps.Reset()
+	}
+	if err != nil {
+		ps.Unlock()
+		return stages, err
+	}
+	ps.LoadMetadata(ctx)
+	self.setPipestance(ps)
+	self.remainingRetries = self.maxRetries
+	self.showedFailed = false
+	self.showedComplete = false
+	self.showedPaused = false
+	return stages, nil
+}
+
 func (self *pipestanceHolder) UpdateState(state core.MetadataState) chan struct{} {
 	oldState := self.info.State
 	self.info.State = state
@@ -132,6 +180,8 @@ func (self *pipestanceHolder) Register() chan struct{} {
 			Path:   api.QueryRegisterEnterprise,
 		}
 		form := self.info.AsForm()
+		// The control key is deliberately not sent, since registration is
+		// over plain http and the key grants control of the pipestance.
 		form.Set("authkey", self.authKey)
 		self.lastRegister = time.Now()
 		complete := make(chan struct{})
@@ -174,19 +224,59 @@ func (self *pipestanceHolder) HandleSignal(os.Signal) {
 
 const WAIT_SECS = 6
 
+// The exit status when the stages given with --until completed, to
+// distinguish a paused pipestance from a completed one.
+const PAUSED_EXIT_CODE = 3
+
+// When the journal is being watched for changes, the run loop still polls
+// at this interval, to check heartbeats and catch anything the watch missed.
+const WATCH_POLL_SECS = 30
+
 //=============================================================================
 // Pipestance runner.
 //=============================================================================
+
+// Reset a stage and everything downstream of it, after listing the stages
+// which will be reset.
+func rerunFrom(pipestance *core.Pipestance, stage string) error {
+	stages, err := pipestance.RerunStages(stage)
+	if err != nil {
+		return err
+	}
+	util.Println("Rerunning from %s.  The following stages will be reset:", stage)
+	for _, fqname := range stages {
+		util.Println("    %s", fqname)
+	}
+	util.Println("")
+	_, err = pipestance.RerunFrom(stage)
+	return err
+}
+
 func runLoop(pipestanceBox *pipestanceHolder, stepSecs int, vdrMode string,
-	noExit bool) {
+	noExit, watch bool) {
 	pipestanceBox.getPipestance().LoadMetadata(context.Background())
 
+	var watcher *util.DirWatcher
+	if watch {
+		if w, err := pipestanceBox.getPipestance().WatchJournal(); err != nil {
+			util.LogInfo("runtime",
+				"Polling for job updates every %d seconds: %v", stepSecs, err)
+		} else {
+			watcher = w
+			defer watcher.Close()
+		}
+	}
+
 	for {
 		hadProgress := loopBody(pipestanceBox, vdrMode, noExit)
 
 		if !hadProgress {
-			// Wait for a bit.
-			time.Sleep(time.Second * time.Duration(stepSecs))
+			if watcher == nil {
+				// Wait for a bit.
+				time.Sleep(time.Second * time.Duration(stepSecs))
+			} else {
+				waitForChanges(watcher, pipestanceBox.getPipestance(), stepSecs)
+			}
 			// During the idle portion of the run loop is a good time to
 			// run the GC.  We do this after the sleep because StepNodes
 			// launches jobs on goroutines, and it's better to give them
@@ -198,6 +288,32 @@ func runLoop(pipestanceBox *pipestanceHolder, stepSecs int, vdrMode string,
 	}
 }
 
+// Wait until a job updates the journal or its metadata, or for the watch
+// poll interval to elapse.
+func waitForChanges(watcher *util.DirWatcher, pipestance *core.Pipestance,
+	stepSecs int) {
+	if err := pipestance.UpdateWatch(watcher); err != nil {
+		util.LogError(err, "runtime", "Could not watch for job updates.")
+	}
+	pollSecs := WATCH_POLL_SECS
+	if stepSecs > pollSecs {
+		pollSecs = stepSecs
+	}
+	timer := time.NewTimer(time.Second * time.Duration(pollSecs))
+	defer timer.Stop()
+	select {
+	case <-watcher.C:
+		// Jobs often update several files at once.  Give them a moment to
+		// finish, so they can be handled in a single step.
+		time.Sleep(200 * time.Millisecond)
+		select {
+		case <-watcher.C:
+		default:
+		}
+	case <-timer.C:
+	}
+}
+
 func loopBody(pipestanceBox *pipestanceHolder, vdrMode string, noExit bool) bool {
 	pipestance := pipestanceBox.getPipestance()
 	ctx, task := trace.NewTask(context.Background(), "update")
@@ -207,6 +323,11 @@ func loopBody(pipestanceBox *pipestanceHolder, vdrMode string, noExit bool) bool
 	// Check for completion states.
 	state := pipestance.GetState(ctx)
 	if state == core.Complete || state == core.DisabledState {
+		if pipestanceBox.showedComplete {
+			// Already cleaned up, and staying alive because of --noexit,
+			// in case stages are rerun.
+			return false
+		}
 		pipestanceBox.UpdateState(state.Prefixed(core.CleanupPrefix))
 		cleanupCompleted(pipestance, pipestanceBox, vdrMode, noExit, ctx)
 		return false
@@ -221,17 +342,27 @@ func loopBody(pipestanceBox *pipestanceHolder, vdrMode string, noExit bool) bool
 			cleanupFailed(pipestance, pipestanceBox, noExit, ctx)
 		}
 		return false
+	} else if state == core.Paused {
+		if pipestanceBox.showedPaused {
+			// Already cleaned up, and staying alive because of --noexit,
+			// in case stages are rerun.
+			return false
+		}
+		cleanupPaused(pipestance, pipestanceBox, noExit, ctx)
+		return false
 	} else {
 		pipestanceBox.UpdateState(state)
 		// If we went from failed to something else, allow the failure message to
 		// be shown once if we fail again.
 		pipestanceBox.showedFailed = false
+		pipestanceBox.showedPaused = false
 
 		// Check job heartbeats.
 		pipestance.CheckHeartbeats(ctx)
 
-		// Step all nodes.
-		return pipestance.StepNodes(ctx)
+		// Step all nodes, notifying webhooks of stages which finish.
+		return pipestance.StepNodesNotify(ctx,
+			pipestanceBox.webhooks.stageNotifier(pipestanceBox.info, state))
 	}
 }
 
@@ -245,7 +376,7 @@ func attemptRetry(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 	}
 	canRetry := false
 	var transient_log string
-	if pipestanceBox.consumeRetry() {
+	if pipestanceBox.consumeRetry() || pipestance.HasOverrideRetries() {
 		canRetry, transient_log = pipestance.IsErrorTransient()
 	}
 	if transient_log != "" && !pipestanceBox.showedFailed {
@@ -278,6 +409,10 @@ func attemptRetry(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 			util.LogInfo("runtime", "Transient error detected.  Log content:\n\n%s\n", transient_log)
 		}
 		util.LogInfo("runtime", "Attempting retry.")
+		pipestanceBox.webhooks.notifyPipestance(api.EventRetry,
+			pipestanceBox.info, core.Failed.Prefixed(core.RetryPrefix),
+			pipestance.GetErrors(), transient_log)
+		pipestance.ConsumeStageRetries()
 		if err := pipestanceBox.restart(ctx); err != nil {
 			util.LogInfo("runtime", "Retry failed:\n%v\n", err)
 			// Let the next loop around actually handle the failure.
@@ -307,12 +442,15 @@ func cleanupCompleted(pipestance *core.Pipestance, pipestanceBox *pipestanceHold
 	trace.WithRegion(ctx, "PostProcess", pipestance.PostProcess)
 	pipestance.Unlock()
 	pipestance.OnFinishHook(ctx)
+	pipestanceBox.webhooks.notifyPipestance(api.EventComplete,
+		pipestanceBox.info, core.Complete, nil, "")
 	updateComplete := pipestanceBox.UpdateState(core.Complete)
 	if noExit {
 		util.Println("Pipestance completed successfully, staying alive because --noexit given.\n")
+		// Keep running the loop, but don't clean up again unless stages are
+		// rerun.
+		pipestanceBox.showedComplete = true
 		runtime.GC()
-		// Don't return; otherwise we'll repeatedly try to clean up.
-		runtime.Goexit()
 	} else {
 		if pipestanceBox.enableUI {
 			// Give time for web ui client to get last update.
@@ -323,10 +461,45 @@ func cleanupCompleted(pipestance *core.Pipestance, pipestanceBox *pipestanceHold
 		if updateComplete != nil {
 			<-updateComplete
 		}
+		pipestanceBox.webhooks.wait(webhookExitWait)
 		util.Suicide(true)
 	}
 }
 
+// Stop after the stages given with --until have completed, leaving the rest
+// of the pipestance to be run later.
+func cleanupPaused(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
+	noExit bool, ctx context.Context) {
+	r := trace.StartRegion(ctx, "cleanupPaused")
+	defer r.End()
+	if pipestanceBox.readOnly {
+		pipestanceBox.UpdateState(core.Paused)
+		util.Println("Target stages completed, staying alive because --inspect given.\n")
+		return
+	}
+	pipestanceBox.cleanupLock.Lock()
+	defer pipestanceBox.cleanupLock.Unlock()
+	pipestance.Unlock()
+	updatePaused := pipestanceBox.UpdateState(core.Paused)
+	if noExit {
+		util.Println("Target stages completed, staying alive because --noexit given.\n")
+		// Keep running the loop, but don't clean up again unless stages are
+		// rerun.
+		pipestanceBox.showedPaused = true
+		runtime.GC()
+	} else {
+		if pipestanceBox.enableUI {
+			util.Println("Waiting %d seconds for UI to do final refresh.", WAIT_SECS)
+			time.Sleep(time.Second * time.Duration(WAIT_SECS))
+		}
+		util.Println("Target stages completed.  Run mrp again without --until to continue the pipestance.\n")
+		if updatePaused != nil {
+			<-updatePaused
+		}
+		util.SuicideWithCode(PAUSED_EXIT_CODE)
+	}
+}
+
 func cleanupFailed(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 	noExit bool, ctx context.Context) {
 	r := trace.StartRegion(ctx, "cleanupFailed")
@@ -345,6 +518,8 @@ func cleanupFailed(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 	var serverUpdate chan struct{}
 	if !pipestanceBox.showedFailed {
 		pipestance.OnFinishHook(ctx)
+		pipestanceBox.webhooks.notifyPipestance(api.EventFailed,
+			pipestanceBox.info, core.Failed, pipestance.GetErrors(), "")
 		if _, _, _, log, kind, errPaths := pipestance.GetFatalError(); kind == "assert" {
 			// Print preflight check failures.
 			util.Println("\n[%s] %s\n", "error", log)
@@ -358,6 +533,7 @@ func cleanupFailed(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 			if serverUpdate != nil {
 				<-serverUpdate
 			}
+			pipestanceBox.webhooks.wait(webhookExitWait)
 			util.Suicide(false)
 		} else if len(errPaths) > 0 {
 			// Build relative path to _errors file
@@ -395,6 +571,7 @@ func cleanupFailed(pipestance *core.Pipestance, pipestanceBox *pipestanceHolder,
 		if serverUpdate != nil {
 			<-serverUpdate
 		}
+		pipestanceBox.webhooks.wait(webhookExitWait)
 		util.Suicide(false)
 	}
 }
@@ -507,8 +684,13 @@ Options:
 
     --vdrmode=MODE      Enables Volatile Data Removal. Valid options:
                             post, rolling (default), or disable
+    --checksum=ALG      Checksum output files after moving them to outs/.
+                            Valid options: disable (default), md5, sha1,
+                            sha256, or sha512
 
     --nopreflight       Skips preflight stages.
+    --nowatch           Poll for job updates, rather than watching the
+                        journal for changes.
     --strict=MODE       Determines how mrp reports cases where it needs to fall
                         back on backwards compatibility for mro checks. Allowed
                         values: disable (default), log, alarm, or error.
@@ -519,9 +701,28 @@ Options:
                         if --uiport is not set).
     --auth-key=KEY      Set the authentication key required for accessing the
                         web UI.
+    --control-key=KEY   Set the key required for restarting, stopping, or
+                        reloading the pipestance through the web UI.
+                        By default a random key is generated, which is
+                        only readable by the pipestance owner.
+    --tls               Serve the UI over HTTPS, with a self-signed
+                        certificate unless --tls-cert is given.
+    --tls-cert=FILE     PEM certificate file to use for serving the UI over
+                        HTTPS.  Requires --tls-key.
+    --tls-key=FILE      PEM private key file for --tls-cert.
     --noexit            Keep UI running after pipestance completes or fails.
     --onfinish=EXEC     Run this when pipeline finishes, success or fail.
+    --webhooks=JSON     JSON file listing URLs to notify of pipestance
+                        completion or failure, stage failures, retries,
+                        and alarms.
     --zip               Zip metadata files after pipestance completes.
+    --compact-metadata
+                        Move the metadata files for completed stages into
+                        per-stage archives while the pipestance runs.
+    --metadata-store=TYPE
+                        Storage for the metadata of a new pipestance.
+                        Valid options: files (default) or db, which keeps
+                        the metadata for finished jobs in a single file.
     --tags=TAGS         Tag pipestance with comma-separated key:value pairs.
 
     --profile=MODE      Enables stage performance profiling. Valid options:
@@ -529,12 +730,28 @@ Options:
     --stackvars         Print local variables in stage code stack trace.
     --monitor           Kill jobs that exceed requested memory resources.
     --inspect           Inspect pipestance without resetting failed stages.
+    --until=STAGES      Only run the given comma-separated stages or
+                        pipelines, and the stages they depend on, then
+                        exit with status 3.  A later run without --until
+                        continues the pipestance.
+    --rerun-from=STAGE  Reset STAGE and every stage downstream of it in an
+                        existing pipestance so that they run again, keeping
+                        the outputs of upstream stages.  STAGE may be a
+                        pipeline, and may omit the ID.<pipestance_name>.
+                        prefix.
     --debug             Enable debug logging for local job manager.
     --stest             Substitute real stages with stress-testing stage.
     --autoretry=NUM     Automatically retry failed runs up to NUM times.
     --retry-wait=SECS   Wait SECS seconds after a failure before attempting
                         automatic retry.  Defaults to 1 second.
     --overrides=JSON    JSON file supplying custom run conditions per stage.
+    --explain-overrides
+                        Print which override rule applies to each stage, and
+                        exit without running anything.
+    --dry-run           Print the stages which would run, with the resources
+                        they would request, and exit without creating the
+                        pipestance or running anything.
+    --json              Print the --dry-run plan as JSON.
     --psdir=PATH        The path to the pipestance directory.  The default is
                         to use <pipestance_name>.
     --never-local       Ignore 'local' modifiers on non-preflight stages.
@@ -672,12 +889,28 @@ Options:
 	util.LogInfo("options", "--vdrmode=%s", config.VdrMode)
 	core.VerifyVDRMode(config.VdrMode)
 
+	// Compute output checksum algorithm.
+	if value := opts["--checksum"]; value != nil {
+		config.ChecksumAlgorithm = value.(string)
+		core.VerifyChecksumAlgorithm(config.ChecksumAlgorithm)
+		util.LogInfo("options", "--checksum=%s", config.ChecksumAlgorithm)
+	}
+
 	// Compute onfinish
 	if value := opts["--onfinish"]; value != nil {
 		config.OnFinishHandler = value.(string)
 		core.VerifyOnFinish(config.OnFinishHandler)
 	}
 
+	// Read webhook configuration.
+	var webhooks []*api.WebhookConfig
+	if value := opts["--webhooks"]; value != nil {
+		var err error
+		webhooks, err = api.ReadWebhookConfig(value.(string))
+		util.DieIf(err)
+		util.LogInfo("options", "--webhooks=%s", value.(string))
+	}
+
 	// Compute profiling mode.
 	if value := opts["--profile"]; value != nil {
 		config.ProfileMode = core.ProfileMode(value.(string))
@@ -720,6 +953,37 @@ Options:
 		}
 		authKey = base64.RawURLEncoding.EncodeToString(key)
 	}
+	var controlKey string
+	if value := opts["--control-key"]; value != nil {
+		controlKey = value.(string)
+		util.LogInfo("options", "--control-key=<redacted>")
+	} else if enableUI {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			util.PrintError(err, "webserv", "Failed to generate a control key.")
+			os.Exit(1)
+		}
+		controlKey = base64.RawURLEncoding.EncodeToString(key)
+	}
+	useTls := false
+	var tlsCert, tlsKey string
+	if value := opts["--tls"]; value != nil && value.(bool) {
+		useTls = true
+		util.LogInfo("options", "--tls")
+	}
+	if value := opts["--tls-cert"]; value != nil {
+		tlsCert = value.(string)
+		useTls = true
+		util.LogInfo("options", "--tls-cert=%s", tlsCert)
+	}
+	if value := opts["--tls-key"]; value != nil {
+		tlsKey = value.(string)
+		util.LogInfo("options", "--tls-key=%s", tlsKey)
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		util.PrintInfo("options", "--tls-cert and --tls-key must be used together.")
+		os.Exit(1)
+	}
 
 	// Parse tags.
 	tags := []string{}
@@ -748,6 +1012,16 @@ Options:
 	config.Zip = opts["--zip"].(bool)
 	util.LogInfo("options", "--zip=%v", config.Zip)
 
+	config.CompactMetadata = opts["--compact-metadata"].(bool)
+	util.LogInfo("options", "--compact-metadata=%v", config.CompactMetadata)
+
+	config.MetadataStore = core.FilesMetadataStore
+	if value := opts["--metadata-store"]; value != nil {
+		config.MetadataStore = value.(string)
+	}
+	util.LogInfo("options", "--metadata-store=%s", config.MetadataStore)
+	core.VerifyMetadataStore(config.MetadataStore)
+
 	config.LimitLoadavg = opts["--limit-loadavg"].(bool)
 	util.LogInfo("options", "--limit-loadavg=%v", config.LimitLoadavg)
 
@@ -757,6 +1031,9 @@ Options:
 	config.SkipPreflight = opts["--nopreflight"].(bool)
 	util.LogInfo("options", "--nopreflight=%v", config.SkipPreflight)
 
+	watch := !opts["--nowatch"].(bool)
+	util.LogInfo("options", "--nowatch=%v", !watch)
+
 	psid := opts["<pipestance_name>"].(string)
 	invocationPath := opts["<call.mro>"].(string)
 	pipestancePath := path.Join(cwd, psid)
@@ -773,6 +1050,20 @@ Options:
 	checkSrc := true
 	config.Monitor = opts["--monitor"].(bool)
 	readOnly := opts["--inspect"].(bool)
+	var until []string
+	if value := opts["--until"]; value != nil {
+		until = strings.Split(value.(string), ",")
+		util.LogInfo("options", "--until=%s", value.(string))
+	}
+	rerunStage := ""
+	if value := opts["--rerun-from"]; value != nil {
+		rerunStage = value.(string)
+		util.LogInfo("options", "--rerun-from=%s", rerunStage)
+		if readOnly {
+			util.PrintInfo("options", "--rerun-from cannot be used with --inspect.")
+			os.Exit(1)
+		}
+	}
 	config.Debug = opts["--debug"].(bool)
 	config.StressTest = opts["--stest"].(bool)
 	envs := map[string]string{}
@@ -833,6 +1124,21 @@ Options:
 	invocationSrc := string(data)
 	executingPreflight := !config.SkipPreflight
 
+	if opts["--explain-overrides"].(bool) {
+		pipestance, err := rt.PlanPipeline(invocationSrc, invocationPath,
+			psid, pipestancePath, mroPaths, mroVersion, envs)
+		util.DieIf(err)
+		explainOverrides(os.Stdout, pipestance)
+		os.Exit(0)
+	}
+	if opts["--dry-run"].(bool) {
+		pipestance, err := rt.PlanPipeline(invocationSrc, invocationPath,
+			psid, pipestancePath, mroPaths, mroVersion, envs)
+		util.DieIf(err)
+		util.DieIf(printPlan(os.Stdout, pipestance, opts["--json"].(bool)))
+		os.Exit(0)
+	}
+
 	factory := core.NewRuntimePipestanceFactory(rt,
 		invocationSrc, invocationPath, psid, mroPaths, pipestancePath, mroVersion,
 		envs, checkSrc, readOnly, tags)
@@ -859,6 +1165,14 @@ Options:
 		remainingRetries: retries,
 		readOnly:         readOnly,
 		retryWait:        retryWait,
+		until:            until,
+	}
+	// When inspecting, keep the targets recorded by the run being inspected.
+	if !readOnly || len(until) > 0 {
+		util.DieIf(pipestance.SetTargets(until))
+	}
+	if !readOnly {
+		pipestanceBox.webhooks = newWebhookNotifier(webhooks)
 	}
 
 	if !readOnly {
@@ -904,20 +1218,44 @@ Options:
 				Scheme: "http",
 				Host:   listener.Addr().String(),
 			}
+			var certPem []byte
+			if useTls {
+				var tlsConfig *tls.Config
+				tlsConfig, certPem, err = makeTlsConfig(tlsCert, tlsKey, hostname)
+				if err != nil {
+					util.PrintError(err, "webserv", "Could not configure TLS.")
+					os.Exit(1)
+				}
+				listener = tls.NewListener(listener, tlsConfig)
+				u.Scheme = "https"
+			}
 			uiport = u.Port()
 			u.Host = net.JoinHostPort(hostname, uiport)
+			controlUrl := u
 			if authKey != "" {
 				q := u.Query()
 				q.Set("auth", authKey)
 				u.RawQuery = q.Encode()
 			}
+			if controlKey != "" {
+				q := controlUrl.Query()
+				q.Set("auth", controlKey)
+				controlUrl.RawQuery = q.Encode()
+			}
 			// Print this here because the log makes more sense when this appears before
 			// the runloop messages start to appear.
 			util.Println("Serving UI at %s\n", u.String())
 			pipestanceBox.enableUI = true
 			pipestanceBox.authKey = authKey
+			pipestanceBox.controlKey = controlKey
 			util.RegisterSignalHandler(&pipestanceBox)
 			if !readOnly {
+				if certPem != nil {
+					pipestance.RecordUiCert(certPem)
+				}
+				if controlKey != "" {
+					pipestance.RecordUiControl(controlUrl.String())
+				}
 				pipestance.RecordUiPort(u.String())
 			}
 		}
@@ -944,7 +1282,7 @@ Options:
 		MaxCores:     rt.JobManager.GetMaxCores(),
 		MaxMemGB:     rt.JobManager.GetMaxMemGB(),
 		InvokePath:   invocationPath,
-		InvokeSource: invocationSrc,
+		InvokeSource: pipestance.GetInvocationSource(),
 		MroPath:      util.FormatMroPath(mroPaths),
 		ProfileMode:  config.ProfileMode,
 		Port:         uiport,
@@ -953,9 +1291,16 @@ Options:
 		PsPath:       pipestancePath,
 	}
 
+	if !reattaching && rerunStage != "" {
+		util.PrintInfo("options",
+			"Ignoring --rerun-from for the new pipestance %s.", psid)
+	}
 	if reattaching {
 		// If it already exists, try to reattach to it.
 		if !readOnly {
+			if rerunStage != "" {
+				util.DieIf(rerunFrom(pipestance, rerunStage))
+			}
 			if err = pipestance.Reset(); err == nil {
 				err = pipestance.RestartLocalJobs(config.JobMode)
 			}
@@ -965,6 +1310,11 @@ Options:
 		util.Println("Running preflight checks (please wait)...")
 	}
 
+	// Reload overrides and job manager configuration on SIGHUP.
+	if !readOnly {
+		util.RegisterSignalHandler(&configReloader{rt: rt})
+	}
+
 	//=========================================================================
 	// Start web server.
 	//=========================================================================
@@ -975,7 +1325,7 @@ Options:
 	//=========================================================================
 	// Start run loop.
 	//=========================================================================
-	go runLoop(&pipestanceBox, stepSecs, config.VdrMode, noExit)
+	go runLoop(&pipestanceBox, stepSecs, config.VdrMode, noExit, watch)
 
 	// Let daemons take over.
 	runtime.Goexit()
@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Reporting of the execution plan for --dry-run.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+func printPlan(w io.Writer, pipestance *core.Pipestance, asJson bool) error {
+	plan := pipestance.Plan()
+	if asJson {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tPHASE\tTHREADS\tMEM_GB\tSPECIAL\tMODE\tNOTE")
+	forks, disabled := 0, 0
+	for _, stage := range plan {
+		note := stageNote(stage)
+		for _, fork := range stage.Forks {
+			forks++
+			if fork.Disabled || stage.Skipped {
+				disabled++
+			}
+		}
+		if stage.Split != nil {
+			printPlannedJob(tw, stage.Fqname, "split", stage.Split, note)
+			printPlannedJob(tw, "", "chunk", stage.Chunk, "")
+			printPlannedJob(tw, "", "join", stage.Join, "")
+		} else {
+			printPlannedJob(tw, stage.Fqname, "main", stage.Chunk, note)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d stages, %d forks, %d disabled or skipped.\n",
+		len(plan), forks, disabled)
+	return err
+}
+
+func printPlannedJob(w io.Writer, stage, phase string, job *core.PlannedJob, note string) {
+	mode := "cluster"
+	if job.Local {
+		mode = "local"
+	}
+	special := job.Special
+	if job.Resources != "" {
+		special += " (" + job.Resources + ")"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+		stage, phase, job.Threads, job.MemGB, special, mode, note)
+}
+
+// Summarize the forks of a stage, and whether they are disabled.
+func stageNote(stage *core.PlannedStage) string {
+	if stage.Skipped {
+		return "skipped (--nopreflight)"
+	}
+	var notes []string
+	if len(stage.Forks) > 1 {
+		notes = append(notes, fmt.Sprintf("%d forks", len(stage.Forks)))
+	}
+	disabled := 0
+	maybe := make(map[string]struct{})
+	for _, fork := range stage.Forks {
+		if fork.Disabled {
+			disabled++
+		} else {
+			for _, ref := range fork.DisabledBy {
+				maybe[ref] = struct{}{}
+			}
+		}
+	}
+	if disabled == len(stage.Forks) {
+		notes = append(notes, "disabled")
+	} else if disabled > 0 {
+		notes = append(notes, fmt.Sprintf("%d disabled", disabled))
+	}
+	if len(maybe) > 0 {
+		refs := make([]string, 0, len(maybe))
+		for ref := range maybe {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		notes = append(notes, "disabled if "+strings.Join(refs, " or "))
+	}
+	return strings.Join(notes, ", ")
+}
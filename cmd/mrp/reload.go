@@ -0,0 +1,27 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Configuration reloading on SIGHUP.
+//
+
+package main
+
+import (
+	"os"
+
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+type configReloader struct {
+	rt *core.Runtime
+}
+
+// Nothing to clean up on shutdown.
+func (self *configReloader) HandleSignal(os.Signal) {}
+
+func (self *configReloader) HandleReload() {
+	if _, err := self.rt.ReloadConfig(core.ResourceLimits{}); err != nil {
+		util.PrintError(err, "reload", "Failed to reload configuration.")
+	}
+}
@@ -0,0 +1,210 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Webhook notifications for pipestance events.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const (
+	// The longest to wait between delivery attempts.
+	maxWebhookBackoff = time.Minute
+
+	// The longest to wait for pending deliveries before exiting.
+	webhookExitWait = 5 * time.Minute
+)
+
+// Sends webhook notifications.  All methods are safe to call on a nil
+// notifier, which does nothing.
+type webhookNotifier struct {
+	hooks []*api.WebhookConfig
+
+	// The delay before the first retry of a failed delivery.  This doubles
+	// after each attempt.
+	initialBackoff time.Duration
+
+	pending sync.WaitGroup
+}
+
+func newWebhookNotifier(hooks []*api.WebhookConfig) *webhookNotifier {
+	if len(hooks) == 0 {
+		return nil
+	}
+	for _, hook := range hooks {
+		util.LogInfo("webhook", "Sending notifications to %s", hook.Url)
+	}
+	return &webhookNotifier{
+		hooks:          hooks,
+		initialBackoff: time.Second,
+	}
+}
+
+func (self *webhookNotifier) wants(event string) bool {
+	if self == nil {
+		return false
+	}
+	for _, hook := range self.hooks {
+		if hook.Wants(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send an event to every webhook which wants it.  Delivery happens in the
+// background.
+func (self *webhookNotifier) send(payload *api.WebhookPayload) {
+	if !self.wants(payload.Event) {
+		return
+	}
+	payload.Timestamp = util.Timestamp()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		util.LogError(err, "webhook", "Could not serialize %s event.",
+			payload.Event)
+		return
+	}
+	for _, hook := range self.hooks {
+		if hook.Wants(payload.Event) {
+			self.pending.Add(1)
+			go self.deliver(hook, payload.Event, body)
+		}
+	}
+}
+
+func (self *webhookNotifier) deliver(hook *api.WebhookConfig, event string, body []byte) {
+	defer self.pending.Done()
+	backoff := self.initialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := self.post(hook, event, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= hook.MaxAttempts {
+			util.LogError(err, "webhook",
+				"Failed to send %s event to %s after %d attempt%s.",
+				event, hook.Url, attempt, util.Pluralize(attempt))
+			return
+		}
+		util.LogInfo("webhook",
+			"Failed to send %s event to %s: %v.  Retrying in %v.",
+			event, hook.Url, err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxWebhookBackoff {
+			backoff = maxWebhookBackoff
+		}
+	}
+}
+
+// Make one delivery attempt.  Returns an error if it failed, and whether the
+// failure is worth retrying.
+func (self *webhookNotifier) post(hook *api.WebhookConfig,
+	event string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(hook.TimeoutSecs)*time.Second)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(api.WebhookEventHeader, event)
+	if secret := hook.Secret(); secret != nil {
+		req.Header.Set(api.WebhookSignatureHeader, api.SignWebhook(secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= http.StatusInternalServerError ||
+			resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusRequestTimeout,
+		fmt.Errorf("server returned %s", resp.Status)
+}
+
+// Wait for pending deliveries to finish, for at most the given time.
+func (self *webhookNotifier) wait(timeout time.Duration) {
+	if self == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		self.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		util.LogInfo("webhook", "Timed out waiting for notifications to be sent.")
+	}
+}
+
+func payloadInfo(info *api.PipestanceInfo, state core.MetadataState) *api.PipestanceInfo {
+	if info == nil {
+		return nil
+	}
+	info = info.StripMro()
+	info.State = state
+	return info
+}
+
+// Send a pipestance-level event.
+func (self *webhookNotifier) notifyPipestance(event string,
+	info *api.PipestanceInfo, state core.MetadataState,
+	errors []*core.NodeErrorInfo, message string) {
+	self.send(&api.WebhookPayload{
+		Event:      event,
+		Pipestance: payloadInfo(info, state),
+		Errors:     errors,
+		Message:    message,
+	})
+}
+
+// Send events for a stage which completed or failed.  Returns nil if no
+// webhook wants stage events, so that the pipestance need not collect them.
+func (self *webhookNotifier) stageNotifier(info *api.PipestanceInfo,
+	state core.MetadataState) func(*core.StageTransition) {
+	if !self.wants(api.EventStageFailed) && !self.wants(api.EventAlarm) {
+		return nil
+	}
+	return func(t *core.StageTransition) {
+		if t.Alarms != "" {
+			self.send(&api.WebhookPayload{
+				Event:      api.EventAlarm,
+				Pipestance: payloadInfo(info, state),
+				Stage:      t.FQname,
+				Message:    t.Alarms,
+			})
+		}
+		if t.State == core.Failed && t.Error != nil {
+			self.send(&api.WebhookPayload{
+				Event:      api.EventStageFailed,
+				Pipestance: payloadInfo(info, state),
+				Stage:      t.FQname,
+				Errors:     []*core.NodeErrorInfo{t.Error},
+			})
+		}
+	}
+}
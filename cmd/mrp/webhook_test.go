@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	secret := []byte("s3cret")
+	var lock sync.Mutex
+	attempts := make(map[string]int)
+	var received []*api.WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if req.URL.Path == "/bad" {
+			attempts["bad"]++
+			http.Error(w, "no", http.StatusBadRequest)
+			return
+		}
+		if req.URL.Path == "/signed" &&
+			!api.VerifyWebhook(secret, body, req.Header.Get(api.WebhookSignatureHeader)) {
+			t.Errorf("Invalid signature %q",
+				req.Header.Get(api.WebhookSignatureHeader))
+		}
+		event := req.Header.Get(api.WebhookEventHeader)
+		// Fail the first attempt for each event.
+		if attempts[req.URL.Path+event]++; attempts[req.URL.Path+event] == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		var payload api.WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		} else if payload.Event != event {
+			t.Errorf("Event header %s does not match payload %s",
+				event, payload.Event)
+		}
+		received = append(received, &payload)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "testWebhookDelivery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "webhooks.json")
+	if err := ioutil.WriteFile(fn, []byte(`[
+		{"url": "`+server.URL+`/signed", "secret_env": "TEST_WEBHOOK_SECRET"},
+		{"url": "`+server.URL+`/failures", "events": ["failed"]},
+		{"url": "`+server.URL+`/bad", "events": ["failed"]}
+	]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.ReadWebhookConfig(fn); err == nil {
+		t.Error("Expected an error for a missing secret.")
+	}
+	os.Setenv("TEST_WEBHOOK_SECRET", string(secret))
+	defer os.Unsetenv("TEST_WEBHOOK_SECRET")
+	hooks, err := api.ReadWebhookConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := newWebhookNotifier(hooks)
+	notifier.initialBackoff = time.Millisecond
+
+	info := &api.PipestanceInfo{PsId: "test", InvokeSource: "call X()"}
+	notifier.notifyPipestance(api.EventComplete, info, core.Complete, nil, "")
+	notifier.notifyPipestance(api.EventFailed, info, core.Failed,
+		[]*core.NodeErrorInfo{{FQname: "ID.test.STAGE", Log: "oops"}}, "")
+	notifier.wait(10 * time.Second)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 deliveries, got %d", len(received))
+	}
+	var failures int
+	for _, p := range received {
+		if p.Pipestance == nil || p.Pipestance.PsId != "test" {
+			t.Errorf("Missing pipestance info in %s event", p.Event)
+		} else if p.Pipestance.InvokeSource != "" {
+			t.Error("Invocation source should not be sent.")
+		}
+		if p.Event == api.EventFailed {
+			failures++
+			if p.Pipestance.State != core.Failed ||
+				len(p.Errors) != 1 || p.Errors[0].Log != "oops" {
+				t.Errorf("Incorrect failure payload %v", p)
+			}
+		}
+	}
+	if failures != 2 {
+		t.Errorf("Expected 2 failure events, got %d", failures)
+	}
+	if attempts["bad"] != 1 {
+		t.Errorf("Expected client errors not to be retried, got %d attempts",
+			attempts["bad"])
+	}
+}
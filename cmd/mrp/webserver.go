@@ -9,6 +9,7 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -19,6 +20,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -67,7 +69,8 @@ type mrpWebServer struct {
 	listener net.Listener
 
 	// True if authentication is required for read-only commands.
-	// Authentication is always required for write commands.
+	// Control commands such as restart and kill always require the control
+	// key, if one is set.
 	readAuth bool
 
 	rt            *core.Runtime
@@ -76,6 +79,10 @@ type mrpWebServer struct {
 	graphPage     []byte
 	startTime     time.Time
 	mutex         sync.Mutex
+
+	// The graph page served to requests authenticated with the control key,
+	// which enables the restart button.
+	adminGraphPage []byte
 }
 
 func (self *mrpWebServer) Start() {
@@ -112,7 +119,15 @@ func (self *mrpWebServer) Start() {
 	}
 }
 
+// Returns true if key matches the expected key.  Empty expected keys never
+// match.
+func keyMatches(key, expect string) bool {
+	return expect != "" &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(expect)) == 1
+}
+
 // Checks that the request includes a valid authentication token, if required.
+// Either the read-only key or the control key is accepted.
 // If it does not, it writes an error to the response and returns false.
 func (self *mrpWebServer) verifyAuth(w http.ResponseWriter, req *http.Request) bool {
 	if err := req.ParseForm(); err != nil {
@@ -123,14 +138,10 @@ func (self *mrpWebServer) verifyAuth(w http.ResponseWriter, req *http.Request) b
 		return true
 	}
 	key := req.FormValue("auth")
-	// No early abort on the check here, to prevent timing attacks.
-	// (not that this is serious security anyway...)
-	authKey := []byte(self.pipestanceBox.authKey)
-	pass := len(self.pipestanceBox.authKey) == len(key)
-	for i, c := range []byte(key) {
-		if i >= len(authKey) || authKey[i] != c {
-			pass = false
-		}
+	// Evaluate both, to avoid leaking which key was used through timing.
+	pass := keyMatches(key, self.pipestanceBox.authKey)
+	if keyMatches(key, self.pipestanceBox.controlKey) {
+		pass = true
 	}
 	if !pass {
 		http.Error(w, "This API requires authentication.", http.StatusUnauthorized)
@@ -138,6 +149,70 @@ func (self *mrpWebServer) verifyAuth(w http.ResponseWriter, req *http.Request) b
 	return pass
 }
 
+// Returns the key required for control actions.  If no separate control key
+// was configured, the read-only key is used.
+func (self *mrpWebServer) requiredControlKey() string {
+	if self.pipestanceBox.controlKey != "" {
+		return self.pipestanceBox.controlKey
+	}
+	return self.pipestanceBox.authKey
+}
+
+// Checks that the request includes the key required for control actions, and
+// records the attempt in the audit log.  If it does not, it writes an error to
+// the response and returns false.
+func (self *mrpWebServer) verifyControl(w http.ResponseWriter,
+	req *http.Request, action string) bool {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		self.audit(req, action, false)
+		return false
+	}
+	expect := self.requiredControlKey()
+	pass := expect == "" || keyMatches(req.FormValue("auth"), expect)
+	self.audit(req, action, pass)
+	if !pass {
+		http.Error(w, "This API requires the control key.", http.StatusUnauthorized)
+	}
+	return pass
+}
+
+// An entry in the audit log of control actions.
+type auditEntry struct {
+	Time          string `json:"time"`
+	Action        string `json:"action"`
+	RemoteAddr    string `json:"remote_addr"`
+	ForwardedFor  string `json:"forwarded_for,omitempty"`
+	Authenticated bool   `json:"authenticated"`
+}
+
+// Record a control request in the log and in the pipestance audit log.
+func (self *mrpWebServer) audit(req *http.Request, action string, allowed bool) {
+	entry := auditEntry{
+		Time:          util.Timestamp(),
+		Action:        action,
+		RemoteAddr:    req.RemoteAddr,
+		ForwardedFor:  req.Header.Get("X-Forwarded-For"),
+		Authenticated: allowed,
+	}
+	if allowed {
+		util.LogInfo("webserv", "Got API %s request from %s.",
+			action, req.RemoteAddr)
+	} else {
+		util.LogInfo("webserv", "Rejected unauthenticated API %s request from %s.",
+			action, req.RemoteAddr)
+	}
+	if self.pipestanceBox.readOnly {
+		return
+	}
+	if b, err := json.Marshal(&entry); err != nil {
+		util.LogError(err, "webserv", "Could not serialize audit log entry.")
+	} else if err := self.pipestanceBox.getPipestance().AppendAuditLog(
+		string(b) + "\n"); err != nil {
+		util.LogError(err, "webserv", "Could not write audit log.")
+	}
+}
+
 //=========================================================================
 // Web endpoints.
 //=========================================================================
@@ -162,43 +237,65 @@ func (self *mrpWebServer) graphTemplate() (*template.Template, error) {
 }
 
 func (self *mrpWebServer) makeGraphPage() {
-	pipestance := self.pipestanceBox.getPipestance()
 	if tmpl, err := self.graphTemplate(); err != nil {
 		util.Println("Error starting web server: %v", err)
 	} else {
-		graphParams := api.GraphPage{
-			InstanceName: "Martian Pipeline Runner",
-			Container:    "runner",
-			Pname:        pipestance.GetPname(),
-			Psid:         pipestance.GetPsid(),
-			Admin:        true,
-			AdminStyle:   false,
-			Release:      util.IsRelease(),
-		}
+		var auth string
 		if self.pipestanceBox.authKey != "" && self.readAuth {
-			graphParams.Auth = "?auth=" + self.pipestanceBox.authKey
+			auth = "?auth=" + self.pipestanceBox.authKey
 		}
-		var buff bytes.Buffer
-		zipper, _ := gzip.NewWriterLevel(&buff, gzip.BestCompression)
-		if err := tmpl.Execute(zipper, &graphParams); err != nil {
+		controlKey := self.pipestanceBox.controlKey
+		if page, err := self.renderGraphPage(tmpl, controlKey == "", auth); err != nil {
+			util.PrintError(err, "webserv", "Error starting web server.")
+		} else if controlKey == "" {
+			self.startTime = time.Now()
+			self.graphPage = page
+		} else if admin, err := self.renderGraphPage(tmpl, true,
+			"?auth="+controlKey); err != nil {
 			util.PrintError(err, "webserv", "Error starting web server.")
 		} else {
-			if err := zipper.Close(); err != nil {
-				util.PrintError(err, "webserv", "Error starting web server.")
-			} else {
-				self.startTime = time.Now()
-				self.graphPage = buff.Bytes()
-			}
+			self.startTime = time.Now()
+			self.graphPage = page
+			self.adminGraphPage = admin
 		}
 	}
 }
 
+func (self *mrpWebServer) renderGraphPage(tmpl *template.Template,
+	admin bool, auth string) ([]byte, error) {
+	pipestance := self.pipestanceBox.getPipestance()
+	graphParams := api.GraphPage{
+		InstanceName: "Martian Pipeline Runner",
+		Container:    "runner",
+		Pname:        pipestance.GetPname(),
+		Psid:         pipestance.GetPsid(),
+		Admin:        admin,
+		AdminStyle:   false,
+		Release:      util.IsRelease(),
+		Auth:         auth,
+	}
+	var buff bytes.Buffer
+	zipper, _ := gzip.NewWriterLevel(&buff, gzip.BestCompression)
+	if err := tmpl.Execute(zipper, &graphParams); err != nil {
+		return nil, err
+	}
+	if err := zipper.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
 func (self *mrpWebServer) serveGraphPage(w http.ResponseWriter, req *http.Request) {
 	if !self.readAuth || self.verifyAuth(w, req) {
+		page := self.graphPage
+		if self.adminGraphPage != nil &&
+			keyMatches(req.FormValue("auth"), self.pipestanceBox.controlKey) {
+			page = self.adminGraphPage
+		}
 		w.Header().Set("Content-Encoding", "gzip")
 		w.Header().Set("Content-Type", "text/html")
 		http.ServeContent(w, req, "graph.html", self.startTime,
-			bytes.NewReader(self.graphPage))
+			bytes.NewReader(page))
 	}
 }
 
@@ -213,10 +310,16 @@ func (self *mrpWebServer) handleApi(sm *http.ServeMux) {
 	sm.HandleFunc(api.QueryGetState+"/", self.getState)
 	sm.HandleFunc(api.QueryGetPerf, self.getPerf)
 	sm.HandleFunc(api.QueryGetPerf+"/", self.getPerf)
+	sm.HandleFunc(api.QueryGetCriticalPath, self.getCriticalPath)
+	sm.HandleFunc(api.QueryGetCriticalPath+"/", self.getCriticalPath)
 	sm.HandleFunc(api.QueryGetMetadata, self.getMetadata)
 	sm.HandleFunc(api.QueryGetMetadata+"/", self.getMetadata)
 	sm.HandleFunc(api.QueryRestart, self.restart)
 	sm.HandleFunc(api.QueryRestart+"/", self.restart)
+	sm.HandleFunc(api.QueryRerun, self.rerun)
+	sm.HandleFunc(api.QueryRerun+"/", self.rerun)
+	sm.HandleFunc(api.QueryReload, self.reload)
+	sm.HandleFunc(api.QueryReload+"/", self.reload)
 	p := self.pipestanceBox.getPipestance().GetPath()
 	sm.Handle(api.QueryGetMetadataTop, self.authorize(pathToMetadata(
 		http.FileServer(http.Dir(p)))))
@@ -243,7 +346,8 @@ func (self *mrpWebServer) authorize(source http.Handler) http.Handler {
 // prefix.
 func pathToMetadata(source http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if p := path.Base(r.URL.Path); len(p) > 0 {
+		if p := path.Base(r.URL.Path); len(p) > 0 &&
+			!api.IsPrivateMetadata(core.MetadataFilePrefix+p) {
 			r2 := new(http.Request)
 			*r2 = *r
 			r2.URL = new(url.URL)
@@ -358,6 +462,45 @@ func (self *mrpWebServer) getPerf(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Get critical path analysis.  The optional "speedup" form value sets the
+// factor used to estimate savings from optimizing each stage, and "cores"
+// overrides the number of cores assumed to be available.
+func (self *mrpWebServer) getCriticalPath(w http.ResponseWriter, req *http.Request) {
+	if self.readAuth && !self.verifyAuth(w, req) {
+		return
+	}
+	var speedup float64
+	if s := req.FormValue("speedup"); s != "" {
+		var err error
+		if speedup, err = strconv.ParseFloat(s, 64); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	cores := 0
+	if s := req.FormValue("cores"); s != "" {
+		var err error
+		if cores, err = strconv.Atoi(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		self.pipestanceBox.lock.Lock()
+		if self.pipestanceBox.info.JobMode == "local" {
+			cores = self.pipestanceBox.info.MaxCores
+		}
+		self.pipestanceBox.lock.Unlock()
+	}
+	report := self.pipestanceBox.getPipestance().AnalyzeCriticalPath(cores, speedup)
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
 // Get metadata file contents.
 func (self *mrpWebServer) getMetadata(w http.ResponseWriter, req *http.Request) {
 	// Someone thought it was a good idea to put a JSON object in the body
@@ -383,8 +526,12 @@ func (self *mrpWebServer) getMetadata(w http.ResponseWriter, req *http.Request)
 		http.Error(w, "'..' not allowed in path.", http.StatusBadRequest)
 		return
 	}
-	data, err := self.rt.GetMetadata(pipestance.GetPath(),
-		path.Join(p, core.MetadataFilePrefix+name))
+	p = path.Join(p, core.MetadataFilePrefix+name)
+	if api.IsPrivateMetadata(p) {
+		http.Error(w, "Not found.", http.StatusNotFound)
+		return
+	}
+	data, err := self.rt.GetMetadata(pipestance.GetPath(), p)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -414,7 +561,7 @@ func (self *mrpWebServer) listMetadataTop(w http.ResponseWriter, req *http.Reque
 
 // Restart failed stage.
 func (self *mrpWebServer) restart(w http.ResponseWriter, req *http.Request) {
-	if !self.verifyAuth(w, req) {
+	if !self.verifyControl(w, req, "restart") {
 		return
 	}
 	if self.pipestanceBox.readOnly {
@@ -432,12 +579,103 @@ func (self *mrpWebServer) restart(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Reset the stage given by the form value stage, and everything downstream
+// of it, and restart the pipestance.  Unless the form value confirm is true,
+// just list the stages which would be reset.
+func (self *mrpWebServer) rerun(w http.ResponseWriter, req *http.Request) {
+	if !self.verifyControl(w, req, "rerun") {
+		return
+	}
+	if self.pipestanceBox.readOnly {
+		http.Error(w, "mrp is in read-only mode.", http.StatusBadRequest)
+		return
+	}
+	stage := req.FormValue("stage")
+	if stage == "" {
+		http.Error(w, "No stage given.", http.StatusBadRequest)
+		return
+	}
+	var stages []string
+	if req.FormValue("confirm") != "true" {
+		var err error
+		stages, err = self.pipestanceBox.getPipestance().RerunStages(stage)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		self.pipestanceBox.cleanupLock.Lock()
+		defer self.pipestanceBox.cleanupLock.Unlock()
+		// Completed and paused pipestances can only be rerun if mrp was
+		// kept alive with --noexit.
+		if st := self.pipestanceBox.getPipestance().GetState(
+			req.Context()); st != core.Failed && st != core.Complete &&
+			st != core.Paused {
+			http.Error(w,
+				"Only failed, paused or completed pipestances can be rerun.",
+				http.StatusBadRequest)
+			return
+		}
+		var err error
+		stages, err = self.pipestanceBox.rerunFrom(req.Context(), stage)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if b, err := json.Marshal(stages); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.Write(b)
+	}
+}
+
+// Reload overrides and job manager configuration.  The form values
+// maxjobs, localcores, and localmem optionally change resource limits.
+func (self *mrpWebServer) reload(w http.ResponseWriter, req *http.Request) {
+	if !self.verifyControl(w, req, "reload") {
+		return
+	}
+	if self.pipestanceBox.readOnly {
+		http.Error(w, "mrp is in read-only mode.", http.StatusBadRequest)
+		return
+	}
+	var limits core.ResourceLimits
+	for key, target := range map[string]*int{
+		"maxjobs":    &limits.MaxJobs,
+		"localcores": &limits.LocalCores,
+		"localmem":   &limits.LocalMemGB,
+	} {
+		if v := req.FormValue(key); v != "" {
+			if n, err := strconv.Atoi(v); err != nil {
+				http.Error(w, "Invalid "+key+": "+err.Error(), http.StatusBadRequest)
+				return
+			} else {
+				*target = n
+			}
+		}
+	}
+	changes, err := self.rt.ReloadConfig(limits)
+	if err != nil {
+		util.LogError(err, "reload", "Failed to reload configuration.")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if changes == nil {
+		changes = []string{}
+	}
+	if b, err := json.Marshal(changes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.Write(b)
+	}
+}
+
 // Kill the pipestance.
 func (self *mrpWebServer) kill(w http.ResponseWriter, req *http.Request) {
-	if !self.verifyAuth(w, req) {
+	if !self.verifyControl(w, req, "kill") {
 		return
 	}
-	util.LogInfo("webserv", "Got API shutdown request.")
 	go func() {
 		self.pipestanceBox.cleanupLock.Lock()
 		defer self.pipestanceBox.cleanupLock.Unlock()
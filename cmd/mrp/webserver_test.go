@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+)
+
+func TestControlAuth(t *testing.T) {
+	server := &mrpWebServer{
+		readAuth: true,
+		pipestanceBox: &pipestanceHolder{
+			authKey:    "readkey",
+			controlKey: "controlkey",
+			readOnly:   true,
+		},
+	}
+	check := func(key string, expectRead, expectControl bool) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/kill?auth="+key, nil)
+		if ok := server.verifyAuth(httptest.NewRecorder(), req); ok != expectRead {
+			t.Errorf("Expected read access with %q to be %v", key, expectRead)
+		}
+		w := httptest.NewRecorder()
+		if ok := server.verifyControl(w, req, "kill"); ok != expectControl {
+			t.Errorf("Expected control access with %q to be %v", key, expectControl)
+		} else if !ok && w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+	check("readkey", true, false)
+	check("controlkey", true, true)
+	check("", false, false)
+	check("readkeyx", false, false)
+
+	// Without a separate control key, the read key is required.
+	server.pipestanceBox.controlKey = ""
+	check("readkey", true, true)
+	check("controlkey", false, false)
+
+	if !api.IsPrivateMetadata(core.UiControl.FileName()) {
+		t.Error("The control url should not be served.")
+	}
+	if api.IsPrivateMetadata(core.UiPort.FileName()) {
+		t.Error("The ui port should be served.")
+	}
+}
+
+func TestSelfSignedTls(t *testing.T) {
+	config, certPem, err := makeTlsConfig("", "", "testhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("ok"))
+		})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "testSelfSignedTls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	url := "https://" + listener.Addr().String()
+	if _, err := api.MrpClient(dir).Get(url); err == nil {
+		t.Error("Expected the self-signed certificate not to be trusted.")
+	}
+	if err := ioutil.WriteFile(path.Join(dir, core.UiCert.FileName()),
+		certPem, 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := api.MrpClient(dir).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, err := ioutil.ReadAll(resp.Body); err != nil {
+		t.Error(err)
+	} else if string(b) != "ok" {
+		t.Errorf("Expected ok, got %q", b)
+	}
+}
@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian provenance exporter.
+//
+// Writes a machine-readable provenance document for a completed pipestance,
+// linking each output file to the stage which produced it, the code and
+// Martian versions, the hosts it ran on, and the input files it used.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian provenance exporter.
+
+Usage:
+    mrprov <pipestance_path> [options]
+    mrprov -h | --help | --version
+
+Options:
+    --format=FORMAT     Output format.  Valid options:
+                            prov (W3C PROV-JSON, default) or
+                            rocrate (RO-Crate JSON-LD)
+    --output=FILE       Write the document to FILE instead of stdout.
+
+    -h --help           Show this message.
+    --version           Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	format := core.ProvenanceProv
+	if value := opts["--format"]; value != nil {
+		format = value.(string)
+	}
+
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	rt := config.NewRuntime()
+	pipestance, err := rt.InspectPipestance(opts["<pipestance_path>"].(string),
+		context.Background())
+	util.DieIf(err)
+
+	if state := pipestance.GetState(context.Background()); state != core.Complete {
+		util.PrintInfo("mrprov",
+			"Pipestance is %v.  Only completed stages will be included.", state)
+	}
+	prov, err := pipestance.ExportProvenance(format)
+	util.DieIf(err)
+
+	var out io.Writer = os.Stdout
+	if value := opts["--output"]; value != nil {
+		f, err := os.Create(value.(string))
+		util.DieIf(err)
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+	util.DieIf(enc.Encode(prov))
+}
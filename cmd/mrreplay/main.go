@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian job replayer.
+//
+// Reruns a single split, chunk, or join job from a pipestance, with the same
+// arguments and job info it originally ran with, in a scratch directory, for
+// reproducing failures interactively.  The environment is inherited from
+// mrreplay rather than from the mrp which originally ran the job.  The
+// stage's environment variables and PATH prefix, as recorded in the job
+// info, are expanded against it.  The values of secret arguments are not
+// kept once the job's fork finishes, so they must be given again.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/shlex"
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian job replayer.
+
+Reruns the job whose metadata directory is given, e.g.
+PIPESTANCE/PIPELINE/STAGE/fork0/chnk0, locally in a scratch directory,
+leaving the pipestance untouched.
+
+Usage:
+    mrreplay <metadata_path> [options]
+    mrreplay -h | --help | --version
+
+Options:
+    --scratch=PATH      Directory to run the job in.  Must not exist.
+                            Defaults to a new temporary directory.
+    --mropath=PATHS     Colon-separated directories to search for the stage
+                            code.  Defaults to MROPATH, or the current
+                            directory.
+    --debugger=CMD      Run the stage code under the given command,
+                            e.g. "gdb --args" or "python -m pdb".
+    --profile=MODE      Profile the job, overriding the mode it originally
+                            ran with.
+    --secrets=FILE      JSON file giving the values of the job's secret
+                            arguments, keyed by parameter name.  They
+                            are removed once the fork finishes, so must
+                            be given again to replay the job.
+    --json              Print the result as JSON.
+
+    -h --help           Show this message.
+    --version           Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	cwd, _ := os.Getwd()
+	mroPaths := util.ParseMroPath(cwd)
+	if value := os.Getenv("MROPATH"); len(value) > 0 {
+		mroPaths = util.ParseMroPath(value)
+	}
+	if value := opts["--mropath"]; value != nil {
+		mroPaths = util.ParseMroPath(value.(string))
+	}
+
+	var debugger []string
+	if value := opts["--debugger"]; value != nil {
+		var err error
+		debugger, err = shlex.Split(value.(string))
+		if err != nil || len(debugger) == 0 {
+			util.PrintInfo("mrreplay", "Invalid value for --debugger: %v", value)
+			os.Exit(1)
+		}
+	}
+	var profileMode core.ProfileMode
+	if value := opts["--profile"]; value != nil {
+		profileMode = core.ProfileMode(value.(string))
+	}
+	var secrets core.LazyArgumentMap
+	if value := opts["--secrets"]; value != nil {
+		b, err := ioutil.ReadFile(value.(string))
+		util.DieIf(err)
+		util.DieIf(json.Unmarshal(b, &secrets))
+	}
+	scratch := ""
+	if value := opts["--scratch"]; value != nil {
+		var err error
+		scratch, err = filepath.Abs(value.(string))
+		util.DieIf(err)
+	}
+
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	if profileMode != "" {
+		config.ProfileMode = profileMode
+	}
+	rt := config.NewRuntime()
+
+	replay, err := rt.NewJobReplay(opts["<metadata_path>"].(string),
+		mroPaths, scratch, secrets, context.Background())
+	util.DieIf(err)
+	util.PrintInfo("mrreplay", "Running in %s", replay.GetPath())
+	result, err := replay.Run(debugger, profileMode)
+	util.DieIf(err)
+
+	if opts["--json"].(bool) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		util.DieIf(enc.Encode(result))
+	} else if result.State != core.Complete {
+		fmt.Printf("Job failed:\n%s\n", result.Error)
+		fmt.Printf("Metadata at %s\n", result.Path)
+	} else {
+		if result.Alarms != "" {
+			fmt.Printf("Alerts:\n%s\n", result.Alarms)
+		}
+		if result.Outs != nil {
+			fmt.Println("Outputs:")
+			b, _ := json.MarshalIndent(result.Outs, "", "    ")
+			fmt.Println(string(b))
+		}
+		fmt.Printf("Metadata at %s\n", result.Path)
+	}
+	if result.State != core.Complete {
+		os.Exit(1)
+	}
+}
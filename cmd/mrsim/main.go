@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian scheduling simulator.
+//
+// Replays the jobs from a completed pipestance, with their observed run
+// times, under different core, memory, and job submission limits, and reports
+// the predicted wall time and utilization.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian scheduling simulator.
+
+Usage:
+    mrsim <pipestance_path> [options]
+    mrsim -h | --help | --version
+
+Options:
+    --localcores=NUM    Number of cores available to jobs.
+    --localmem=NUM      GB of memory available to jobs.
+    --maxjobs=NUM       Maximum number of jobs running at once.
+    --jobinterval=NUM   Minimum delay between submitting jobs, in ms.
+    --json              Print the report as JSON.
+
+    Limits which are not given are treated as unlimited.
+
+    -h --help           Show this message.
+    --version           Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	psPath := opts["<pipestance_path>"].(string)
+	intOpt := func(name string) int {
+		value := opts[name]
+		if value == nil {
+			return 0
+		}
+		n, err := strconv.Atoi(value.(string))
+		if err != nil || n < 0 {
+			util.PrintInfo("mrsim", "Invalid value for %s: %v", name, value)
+			os.Exit(1)
+		}
+		return n
+	}
+	simOpts := core.SimulationOptions{
+		Cores:         intOpt("--localcores"),
+		MemGB:         intOpt("--localmem"),
+		MaxJobs:       intOpt("--maxjobs"),
+		JobIntervalMs: intOpt("--jobinterval"),
+	}
+
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	rt := config.NewRuntime()
+	pipestance, err := rt.InspectPipestance(psPath, context.Background())
+	util.DieIf(err)
+	if state := pipestance.GetState(context.Background()); state != core.Complete {
+		util.PrintInfo("mrsim",
+			"%s is %v.  Only completed jobs will be simulated.", psPath, state)
+	}
+	report := pipestance.Simulate(simOpts)
+
+	if opts["--json"].(bool) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		util.DieIf(enc.Encode(report))
+		return
+	}
+	printReport(report)
+}
+
+func seconds(s float64) time.Duration {
+	return (time.Duration(s * float64(time.Second))).Round(time.Second)
+}
+
+func limit(n int, unit string) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d%s", n, unit)
+}
+
+func printReport(report *core.SimulationReport) {
+	if report.Jobs == 0 {
+		fmt.Println("No completed jobs found.")
+		return
+	}
+	opts := report.Options
+	fmt.Printf("Cores:               %s\n", limit(opts.Cores, ""))
+	fmt.Printf("Memory:              %s\n", limit(opts.MemGB, " GB"))
+	fmt.Printf("Max jobs:            %s\n", limit(opts.MaxJobs, ""))
+	if opts.JobIntervalMs > 0 {
+		fmt.Printf("Job interval:        %dms\n", opts.JobIntervalMs)
+	}
+	fmt.Println()
+	fmt.Printf("Jobs:                %d\n", report.Jobs)
+	fmt.Printf("Actual wall time:    %v\n", seconds(report.ActualWallTime))
+	fmt.Printf("Predicted wall time: %v\n", seconds(report.WallTime))
+	fmt.Printf("Queue wait:          %v\n", seconds(report.QueueWait))
+	fmt.Printf("Peak reserved:       %d threads, %d GB, %d jobs\n",
+		report.PeakThreads, report.PeakMemGB, report.PeakJobs)
+	if opts.Cores > 0 {
+		fmt.Printf("Core utilization:    %.1f%%\n", 100*report.CoreUtilization)
+	}
+	if opts.MemGB > 0 {
+		fmt.Printf("Memory utilization:  %.1f%%\n", 100*report.MemUtilization)
+	}
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tSTART\tEND\tWALL")
+	for _, st := range report.Stages {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\n",
+			st.Stage, seconds(st.Start), seconds(st.End), seconds(st.WallTime))
+	}
+	tw.Flush()
+}
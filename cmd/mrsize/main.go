@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian resource right-sizing tool.
+//
+// Compares the threads and memory requested by each stage's split, chunks,
+// and join with what mrjob observed them using, across one or more completed
+// pipestances, and suggests overrides to bring the reservations in line.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian resource right-sizing tool.
+
+Usage:
+    mrsize <pipestance_path>... [options]
+    mrsize -h | --help | --version
+
+Options:
+    --headroom=FRAC     Fraction to add to the highest observed usage when
+                        computing suggested reservations.  Default 0.2.
+    --output=FILE       Write the suggested overrides to FILE, and print the
+                        usage summary to standard output.  Otherwise the
+                        overrides are printed to standard output and the
+                        summary to standard error.
+    --json              Print the usage summary as JSON.
+
+    -h --help           Show this message.
+    --version           Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	headroom := 0.2
+	if value := opts["--headroom"]; value != nil {
+		if h, err := strconv.ParseFloat(value.(string), 64); err != nil || h < 0 {
+			util.PrintInfo("mrsize", "Invalid headroom %v.", value)
+			os.Exit(1)
+		} else {
+			headroom = h
+		}
+	}
+
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	rt := config.NewRuntime()
+	var usages [][]*core.ResourceUsage
+	for _, psPath := range opts["<pipestance_path>"].([]string) {
+		pipestance, err := rt.InspectPipestance(psPath, context.Background())
+		util.DieIf(err)
+		if state := pipestance.GetState(context.Background()); state != core.Complete {
+			util.PrintInfo("mrsize",
+				"%s is %v.  Only completed jobs will be included.", psPath, state)
+		}
+		usages = append(usages, pipestance.GetResourceUsage())
+	}
+	usage := core.MergeResourceUsage(usages...)
+	overrides := core.RecommendOverrides(usage, headroom)
+
+	var overrideOut io.Writer = os.Stdout
+	var summaryOut io.Writer = os.Stderr
+	if value := opts["--output"]; value != nil {
+		f, err := os.Create(value.(string))
+		util.DieIf(err)
+		defer f.Close()
+		overrideOut = f
+		summaryOut = os.Stdout
+	}
+	if opts["--json"].(bool) {
+		enc := json.NewEncoder(summaryOut)
+		enc.SetIndent("", "    ")
+		util.DieIf(enc.Encode(usage))
+	} else {
+		printSummary(summaryOut, usage)
+	}
+	enc := json.NewEncoder(overrideOut)
+	enc.SetIndent("", "    ")
+	util.DieIf(enc.Encode(overrides))
+}
+
+func printSummary(w io.Writer, usage []*core.ResourceUsage) {
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tPHASE\tJOBS\tTHREADS\tUSED\tMEM GB\tUSED\tCORE HOURS\tWASTED")
+	var coreHours, wasted, memHours, wastedMem float64
+	for _, u := range usage {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.1f\t%d\t%.1f\t%.2f\t%.2f\n",
+			u.Stage, u.Phase, u.Jobs,
+			u.ReqThreads, u.MaxThreads,
+			u.ReqMemGB, u.MaxMemGB,
+			u.CoreHours, u.WastedCoreHours)
+		coreHours += u.CoreHours
+		wasted += u.WastedCoreHours
+		memHours += u.MemGBHours
+		wastedMem += u.WastedMemGBHours
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	if coreHours > 0 {
+		fmt.Fprintf(w, "Wasted core hours:   %.2f of %.2f (%.0f%%)\n",
+			wasted, coreHours, 100*wasted/coreHours)
+	}
+	if memHours > 0 {
+		fmt.Fprintf(w, "Wasted mem GB hours: %.2f of %.2f (%.0f%%)\n",
+			wastedMem, memHours, 100*wastedMem/memHours)
+	}
+}
@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian single-stage runner.
+//
+// Runs the split, chunks, and join of one stage with arguments from a json
+// file, without needing a pipeline or invocation, and leaves the metadata
+// directory in place for inspection.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian single-stage runner.
+
+Runs a stage with the arguments in a json file, in a new directory.
+
+Usage:
+    mrstage <stage_name> <args_json> <output_path> [options]
+    mrstage -h | --help | --version
+
+Options:
+    --mropath=PATHS     Colon-separated directories to search for the stage.
+                            Defaults to MROPATH, or the current directory.
+    --localcores=NUM    Maximum cores to give each job.
+    --localmem=NUM      Maximum GB of memory to give each job.
+    --stackvars         Print local variables in stage code stack traces.
+    --monitor           Kill jobs which exceed their memory reservation.
+    --json              Print the result as JSON.
+
+    -h --help           Show this message.
+    --version           Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	cwd, _ := os.Getwd()
+	mroPaths := util.ParseMroPath(cwd)
+	if value := os.Getenv("MROPATH"); len(value) > 0 {
+		mroPaths = util.ParseMroPath(value)
+	}
+	if value := opts["--mropath"]; value != nil {
+		mroPaths = util.ParseMroPath(value.(string))
+	}
+
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	config.StackVars = opts["--stackvars"].(bool)
+	config.Monitor = opts["--monitor"].(bool)
+	intOpt := func(name string) int {
+		value := opts[name]
+		if value == nil {
+			return 0
+		}
+		n, err := strconv.Atoi(value.(string))
+		if err != nil || n < 1 {
+			util.PrintInfo("mrstage", "Invalid value for %s: %v", name, value)
+			os.Exit(1)
+		}
+		return n
+	}
+	config.LocalCores = intOpt("--localcores")
+	config.LocalMem = intOpt("--localmem")
+	rt := config.NewRuntime()
+
+	data, err := ioutil.ReadFile(opts["<args_json>"].(string))
+	util.DieIf(err)
+	args, err := core.ParseStageArgs(data)
+	util.DieIf(err)
+	outPath, err := filepath.Abs(opts["<output_path>"].(string))
+	util.DieIf(err)
+	harness, err := rt.NewStageHarness(opts["<stage_name>"].(string), mroPaths, outPath)
+	util.DieIf(err)
+	result, err := harness.Run(args)
+	util.DieIf(err)
+
+	if opts["--json"].(bool) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		util.DieIf(enc.Encode(result))
+	} else if result.FailedPhase != "" {
+		fmt.Printf("Stage failed in %s:\n%s\n", result.FailedPhase, result.Error)
+		fmt.Printf("Metadata at %s\n", result.FailedPath)
+	} else {
+		if result.Alarms != "" {
+			fmt.Printf("Alerts:\n%s\n", result.Alarms)
+		}
+		fmt.Println("Outputs:")
+		b, _ := json.MarshalIndent(result.Outs, "", "    ")
+		fmt.Println(string(b))
+		fmt.Printf("Metadata at %s\n", harness.GetPath())
+	}
+	if result.FailedPhase != "" {
+		os.Exit(1)
+	}
+}
@@ -9,13 +9,24 @@ path to a pipestance root directory, it attempts to discover the tcp endpoint
 exposed by the mrp instance running in that directory.
 
 The default action is to query the pipestance and return basic information
-about its state.
+about its state.  The --tree option shows the full node tree, including the
+state of each fork and job, the hosts running jobs and their durations, and
+any failure messages.  The --json option prints the same information as JSON,
+and --watch refreshes the display periodically.  If mrp is not running, the
+status is read directly from the pipestance metadata.
 
 The --stop option allows users to terminate the pipestance.  For running
 pipestances, this forces the pipestance into a failed state, and mrp to
 terminate.  For completed mrp instances launched with the --noexit option,
 it causes mrp to terminate.
 
+The --reload option causes mrp to re-read its overrides file and job manager
+configuration, and optionally change its job and local resource limits.  The
+new settings apply to jobs which have not started yet.
+
+The --stop, --restart, and --reload options use the control key recorded by
+mrp, which is only readable by the user running it.
+
 */
 package main
 
@@ -27,8 +38,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path"
 	"sort"
+	"strconv"
+	"time"
 
 	"github.com/martian-lang/martian/martian/api"
 	"github.com/martian-lang/martian/martian/core"
@@ -37,6 +49,10 @@ import (
 	"github.com/martian-lang/docopt.go"
 )
 
+// The client used to connect to mrp, which trusts its certificate if it is
+// serving over TLS.
+var mrpClient = http.DefaultClient
+
 func main() {
 	//=========================================================================
 	// Commandline argument and environment variables.
@@ -49,54 +65,142 @@ Usage:
     mrstat -h | --help | --version
 
 Options:
-    --stop      Cause the mrp process to shut down.
-                If the pipestance is running, this will cause it to fail.
-    --restart   If mrp was launched with --noexit, and the pipeline failed,
-                attempt to retry the run.
+    --tree          Show the status of every node, fork, and job.
+    --all           With --tree, include jobs which have completed.
+    --json          Print the node tree status as JSON.
+    --watch=SECS    Refresh the status every SECS seconds until the
+                    pipestance completes or fails.
+    --stop          Cause the mrp process to shut down.
+                    If the pipestance is running, this will cause it to fail.
+    --restart       If mrp was launched with --noexit, and the pipeline
+                    failed, attempt to retry the run.
+    --reload        Reload the overrides file and job manager configuration.
+    --maxjobs=NUM   With --reload, change the maximum number of concurrent
+                    cluster jobs.
+    --localcores=NUM
+                    With --reload, change the cores used for local jobs.
+    --localmem=NUM  With --reload, change the GB of memory used for local
+                    jobs.
 
-    -h --help   Show this message.
-    --version   Show version.`
+    -h --help       Show this message.
+    --version       Show version.`
 	martianVersion := util.GetVersion()
 	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
 
 	stop := (opts["--stop"] != nil && opts["--stop"].(bool))
 	restart := (opts["--restart"] != nil && opts["--restart"].(bool))
+	reload := (opts["--reload"] != nil && opts["--reload"].(bool))
+
+	tree := (opts["--tree"] != nil && opts["--tree"].(bool))
+	all := (opts["--all"] != nil && opts["--all"].(bool))
+	asJson := (opts["--json"] != nil && opts["--json"].(bool))
+	var watch time.Duration
+	if value := opts["--watch"]; value != nil {
+		if secs, err := strconv.ParseFloat(value.(string), 64); err != nil || secs <= 0 {
+			fmt.Fprintln(os.Stderr, "Invalid --watch interval", value)
+			os.Exit(1)
+		} else {
+			watch = time.Duration(secs * float64(time.Second))
+		}
+	}
 
 	psid := opts["<pipestance_name>"].(string)
 
-	var mrpUrl *url.URL
-	if urlBytes, err := ioutil.ReadFile(path.Join(psid, core.UiPort.FileName())); err != nil {
+	mrpClient = api.MrpClient(psid)
+	mrpUrl, err := api.ReadMrpUrl(psid, stop || restart || reload)
+	if err != nil {
+		mrpUrl = nil
 		if os.IsNotExist(err) {
 			if info, err := os.Stat(psid); err != nil || !info.IsDir() {
 				fmt.Fprintln(os.Stderr, psid,
 					"is not a pipestance directory.")
-			} else {
+				os.Exit(3)
+			} else if stop || restart || reload {
 				fmt.Fprintln(os.Stderr, "Either", psid,
 					"is not currently running,")
 				fmt.Fprintln(os.Stderr, "or its monitoring UI port is disabled.")
+				os.Exit(3)
 			}
+		} else if _, ok := err.(*url.Error); ok {
+			fmt.Fprintln(os.Stderr, "Cannot parse url for", psid)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(4)
 		} else {
 			fmt.Fprintln(os.Stderr, "Cannot read", psid, ":", err)
+			os.Exit(3)
 		}
-		os.Exit(3)
-	} else if mrpUrl, err = url.Parse(string(urlBytes)); err != nil {
-		fmt.Fprintln(os.Stderr, "Cannot parse url", string(urlBytes))
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(4)
 	}
 	if stop {
 		sendStop(psid, mrpUrl)
 	} else if restart {
 		sendRestart(psid, mrpUrl)
-	} else {
+	} else if reload {
+		sendReload(psid, mrpUrl, opts)
+	} else if mrpUrl != nil && !tree && !asJson && watch == 0 {
 		status(psid, mrpUrl)
+	} else {
+		util.SetupSignalHandlers()
+		treeStatus(psid, mrpUrl, all, asJson, watch)
 	}
 }
 
+// Chooses the api if mrp is reachable, otherwise falls back to reading
+// metadata.
+func getSource(psid string, mrpUrl *url.URL) stateSource {
+	if mrpUrl != nil {
+		u := *mrpUrl
+		u.Path = api.QueryGetInfo
+		if resp, err := mrpClient.Get(u.String()); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return &apiSource{mrpUrl: mrpUrl}
+			}
+		}
+	}
+	return &metadataSource{psPath: psid}
+}
+
+func treeStatus(psid string, mrpUrl *url.URL, all, asJson bool, watch time.Duration) {
+	source := getSource(psid, mrpUrl)
+	for {
+		st, err := getStatus(source)
+		if err != nil {
+			if _, ok := source.(*apiSource); ok {
+				// mrp may have exited since the last refresh.
+				source = &metadataSource{psPath: psid}
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "Cannot read pipestance status:", err)
+			os.Exit(5)
+		}
+		if watch > 0 && !asJson {
+			// Clear the screen.
+			fmt.Print("\033[H\033[2J")
+		}
+		if asJson {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			if err := enc.Encode(st); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(7)
+			}
+		} else {
+			st.print(os.Stdout, all)
+		}
+		if watch == 0 || st.Info == nil ||
+			st.Info.State == core.Complete || st.Info.State == core.Failed ||
+			st.Info.State == core.Paused {
+			break
+		}
+		time.Sleep(watch)
+	}
+	os.Exit(0)
+}
+
 func sendStop(psid string, mrpUrl *url.URL) {
 	mrpUrl.Path = api.QueryKill
 	fmt.Println("Sending stop command to", psid)
-	if resp, err := http.PostForm(mrpUrl.String(), mrpUrl.Query()); err != nil {
+	if resp, err := mrpClient.PostForm(mrpUrl.String(), mrpUrl.Query()); err != nil {
 		fmt.Fprintln(os.Stderr, "Cannot connect to", mrpUrl)
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(5)
@@ -117,7 +221,7 @@ func sendStop(psid string, mrpUrl *url.URL) {
 func sendRestart(psid string, mrpUrl *url.URL) {
 	mrpUrl.Path = api.QueryRestart
 	fmt.Println("Sending restart command to", psid)
-	if resp, err := http.PostForm(mrpUrl.String(), mrpUrl.Query()); err != nil {
+	if resp, err := mrpClient.PostForm(mrpUrl.String(), mrpUrl.Query()); err != nil {
 		fmt.Fprintln(os.Stderr, "Cannot connect to", mrpUrl)
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(5)
@@ -135,9 +239,43 @@ func sendRestart(psid string, mrpUrl *url.URL) {
 	os.Exit(0)
 }
 
+func sendReload(psid string, mrpUrl *url.URL, opts map[string]interface{}) {
+	mrpUrl.Path = api.QueryReload
+	form := mrpUrl.Query()
+	for _, key := range []string{"maxjobs", "localcores", "localmem"} {
+		if value := opts["--"+key]; value != nil {
+			form.Set(key, value.(string))
+		}
+	}
+	fmt.Println("Sending reload command to", psid)
+	if resp, err := mrpClient.PostForm(mrpUrl.String(), form); err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot connect to", mrpUrl)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(5)
+	} else {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintln(os.Stderr, "Response:", resp.Status)
+			io.Copy(os.Stderr, resp.Body)
+			os.Exit(6)
+		}
+		var changes []string
+		if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not parse response:", err)
+			os.Exit(6)
+		}
+		if len(changes) == 0 {
+			fmt.Println("Configuration reloaded with no changes.")
+		}
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+}
+
 func status(psid string, mrpUrl *url.URL) {
 	mrpUrl.Path = api.QueryGetInfo + "/" + psid
-	if resp, err := http.Get(mrpUrl.String()); err != nil {
+	if resp, err := mrpClient.Get(mrpUrl.String()); err != nil {
 		fmt.Fprintln(os.Stderr, "Cannot connect to", mrpUrl)
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(5)
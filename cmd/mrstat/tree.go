@@ -0,0 +1,334 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Detailed pipestance status, either from a running mrp or from metadata.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The status of a single job (split, chunk, or join).
+type jobStatus struct {
+	Name     string             `json:"name"`
+	State    core.MetadataState `json:"state"`
+	Host     string             `json:"host,omitempty"`
+	Start    string             `json:"start,omitempty"`
+	Duration float64            `json:"duration_seconds,omitempty"`
+	Threads  int                `json:"threads,omitempty"`
+	MemGB    int                `json:"memGB,omitempty"`
+}
+
+// The status of a fork of a stage or pipeline.
+type forkStatus struct {
+	Index int                `json:"index"`
+	State core.MetadataState `json:"state"`
+	Jobs  []*jobStatus       `json:"jobs,omitempty"`
+}
+
+// The status of a node in the pipeline graph.
+type nodeStatus struct {
+	Name      string              `json:"name"`
+	Fqname    string              `json:"fqname"`
+	Type      string              `json:"type"`
+	State     core.MetadataState  `json:"state"`
+	CoreHours float64             `json:"core_hours,omitempty"`
+	Error     *core.NodeErrorInfo `json:"error,omitempty"`
+	Forks     []*forkStatus       `json:"forks,omitempty"`
+	Children  []*nodeStatus       `json:"children,omitempty"`
+}
+
+// The detailed status of a pipestance.
+type pipestanceStatus struct {
+	// True if the status was read from a running mrp, false if it was read
+	// directly from the pipestance metadata.
+	Live bool                `json:"live"`
+	Info *api.PipestanceInfo `json:"info,omitempty"`
+	Root *nodeStatus         `json:"root"`
+}
+
+// A source of state information for a pipestance.
+type stateSource interface {
+	getState() (*api.PipestanceState, error)
+	getPerf() ([]*core.NodePerfInfo, error)
+}
+
+// Queries a running mrp through its api endpoints.
+type apiSource struct {
+	mrpUrl *url.URL
+}
+
+func (self *apiSource) get(query string, target interface{}) error {
+	u := *self.mrpUrl
+	u.Path = query
+	resp, err := mrpClient.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func (self *apiSource) getState() (*api.PipestanceState, error) {
+	var state api.PipestanceState
+	return &state, self.get(api.QueryGetState, &state)
+}
+
+func (self *apiSource) getPerf() ([]*core.NodePerfInfo, error) {
+	var perf api.PerfInfo
+	if err := self.get(api.QueryGetPerf, &perf); err != nil {
+		return nil, err
+	}
+	return perf.Nodes, nil
+}
+
+// Reads the pipestance metadata directly, for when mrp is not running.
+type metadataSource struct {
+	psPath string
+	ps     *core.Pipestance
+}
+
+func (self *metadataSource) getState() (*api.PipestanceState, error) {
+	// Reattach every time, so that chunks which were created since the last
+	// refresh are picked up.
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	rt := config.NewRuntime()
+	ps, err := rt.InspectPipestance(self.psPath, context.Background())
+	if err != nil {
+		return nil, err
+	}
+	self.ps = ps
+	info := &api.PipestanceInfo{
+		Pname:  ps.GetPname(),
+		PsId:   ps.GetPsid(),
+		State:  ps.GetState(context.Background()),
+		PsPath: ps.GetPath(),
+	}
+	info.Uuid, _ = ps.GetUuid()
+	return &api.PipestanceState{
+		Nodes: ps.SerializeState(),
+		Info:  info,
+	}, nil
+}
+
+func (self *metadataSource) getPerf() ([]*core.NodePerfInfo, error) {
+	if self.ps == nil {
+		return nil, nil
+	}
+	return self.ps.SerializePerf(), nil
+}
+
+// Reads the job information for a split, chunk, or join.
+func getJobStatus(name string, md *core.MetadataInfo, now time.Time) *jobStatus {
+	if md == nil {
+		return nil
+	}
+	job := &jobStatus{
+		Name:  name,
+		State: md.State(),
+	}
+	if job.State == core.Waiting || job.State == core.DisabledState {
+		return job
+	}
+	var info core.JobInfo
+	if b, err := core.ReadMetadataFile(path.Join(md.Path,
+		core.JobInfoFile.FileName())); err != nil {
+		return job
+	} else if err := json.Unmarshal(b, &info); err != nil {
+		return job
+	}
+	job.Host = info.Host
+	job.Threads = info.Threads
+	job.MemGB = info.MemGB
+	if wc := info.WallClockInfo; wc != nil {
+		job.Start = wc.Start
+		if wc.Duration > 0 {
+			job.Duration = wc.Duration
+		} else if job.State == core.Running {
+			if start, err := time.ParseInLocation(util.TIMEFMT,
+				wc.Start, time.Local); err == nil {
+				job.Duration = now.Sub(start).Seconds()
+			}
+		}
+	}
+	return job
+}
+
+func getForkStatus(fork *core.ForkInfo, now time.Time) *forkStatus {
+	status := &forkStatus{
+		Index: fork.Index,
+		State: fork.State,
+	}
+	if job := getJobStatus("split", fork.SplitMetadata, now); job != nil &&
+		job.State != core.Waiting {
+		status.Jobs = append(status.Jobs, job)
+	}
+	for _, chunk := range fork.Chunks {
+		if job := getJobStatus(fmt.Sprintf("chnk%d", chunk.Index),
+			chunk.Metadata, now); job != nil {
+			status.Jobs = append(status.Jobs, job)
+		}
+	}
+	if job := getJobStatus("join", fork.JoinMetadata, now); job != nil &&
+		job.State != core.Waiting {
+		status.Jobs = append(status.Jobs, job)
+	}
+	return status
+}
+
+// Builds the node tree from the flat list of nodes, using the fully
+// qualified names to find each node's parent.
+func buildStatus(state *api.PipestanceState,
+	perf []*core.NodePerfInfo, now time.Time) *nodeStatus {
+	coreHours := make(map[string]float64, len(perf))
+	for _, node := range perf {
+		for _, fork := range node.Forks {
+			if fork.ForkStats != nil {
+				coreHours[node.Fqname] += fork.ForkStats.CoreHours
+			}
+		}
+	}
+	byName := make(map[string]*nodeStatus, len(state.Nodes))
+	var root *nodeStatus
+	for _, node := range state.Nodes {
+		status := &nodeStatus{
+			Name:      node.Name,
+			Fqname:    node.Fqname,
+			Type:      node.Type,
+			State:     node.State,
+			CoreHours: coreHours[node.Fqname],
+			Error:     node.Error,
+		}
+		if node.Type == "stage" {
+			status.Forks = make([]*forkStatus, 0, len(node.Forks))
+			for _, fork := range node.Forks {
+				status.Forks = append(status.Forks, getForkStatus(fork, now))
+			}
+		}
+		byName[node.Fqname] = status
+		if i := strings.LastIndexByte(node.Fqname, '.'); i > 0 {
+			if parent := byName[node.Fqname[:i]]; parent != nil {
+				parent.Children = append(parent.Children, status)
+				continue
+			}
+		}
+		if root == nil {
+			root = status
+		}
+	}
+	return root
+}
+
+func getStatus(source stateSource) (*pipestanceStatus, error) {
+	state, err := source.getState()
+	if err != nil {
+		return nil, err
+	}
+	perf, err := source.getPerf()
+	if err != nil {
+		perf = nil
+	}
+	_, live := source.(*apiSource)
+	return &pipestanceStatus{
+		Live: live,
+		Info: state.Info,
+		Root: buildStatus(state, perf, time.Now()),
+	}, nil
+}
+
+func formatDuration(seconds float64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+func stateString(state core.MetadataState) string {
+	if state == core.Waiting {
+		return "waiting"
+	}
+	return string(state)
+}
+
+// Prints the status tree.  Jobs are only listed for forks which are not yet
+// complete, unless all is set.
+func (self *pipestanceStatus) print(w io.Writer, all bool) {
+	if info := self.Info; info != nil {
+		fmt.Fprintf(w, "Pipestance %s (%s): %s\n",
+			info.PsId, info.Pname, stateString(info.State))
+		if info.Hostname != "" {
+			fmt.Fprintf(w, "mrp pid %d on %s\n", info.Pid, info.Hostname)
+		}
+	}
+	if !self.Live {
+		fmt.Fprintln(w, "mrp is not running; status was read from metadata.")
+	}
+	fmt.Fprintln(w)
+	if self.Root != nil {
+		self.Root.print(w, "", all)
+	}
+}
+
+func (self *nodeStatus) print(w io.Writer, indent string, all bool) {
+	line := indent + self.Name
+	if self.Type == "stage" && len(self.Forks) > 1 {
+		line += fmt.Sprintf(" [%d forks]", len(self.Forks))
+	}
+	line = fmt.Sprintf("%-50s %-10s", line, stateString(self.State))
+	if self.CoreHours >= 0.01 {
+		line += fmt.Sprintf(" %.2f core-hours", self.CoreHours)
+	}
+	fmt.Fprintln(w, strings.TrimRight(line, " "))
+	childIndent := indent + "  "
+	if self.Error != nil {
+		fmt.Fprintf(w, "%s! %s\n", childIndent, self.Error.Path)
+		for _, line := range strings.Split(
+			strings.TrimSpace(self.Error.Summary), "\n") {
+			fmt.Fprintf(w, "%s! %s\n", childIndent, line)
+		}
+	}
+	for _, fork := range self.Forks {
+		if !all && (fork.State == core.Complete || fork.State == core.DisabledState) {
+			continue
+		}
+		jobIndent := childIndent
+		if len(self.Forks) > 1 {
+			fmt.Fprintf(w, "%-50s %s\n",
+				fmt.Sprintf("%sfork%d", childIndent, fork.Index),
+				stateString(fork.State))
+			jobIndent += "  "
+		}
+		for _, job := range fork.Jobs {
+			if !all && job.State == core.Complete {
+				continue
+			}
+			fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("%-50s %-10s %-20s %s",
+				jobIndent+job.Name,
+				stateString(job.State),
+				job.Host,
+				formatDuration(job.Duration)), " "))
+		}
+	}
+	for _, child := range self.Children {
+		child.print(w, childIndent, all)
+	}
+}
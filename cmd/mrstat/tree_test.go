@@ -0,0 +1,23 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package main
+
+import "testing"
+
+func TestFormatDuration(t *testing.T) {
+	for _, c := range []struct {
+		seconds float64
+		expect  string
+	}{
+		{0, ""},
+		{0.4, "0s"},
+		{0.9, "1s"},
+		{59.7, "1m0s"},
+		{3723.2, "1h2m3s"},
+	} {
+		if s := formatDuration(c.seconds); s != c.expect {
+			t.Errorf("Expected %v seconds to format as %q, got %q",
+				c.seconds, c.expect, s)
+		}
+	}
+}
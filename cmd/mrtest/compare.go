@@ -0,0 +1,240 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Compare a value to its expected value, returning a description of each
+// difference.  Numbers are compared using the tolerance, and strings which
+// are paths inside root are made relative to it, with job uniquifiers
+// removed, first.
+func compareValues(name string, actual, expected interface{},
+	tol Tolerance, root string) []string {
+	switch e := expected.(type) {
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected %v, got %s",
+				name, e, describe(actual))}
+		}
+		if !withinTolerance(a, e, tol) {
+			return []string{fmt.Sprintf("%s: expected %v, got %v", name, e, a)}
+		}
+		return nil
+	case string:
+		a, ok := actual.(string)
+		if ok && root != "" && strings.HasPrefix(a, root+"/") {
+			a = uniquifierRe.ReplaceAllString(a[len(root)+1:], "$1")
+		}
+		if !ok || a != e {
+			return []string{fmt.Sprintf("%s: expected %q, got %s",
+				name, e, describe(actual))}
+		}
+		return nil
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an array, got %s",
+				name, describe(actual))}
+		}
+		if len(a) != len(e) {
+			return []string{fmt.Sprintf("%s: expected %d elements, got %d",
+				name, len(e), len(a))}
+		}
+		var diffs []string
+		for i := range e {
+			diffs = append(diffs, compareValues(
+				fmt.Sprintf("%s[%d]", name, i), a[i], e[i], tol, root)...)
+		}
+		return diffs
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %s",
+				name, describe(actual))}
+		}
+		var diffs []string
+		for _, key := range sortedKeys(e) {
+			if v, ok := a[key]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: missing key %q", name, key))
+			} else {
+				diffs = append(diffs, compareValues(
+					name+"."+key, v, e[key], tol, root)...)
+			}
+		}
+		for _, key := range sortedKeys(a) {
+			if _, ok := e[key]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: extra key %q", name, key))
+			}
+		}
+		return diffs
+	default:
+		if !reflect.DeepEqual(actual, expected) {
+			return []string{fmt.Sprintf("%s: expected %s, got %s",
+				name, describe(expected), describe(actual))}
+		}
+		return nil
+	}
+}
+
+func withinTolerance(actual, expected float64, tol Tolerance) bool {
+	if actual == expected {
+		return true
+	}
+	if math.IsNaN(actual) || math.IsNaN(expected) {
+		return false
+	}
+	return math.Abs(actual-expected) <= tol.Abs+tol.Rel*math.Abs(expected)
+}
+
+func describe(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Compare a file from the pipestance to its expected version.
+func compareFile(actual, expected, format string, tols *Tolerances, root string) []string {
+	switch format {
+	case "json":
+		return compareJsonFiles(actual, expected, tols, root)
+	case "text":
+		return compareTextFiles(actual, expected)
+	default:
+		a, err := ioutil.ReadFile(actual)
+		if err != nil {
+			return []string{err.Error()}
+		}
+		e, err := ioutil.ReadFile(expected)
+		if err != nil {
+			return []string{err.Error()}
+		}
+		if !bytes.Equal(a, e) {
+			return []string{fmt.Sprintf("%s differs from %s", actual, expected)}
+		}
+		return nil
+	}
+}
+
+func readJson(fn string) (interface{}, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return v, nil
+}
+
+func compareJsonFiles(actual, expected string, tols *Tolerances, root string) []string {
+	a, err := readJson(actual)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	e, err := readJson(expected)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	am, aok := a.(map[string]interface{})
+	em, eok := e.(map[string]interface{})
+	if !aok || !eok {
+		return compareValues(actual, a, e, tols.Tolerance, root)
+	}
+	// Apply per-key tolerances to the top-level keys.
+	var diffs []string
+	for _, key := range sortedKeys(em) {
+		if v, ok := am[key]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: missing key %q", actual, key))
+		} else {
+			diffs = append(diffs, compareValues(actual+": "+key,
+				v, em[key], tols.get(key), root)...)
+		}
+	}
+	for _, key := range sortedKeys(am) {
+		if _, ok := em[key]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: extra key %q", actual, key))
+		}
+	}
+	return diffs
+}
+
+var (
+	// Matches the uniquifier suffix on a job directory, e.g. chnk0-u39ced5d9dd.
+	uniquifierRe = regexp.MustCompile(`-u[0-9a-f]{10}(/|$)`)
+
+	timestampRe  = regexp.MustCompile(`[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{1,2}:[0-9]{2}:[0-9]{2}`)
+	quotedPathRe = regexp.MustCompile(`"/.*/([^/]+)"`)
+)
+
+// Replace quoted absolute paths with their base names, and timestamps with
+// a placeholder.
+func cleanLine(line string) string {
+	return timestampRe.ReplaceAllString(
+		quotedPathRe.ReplaceAllString(line, `"$1"`), "__TIMESTAMP__")
+}
+
+func readLines(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, cleanLine(scanner.Text()))
+	}
+	return lines, scanner.Err()
+}
+
+func compareTextFiles(actual, expected string) []string {
+	a, err := readLines(actual)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	e, err := readLines(expected)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for i := 0; i < len(a) && i < len(e); i++ {
+		if a[i] != e[i] {
+			return []string{fmt.Sprintf("%s line %d: expected %q, got %q",
+				actual, i+1, e[i], a[i])}
+		}
+	}
+	if len(a) != len(e) {
+		return []string{fmt.Sprintf("%s: expected %d lines, got %d",
+			actual, len(e), len(a))}
+	}
+	return nil
+}
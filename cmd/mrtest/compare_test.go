@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func parseJson(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestCompareValues(t *testing.T) {
+	check := func(actual, expected string, tol Tolerance, diffs int) {
+		t.Helper()
+		result := compareValues("value",
+			parseJson(t, actual), parseJson(t, expected), tol, "/ps")
+		if len(result) != diffs {
+			t.Errorf("Expected %d differences comparing %s to %s, got %v",
+				diffs, actual, expected, result)
+		}
+	}
+	check(`1.0`, `1`, Tolerance{}, 0)
+	check(`1.001`, `1`, Tolerance{}, 1)
+	check(`1.001`, `1`, Tolerance{Abs: 0.01}, 0)
+	check(`1.1`, `1`, Tolerance{Rel: 0.01}, 1)
+	check(`101`, `100`, Tolerance{Rel: 0.01}, 0)
+	check(`"/ps/outs/a.txt"`, `"outs/a.txt"`, Tolerance{}, 0)
+	check(`"/ps/S/fork0/chnk0-u0123456789/files/a.txt"`,
+		`"S/fork0/chnk0/files/a.txt"`, Tolerance{}, 0)
+	check(`"/other/outs/a.txt"`, `"outs/a.txt"`, Tolerance{}, 1)
+	check(`[1, 2.001, 3]`, `[1, 2, 3]`, Tolerance{Abs: 0.01}, 0)
+	check(`[1, 2]`, `[1, 2, 3]`, Tolerance{}, 1)
+	check(`{"a": 1, "b": 2}`, `{"a": 1, "c": 2}`, Tolerance{}, 2)
+	check(`{"a": null}`, `{"a": 1}`, Tolerance{}, 1)
+	check(`true`, `true`, Tolerance{}, 0)
+}
+
+func TestCompareFile(t *testing.T) {
+	d, err := ioutil.TempDir("", "mrtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	write := func(name, content string) string {
+		fn := path.Join(d, name)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fn
+	}
+	tols := &Tolerances{Params: map[string]Tolerance{"x": {Abs: 0.1}}}
+	a := write("a.json", `{"x": 1.05, "y": 2}`)
+	e := write("e.json", `{"x": 1, "y": 2}`)
+	if diffs := compareFile(a, e, "json", tols, d); len(diffs) != 0 {
+		t.Errorf("Expected json to match, got %v", diffs)
+	}
+	if diffs := compareFile(a, e, "binary", tols, d); len(diffs) != 1 {
+		t.Errorf("Expected binary contents to differ, got %v", diffs)
+	}
+	a = write("a.txt", "written \"/tmp/x/foo.txt\" at 2018-01-02 03:04:05\n")
+	e = write("e.txt", "written \"/home/y/foo.txt\" at 2017-11-12 13:14:15\n")
+	if diffs := compareFile(a, e, "text", tols, d); len(diffs) != 0 {
+		t.Errorf("Expected text to match, got %v", diffs)
+	}
+	e = write("e.txt", "written \"/home/y/bar.txt\" at 2017-11-12 13:14:15\n")
+	if diffs := compareFile(a, e, "text", tols, d); len(diffs) != 1 {
+		t.Errorf("Expected text to differ, got %v", diffs)
+	}
+}
+
+func TestWriteJunit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJunit(&buf, []*TestResult{
+		{Name: "pass", Seconds: 1},
+		{Name: "fail", Failures: []string{"a < b"}},
+		{Name: "error", Error: errors.New("no spec")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+	for _, s := range []string{
+		`tests="3" failures="1" errors="1"`,
+		`<failure message="a &lt; b">`,
+		`<error message="no spec">`,
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("Expected report to contain %s, got\n%s", s, report)
+		}
+	}
+}
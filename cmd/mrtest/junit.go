@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JUnit XML report format, as understood by most CI systems.
+
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Cases    []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+func writeJunit(w io.Writer, results []*TestResult) error {
+	suite := &junitTestSuite{
+		Name:  "mrtest",
+		Tests: len(results),
+	}
+	var total float64
+	for _, result := range results {
+		total += result.Seconds
+		tc := &junitTestCase{
+			Name:      result.Name,
+			ClassName: "mrtest." + result.Name,
+			Time:      junitTime(result.Seconds),
+			SystemOut: result.Output,
+		}
+		if result.Error != nil {
+			suite.Errors++
+			tc.Error = &junitMessage{
+				Message: result.Error.Error(),
+				Text:    result.Error.Error(),
+			}
+		} else if len(result.Failures) > 0 {
+			suite.Failures++
+			tc.Failure = &junitMessage{
+				Message: result.Failures[0],
+				Text:    strings.Join(result.Failures, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = junitTime(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&junitTestSuites{Suites: []*junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
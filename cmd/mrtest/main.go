@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian pipeline regression test runner.
+//
+// Runs pipelines described by json test specs with mrp in a temporary
+// directory, checks the exit code, failures, outputs, and output files
+// against their expected values, and optionally writes a JUnit XML report.
+package main
+
+import (
+	"os"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian pipeline regression test runner.
+
+Usage:
+    mrtest <spec>... [options]
+    mrtest -h | --help | --version
+
+Options:
+    --junit=FILE    Write a JUnit XML report to FILE.
+    --mrp=PATH      The mrp executable to run.  Defaults to the mrp
+                        next to mrtest.
+    --keep          Keep the working directories of passing tests.
+                        Directories of failing tests are always kept.
+
+    -h --help       Show this message.
+    --version       Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	runner := &Runner{
+		Mrp:  util.RelPath("mrp"),
+		Keep: opts["--keep"].(bool),
+	}
+	if value := opts["--mrp"]; value != nil {
+		runner.Mrp = value.(string)
+	}
+
+	var results []*TestResult
+	failed := 0
+	for _, fn := range opts["<spec>"].([]string) {
+		var result *TestResult
+		if spec, err := loadSpec(fn); err != nil {
+			result = &TestResult{Name: fn, Error: err}
+		} else {
+			util.PrintInfo("mrtest", "Running %s", spec.Name)
+			result = runner.Run(spec)
+		}
+		results = append(results, result)
+		if result.Passed() {
+			util.PrintInfo("mrtest", "PASS %s (%.1fs)", result.Name, result.Seconds)
+			continue
+		}
+		failed++
+		if result.Error != nil {
+			util.PrintInfo("mrtest", "ERROR %s: %v", result.Name, result.Error)
+		} else {
+			util.PrintInfo("mrtest", "FAIL %s (%.1fs)", result.Name, result.Seconds)
+			for _, msg := range result.Failures {
+				util.PrintInfo("mrtest", "    %s", msg)
+			}
+		}
+		if result.WorkDir != "" {
+			util.PrintInfo("mrtest", "    Working directory: %s", result.WorkDir)
+		}
+	}
+
+	if value := opts["--junit"]; value != nil {
+		f, err := os.Create(value.(string))
+		util.DieIf(err)
+		util.DieIf(writeJunit(f, results))
+		util.DieIf(f.Close())
+	}
+	util.PrintInfo("mrtest", "%d of %d tests passed.",
+		len(results)-failed, len(results))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,251 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+type Runner struct {
+	// The mrp executable.
+	Mrp string
+
+	// Keep the working directories of passing tests.
+	Keep bool
+}
+
+type TestResult struct {
+	Name    string
+	Seconds float64
+
+	// The combined output of mrp.
+	Output string
+
+	// The ways in which the test did not match expectations.
+	Failures []string
+
+	// Set if the test could not be run.
+	Error error
+
+	// The working directory, if it was kept.
+	WorkDir string
+}
+
+func (self *TestResult) Passed() bool {
+	return self.Error == nil && len(self.Failures) == 0
+}
+
+func (self *TestResult) fail(format string, args ...interface{}) {
+	self.Failures = append(self.Failures, fmt.Sprintf(format, args...))
+}
+
+// Run a test in a new temporary directory.
+func (self *Runner) Run(spec *TestSpec) *TestResult {
+	result := &TestResult{Name: spec.Name}
+	start := time.Now()
+	workDir, err := ioutil.TempDir("", "mrtest-"+spec.Name)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	self.run(spec, workDir, result)
+	result.Seconds = time.Since(start).Seconds()
+	if result.Passed() && !self.Keep {
+		os.RemoveAll(workDir)
+	} else {
+		result.WorkDir = workDir
+	}
+	return result
+}
+
+func (self *Runner) run(spec *TestSpec, workDir string, result *TestResult) {
+	for _, fn := range spec.CreateFiles {
+		fn = path.Join(workDir, fn)
+		if err := os.MkdirAll(path.Dir(fn), 0755); err != nil {
+			result.Error = err
+			return
+		}
+		if err := ioutil.WriteFile(fn, nil, 0644); err != nil {
+			result.Error = err
+			return
+		}
+	}
+
+	ctx := context.Background()
+	if spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx,
+			time.Duration(spec.Timeout)*time.Second)
+		defer cancel()
+	}
+	args := append([]string{
+		spec.resolve(spec.Mro), spec.Psid,
+		"--jobmode=local",
+		"--disable-ui",
+	}, spec.Args...)
+	cmd := exec.CommandContext(ctx, self.Mrp, args...)
+	cmd.Dir = workDir
+	cmd.Env = spec.environ(workDir)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	result.Output = output.String()
+	if ctx.Err() == context.DeadlineExceeded {
+		result.fail("mrp did not finish within %d seconds", spec.Timeout)
+		return
+	}
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			code = status.ExitStatus()
+		} else {
+			code = -1
+		}
+	} else if err != nil {
+		result.Error = err
+		return
+	}
+	if expect := spec.expectedReturn(); code != expect {
+		result.fail("mrp returned %d, expected %d", code, expect)
+	}
+
+	psPath := path.Join(workDir, spec.Psid)
+	if spec.ExpectedFailure != nil || len(spec.Outputs) > 0 {
+		config := core.DefaultRuntimeOptions()
+		config.VdrMode = "disable"
+		rt := config.NewRuntime()
+		pipestance, err := rt.InspectPipestance(psPath, context.Background())
+		if err != nil {
+			result.fail("Could not read pipestance: %v", err)
+			return
+		}
+		state := pipestance.GetState(context.Background())
+		if spec.ExpectedFailure != nil {
+			checkFailure(spec.ExpectedFailure, state, pipestance.GetErrors(), result)
+		} else if state != core.Complete {
+			result.fail("Pipestance is %v", state)
+		}
+		if len(spec.Outputs) > 0 {
+			checkOutputs(spec, psPath, path.Join(psPath, pipestance.GetPname(),
+				fmt.Sprintf("fork%d", spec.Fork), "_outs"), result)
+		}
+	}
+	for _, f := range spec.Files {
+		result.Failures = append(result.Failures, compareFile(
+			path.Join(psPath, f.Actual), spec.resolve(f.Expected),
+			f.format(), &spec.Tolerance, psPath)...)
+	}
+}
+
+func checkFailure(expect *ExpectedFailure, state core.MetadataState,
+	errors []*core.NodeErrorInfo, result *TestResult) {
+	if state != core.Failed {
+		result.fail("Pipestance is %v, expected it to fail", state)
+		return
+	}
+	var re *regexp.Regexp
+	if expect.Message != "" {
+		var err error
+		if re, err = regexp.Compile(expect.Message); err != nil {
+			result.Error = err
+			return
+		}
+	}
+	for _, info := range errors {
+		if info == nil {
+			continue
+		}
+		// The name of the failed node includes the fork and chunk.
+		if expect.Stage != "" && !strings.HasPrefix(info.FQname, expect.Stage+".") &&
+			!strings.Contains(info.FQname, "."+expect.Stage+".") {
+			continue
+		}
+		if re == nil || re.MatchString(info.Summary) || re.MatchString(info.Log) {
+			return
+		}
+	}
+	failed := make([]string, 0, len(errors))
+	for _, info := range errors {
+		if info != nil {
+			failed = append(failed, info.FQname)
+		}
+	}
+	if expect.Message != "" {
+		result.fail("No failure of %q with a message matching %q.  Failed stages: %s",
+			expect.Stage, expect.Message, strings.Join(failed, ", "))
+	} else {
+		result.fail("%s did not fail.  Failed stages: %s",
+			expect.Stage, strings.Join(failed, ", "))
+	}
+}
+
+func checkOutputs(spec *TestSpec, psPath, outsFile string, result *TestResult) {
+	v, err := readJson(outsFile)
+	if err != nil {
+		result.fail("Could not read pipeline outputs: %v", err)
+		return
+	}
+	outs, ok := v.(map[string]interface{})
+	if !ok {
+		result.fail("%s is not a json object", outsFile)
+		return
+	}
+	if p, err := filepath.EvalSymlinks(psPath); err == nil {
+		psPath = p
+	}
+	for _, key := range sortedKeys(spec.Outputs) {
+		if actual, ok := outs[key]; !ok {
+			result.fail("Missing output %s", key)
+		} else {
+			result.Failures = append(result.Failures, compareValues(
+				key, resolveOutputs(actual), spec.Outputs[key],
+				spec.Tolerance.get(key), psPath)...)
+		}
+	}
+}
+
+// When a pipestance completes, file outputs of the top-level pipeline are
+// moved to the outs directory and replaced with symlinks.  Resolve paths in
+// output values to their final locations.
+func resolveOutputs(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !filepath.IsAbs(v) {
+			return v
+		}
+		if p, err := filepath.EvalSymlinks(v); err == nil {
+			return p
+		}
+		return v
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = resolveOutputs(elem)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			result[key] = resolveOutputs(elem)
+		}
+		return result
+	default:
+		return value
+	}
+}
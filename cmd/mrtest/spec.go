@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A regression test case.
+type TestSpec struct {
+	// The name of the test.  Defaults to the name of the spec file.
+	Name string `json:"name"`
+
+	// The mro file to run, relative to the spec file.
+	Mro string `json:"mro"`
+
+	// The pipestance ID to use.  Defaults to "pipeline_test".
+	Psid string `json:"psid"`
+
+	// Directories to search for included mro files, relative to the spec
+	// file.  Defaults to the directory containing the spec file.
+	MroPath []string `json:"mropath"`
+
+	// Extra arguments to mrp.
+	Args []string `json:"args"`
+
+	// Extra environment variables for mrp.  $WORK_DIR and $SPEC_DIR are
+	// replaced by the test's working directory and the directory containing
+	// the spec file.
+	Env map[string]string `json:"env"`
+
+	// Empty files to create in the working directory, relative to it,
+	// before running mrp.
+	CreateFiles []string `json:"create_files"`
+
+	// Maximum time to run mrp, in seconds.  Zero means no limit.
+	Timeout int `json:"timeout"`
+
+	// The exit code mrp is expected to return.  Defaults to 1 if a failure
+	// is expected, and 0 otherwise.
+	ExpectedReturn *int `json:"expected_return"`
+
+	// If set, the pipestance is expected to fail in the given way.
+	ExpectedFailure *ExpectedFailure `json:"expected_failure"`
+
+	// The expected values of top-level pipeline outputs.  Only the
+	// outputs listed are compared.  File paths are given relative to the
+	// pipestance directory, e.g. "outs/result.json".
+	Outputs map[string]interface{} `json:"outputs"`
+
+	// For pipelines with sweeps, the fork whose outputs are compared.
+	Fork int `json:"fork"`
+
+	// Tolerances for comparing floating point values in outputs and json
+	// files.
+	Tolerance Tolerances `json:"tolerance"`
+
+	// Files to compare to expected versions.
+	Files []FileComparison `json:"files"`
+
+	// The path to the spec file.
+	path string
+}
+
+type ExpectedFailure struct {
+	// The stage expected to fail.  This may be the fully qualified name or
+	// any suffix of it, e.g. PIPELINE.STAGE or STAGE.
+	Stage string `json:"stage"`
+
+	// A regular expression which must match the error message.
+	Message string `json:"message"`
+}
+
+type Tolerance struct {
+	// The maximum absolute difference.
+	Abs float64 `json:"abs"`
+
+	// The maximum difference relative to the expected value.
+	Rel float64 `json:"rel"`
+}
+
+type Tolerances struct {
+	Tolerance
+
+	// Tolerances for specific outputs or json keys, overriding the default.
+	// Keys are output names, or for files the top-level key in the file.
+	Params map[string]Tolerance `json:"params"`
+}
+
+// Get the tolerance for the given output or key.
+func (self *Tolerances) get(param string) Tolerance {
+	if tol, ok := self.Params[param]; ok {
+		return tol
+	}
+	return self.Tolerance
+}
+
+type FileComparison struct {
+	// The path to the output file, relative to the pipestance directory.
+	Actual string `json:"actual"`
+
+	// The path to the expected file, relative to the spec file.
+	Expected string `json:"expected"`
+
+	// How to compare the files.  One of "json", "text", or "binary".
+	// Defaults to "json" for files ending in .json and "binary" otherwise.
+	//
+	// Text comparisons ignore absolute paths and timestamps, in the same
+	// way as martian_test.py.  Json comparisons apply the float tolerance.
+	Format string `json:"format"`
+}
+
+func (self *FileComparison) format() string {
+	if self.Format != "" {
+		return self.Format
+	} else if strings.HasSuffix(self.Actual, ".json") {
+		return "json"
+	}
+	return "binary"
+}
+
+// Load and validate a test spec.
+func loadSpec(fn string) (*TestSpec, error) {
+	fn, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	spec := &TestSpec{path: fn}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	if spec.Name == "" {
+		spec.Name = strings.TrimSuffix(path.Base(fn), path.Ext(fn))
+	}
+	if spec.Mro == "" {
+		return nil, fmt.Errorf("%s: no mro file given", fn)
+	}
+	if spec.Psid == "" {
+		spec.Psid = "pipeline_test"
+	}
+	if len(spec.MroPath) == 0 {
+		spec.MroPath = []string{"."}
+	}
+	for _, f := range spec.Files {
+		if f.Actual == "" || f.Expected == "" {
+			return nil, fmt.Errorf("%s: file comparisons require actual and expected paths", fn)
+		}
+		switch f.format() {
+		case "json", "text", "binary":
+		default:
+			return nil, fmt.Errorf("%s: unknown file format %q", fn, f.Format)
+		}
+	}
+	return spec, nil
+}
+
+// The directory containing the spec file.
+func (self *TestSpec) dir() string {
+	return path.Dir(self.path)
+}
+
+// Resolve a path relative to the spec file.
+func (self *TestSpec) resolve(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(self.dir(), p)
+}
+
+func (self *TestSpec) expectedReturn() int {
+	if self.ExpectedReturn != nil {
+		return *self.ExpectedReturn
+	} else if self.ExpectedFailure != nil {
+		return 1
+	}
+	return 0
+}
+
+// Get the environment for running mrp in the given working directory.
+func (self *TestSpec) environ(workDir string) []string {
+	mroPaths := make([]string, 0, len(self.MroPath))
+	for _, p := range self.MroPath {
+		mroPaths = append(mroPaths, self.resolve(p))
+	}
+	env := append(os.Environ(), "MROPATH="+strings.Join(mroPaths, ":"))
+	expand := func(name string) string {
+		switch name {
+		case "WORK_DIR":
+			return workDir
+		case "SPEC_DIR":
+			return self.dir()
+		}
+		return os.Getenv(name)
+	}
+	for key, value := range self.Env {
+		env = append(env, key+"="+os.Expand(value, expand))
+	}
+	return env
+}
@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian pipestance viewer.
+//
+// Serves the pipeline graph UI for any number of pipestance directories,
+// without mrp running.  Pipestances are never modified.  Metadata is read
+// from the pipestance directory, or from metadata.zip for pipestances whose
+// metadata was zipped.  The api endpoints are the same as those served by
+// mrp, except that control actions such as restart are rejected.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetupSignalHandlers()
+	doc := `Martian pipestance viewer.
+
+Usage:
+    mrv <pipestance_path>... [options]
+    mrv -h | --help | --version
+
+Options:
+    --port=NUM      Serve the UI at http://<hostname>:NUM.  By default a
+                    free port is chosen.
+    --auth-key=KEY  Require this key for accessing the UI.
+
+    -h --help       Show this message.
+    --version       Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+	util.Println("Martian Pipestance Viewer - %s", martianVersion)
+
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	rt := config.NewRuntime()
+
+	server := &mrvWebServer{
+		pipestances: make(map[string]*servedPipestance),
+		webRoot:     util.RelPath(path.Join("..", "web", "martian")),
+	}
+	for _, p := range opts["<pipestance_path>"].([]string) {
+		ps, err := newServedPipestance(p, rt)
+		if err != nil {
+			util.PrintError(err, "mrv", "Cannot serve %s", p)
+			os.Exit(1)
+		}
+		if other := server.pipestances[ps.psid]; other != nil {
+			util.PrintInfo("mrv",
+				"Pipestances %s and %s have the same ID.",
+				other.path, ps.path)
+			os.Exit(1)
+		}
+		server.pipestances[ps.psid] = ps
+	}
+	if value := opts["--auth-key"]; value != nil {
+		server.authKey = value.(string)
+	}
+
+	port := "0"
+	if value := opts["--port"]; value != nil {
+		port = value.(string)
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		util.PrintError(err, "mrv", "Cannot open port %s", port)
+		os.Exit(1)
+	}
+	hostname, _ := os.Hostname()
+	u := url.URL{
+		Scheme: "http",
+		Host: net.JoinHostPort(hostname,
+			fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)),
+	}
+	if server.authKey != "" {
+		q := u.Query()
+		q.Set("auth", server.authKey)
+		u.RawQuery = q.Encode()
+	}
+	util.Println("Serving %d pipestance%s at %s",
+		len(server.pipestances), util.Pluralize(len(server.pipestances)),
+		u.String())
+	util.DieIf(server.serve(listener))
+}
@@ -0,0 +1,203 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Read-only access to pipestance state from its metadata.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// A pipestance directory being served.
+type servedPipestance struct {
+	psid string
+	path string
+	rt   *core.Runtime
+
+	lock sync.Mutex
+
+	// The final state and performance data, once the pipestance has
+	// finished.  These never change, so they are only read once.
+	final *api.PipestanceState
+	perf  []*core.NodePerfInfo
+
+	// The directory where the pipestance was run, if it has since been moved.
+	// Metadata paths in the final state are relative to this.
+	origPath string
+}
+
+func newServedPipestance(psPath string, rt *core.Runtime) (*servedPipestance, error) {
+	psPath, err := filepath.Abs(psPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path.Join(psPath,
+		core.InvocationFile.FileName())); err != nil {
+		return nil, fmt.Errorf("%s is not a pipestance directory", psPath)
+	}
+	return &servedPipestance{
+		psid: path.Base(psPath),
+		path: psPath,
+		rt:   rt,
+	}, nil
+}
+
+// Read a top-level metadata file.
+func (self *servedPipestance) readRaw(name core.MetadataFileName) string {
+	b, _ := ioutil.ReadFile(path.Join(self.path, name.FileName()))
+	return string(b)
+}
+
+func (self *servedPipestance) exists(name core.MetadataFileName) bool {
+	_, err := os.Stat(path.Join(self.path, name.FileName()))
+	return err == nil
+}
+
+// Information about the pipestance, as far as it can be determined from
+// its metadata.
+func (self *servedPipestance) makeInfo(pname string, state core.MetadataState) *api.PipestanceInfo {
+	info := &api.PipestanceInfo{
+		Pname:        pname,
+		PsId:         self.psid,
+		State:        state,
+		PsPath:       self.path,
+		Start:        core.ParseTimestamp(self.readRaw(core.TimestampFile)),
+		JobMode:      strings.TrimSpace(self.readRaw(core.JobModeFile)),
+		InvokePath:   path.Join(self.path, core.InvocationFile.FileName()),
+		InvokeSource: self.readRaw(core.InvocationFile),
+		Uuid:         strings.TrimSpace(self.readRaw(core.UuidFile)),
+	}
+	info.Version, info.MroVersion, _ = core.ParseVersions(
+		self.readRaw(core.VersionsFile))
+	return info
+}
+
+// Find the top-level pipeline node, which has the shortest name.
+func rootNode(nodes []*core.NodeInfo) *core.NodeInfo {
+	var root *core.NodeInfo
+	for _, node := range nodes {
+		if root == nil || len(node.Fqname) < len(root.Fqname) {
+			root = node
+		}
+	}
+	return root
+}
+
+// Load the final state of a finished pipestance, if it has one.
+func (self *servedPipestance) loadFinal() (*api.PipestanceState, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.final != nil {
+		return self.final, nil
+	}
+	if !self.exists(core.FinalState) {
+		return nil, nil
+	}
+	var nodes []*core.NodeInfo
+	if err := self.rt.GetSerializationInto(self.path,
+		core.FinalState, &nodes); err != nil {
+		return nil, err
+	}
+	root := rootNode(nodes)
+	if root == nil {
+		return nil, fmt.Errorf("No nodes in final state for %s", self.psid)
+	}
+	if orig := path.Dir(root.Path); orig != self.path {
+		self.origPath = orig
+	}
+	var perf []*core.NodePerfInfo
+	if err := self.rt.GetSerializationInto(self.path,
+		core.Perf, &perf); err == nil {
+		self.perf = perf
+	}
+	self.final = &api.PipestanceState{
+		Nodes: nodes,
+		Info:  self.makeInfo(root.Name, root.State),
+	}
+	return self.final, nil
+}
+
+// Load an unfinished pipestance from its metadata.  Zipped metadata is read
+// from metadata.zip without unpacking it.
+func (self *servedPipestance) inspect(ctx context.Context) (*core.Pipestance, error) {
+	return self.rt.InspectPipestance(self.path, ctx)
+}
+
+// Get the current state of the pipestance.
+func (self *servedPipestance) getState(ctx context.Context) (*api.PipestanceState, error) {
+	if final, err := self.loadFinal(); final != nil || err != nil {
+		return final, err
+	}
+	ps, err := self.inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &api.PipestanceState{
+		Nodes: ps.SerializeState(),
+		Info:  self.makeInfo(ps.GetPname(), ps.GetState(ctx)),
+	}, nil
+}
+
+func (self *servedPipestance) getInfo(ctx context.Context) (*api.PipestanceInfo, error) {
+	if state, err := self.getState(ctx); err != nil {
+		return nil, err
+	} else {
+		return state.Info, nil
+	}
+}
+
+func (self *servedPipestance) getPerf(ctx context.Context) ([]*core.NodePerfInfo, error) {
+	if final, err := self.loadFinal(); final != nil || err != nil {
+		return self.perf, err
+	}
+	ps, err := self.inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ps.SerializePerf(), nil
+}
+
+func (self *servedPipestance) getCriticalPath(ctx context.Context,
+	cores int, speedup float64) (*core.CriticalPathReport, error) {
+	ps, err := self.inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ps.AnalyzeCriticalPath(cores, speedup), nil
+}
+
+// Open a metadata file, which may be inside metadata.zip.  Paths outside of
+// the pipestance directory are rejected.  Absolute paths from where the
+// pipestance was originally run are mapped to its current location.
+func (self *servedPipestance) openMetadata(p string) (io.ReadCloser, error) {
+	if api.IsPrivateMetadata(p) {
+		return nil, os.ErrNotExist
+	}
+	self.lock.Lock()
+	orig := self.origPath
+	self.lock.Unlock()
+	if !filepath.IsAbs(p) {
+		p = path.Join(self.path, p)
+	} else if orig != "" && strings.HasPrefix(p, orig+"/") {
+		p = path.Join(self.path, strings.TrimPrefix(p, orig+"/"))
+	}
+	p = path.Clean(p)
+	if rel, err := filepath.Rel(self.path, p); err != nil ||
+		rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, os.ErrNotExist
+	}
+	return self.rt.GetMetadata(self.path, p)
+}
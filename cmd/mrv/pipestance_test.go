@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestServeZippedPipestance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testServeZippedPipestance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	psPath := path.Join(dir, "ps")
+	forkPath := path.Join(psPath, "PIPE", "fork0")
+	if err := os.MkdirAll(forkPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(fn, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(path.Join(psPath, core.InvocationFile.FileName()), "call PIPE()")
+	write(path.Join(psPath, core.UiControl.FileName()), "secret")
+	// The pipestance was run from a different directory.
+	nodes := []*core.NodeInfo{
+		{Name: "PIPE", Fqname: "ID.ps.PIPE", Path: "/old/ps/PIPE", State: core.Complete},
+		{Name: "STAGE", Fqname: "ID.ps.PIPE.STAGE", Path: "/old/ps/PIPE/STAGE"},
+	}
+	if b, err := json.Marshal(nodes); err != nil {
+		t.Fatal(err)
+	} else {
+		write(path.Join(psPath, core.FinalState.FileName()), string(b))
+	}
+	stdout := path.Join(forkPath, core.StdOut.FileName())
+	write(stdout, "zipped output")
+	if err := util.CreateZip(path.Join(psPath, core.MetadataZip.FileName()),
+		[]string{stdout}); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(stdout)
+
+	// Serving a finished pipestance doesn't need a job manager.
+	ps, err := newServedPipestance(psPath, new(core.Runtime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := ps.getState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Info.Pname != "PIPE" || state.Info.State != core.Complete {
+		t.Errorf("Expected complete PIPE, got %s %s",
+			state.Info.State, state.Info.Pname)
+	}
+
+	read := func(p string) (string, error) {
+		f, err := ps.openMetadata(p)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		return string(b), err
+	}
+	if s, err := read("/old/ps/PIPE/fork0/_stdout"); err != nil {
+		t.Error(err)
+	} else if s != "zipped output" {
+		t.Errorf("Expected zipped output, got %q", s)
+	}
+	if s, err := read(core.InvocationFile.FileName()); err != nil {
+		t.Error(err)
+	} else if s != "call PIPE()" {
+		t.Errorf("Expected invocation, got %q", s)
+	}
+	for _, p := range []string{
+		core.UiControl.FileName(),
+		"../ps2/_invocation",
+		"/etc/passwd",
+	} {
+		if _, err := read(p); err == nil {
+			t.Errorf("Expected %s to be inaccessible", p)
+		}
+	}
+	if _, err := os.Stat(path.Join(psPath, core.MetadataZip.FileName())); err != nil {
+		t.Error("Expected metadata.zip to be left in place.")
+	}
+}
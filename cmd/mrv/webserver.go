@@ -0,0 +1,396 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// mrv webserver.
+//
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martian-lang/martian/martian/api"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The container name used in api paths.
+const mrvContainer = "mrv"
+
+type mrvWebServer struct {
+	pipestances map[string]*servedPipestance
+	webRoot     string
+
+	// If set, required for all requests.
+	authKey string
+}
+
+func (self *mrvWebServer) handler() http.Handler {
+	sm := http.NewServeMux()
+	self.handleApi(sm)
+	self.handleStatic(sm)
+	sm.HandleFunc("/pipestance/", self.serveGraphPage)
+	sm.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" && req.URL.Path != "/index.html" {
+			http.NotFound(w, req)
+		} else {
+			self.serveIndex(w, req)
+		}
+	})
+	return sm
+}
+
+// Checks that the request includes the authentication key, if one is set.
+// If it does not, it writes an error to the response and returns false.
+func (self *mrvWebServer) verifyAuth(w http.ResponseWriter, req *http.Request) bool {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if self.authKey == "" {
+		return true
+	}
+	if subtle.ConstantTimeCompare([]byte(req.FormValue("auth")),
+		[]byte(self.authKey)) != 1 {
+		http.Error(w, "This API requires authentication.", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// The query string to append to links, to pass along authentication.
+func (self *mrvWebServer) authQuery() string {
+	if self.authKey == "" {
+		return ""
+	}
+	return "?auth=" + url.QueryEscape(self.authKey)
+}
+
+// Finds the pipestance for an api request.  Api paths are of the form
+// <query>/<container>/<pname>/<psid>[/<file>], so the pipestance id is the
+// third element after the query.
+func (self *mrvWebServer) findPipestance(w http.ResponseWriter,
+	req *http.Request, query string) (*servedPipestance, string) {
+	if !self.verifyAuth(w, req) {
+		return nil, ""
+	}
+	parts := strings.SplitN(strings.Trim(
+		strings.TrimPrefix(req.URL.Path, query), "/"), "/", 4)
+	if len(parts) < 3 {
+		http.NotFound(w, req)
+		return nil, ""
+	}
+	ps := self.pipestances[parts[2]]
+	if ps == nil {
+		http.NotFound(w, req)
+		return nil, ""
+	}
+	if len(parts) > 3 {
+		return ps, parts[3]
+	}
+	return ps, ""
+}
+
+//=========================================================================
+// Web pages.
+//=========================================================================
+
+func (self *mrvWebServer) handleStatic(sm *http.ServeMux) {
+	res := http.FileServer(http.Dir(path.Join(self.webRoot, "serve")))
+	contentGzip := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		res.ServeHTTP(w, req)
+	}
+	sm.HandleFunc("/graph.js", contentGzip)
+	sm.HandleFunc("/favicon.ico", contentGzip)
+	sm.HandleFunc("/css/", contentGzip)
+	sm.HandleFunc("/js/", contentGzip)
+	sm.Handle("/fonts/", res)
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><title>Martian Pipestance Viewer</title>
+<link rel="stylesheet" href="/css/bootstrap.min.css">
+<link rel="icon" type="image/x-icon" href="/favicon.ico"></head>
+<body><div class="container"><h3>Pipestances</h3>
+<table class="table"><tr><th>ID</th><th>Pipeline</th><th>State</th><th>Started</th><th>Path</th></tr>
+{{range .}}<tr><td><a href="/pipestance/{{.PsId}}{{.Auth}}">{{.PsId}}</a></td>
+<td>{{.Pname}}</td><td>{{.State}}</td><td>{{.Start}}</td><td>{{.PsPath}}</td></tr>
+{{end}}</table></div></body></html>
+`))
+
+type indexEntry struct {
+	*api.PipestanceInfo
+	Auth string
+}
+
+func (self *mrvWebServer) serveIndex(w http.ResponseWriter, req *http.Request) {
+	if !self.verifyAuth(w, req) {
+		return
+	}
+	psids := make([]string, 0, len(self.pipestances))
+	for psid := range self.pipestances {
+		psids = append(psids, psid)
+	}
+	sort.Strings(psids)
+	entries := make([]indexEntry, 0, len(psids))
+	for _, psid := range psids {
+		ps := self.pipestances[psid]
+		info, err := ps.getInfo(req.Context())
+		if err != nil {
+			util.LogError(err, "mrv", "Could not read %s", ps.path)
+			info = &api.PipestanceInfo{
+				PsId:   psid,
+				PsPath: ps.path,
+				State:  core.MetadataState("unknown"),
+			}
+		}
+		entries = append(entries, indexEntry{info, self.authQuery()})
+	}
+	var buf bytes.Buffer
+	if err := indexTemplate.Execute(&buf, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(buf.Bytes())
+}
+
+func (self *mrvWebServer) serveGraphPage(w http.ResponseWriter, req *http.Request) {
+	if !self.verifyAuth(w, req) {
+		return
+	}
+	ps := self.pipestances[strings.Trim(
+		strings.TrimPrefix(req.URL.Path, "/pipestance/"), "/")]
+	if ps == nil {
+		http.NotFound(w, req)
+		return
+	}
+	info, err := ps.getInfo(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl, err := template.New("graph.html").Delims("[[", "]]").ParseFiles(
+		path.Join(self.webRoot, "templates", "graph.html"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &api.GraphPage{
+		InstanceName: "Martian Pipestance Viewer",
+		Container:    mrvContainer,
+		Pname:        info.Pname,
+		Psid:         ps.psid,
+		Release:      util.IsRelease(),
+		Auth:         self.authQuery(),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(buf.Bytes())
+}
+
+//=========================================================================
+// API endpoints.
+//=========================================================================
+
+func (self *mrvWebServer) handleApi(sm *http.ServeMux) {
+	sm.HandleFunc(api.QueryGetInfo+"/", self.getInfo)
+	sm.HandleFunc(api.QueryGetState+"/", self.getState)
+	sm.HandleFunc(api.QueryGetPerf+"/", self.getPerf)
+	sm.HandleFunc(api.QueryGetCriticalPath+"/", self.getCriticalPath)
+	sm.HandleFunc(api.QueryGetMetadata+"/", self.getMetadata)
+	sm.HandleFunc(api.QueryListMetadataTop+"/", self.listMetadataTop)
+	sm.HandleFunc(api.QueryGetMetadataTop, self.getMetadataTop)
+	sm.HandleFunc(api.QueryExtras, self.getExtras)
+	for _, query := range []string{api.QueryRestart, api.QueryRerun, api.QueryKill, api.QueryReload} {
+		sm.HandleFunc(query, readOnly)
+		sm.HandleFunc(query+"/", readOnly)
+	}
+}
+
+func readOnly(w http.ResponseWriter, req *http.Request) {
+	http.Error(w, "mrv is read-only.", http.StatusForbidden)
+}
+
+// Write a JSON response, compressing it if it's large.
+func writeJson(w http.ResponseWriter, req *http.Request, obj interface{}) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(b) < 4096 || !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+		w.Write(b)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	zipper, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	zipper.Write(b)
+	if err := zipper.Close(); err != nil {
+		// Can't use http.Error since the header was already set.
+		fmt.Fprintf(w, "\nzip error: %v", err)
+	}
+}
+
+func (self *mrvWebServer) getInfo(w http.ResponseWriter, req *http.Request) {
+	ps, _ := self.findPipestance(w, req, api.QueryGetInfo)
+	if ps == nil {
+		return
+	}
+	if info, err := ps.getInfo(req.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		writeJson(w, req, info)
+	}
+}
+
+func (self *mrvWebServer) getState(w http.ResponseWriter, req *http.Request) {
+	ps, _ := self.findPipestance(w, req, api.QueryGetState)
+	if ps == nil {
+		return
+	}
+	if state, err := ps.getState(req.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		writeJson(w, req, state)
+	}
+}
+
+func (self *mrvWebServer) getPerf(w http.ResponseWriter, req *http.Request) {
+	ps, _ := self.findPipestance(w, req, api.QueryGetPerf)
+	if ps == nil {
+		return
+	}
+	if perf, err := ps.getPerf(req.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		writeJson(w, req, &api.PerfInfo{Nodes: perf})
+	}
+}
+
+func (self *mrvWebServer) getCriticalPath(w http.ResponseWriter, req *http.Request) {
+	ps, _ := self.findPipestance(w, req, api.QueryGetCriticalPath)
+	if ps == nil {
+		return
+	}
+	var speedup float64
+	if s := req.FormValue("speedup"); s != "" {
+		var err error
+		if speedup, err = strconv.ParseFloat(s, 64); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	cores := 0
+	if s := req.FormValue("cores"); s != "" {
+		var err error
+		if cores, err = strconv.Atoi(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if report, err := ps.getCriticalPath(req.Context(), cores, speedup); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else {
+		writeJson(w, req, report)
+	}
+}
+
+func serveFile(w http.ResponseWriter, ps *servedPipestance, p string) {
+	data, err := ps.openMetadata(p)
+	if err != nil {
+		http.Error(w, "File not found.", http.StatusNotFound)
+		return
+	}
+	defer data.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.Copy(w, data)
+}
+
+func (self *mrvWebServer) getMetadata(w http.ResponseWriter, req *http.Request) {
+	// The body is read before findPipestance parses the form, since
+	// ParseForm would otherwise consume it.
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil || len(body) == 0 {
+		http.Error(w, "Request body is required.", http.StatusBadRequest)
+		return
+	}
+	ps, _ := self.findPipestance(w, req, api.QueryGetMetadata)
+	if ps == nil {
+		return
+	}
+	var form api.MetadataForm
+	if err := json.Unmarshal(body, &form); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serveFile(w, ps, path.Join(path.Clean(form.Path),
+		core.MetadataFilePrefix+path.Base(form.Name)))
+}
+
+func (self *mrvWebServer) listMetadataTop(w http.ResponseWriter, req *http.Request) {
+	ps, _ := self.findPipestance(w, req, api.QueryListMetadataTop)
+	if ps == nil {
+		return
+	}
+	if result, err := api.GetFilesListing(ps.path); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		writeJson(w, req, result)
+	}
+}
+
+func (self *mrvWebServer) getMetadataTop(w http.ResponseWriter, req *http.Request) {
+	ps, name := self.findPipestance(w, req, api.QueryGetMetadataTop)
+	if ps == nil {
+		return
+	}
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, req)
+		return
+	}
+	serveFile(w, ps, core.MetadataFilePrefix+name)
+}
+
+func (self *mrvWebServer) getExtras(w http.ResponseWriter, req *http.Request) {
+	ps, name := self.findPipestance(w, req, api.QueryExtras)
+	if ps == nil {
+		return
+	}
+	if name == "" || strings.Contains(name, "/") || name[0] == '.' {
+		http.NotFound(w, req)
+		return
+	}
+	http.ServeFile(w, req, path.Join(ps.path, "extras", name))
+}
+
+// Serve until the process is killed.
+func (self *mrvWebServer) serve(listener net.Listener) error {
+	server := &http.Server{
+		Handler:     self.handler(),
+		ReadTimeout: 5 * time.Second,
+		IdleTimeout: time.Minute,
+	}
+	server.ErrorLog, _ = util.GetLogger("webserv")
+	return server.Serve(listener)
+}
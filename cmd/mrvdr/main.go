@@ -0,0 +1,125 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian volatile disk recovery forecast tool.
+//
+// Given a completed pipestance which was run with VDR disabled, simulates
+// what rolling VDR would have deleted and when, in order to estimate the
+// storage savings before enabling it.  Nothing in the pipestance is deleted.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian VDR forecast.
+
+Usage:
+    mrvdr <pipestance_path> [options]
+    mrvdr -h | --help | --version
+
+Options:
+    --overrides=<json>  JSON file supplying custom stage overrides,
+                            e.g. force_volatile.
+    --timeline          Include the disk usage timeline in text output.
+    --json              Print the full report as JSON.
+
+    -h --help           Show this message.
+    --version           Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	psPath := opts["<pipestance_path>"].(string)
+	config := core.DefaultRuntimeOptions()
+	config.VdrMode = "disable"
+	if value := opts["--overrides"]; value != nil {
+		overrides, err := core.ReadOverrides(value.(string))
+		util.DieIf(err)
+		config.Overrides = overrides
+	}
+	rt := config.NewRuntime()
+
+	pipestance, err := rt.InspectPipestance(psPath, context.Background())
+	util.DieIf(err)
+
+	forecast := pipestance.ForecastVDR()
+	if opts["--json"].(bool) {
+		b, err := json.MarshalIndent(forecast, "", "    ")
+		util.DieIf(err)
+		os.Stdout.Write(b)
+		fmt.Println()
+	} else {
+		printForecast(forecast, opts["--timeline"].(bool))
+	}
+}
+
+func printForecast(forecast *core.VdrForecast, timeline bool) {
+	forks := make([]*core.VdrForecastFork, len(forecast.Forks))
+	copy(forks, forecast.Forks)
+	sort.SliceStable(forks, func(i, j int) bool {
+		return forks[i].ReclaimableBytes > forks[j].ReclaimableBytes
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tFORK\tVOLATILE\tTOTAL\tRECLAIMABLE\tDELETED AT")
+	for _, f := range forks {
+		killTime := "-"
+		if f.ReclaimableBytes > 0 {
+			killTime = f.KillTime.Format(util.TIMEFMT)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%s\t%s\t%s\n",
+			f.Name, f.Fork, f.Volatile,
+			humanize.Bytes(f.TotalBytes),
+			humanize.Bytes(f.ReclaimableBytes),
+			killTime)
+	}
+	tw.Flush()
+
+	fmt.Println()
+	fmt.Printf("Total output size:    %s\n", humanize.Bytes(forecast.TotalBytes))
+	fmt.Printf("Reclaimable by VDR:   %s\n", humanize.Bytes(forecast.ReclaimableBytes))
+	fmt.Printf("Peak usage, no VDR:   %s\n", humanize.Bytes(uint64(forecast.PeakBytes)))
+	fmt.Printf("Peak usage, with VDR: %s\n", humanize.Bytes(uint64(forecast.PeakBytesWithVdr)))
+
+	header := false
+	for _, f := range forecast.Forks {
+		for _, r := range f.Retained {
+			if !header {
+				fmt.Println()
+				fmt.Println("Retained outputs preventing deletion:")
+				header = true
+			}
+			fmt.Printf("    %s.fork%d %s (%s, %s in %d files)\n",
+				f.Name, f.Fork, r.Argument, r.Reason,
+				humanize.Bytes(r.Bytes), r.Count)
+		}
+	}
+
+	if timeline {
+		fmt.Println()
+		tw = tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tNO VDR\tWITH VDR\tEVENT")
+		for _, p := range forecast.Timeline {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+				p.Timestamp.Format(util.TIMEFMT),
+				humanize.Bytes(uint64(p.Bytes)),
+				humanize.Bytes(uint64(p.BytesWithVdr)),
+				p.Description)
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian output checksum verification tool.
+//
+// Verifies the output files of a pipestance which was run with checksums
+// enabled (mrp --checksum) against the recorded checksum manifests.  The
+// argument may be either the pipestance directory, in which case the outputs
+// of every stage are verified as well as the outs directory, or a copy of its
+// outs directory.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/core"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetPrintLogger(os.Stderr)
+	util.SetupSignalHandlers()
+	doc := `Martian output verifier.
+
+Usage:
+    mrverify <path> [--json]
+    mrverify -h | --help | --version
+
+Arguments:
+    path        A pipestance directory, or a copy of its outs directory.
+
+Options:
+    --json      Print mismatched files as JSON.
+    -h --help   Show this message.
+    --version   Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	outsPath := opts["<path>"].(string)
+	var psPath string
+	if _, err := os.Stat(path.Join(outsPath, core.ChecksumsFile.FileName())); os.IsNotExist(err) {
+		psPath = outsPath
+		outsPath = path.Join(outsPath, "outs")
+	}
+	manifest, err := core.ReadChecksumManifest(outsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not read checksum manifest:", err)
+		fmt.Fprintln(os.Stderr, "Was the pipestance run with --checksum?")
+		os.Exit(2)
+	}
+	mismatches, err := manifest.Verify(outsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	count := len(manifest.Files)
+	if psPath != "" {
+		for _, m := range mismatches {
+			m.Path = path.Join("outs", m.Path)
+		}
+		config := core.DefaultRuntimeOptions()
+		config.VdrMode = "disable"
+		pipestance, err := config.NewRuntime().InspectPipestance(psPath,
+			context.Background())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not read stage checksums:", err)
+			os.Exit(2)
+		}
+		stageCount, stageMismatches, err := pipestance.VerifyChecksums()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		count += stageCount
+		mismatches = append(mismatches, stageMismatches...)
+	}
+	if opts["--json"].(bool) {
+		if mismatches == nil {
+			mismatches = []*core.ChecksumMismatch{}
+		}
+		b, _ := json.MarshalIndent(mismatches, "", "    ")
+		os.Stdout.Write(b)
+		fmt.Println()
+	} else {
+		for _, m := range mismatches {
+			if m.Error != "" {
+				fmt.Printf("FAILED %s: %s\n", m.Path, m.Error)
+			} else {
+				fmt.Printf("FAILED %s: expected %s %s, found %s\n",
+					m.Path, manifest.Algorithm, m.Expected, m.Actual)
+			}
+		}
+		fmt.Printf("%d of %d files verified.\n",
+			count-len(mismatches), count)
+	}
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,5 +1,7 @@
 module github.com/martian-lang/martian
 
+go 1.27.1
+
 require (
 	github.com/cloudfoundry/gosigar v1.1.0
 	github.com/dustin/go-humanize v0.0.0-20180713052910-9f541cc9db5d
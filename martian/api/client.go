@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// Reads the UI url for the mrp instance running in the given pipestance
+// directory.  If control is true, the url includes the key required for
+// control actions such as restart and kill, if the current user is permitted
+// to read it.  Returns an error satisfying os.IsNotExist if mrp is not running
+// or the UI is disabled.
+func ReadMrpUrl(psPath string, control bool) (*url.URL, error) {
+	var b []byte
+	var err error
+	if control {
+		b, err = ioutil.ReadFile(path.Join(psPath, core.UiControl.FileName()))
+	}
+	if !control || err != nil {
+		if b, err = ioutil.ReadFile(path.Join(psPath, core.UiPort.FileName())); err != nil {
+			return nil, err
+		}
+	}
+	return url.Parse(strings.TrimSpace(string(b)))
+}
+
+// Returns an HTTP client for connecting to the mrp instance running in the
+// given pipestance directory.  If mrp is serving its UI over TLS, the client
+// trusts the certificate it recorded, in addition to the system roots.
+func MrpClient(psPath string) *http.Client {
+	b, err := ioutil.ReadFile(path.Join(psPath, core.UiCert.FileName()))
+	if err != nil {
+		return http.DefaultClient
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+}
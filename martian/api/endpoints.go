@@ -15,12 +15,24 @@ const (
 	// Gets information about a pipestance's performance.
 	QueryGetPerf = "/api/get-perf"
 
+	// Gets the critical path and scheduling efficiency of a pipestance.
+	QueryGetCriticalPath = "/api/get-critical-path"
+
 	// Get the contents of a specific metadata file.
 	QueryGetMetadata = "/api/get-metadata"
 
 	// Restarts a failed pipestance.
 	QueryRestart = "/api/restart"
 
+	// Resets a stage and everything downstream of it in a failed
+	// pipestance, and restarts it.  Without confirm=true, only lists the
+	// stages which would be reset.
+	QueryRerun = "/api/rerun"
+
+	// Reloads stage overrides and job manager configuration, and optionally
+	// changes resource limits.
+	QueryReload = "/api/reload"
+
 	// Get the contents of a pipestance's top-level metadata.
 	QueryGetMetadataTop = "/api/get-metadata-top/"
 
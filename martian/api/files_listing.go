@@ -2,6 +2,7 @@ package api
 
 import (
 	"io/ioutil"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -27,6 +28,12 @@ func fileOnWhitelist(f core.MetadataFileName) bool {
 	}
 }
 
+// Returns true if the given metadata file should never be served through the
+// API, because it contains credentials.
+func IsPrivateMetadata(p string) bool {
+	return path.Base(p) == core.UiControl.FileName()
+}
+
 func GetFilesListing(psdir string) (*FilesListing, error) {
 	if allfiles, err := util.Readdirnames(psdir); err != nil {
 		return nil, err
@@ -0,0 +1,152 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/core"
+)
+
+// Events for which webhooks may be sent.
+const (
+	// The pipestance completed successfully.
+	EventComplete = "complete"
+
+	// The pipestance failed, and will not be retried automatically.
+	EventFailed = "failed"
+
+	// A stage failed.  The pipestance may still be retried.
+	EventStageFailed = "stage_failed"
+
+	// A failed pipestance is being retried automatically.
+	EventRetry = "retry"
+
+	// A stage raised an alarm.
+	EventAlarm = "alarm"
+)
+
+// The HTTP headers set on webhook requests.
+const (
+	WebhookEventHeader     = "X-Martian-Event"
+	WebhookSignatureHeader = "X-Martian-Signature"
+)
+
+// The JSON body sent to webhooks.
+type WebhookPayload struct {
+	Event      string          `json:"event"`
+	Timestamp  string          `json:"timestamp"`
+	Pipestance *PipestanceInfo `json:"pipestance"`
+
+	// The stage which failed or raised an alarm.
+	Stage string `json:"stage,omitempty"`
+
+	// For failures, the errors from each failed stage.
+	Errors []*core.NodeErrorInfo `json:"errors,omitempty"`
+
+	// The text of a new alarm, or the error which triggered a retry.
+	Message string `json:"message,omitempty"`
+}
+
+// The configuration for a webhook endpoint.
+type WebhookConfig struct {
+	Url string `json:"url"`
+
+	// The events to send.  If empty, all events are sent.
+	Events []string `json:"events,omitempty"`
+
+	// The name of an environment variable holding the key used to sign
+	// requests.  The key is not put in the configuration file itself, so
+	// that the file can be shared.
+	SecretEnv string `json:"secret_env,omitempty"`
+
+	// The maximum number of times to attempt delivery.  Defaults to 5.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	// The timeout for each attempt, in seconds.  Defaults to 30.
+	TimeoutSecs int `json:"timeout_secs,omitempty"`
+
+	secret []byte
+}
+
+// Returns true if this webhook should receive the given event.
+func (self *WebhookConfig) Wants(event string) bool {
+	if len(self.Events) == 0 {
+		return true
+	}
+	for _, e := range self.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// The key used to sign requests, or nil if they are not signed.
+func (self *WebhookConfig) Secret() []byte {
+	return self.secret
+}
+
+// Read a webhook configuration file, which contains a JSON list of
+// WebhookConfig objects.
+func ReadWebhookConfig(fn string) ([]*WebhookConfig, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []*WebhookConfig
+	if err := json.Unmarshal(b, &hooks); err != nil {
+		return nil, fmt.Errorf("Invalid webhook configuration %s: %v", fn, err)
+	}
+	for _, hook := range hooks {
+		if !strings.HasPrefix(hook.Url, "http://") &&
+			!strings.HasPrefix(hook.Url, "https://") {
+			return nil, fmt.Errorf("Invalid webhook url %q", hook.Url)
+		}
+		for _, event := range hook.Events {
+			switch event {
+			case EventComplete, EventFailed, EventStageFailed,
+				EventRetry, EventAlarm:
+			default:
+				return nil, fmt.Errorf("Unknown webhook event %q", event)
+			}
+		}
+		if hook.SecretEnv != "" {
+			secret := os.Getenv(hook.SecretEnv)
+			if secret == "" {
+				return nil, fmt.Errorf(
+					"Webhook secret environment variable %s is not set",
+					hook.SecretEnv)
+			}
+			hook.secret = []byte(secret)
+		}
+		if hook.MaxAttempts <= 0 {
+			hook.MaxAttempts = 5
+		}
+		if hook.TimeoutSecs <= 0 {
+			hook.TimeoutSecs = 30
+		}
+	}
+	return hooks, nil
+}
+
+// Compute the value of the signature header for a request body.
+func SignWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check the signature header for a webhook request body.
+func VerifyWebhook(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
@@ -98,7 +98,7 @@ func checkType(val json.RawMessage, typename string, arrayDim int,
 			} else {
 				return true, ""
 			}
-		case "path", "file", "string":
+		case "path", "file", "string", "secret":
 			var v string
 			if err := json.Unmarshal(val, &v); err != nil {
 				return truncateMessage(val, "a string")
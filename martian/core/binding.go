@@ -200,6 +200,9 @@ func (self *Binding) serializeState(argPermute map[string]interface{}, readSize
 		}
 	}
 	v, err := self.resolve(argPermute, readSize)
+	if self.tname == syntax.KindSecret {
+		v = redactSecretValue(v)
+	}
 	return &BindingInfo{
 		Id:          self.id,
 		Type:        self.tname,
@@ -0,0 +1,322 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Checksums for pipeline output files.
+//
+// When enabled, the file outputs of each stage fork are checksummed when the
+// fork completes, and recorded in the fork metadata relative to the fork
+// directory.  The outputs of each top-level fork are also checksummed after
+// they are moved into the outs directory, and collected into a manifest in
+// the outs directory, so that a copy of the outs directory can be verified
+// independently of the pipestance.
+//
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const disableChecksum = "disable"
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+func VerifyChecksumAlgorithm(algorithm string) {
+	if algorithm == disableChecksum {
+		return
+	} else if _, ok := checksumAlgorithms[algorithm]; ok {
+		return
+	}
+	validModes := make([]string, 0, len(checksumAlgorithms)+1)
+	validModes = append(validModes, disableChecksum)
+	for alg := range checksumAlgorithms {
+		validModes = append(validModes, alg)
+	}
+	sort.Strings(validModes[1:])
+	util.PrintInfo("runtime", "Invalid checksum algorithm: %s. Valid algorithms: %s",
+		algorithm, strings.Join(validModes, ", "))
+	os.Exit(1)
+}
+
+// The checksum of a single output file.
+type ChecksumEntry struct {
+	// The output parameter which produced the file.
+	Param string `json:"param"`
+
+	// The path to the file, relative to the outs directory.
+	Path string `json:"path"`
+
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// A set of output file checksums.
+type ChecksumManifest struct {
+	Algorithm string           `json:"algorithm"`
+	Files     []*ChecksumEntry `json:"files"`
+}
+
+// A file which failed checksum verification.
+type ChecksumMismatch struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func checksumFile(fpath string, newHash func() hash.Hash) (string, int64, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := newHash()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", n, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// Add checksums for the file or directory at fpath, which must be inside
+// outsPath.
+func (self *ChecksumManifest) add(outsPath, param, fpath string) error {
+	newHash := checksumAlgorithms[self.Algorithm]
+	if newHash == nil {
+		return fmt.Errorf("Unsupported checksum algorithm %s", self.Algorithm)
+	}
+	// Resolve the top-level path, which might be a symlink to a file
+	// outside of the pipestance.
+	root := fpath
+	if resolved, err := filepath.EvalSymlinks(fpath); err == nil {
+		root = resolved
+	}
+	return util.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel, err = filepath.Rel(outsPath, filepath.Join(fpath, rel))
+		if err != nil {
+			return err
+		}
+		digest, size, err := checksumFile(p, newHash)
+		if err != nil {
+			return err
+		}
+		self.Files = append(self.Files, &ChecksumEntry{
+			Param:  param,
+			Path:   rel,
+			Size:   size,
+			Digest: digest,
+		})
+		return nil
+	})
+}
+
+// Verify re-computes the checksums for files in the manifest, relative to
+// the given outs directory, and returns the files which do not match.
+func (self *ChecksumManifest) Verify(outsPath string) ([]*ChecksumMismatch, error) {
+	newHash := checksumAlgorithms[self.Algorithm]
+	if newHash == nil {
+		return nil, fmt.Errorf("Unsupported checksum algorithm %s", self.Algorithm)
+	}
+	var mismatches []*ChecksumMismatch
+	for _, entry := range self.Files {
+		digest, size, err := checksumFile(filepath.Join(outsPath, entry.Path), newHash)
+		if err != nil {
+			mismatches = append(mismatches, &ChecksumMismatch{
+				Path:     entry.Path,
+				Expected: entry.Digest,
+				Error:    err.Error(),
+			})
+		} else if digest != entry.Digest || size != entry.Size {
+			mismatches = append(mismatches, &ChecksumMismatch{
+				Path:     entry.Path,
+				Expected: entry.Digest,
+				Actual:   digest,
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+// ReadChecksumManifest reads the checksum manifest from an outs directory.
+func ReadChecksumManifest(outsPath string) (*ChecksumManifest, error) {
+	var manifest ChecksumManifest
+	md := NewMetadata("", outsPath)
+	if err := md.ReadInto(ChecksumsFile, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Compute checksums for file outputs of the fork and record them in the fork
+// metadata.  Paths in the manifest are relative to basePath, and outPaths is
+// the mapping from parameter id to output path.
+func (self *Fork) writeChecksums(basePath string, outPaths map[string]string) error {
+	algorithm := self.node.rt.Config.ChecksumAlgorithm
+	if algorithm == "" || algorithm == disableChecksum {
+		return nil
+	}
+	manifest := ChecksumManifest{Algorithm: algorithm}
+	params := make([]string, 0, len(outPaths))
+	for param := range outPaths {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	var errs []string
+	for _, param := range params {
+		if err := manifest.add(basePath, param, outPaths[param]); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := self.metadata.Write(ChecksumsFile, &manifest); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return &util.MartianError{Msg: strings.Join(errs, "\n")}
+	}
+	return nil
+}
+
+// Compute checksums for the file outputs of a completed stage fork, relative
+// to the fork directory.
+func (self *Fork) writeStageChecksums(outs LazyArgumentMap) error {
+	algorithm := self.node.rt.Config.ChecksumAlgorithm
+	if algorithm == "" || algorithm == disableChecksum {
+		return nil
+	}
+	outPaths := make(map[string]string)
+	for _, param := range self.OutParams().List {
+		if !param.IsFile() {
+			continue
+		}
+		var p string
+		if raw, ok := outs[param.GetId()]; !ok || json.Unmarshal(raw, &p) != nil || p == "" {
+			continue
+		}
+		if _, err := os.Lstat(p); err == nil {
+			outPaths[param.GetId()] = p
+		}
+	}
+	if len(outPaths) == 0 {
+		return nil
+	}
+	return self.writeChecksums(self.metadata.path, outPaths)
+}
+
+// VerifyChecksums re-computes the checksums recorded for each completed stage
+// fork.  It returns the number of files checked and the files which do not
+// match, with paths relative to the pipestance directory.
+func (self *Pipestance) VerifyChecksums() (int, []*ChecksumMismatch, error) {
+	count := 0
+	var mismatches []*ChecksumMismatch
+	for _, node := range self.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		for _, fork := range node.forks {
+			if !fork.metadata.exists(ChecksumsFile) {
+				continue
+			}
+			var manifest ChecksumManifest
+			if err := fork.metadata.ReadInto(ChecksumsFile, &manifest); err != nil {
+				return count, mismatches, err
+			}
+			forkMismatches, err := manifest.Verify(fork.metadata.path)
+			if err != nil {
+				return count, mismatches, err
+			}
+			count += len(manifest.Files)
+			killed := fork.vdrKilledPaths()
+			for _, m := range forkMismatches {
+				if m.Error != "" && wasKilled(killed,
+					filepath.Join(fork.metadata.path, m.Path)) {
+					// Deleted by VDR, not corrupted.
+					count--
+					continue
+				}
+				if rel, err := filepath.Rel(self.GetPath(),
+					filepath.Join(fork.metadata.path, m.Path)); err == nil {
+					m.Path = rel
+				}
+				mismatches = append(mismatches, m)
+			}
+		}
+	}
+	return count, mismatches, nil
+}
+
+// Get the set of paths which VDR has deleted from the fork.
+func (self *Fork) vdrKilledPaths() map[string]struct{} {
+	killed := make(map[string]struct{})
+	if report, ok := self.getVdrKillReport(); ok {
+		for _, p := range report.Paths {
+			killed[p] = struct{}{}
+		}
+	}
+	if report := self.getPartialKillReport(); report != nil {
+		for _, p := range report.Paths {
+			killed[p] = struct{}{}
+		}
+	}
+	return killed
+}
+
+// Returns true if fpath, or a directory containing it, was deleted by VDR.
+func wasKilled(killed map[string]struct{}, fpath string) bool {
+	for p := fpath; len(p) > 1; p = filepath.Dir(p) {
+		if _, ok := killed[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect the checksums for all forks of the top-level pipeline into a single
+// manifest in the outs directory.
+func (self *Pipestance) writeChecksumManifest() error {
+	algorithm := self.node.rt.Config.ChecksumAlgorithm
+	if algorithm == "" || algorithm == disableChecksum {
+		return nil
+	}
+	manifest := ChecksumManifest{Algorithm: algorithm}
+	for _, fork := range self.node.forks {
+		var forkManifest ChecksumManifest
+		if err := fork.metadata.ReadInto(ChecksumsFile, &forkManifest); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		manifest.Files = append(manifest.Files, forkManifest.Files...)
+	}
+	md := NewMetadata("", filepath.Join(self.GetPath(), "outs"))
+	return md.WriteAtomic(ChecksumsFile, &manifest)
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestChecksumManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testChecksumManifest")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	outs := path.Join(dir, "outs")
+	external := path.Join(dir, "external.txt")
+	os.MkdirAll(path.Join(outs, "things"), 0755)
+	ioutil.WriteFile(path.Join(outs, "single.txt"), []byte("hello\n"), 0644)
+	ioutil.WriteFile(path.Join(outs, "things", "a"), []byte("a"), 0644)
+	ioutil.WriteFile(path.Join(outs, "things", "b"), []byte("b"), 0644)
+	ioutil.WriteFile(external, []byte("outside"), 0644)
+	os.Symlink(external, path.Join(outs, "link.txt"))
+
+	manifest := ChecksumManifest{Algorithm: "sha256"}
+	for param, p := range map[string]string{
+		"single": "single.txt",
+		"things": "things",
+		"link":   "link.txt",
+	} {
+		if err := manifest.add(outs, param, path.Join(outs, p)); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(manifest.Files) != 4 {
+		t.Fatalf("Expected 4 files, got %d", len(manifest.Files))
+	}
+	for _, entry := range manifest.Files {
+		switch entry.Path {
+		case "single.txt":
+			if entry.Digest != "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" {
+				t.Errorf("Incorrect digest %s for %s", entry.Digest, entry.Path)
+			}
+			if entry.Size != 6 {
+				t.Errorf("Incorrect size %d for %s", entry.Size, entry.Path)
+			}
+		case "things/a", "things/b":
+			if entry.Param != "things" {
+				t.Errorf("Incorrect param %s for %s", entry.Param, entry.Path)
+			}
+		case "link.txt":
+			if entry.Size != 7 {
+				t.Errorf("Incorrect size %d for %s", entry.Size, entry.Path)
+			}
+		default:
+			t.Errorf("Unexpected path %s", entry.Path)
+		}
+	}
+
+	if mismatches, err := manifest.Verify(outs); err != nil {
+		t.Error(err)
+	} else if len(mismatches) != 0 {
+		t.Errorf("Expected no mismatches, got %d", len(mismatches))
+	}
+	ioutil.WriteFile(path.Join(outs, "things", "a"), []byte("c"), 0644)
+	os.Remove(path.Join(outs, "single.txt"))
+	if mismatches, err := manifest.Verify(outs); err != nil {
+		t.Error(err)
+	} else if len(mismatches) != 2 {
+		t.Errorf("Expected 2 mismatches, got %d", len(mismatches))
+	} else {
+		for _, m := range mismatches {
+			if m.Path == "single.txt" && m.Error == "" {
+				t.Error("Expected an error for missing file.")
+			} else if m.Path == "things/a" && m.Actual == "" {
+				t.Error("Expected a digest for changed file.")
+			}
+		}
+	}
+}
+
+func TestStageChecksums(t *testing.T) {
+	ps, cleanup := invokeProduceConsume(t)
+	defer cleanup()
+	ps.node.rt.Config.ChecksumAlgorithm = "sha256"
+	fork := ps.node.find(ps.GetFQName() + ".PRODUCE").forks[0]
+	if err := os.MkdirAll(fork.metadata.FilesPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := fork.metadata.FilePath("data")
+	ioutil.WriteFile(data, []byte("hello\n"), 0644)
+	outs, err := ParseStageArgs([]byte(`{"data": "` + data + `", "kept": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.writeStageChecksums(outs); err != nil {
+		t.Fatal(err)
+	}
+	if count, mismatches, err := ps.VerifyChecksums(); err != nil {
+		t.Error(err)
+	} else if count != 1 || len(mismatches) != 0 {
+		t.Errorf("Expected 1 file to verify, got %d with %d mismatches",
+			count, len(mismatches))
+	}
+	ioutil.WriteFile(data, []byte("goodbye\n"), 0644)
+	if _, mismatches, err := ps.VerifyChecksums(); err != nil {
+		t.Error(err)
+	} else if len(mismatches) != 1 {
+		t.Errorf("Expected 1 mismatch, got %d", len(mismatches))
+	} else if expect := "PIPE/PRODUCE/fork0/files/data"; mismatches[0].Path != expect {
+		t.Errorf("Expected mismatch for %s, got %s", expect, mismatches[0].Path)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Comparison of the outputs and performance of two pipestances.
+//
+// Nodes are paired with MapTwoPipestances.  Output values are compared after
+// removing the pipestance path and job uniquifiers from any paths they
+// contain, and file outputs are compared by checksum, so that two runs of a
+// pipeline on the same inputs compare equal even though they ran in
+// different directories.
+//
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The comparison of one output parameter of a fork.
+type OutputComparison struct {
+	Param string `json:"param"`
+	File  bool   `json:"file,omitempty"`
+
+	// The output values, with paths made relative to the pipestance.
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+
+	// Checksums of file outputs.
+	OldDigest string `json:"old_digest,omitempty"`
+	NewDigest string `json:"new_digest,omitempty"`
+
+	// Also set if the output could not be compared, since it is not known
+	// to be unchanged.
+	Changed bool `json:"changed"`
+
+	// Set if a file output could not be read, for example because it was
+	// removed by volatile data removal.
+	Error string `json:"error,omitempty"`
+}
+
+// The comparison of one fork of a stage.
+type ForkComparison struct {
+	Index    int           `json:"index"`
+	OldState MetadataState `json:"old_state"`
+	NewState MetadataState `json:"new_state"`
+
+	Outputs []*OutputComparison `json:"outputs"`
+
+	// Wall time in seconds and peak memory in MB, over all of the fork's
+	// jobs.
+	OldWallTime float64 `json:"old_wall_seconds"`
+	NewWallTime float64 `json:"new_wall_seconds"`
+	OldMaxRssMB int     `json:"old_maxrss_mb"`
+	NewMaxRssMB int     `json:"new_maxrss_mb"`
+}
+
+// Returns true if any output of the fork changed.
+func (self *ForkComparison) Changed() bool {
+	for _, out := range self.Outputs {
+		if out.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// The comparison of a stage which is present in both pipestances.
+type StageComparison struct {
+	// The stage name, without the ID.<psid> prefix.
+	Stage string `json:"stage"`
+
+	Forks []*ForkComparison `json:"forks"`
+
+	// True if any output of any fork changed.
+	Changed bool `json:"changed"`
+
+	// Set if the two pipestances have different numbers of forks of the
+	// stage.  Only the forks present in both are compared.
+	OldForks int `json:"old_forks,omitempty"`
+	NewForks int `json:"new_forks,omitempty"`
+}
+
+type PipestanceComparison struct {
+	Stages []*StageComparison `json:"stages"`
+
+	// Stages which are only in the new or old pipestance.
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+
+	// The number of stages with changed outputs.
+	ChangedStages int `json:"changed_stages"`
+
+	OldWallTime float64 `json:"old_wall_seconds"`
+	NewWallTime float64 `json:"new_wall_seconds"`
+}
+
+// ComparePipestances pairs the stages of two pipestances by name, and
+// compares their outputs and performance.  It is an error if none of the
+// stages can be paired.
+func ComparePipestances(newp, oldp *Pipestance) (*PipestanceComparison, error) {
+	result := &PipestanceComparison{
+		Stages:      []*StageComparison{},
+		Added:       []string{},
+		Removed:     []string{},
+		OldWallTime: oldp.wallTime(),
+		NewWallTime: newp.wallTime(),
+	}
+	nodeMap, err := MapTwoPipestances(newp, oldp)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[*Node]bool, len(nodeMap))
+	for _, node := range newp.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		old := nodeMap[node]
+		if old == nil {
+			result.Added = append(result.Added, partiallyQualifiedName(node.fqname))
+			continue
+		}
+		matched[old] = true
+		stage := compareStages(node, old, newp.GetPath(), oldp.GetPath())
+		if stage.Changed {
+			result.ChangedStages++
+		}
+		result.Stages = append(result.Stages, stage)
+	}
+	for _, node := range oldp.allNodes() {
+		if node.kind == "stage" && !matched[node] {
+			result.Removed = append(result.Removed, partiallyQualifiedName(node.fqname))
+		}
+	}
+	sort.Strings(result.Removed)
+	return result, nil
+}
+
+// The wall time of the pipestance so far, in seconds.
+func (self *Pipestance) wallTime() float64 {
+	perf, _ := self.node.serializePerf()
+	if len(perf.Forks) == 0 || perf.Forks[0].ForkStats == nil {
+		return 0
+	}
+	return perf.Forks[0].ForkStats.WallTime
+}
+
+func compareStages(newNode, oldNode *Node, newRoot, oldRoot string) *StageComparison {
+	stage := &StageComparison{
+		Stage: partiallyQualifiedName(newNode.fqname),
+	}
+	if len(newNode.forks) != len(oldNode.forks) {
+		stage.OldForks = len(oldNode.forks)
+		stage.NewForks = len(newNode.forks)
+	}
+	newPerf, _ := newNode.serializePerf()
+	oldPerf, _ := oldNode.serializePerf()
+	for i, newFork := range newNode.forks {
+		if i >= len(oldNode.forks) {
+			break
+		}
+		oldFork := oldNode.forks[i]
+		fork := &ForkComparison{
+			Index:    i,
+			OldState: oldFork.getState(),
+			NewState: newFork.getState(),
+			Outputs:  compareOutputs(newFork, oldFork, newRoot, oldRoot),
+		}
+		if stats := oldPerf.Forks[i].ForkStats; stats != nil {
+			fork.OldWallTime = stats.WallTime
+			fork.OldMaxRssMB = stats.MaxRss / 1024
+		}
+		if stats := newPerf.Forks[i].ForkStats; stats != nil {
+			fork.NewWallTime = stats.WallTime
+			fork.NewMaxRssMB = stats.MaxRss / 1024
+		}
+		if fork.Changed() {
+			stage.Changed = true
+		}
+		stage.Forks = append(stage.Forks, fork)
+	}
+	return stage
+}
+
+func compareOutputs(newFork, oldFork *Fork, newRoot, oldRoot string) []*OutputComparison {
+	var newOuts, oldOuts map[string]interface{}
+	if newFork.metadata.exists(OutsFile) {
+		newFork.metadata.ReadInto(OutsFile, &newOuts)
+	}
+	if oldFork.metadata.exists(OutsFile) {
+		oldFork.metadata.ReadInto(OutsFile, &oldOuts)
+	}
+	params := newFork.OutParams().List
+	result := make([]*OutputComparison, 0, len(params))
+	for _, param := range params {
+		id := param.GetId()
+		newValue, oldValue := newOuts[id], oldOuts[id]
+		out := &OutputComparison{
+			Param: id,
+			File:  param.IsFile(),
+			Old:   relativizeOutput(oldValue, oldRoot),
+			New:   relativizeOutput(newValue, newRoot),
+		}
+		if newPath, ok := newValue.(string); ok && out.File {
+			if oldPath, ok := oldValue.(string); ok {
+				var err error
+				if out.OldDigest, err = checksumPath(oldPath); err != nil {
+					out.Error = err.Error()
+				} else if out.NewDigest, err = checksumPath(newPath); err != nil {
+					out.Error = err.Error()
+				}
+				out.Changed = out.Error != "" || out.OldDigest != out.NewDigest
+			} else {
+				out.Changed = true
+			}
+		} else {
+			out.Changed = !reflect.DeepEqual(out.Old, out.New)
+		}
+		result = append(result, out)
+	}
+	return result
+}
+
+// Matches the uniquifier suffix on a job directory, e.g. chnk0-u39ced5d9dd.
+var uniquifierRe = regexp.MustCompile(`-u[0-9a-f]{10}(/|$)`)
+
+// Make paths in an output value relative to the pipestance root, and strip
+// job uniquifiers from them.
+func relativizeOutput(value interface{}, root string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, root+"/") {
+			return uniquifierRe.ReplaceAllString(v[len(root)+1:], "$1")
+		}
+		return v
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = relativizeOutput(elem, root)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			result[key] = relativizeOutput(elem, root)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// Compute a checksum of a file, or of the names and contents of all of the
+// files in a directory.
+func checksumPath(p string) (string, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		digest, _, err := checksumFile(p, sha256.New)
+		return digest, err
+	}
+	h := sha256.New()
+	err = filepath.Walk(p, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(fpath); err != nil {
+				return err
+			} else if target.IsDir() {
+				return nil
+			}
+		}
+		digest, _, err := checksumFile(fpath, sha256.New)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(p, fpath)
+		h.Write([]byte(rel + "\x00" + digest + "\n"))
+		return nil
+	})
+	return hex.EncodeToString(h.Sum(nil)), err
+}
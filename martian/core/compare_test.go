@@ -0,0 +1,165 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestRelativizeOutput(t *testing.T) {
+	root := "/data/ps1"
+	value := map[string]interface{}{
+		"count": 3.0,
+		"file":  root + "/PIPE/STAGE/fork0/chnk0-u39ced5d9dd/files/out.txt",
+		"list": []interface{}{
+			root + "/PIPE/STAGE/fork0/join-u39ced5d9de/files/a.txt",
+			"/elsewhere/b.txt",
+		},
+	}
+	expect := map[string]interface{}{
+		"count": 3.0,
+		"file":  "PIPE/STAGE/fork0/chnk0/files/out.txt",
+		"list": []interface{}{
+			"PIPE/STAGE/fork0/join/files/a.txt",
+			"/elsewhere/b.txt",
+		},
+	}
+	if v := relativizeOutput(value, root); !reflect.DeepEqual(v, expect) {
+		t.Errorf("Expected %v, got %v", expect, v)
+	}
+}
+
+func TestChecksumPath(t *testing.T) {
+	d, err := ioutil.TempDir("", "compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	write := func(name, content string) {
+		t.Helper()
+		p := path.Join(d, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a/x.txt", "x")
+	write("a/sub/y.txt", "y")
+	write("b/x.txt", "x")
+	write("b/sub/y.txt", "y")
+	write("c/x.txt", "x")
+	write("c/sub/y.txt", "z")
+	sum := func(name string) string {
+		t.Helper()
+		s, err := checksumPath(path.Join(d, name))
+		if err != nil {
+			t.Error(err)
+		}
+		return s
+	}
+	if sum("a") != sum("b") {
+		t.Error("Expected identical directories to match.")
+	}
+	if sum("a") == sum("c") {
+		t.Error("Expected different directories not to match.")
+	}
+	if sum("a/x.txt") != sum("c/x.txt") {
+		t.Error("Expected identical files to match.")
+	}
+	if _, err := checksumPath(path.Join(d, "missing")); err == nil {
+		t.Error("Expected an error for a missing file.")
+	}
+}
+
+func planCompare(t *testing.T, src, psid string) (*Pipestance, func()) {
+	t.Helper()
+	d, err := ioutil.TempDir("", "compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, cleanup := testRuntime(t)
+	ps, err := rt.PlanPipeline(src, path.Join(d, "src.mro"), psid,
+		path.Join(d, psid), nil, "1.0.0", make(map[string]string))
+	if err != nil {
+		cleanup()
+		os.RemoveAll(d)
+		t.Fatal(err)
+	}
+	return ps, func() {
+		cleanup()
+		os.RemoveAll(d)
+	}
+}
+
+const compareSrc = `
+filetype txt;
+
+stage MAKE(
+    in  float value,
+    out txt result,
+    src exec "stages/make",
+)
+
+pipeline COMPARE(
+    out txt result,
+)
+{
+    call MAKE(
+        value = 1.0,
+    )
+
+    return (
+        result = MAKE.result,
+    )
+}
+
+call COMPARE()
+`
+
+func TestCompareUnreadableOutput(t *testing.T) {
+	oldp, cleanupOld := planCompare(t, compareSrc, "old")
+	defer cleanupOld()
+	newp, cleanupNew := planCompare(t, compareSrc, "new")
+	defer cleanupNew()
+	for _, ps := range []*Pipestance{oldp, newp} {
+		node := ps.node.find("ID." + ps.GetPsid() + ".COMPARE.MAKE")
+		if err := node.mkdirs(); err != nil {
+			t.Fatal(err)
+		}
+		result := path.Join(node.path, "result.txt")
+		if ps == newp {
+			if err := ioutil.WriteFile(result, []byte("x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		node.forks[0].metadata.Write(OutsFile,
+			map[string]interface{}{"result": result})
+	}
+	result, err := ComparePipestances(newp, oldp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Stages) != 1 || len(result.Stages[0].Forks) != 1 {
+		t.Fatalf("Expected one stage with one fork, got %v", result.Stages)
+	}
+	out := result.Stages[0].Forks[0].Outputs[0]
+	if out.Error == "" || !out.Changed || !result.Stages[0].Changed {
+		t.Errorf("Expected the missing output to be reported as changed, got %v", out)
+	}
+}
+
+func TestCompareUnrelated(t *testing.T) {
+	oldp, cleanupOld := planCompare(t, compareSrc, "old")
+	defer cleanupOld()
+	newp, cleanupNew := planPartialRun(t)
+	defer cleanupNew()
+	if _, err := ComparePipestances(newp, oldp); err == nil {
+		t.Error("Expected an error comparing unrelated pipestances.")
+	}
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Running stage code inside container images.
+//
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"golang.org/x/sys/unix"
+)
+
+// ContainerConfig defines how to run stage code in a container image, using
+// an OCI runtime such as podman or singularity.  It is read from the
+// "container" section of the job manager config.json.
+//
+// The runtime command is mrjob's child process, so it must pass file
+// descriptors 3 and 4, which the adapters use for the log and for reporting
+// errors, through to the stage code (e.g. podman --preserve-fds=2).  Memory
+// monitoring and rusage only account for processes which are descendants of
+// mrjob, so they may be inaccurate for runtimes which start the container
+// through a daemon.
+type ContainerConfig struct {
+	// The runtime command.
+	Command string `json:"cmd"`
+
+	// The arguments to give the runtime before the image.  ${WORKDIR} expands
+	// to the job's working directory, and ${UID} and ${GID} to the user and
+	// group mrjob is running as.
+	Args []string `json:"args,omitempty"`
+
+	// The arguments to add for each path which is bind-mounted into the
+	// container, at the same location.  ${MOUNT} expands to the path.
+	MountArgs []string `json:"mount_args,omitempty"`
+
+	// The arguments to add for each environment variable which is passed
+	// through to the container.  ${ENV} expands to the name of the variable,
+	// and ${VALUE} to its value.
+	EnvArgs []string `json:"env_args,omitempty"`
+
+	// The arguments to add for each resource limit which is passed through
+	// to the container.  ${RLIMIT} expands to the name of the limit (nofile
+	// or nproc), and ${SOFT} and ${HARD} to its values, with -1 meaning
+	// unlimited.
+	RlimitArgs []string `json:"rlimit_args,omitempty"`
+}
+
+// ContainerInfo is recorded in a job's _jobinfo to tell mrjob to run the
+// stage code in a container.
+type ContainerInfo struct {
+	// The container image.
+	Image string `json:"image"`
+
+	// The runtime to use, from the job manager config.
+	Runtime *ContainerConfig `json:"runtime"`
+
+	// The paths to bind-mount into the container.
+	Mounts []string `json:"mounts,omitempty"`
+
+	// The names of the environment variables to pass through.
+	Env []string `json:"env,omitempty"`
+}
+
+// The resource limits which are passed through to the container, in the
+// order their arguments are added.
+var containerRlimits = [...]struct {
+	name string
+	get  func() (*unix.Rlimit, error)
+}{
+	{"nofile", GetMaxFiles},
+	{"nproc", GetMaxProcs},
+}
+
+func formatRlimit(v uint64) string {
+	if v == unix.RLIM_INFINITY {
+		return "-1"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// Command returns the command line which runs the given command in the
+// container, using mrjob's working directory, environment, and resource
+// limits.
+func (self *ContainerInfo) Command(args []string) ([]string, error) {
+	rt := self.Runtime
+	if rt == nil || rt.Command == "" {
+		return nil, fmt.Errorf("No container runtime is configured.")
+	}
+	if self.Image == "" {
+		return nil, fmt.Errorf("No container image was given.")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, 0, 2+len(rt.Args)+len(args)+
+		len(self.Mounts)*len(rt.MountArgs)+
+		len(self.Env)*len(rt.EnvArgs)+
+		2*len(rt.RlimitArgs))
+	cmd = append(cmd, rt.Command)
+	expand := func(templates []string, replacements ...string) {
+		r := strings.NewReplacer(replacements...)
+		for _, arg := range templates {
+			cmd = append(cmd, r.Replace(arg))
+		}
+	}
+	expand(rt.Args,
+		"${WORKDIR}", wd,
+		"${UID}", strconv.Itoa(os.Getuid()),
+		"${GID}", strconv.Itoa(os.Getgid()))
+	for _, mount := range self.Mounts {
+		expand(rt.MountArgs, "${MOUNT}", mount)
+	}
+	for _, name := range self.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			expand(rt.EnvArgs, "${ENV}", name, "${VALUE}", value)
+		}
+	}
+	if len(rt.RlimitArgs) > 0 {
+		for _, limit := range containerRlimits {
+			if rlim, err := limit.get(); err != nil {
+				return nil, err
+			} else {
+				expand(rt.RlimitArgs,
+					"${RLIMIT}", limit.name,
+					"${SOFT}", formatRlimit(rlim.Cur),
+					"${HARD}", formatRlimit(rlim.Max))
+			}
+		}
+	}
+	cmd = append(cmd, self.Image)
+	return append(cmd, args...), nil
+}
+
+// Get the container to run a job's stage code in, if any.  The pipestance,
+// the mro path, the stage code and adapters, and any inputs outside of the
+// pipestance are mounted into the container.
+//
+// Only the thread limiting variables, TMPDIR, and the variables declared by
+// the stage are passed through to the container.  The rest of the
+// environment, in particular PATH, comes from the image, since paths on the
+// host are generally meaningless inside it.
+func (self *Node) getContainer(stageType string, metadata *Metadata,
+	stageEnv map[string]string) (*ContainerInfo, error) {
+	image := self.container
+	override := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.container", stageType), image)
+	if s, ok := override.(string); ok {
+		image = s
+	} else {
+		return nil, fmt.Errorf("Invalid value for %s %s.container: %v",
+			self.fqname, stageType, override)
+	}
+	if image == "" {
+		return nil, nil
+	}
+	if self.stagecodeLang == syntax.ExecStage {
+		return nil, fmt.Errorf(
+			"Stage %s is an exec stage, which cannot be run in a container.",
+			self.fqname)
+	}
+	config := self.rt.ContainerConfig()
+	if config == nil {
+		return nil, fmt.Errorf(
+			"Stage %s requires container %s, but no container runtime is configured.",
+			self.fqname, image)
+	}
+
+	mounts := append([]string{
+		path.Dir(self.journalPath),
+		self.rt.adaptersPath,
+	}, self.mroPaths...)
+	if fields := strings.Fields(self.stagecodeCmd); len(fields) > 0 {
+		mounts = append(mounts, fields[0])
+	}
+	if b, err := metadata.readRawBytes(ArgsFile); err == nil {
+		for _, fn := range getMaybeFileNames(b) {
+			if path.IsAbs(fn) {
+				if _, err := os.Stat(fn); err == nil {
+					mounts = append(mounts, fn)
+				}
+			}
+		}
+	}
+
+	threadEnvs := self.rt.JobManager.GetSettings().ThreadEnvs
+	env := make([]string, 0, len(stageEnv)+len(threadEnvs)+1)
+	for name := range stageEnv {
+		if name != "PATH" {
+			env = append(env, name)
+		}
+	}
+	env = append(env, "TMPDIR")
+	env = append(env, threadEnvs...)
+	sort.Strings(env)
+
+	return &ContainerInfo{
+		Image:   image,
+		Runtime: config,
+		Mounts:  minimalMounts(mounts),
+		Env:     uniqueSorted(env),
+	}, nil
+}
+
+// Clean up a list of paths to mount, removing duplicates and paths which are
+// inside other paths in the list.
+func minimalMounts(mounts []string) []string {
+	clean := make([]string, 0, len(mounts))
+	for _, p := range mounts {
+		if p != "" {
+			if abs, err := filepath.Abs(p); err == nil {
+				clean = append(clean, abs)
+			}
+		}
+	}
+	sort.Strings(clean)
+	result := clean[:0]
+	for _, p := range clean {
+		if n := len(result); n > 0 {
+			last := result[n-1]
+			if p == last || last == "/" || strings.HasPrefix(p, last+"/") {
+				continue
+			}
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// Remove adjacent duplicates from a sorted list.
+func uniqueSorted(list []string) []string {
+	result := list[:0]
+	for _, s := range list {
+		if n := len(result); n == 0 || result[n-1] != s {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMinimalMounts(t *testing.T) {
+	mounts := minimalMounts([]string{
+		"/ps/STAGE/fork0/files/a.txt",
+		"/data/ref",
+		"/ps",
+		"",
+		"/data/ref",
+		"/data/reference.fa",
+	})
+	expect := []string{"/data/ref", "/data/reference.fa", "/ps"}
+	if !reflect.DeepEqual(mounts, expect) {
+		t.Errorf("Expected %v, got %v", expect, mounts)
+	}
+}
+
+// The stub runtime skips its own arguments, up to and including the image,
+// and runs the rest, after printing them.
+const stubContainerRuntime = `#!/bin/sh
+echo "$@"
+while [ "$1" != "test-image" ]; do shift; done
+shift
+exec "$@"
+`
+
+func TestContainerCommand(t *testing.T) {
+	d, err := ioutil.TempDir("", "container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	stub := path.Join(d, "runtime")
+	if err := ioutil.WriteFile(stub, []byte(stubContainerRuntime), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("MRO_TEST_CONTAINER_ENV", "1")
+	defer os.Unsetenv("MRO_TEST_CONTAINER_ENV")
+
+	info := &ContainerInfo{
+		Image: "test-image",
+		Runtime: &ContainerConfig{
+			Command:    stub,
+			Args:       []string{"run", "--user=${UID}"},
+			MountArgs:  []string{"-v", "${MOUNT}:${MOUNT}"},
+			EnvArgs:    []string{"--env=${ENV}"},
+			RlimitArgs: []string{"--ulimit=${RLIMIT}=${SOFT}:${HARD}"},
+		},
+		Mounts: []string{d},
+		Env:    []string{"MRO_TEST_CONTAINER_ENV", "MRO_TEST_CONTAINER_UNSET"},
+	}
+	args, err := info.Command([]string{"echo", "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdline := strings.Join(args, " ")
+	for _, s := range []string{
+		stub + " run --user=",
+		" -v " + d + ":" + d + " ",
+		" --env=MRO_TEST_CONTAINER_ENV ",
+		" --ulimit=nofile=",
+		" --ulimit=nproc=",
+		" test-image echo hello",
+	} {
+		if !strings.Contains(cmdline, s) {
+			t.Errorf("Expected %q in %s", s, cmdline)
+		}
+	}
+	if strings.Index(cmdline, " --ulimit=nofile=") > strings.Index(cmdline, " --ulimit=nproc=") {
+		t.Errorf("Expected the resource limits in a consistent order, got %s", cmdline)
+	}
+	if strings.Contains(cmdline, "MRO_TEST_CONTAINER_UNSET") {
+		t.Errorf("Expected unset variables to be skipped, got %s", cmdline)
+	}
+	if out, err := exec.Command(args[0], args[1:]...).Output(); err != nil {
+		t.Error(err)
+	} else if lines := strings.Split(strings.TrimSpace(string(out)), "\n"); lines[len(lines)-1] != "hello" {
+		t.Errorf("Expected the command to run in the stub runtime, got %s", out)
+	}
+
+	info.Runtime = nil
+	if _, err := info.Command([]string{"true"}); err == nil {
+		t.Error("Expected an error without a runtime.")
+	}
+}
@@ -0,0 +1,381 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Critical path analysis of pipestance performance data.
+//
+// Every split, chunk, and join which has run is treated as a job in a
+// dependency graph.  Chunks depend on their split, joins on their chunks, and
+// the first jobs of a stage fork depend on the last jobs of the stage forks
+// which it is bound to.  The time between when all of a job's dependencies
+// finished and when it started is counted as queue wait.
+//
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A single split, chunk, or join job.
+type CriticalPathJob struct {
+	Name      string    `json:"name"`
+	Stage     string    `json:"stage"`
+	Fork      int       `json:"fork"`
+	Phase     string    `json:"phase"`
+	Threads   int       `json:"threads"`
+	MemGB     int       `json:"mem_gb"`
+	Ready     time.Time `json:"ready"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	QueueWait float64   `json:"queue_wait_seconds"`
+	RunTime   float64   `json:"run_seconds"`
+	CpuTime   float64   `json:"cpu_seconds"`
+
+	deps []*CriticalPathJob
+}
+
+// Aggregate timing information for a stage.
+type StageTimeInfo struct {
+	Stage        string  `json:"stage"`
+	Jobs         int     `json:"jobs"`
+	RunTime      float64 `json:"run_seconds"`
+	QueueWait    float64 `json:"queue_wait_seconds"`
+	CoreHours    float64 `json:"core_hours"`
+	CpuHours     float64 `json:"cpu_hours"`
+	CriticalTime float64 `json:"critical_seconds"`
+
+	// The estimated reduction in pipestance wall time if this stage's jobs
+	// ran faster by the report's speedup factor.
+	Savings float64 `json:"savings_seconds"`
+}
+
+// The result of critical path analysis.
+type CriticalPathReport struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	WallTime float64   `json:"wall_seconds"`
+
+	// The chain of jobs which determined the pipestance wall time.
+	Path          []*CriticalPathJob `json:"path"`
+	PathRunTime   float64            `json:"path_run_seconds"`
+	PathQueueWait float64            `json:"path_queue_wait_seconds"`
+
+	// The number of cores available.  If not known, the peak number of
+	// threads reserved by concurrent jobs.
+	Cores       int `json:"cores"`
+	PeakThreads int `json:"peak_threads"`
+
+	// Core hours reserved by jobs, actually used by jobs (user + system
+	// time), and available but not reserved by any job.
+	ReservedCoreHours float64 `json:"reserved_core_hours"`
+	UsedCoreHours     float64 `json:"used_core_hours"`
+	IdleCoreHours     float64 `json:"idle_core_hours"`
+
+	Speedup float64          `json:"speedup"`
+	Stages  []*StageTimeInfo `json:"stages"`
+}
+
+func newCriticalPathJob(name, stage string, fork int, phase string,
+	perf *PerfInfo) *CriticalPathJob {
+	if perf == nil || perf.Start.IsZero() || perf.End.Before(perf.Start) {
+		return nil
+	}
+	threads := perf.NumThreads
+	if threads < 1 {
+		threads = 1
+	}
+	return &CriticalPathJob{
+		Name:    name,
+		Stage:   stage,
+		Fork:    fork,
+		Phase:   phase,
+		Threads: threads,
+		Start:   perf.Start,
+		End:     perf.End,
+		RunTime: perf.End.Sub(perf.Start).Seconds(),
+		CpuTime: perf.UserTime + perf.SystemTime,
+	}
+}
+
+// Get the memory reserved for a job, or if that was not recorded, the
+// highest memory usage observed.
+func reservedMemGB(metadata *Metadata, perf *PerfInfo) int {
+	var info JobInfo
+	if err := metadata.ReadInto(JobInfoFile, &info); err == nil && info.MemGB > 0 {
+		return info.MemGB
+	}
+	const kbPerGB = 1024 * 1024
+	if memGB := (perf.MaxRss + kbPerGB - 1) / kbPerGB; memGB > 1 {
+		return memGB
+	}
+	return 1
+}
+
+// Get the jobs for a fork, in order, along with the subset of them which
+// other stages wait on.
+func (self *Fork) criticalPathJobs() (all, first, last []*CriticalPathJob) {
+	perf, _ := self.serializePerf()
+	stage := self.node.fqname
+	split := newCriticalPathJob(self.fqname+".split", stage,
+		self.index, STAGE_TYPE_SPLIT, perf.SplitStats)
+	if split != nil {
+		split.MemGB = reservedMemGB(self.split_metadata, perf.SplitStats)
+		all = append(all, split)
+		first = []*CriticalPathJob{split}
+	}
+	var chunks []*CriticalPathJob
+	for i, chunk := range perf.Chunks {
+		if job := newCriticalPathJob(
+			fmt.Sprintf("%s.chnk%d", self.fqname, chunk.Index),
+			stage, self.index, STAGE_TYPE_CHUNK,
+			chunk.ChunkStats); job != nil {
+			job.MemGB = reservedMemGB(self.chunks[i].metadata, chunk.ChunkStats)
+			if split != nil {
+				job.deps = []*CriticalPathJob{split}
+			}
+			chunks = append(chunks, job)
+		}
+	}
+	all = append(all, chunks...)
+	if split == nil {
+		first = chunks
+	}
+	join := newCriticalPathJob(self.fqname+".join", stage,
+		self.index, STAGE_TYPE_JOIN, perf.JoinStats)
+	if join != nil {
+		join.MemGB = reservedMemGB(self.join_metadata, perf.JoinStats)
+		join.deps = chunks
+		if len(chunks) == 0 && split != nil {
+			join.deps = first
+		}
+		all = append(all, join)
+		last = []*CriticalPathJob{join}
+	} else if len(chunks) > 0 {
+		last = chunks
+	} else {
+		last = first
+	}
+	if len(first) == 0 {
+		first = last
+	}
+	return all, first, last
+}
+
+// Builds the job dependency graph for the pipestance.
+func (self *Pipestance) criticalPathJobs() []*CriticalPathJob {
+	var jobs []*CriticalPathJob
+	firstJobs := make(map[*Fork][]*CriticalPathJob)
+	lastJobs := make(map[*Fork][]*CriticalPathJob)
+	var stages []*Node
+	for _, node := range self.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		stages = append(stages, node)
+		for _, fork := range node.forks {
+			all, first, last := fork.criticalPathJobs()
+			jobs = append(jobs, all...)
+			firstJobs[fork] = first
+			lastJobs[fork] = last
+		}
+	}
+	for _, node := range stages {
+		for _, fork := range node.forks {
+			var deps []*CriticalPathJob
+			for _, prenode := range node.prenodes {
+				pre := prenode.getNode()
+				if pre.kind != "stage" {
+					continue
+				}
+				if match := pre.matchFork(fork.argPermute); match != nil {
+					deps = append(deps, lastJobs[match]...)
+				} else {
+					for _, preFork := range pre.forks {
+						deps = append(deps, lastJobs[preFork]...)
+					}
+				}
+			}
+			for _, job := range firstJobs[fork] {
+				job.deps = append(job.deps, deps...)
+			}
+		}
+	}
+	return jobs
+}
+
+// AnalyzeCriticalPath computes the critical path and scheduling efficiency
+// of the pipestance from its performance data.  Cores is the number of cores
+// available to the pipestance, or 0 if unknown.  Speedup is the factor by
+// which to assume a stage is sped up when estimating the savings from
+// optimizing it.
+func (self *Pipestance) AnalyzeCriticalPath(cores int, speedup float64) *CriticalPathReport {
+	return analyzeCriticalPath(self.criticalPathJobs(), cores, speedup)
+}
+
+func latestDep(job *CriticalPathJob) *CriticalPathJob {
+	var latest *CriticalPathJob
+	for _, dep := range job.deps {
+		if latest == nil || dep.End.After(latest.End) {
+			latest = dep
+		}
+	}
+	return latest
+}
+
+// Computes the pipestance wall time if the jobs for the given stage ran
+// faster by the given factor.  Queue wait
+// times are held fixed.  Resource contention is not taken into account.
+func simulateSpeedup(jobs []*CriticalPathJob, start time.Time,
+	stage string, speedup float64) float64 {
+	ends := make(map[*CriticalPathJob]float64, len(jobs))
+	var end func(job *CriticalPathJob) float64
+	end = func(job *CriticalPathJob) float64 {
+		if e, ok := ends[job]; ok {
+			return e
+		}
+		var ready float64
+		if len(job.deps) == 0 {
+			ready = job.Start.Sub(start).Seconds()
+		} else {
+			for _, dep := range job.deps {
+				if e := end(dep); e > ready {
+					ready = e
+				}
+			}
+			ready += job.QueueWait
+		}
+		run := job.RunTime
+		if job.Stage == stage {
+			run /= speedup
+		}
+		ends[job] = ready + run
+		return ready + run
+	}
+	var makespan float64
+	for _, job := range jobs {
+		if e := end(job); e > makespan {
+			makespan = e
+		}
+	}
+	return makespan
+}
+
+func analyzeCriticalPath(jobs []*CriticalPathJob,
+	cores int, speedup float64) *CriticalPathReport {
+	if speedup <= 1 {
+		speedup = 2
+	}
+	report := &CriticalPathReport{
+		Cores:   cores,
+		Speedup: speedup,
+		Path:    []*CriticalPathJob{},
+		Stages:  []*StageTimeInfo{},
+	}
+	if len(jobs) == 0 {
+		return report
+	}
+	var lastJob *CriticalPathJob
+	for _, job := range jobs {
+		if report.Start.IsZero() || job.Start.Before(report.Start) {
+			report.Start = job.Start
+		}
+		if lastJob == nil || job.End.After(lastJob.End) {
+			lastJob = job
+		}
+	}
+	report.End = lastJob.End
+	report.WallTime = report.End.Sub(report.Start).Seconds()
+
+	stages := make(map[string]*StageTimeInfo)
+	var stageList []*StageTimeInfo
+	type event struct {
+		t       time.Time
+		threads int
+	}
+	events := make([]event, 0, 2*len(jobs))
+	for _, job := range jobs {
+		job.Ready = report.Start
+		if dep := latestDep(job); dep != nil {
+			job.Ready = dep.End
+		}
+		if job.Start.After(job.Ready) {
+			job.QueueWait = job.Start.Sub(job.Ready).Seconds()
+		}
+		st := stages[job.Stage]
+		if st == nil {
+			st = &StageTimeInfo{Stage: job.Stage}
+			stages[job.Stage] = st
+			stageList = append(stageList, st)
+		}
+		st.Jobs++
+		st.RunTime += job.RunTime
+		st.QueueWait += job.QueueWait
+		st.CoreHours += float64(job.Threads) * job.RunTime / 3600
+		st.CpuHours += job.CpuTime / 3600
+		report.ReservedCoreHours += float64(job.Threads) * job.RunTime / 3600
+		report.UsedCoreHours += job.CpuTime / 3600
+		// Timestamps only have one-second resolution, so count jobs which
+		// appear to take no time as running for a second.
+		end := job.End
+		if !end.After(job.Start) {
+			end = job.Start.Add(time.Second)
+		}
+		events = append(events,
+			event{job.Start, job.Threads},
+			event{end, -job.Threads})
+	}
+
+	// Peak concurrency.  Ends sort before starts at the same instant.
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].t.Equal(events[j].t) {
+			return events[i].threads < events[j].threads
+		}
+		return events[i].t.Before(events[j].t)
+	})
+	threads := 0
+	for _, ev := range events {
+		threads += ev.threads
+		if threads > report.PeakThreads {
+			report.PeakThreads = threads
+		}
+	}
+	if report.Cores <= 0 {
+		report.Cores = report.PeakThreads
+	}
+	if idle := float64(report.Cores)*report.WallTime/3600 -
+		report.ReservedCoreHours; idle > 0 {
+		report.IdleCoreHours = idle
+	}
+
+	for job := lastJob; job != nil; job = latestDep(job) {
+		report.Path = append(report.Path, job)
+		report.PathRunTime += job.RunTime
+		report.PathQueueWait += job.QueueWait
+		stages[job.Stage].CriticalTime += job.RunTime
+	}
+	for i, j := 0, len(report.Path)-1; i < j; i, j = i+1, j-1 {
+		report.Path[i], report.Path[j] = report.Path[j], report.Path[i]
+	}
+
+	// Stages not on the critical path cannot reduce the wall time, since
+	// queue waits are held fixed.
+	baseline := simulateSpeedup(jobs, report.Start, "", 1)
+	for _, st := range stageList {
+		if st.CriticalTime > 0 {
+			if saved := baseline - simulateSpeedup(jobs, report.Start,
+				st.Stage, speedup); saved > 0 {
+				st.Savings = saved
+			}
+		}
+	}
+	sort.SliceStable(stageList, func(i, j int) bool {
+		if stageList[i].Savings != stageList[j].Savings {
+			return stageList[i].Savings > stageList[j].Savings
+		}
+		return stageList[i].CriticalTime > stageList[j].CriticalTime
+	})
+	report.Stages = stageList
+	return report
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyzeCriticalPath(t *testing.T) {
+	start := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	job := func(name, stage string, threads, from, to int,
+		deps ...*CriticalPathJob) *CriticalPathJob {
+		return &CriticalPathJob{
+			Name:    name,
+			Stage:   stage,
+			Threads: threads,
+			Start:   start.Add(time.Duration(from) * time.Second),
+			End:     start.Add(time.Duration(to) * time.Second),
+			RunTime: float64(to - from),
+			deps:    deps,
+		}
+	}
+	// A runs 0-10.  B (2 threads) and C both depend on A; B runs 12-40 and
+	// C runs 10-20.  D depends on both and runs 45-50.
+	a := job("A", "A", 1, 0, 10)
+	b := job("B", "B", 2, 12, 40, a)
+	c := job("C", "C", 1, 10, 20, a)
+	d := job("D", "D", 1, 45, 50, b, c)
+	report := analyzeCriticalPath([]*CriticalPathJob{a, b, c, d}, 4, 2)
+
+	if report.WallTime != 50 {
+		t.Errorf("Expected wall time 50, got %v", report.WallTime)
+	}
+	if len(report.Path) != 3 || report.Path[0] != a ||
+		report.Path[1] != b || report.Path[2] != d {
+		t.Errorf("Incorrect critical path %v", report.Path)
+	}
+	if report.PathRunTime != 43 || report.PathQueueWait != 7 {
+		t.Errorf("Expected 43s running and 7s waiting, got %v and %v",
+			report.PathRunTime, report.PathQueueWait)
+	}
+	if b.QueueWait != 2 || c.QueueWait != 0 {
+		t.Errorf("Incorrect queue waits %v, %v", b.QueueWait, c.QueueWait)
+	}
+	if report.PeakThreads != 3 {
+		t.Errorf("Expected peak threads 3, got %d", report.PeakThreads)
+	}
+	// 4 cores * 50s = 200 core-seconds, of which 10+56+10+5 = 81 reserved.
+	if idle := report.IdleCoreHours * 3600; idle < 118.99 || idle > 119.01 {
+		t.Errorf("Expected 119 idle core seconds, got %v", idle)
+	}
+	if report.Stages[0].Stage != "B" || report.Stages[0].Savings != 14 {
+		t.Errorf("Expected B to save 14s, got %s %v",
+			report.Stages[0].Stage, report.Stages[0].Savings)
+	}
+	for _, st := range report.Stages {
+		if st.Stage == "C" && st.Savings != 0 {
+			t.Errorf("Expected no savings from C, got %v", st.Savings)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Per-stage environment variables.
+//
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+// Get the extra environment variables and PATH prefix for a job, from the
+// stage's env and path resources, or the "env" and "path" overrides, which
+// replace them.  They are returned unexpanded, to be recorded in the job
+// info, since they must be expanded against the environment the job runs
+// in, which for cluster jobs is not mrp's.  See ExpandStageEnv.
+//
+// They are applied by mrjob, so exec stages, which are not run through it,
+// cannot use them.
+func (self *Node) getStageEnv(stageType string) (map[string]string, []string, error) {
+	env, err := self.getEnvOverride(stageType)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix, err := self.getPathOverride(stageType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(env) == 0 && len(prefix) == 0 {
+		return nil, nil, nil
+	}
+	if self.stagecodeLang == syntax.ExecStage {
+		return nil, nil, fmt.Errorf(
+			"Stage %s is an exec stage, which cannot set env or path.",
+			self.fqname)
+	}
+	return env, prefix, nil
+}
+
+// ExpandStageEnv expands a stage's extra environment variables and PATH
+// prefix, as recorded in the job info.  Values may refer to other
+// variables, e.g. "$HOME/lib:$PYTHONPATH", which are looked up in the job's
+// environment.  The path entries are prepended to PATH, and may also refer
+// to the stage's own variables.  Returns the variables to set.
+func ExpandStageEnv(env map[string]string, prefix []string,
+	lookup func(string) string) map[string]string {
+	if len(env) == 0 && len(prefix) == 0 {
+		return nil
+	}
+	added := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		added[k] = os.Expand(v, lookup)
+	}
+	if len(prefix) > 0 {
+		stageLookup := func(name string) string {
+			if v, ok := added[name]; ok {
+				return v
+			}
+			return lookup(name)
+		}
+		p := stageLookup("PATH")
+		dirs := make([]string, 0, len(prefix)+1)
+		for _, dir := range prefix {
+			dirs = append(dirs, os.Expand(dir, stageLookup))
+		}
+		if p != "" {
+			dirs = append(dirs, p)
+		}
+		added["PATH"] = strings.Join(dirs, ":")
+	}
+	return added
+}
+
+func (self *Node) getEnvOverride(stageType string) (map[string]string, error) {
+	override := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.env", stageType), nil)
+	if override == nil {
+		return self.stageEnv, nil
+	}
+	if m, ok := override.(map[string]interface{}); ok {
+		env := make(map[string]string, len(m))
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				env[k] = s
+			} else {
+				return nil, fmt.Errorf("Invalid value for %s %s.env[%s]: %v",
+					self.fqname, stageType, k, v)
+			}
+		}
+		return env, nil
+	}
+	return nil, fmt.Errorf("Invalid value for %s %s.env: %v",
+		self.fqname, stageType, override)
+}
+
+func (self *Node) getPathOverride(stageType string) ([]string, error) {
+	override := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.path", stageType), nil)
+	if override == nil {
+		return append([]string(nil), self.pathPrefix...), nil
+	}
+	if list, ok := override.([]interface{}); ok {
+		prefix := make([]string, 0, len(list))
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				prefix = append(prefix, s)
+			} else {
+				return nil, fmt.Errorf("Invalid value for %s %s.path: %v",
+					self.fqname, stageType, override)
+			}
+		}
+		return prefix, nil
+	}
+	return nil, fmt.Errorf("Invalid value for %s %s.path: %v",
+		self.fqname, stageType, override)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+func TestStageEnv(t *testing.T) {
+	overrides, err := parseOverrides([]byte(`{
+		"PIPE.OVERRIDDEN": {
+			"env": {"TOOL_HOME": "/opt/tool/2.0"},
+			"chunk.path": ["${TOOL_HOME}/bin"]
+		},
+		"PIPE.BAD": {
+			"env": {"THREADS": 2}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := &Runtime{overrides: overrides}
+	root := &Node{fqname: "ID.ps", rt: rt}
+	top := &Node{fqname: "ID.ps.PIPE", parent: root, rt: rt}
+	newStage := func(name string) *Node {
+		return &Node{
+			fqname: "ID.ps.PIPE." + name,
+			parent: top,
+			rt:     rt,
+			stageEnv: map[string]string{
+				"TOOL_HOME":  "/opt/tool/1.0",
+				"PYTHONPATH": "/opt/tool/1.0/lib:$PYTHONPATH",
+			},
+			pathPrefix: []string{"/opt/tool/1.0/bin"},
+		}
+	}
+	check := func(node *Node, stageType string, expect map[string]string) {
+		t.Helper()
+		env, prefix, err := node.getStageEnv(stageType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := map[string]string{
+			"PATH":       "/usr/bin",
+			"PYTHONPATH": "/base",
+		}
+		added := ExpandStageEnv(env, prefix, func(name string) string {
+			return base[name]
+		})
+		if !reflect.DeepEqual(added, expect) {
+			t.Errorf("Expected %v, got %v", expect, added)
+		}
+	}
+
+	check(newStage("STAGE"), "chunk", map[string]string{
+		"TOOL_HOME":  "/opt/tool/1.0",
+		"PYTHONPATH": "/opt/tool/1.0/lib:/base",
+		"PATH":       "/opt/tool/1.0/bin:/usr/bin",
+	})
+	check(newStage("OVERRIDDEN"), "chunk", map[string]string{
+		"TOOL_HOME": "/opt/tool/2.0",
+		"PATH":      "/opt/tool/2.0/bin:/usr/bin",
+	})
+	check(newStage("OVERRIDDEN"), "split", map[string]string{
+		"TOOL_HOME": "/opt/tool/2.0",
+		"PATH":      "/opt/tool/1.0/bin:/usr/bin",
+	})
+	check(&Node{fqname: "ID.ps.PIPE.PLAIN", parent: top, rt: rt}, "chunk", nil)
+
+	// The values are recorded unexpanded, to be expanded where the job runs.
+	if env, prefix, err := newStage("STAGE").getStageEnv("chunk"); err != nil {
+		t.Error(err)
+	} else if env["PYTHONPATH"] != "/opt/tool/1.0/lib:$PYTHONPATH" ||
+		!reflect.DeepEqual(prefix, []string{"/opt/tool/1.0/bin"}) {
+		t.Errorf("Expected unexpanded values, got %v and %v", env, prefix)
+	}
+	if _, _, err := newStage("BAD").getStageEnv("chunk"); err == nil {
+		t.Error("Expected an error for a non-string variable.")
+	}
+	execStage := newStage("STAGE")
+	execStage.stagecodeLang = syntax.ExecStage
+	if _, _, err := execStage.getStageEnv("chunk"); err == nil {
+		t.Error("Expected an error for an exec stage.")
+	}
+}
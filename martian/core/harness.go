@@ -0,0 +1,414 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Running a single stage in isolation, for testing stage code.
+//
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// A StageHarness runs the split, chunks, and join of a single stage with
+// the given arguments, without a pipeline around it.  Jobs are run one at a
+// time, through the same adapters and metadata files mrp would use, in a
+// directory laid out like the stage's directory in a pipestance.
+type StageHarness struct {
+	rt            *Runtime
+	stage         *syntax.Stage
+	stagecodeCmd  string
+	stagecodeLang syntax.StageCodeType
+	fqname        string
+	path          string
+	journalPath   string
+	invocation    *InvocationData
+}
+
+// The result of running a stage with a StageHarness.
+type StageHarnessResult struct {
+	// The phase which failed, if any.
+	FailedPhase string `json:"failed_phase,omitempty"`
+
+	// The metadata directory of the job which failed, if any.
+	FailedPath string `json:"failed_path,omitempty"`
+
+	// The error message from the failed job, or from output validation.
+	Error string `json:"error,omitempty"`
+
+	// Any alarms raised by the stage or by output validation.
+	Alarms string `json:"alarms,omitempty"`
+
+	// The stage outputs, if it completed.
+	Outs LazyArgumentMap `json:"outs,omitempty"`
+}
+
+// NewStageHarness finds the given stage in the mro path, and prepares to
+// run it in the given directory, which must not already exist.
+func (self *Runtime) NewStageHarness(name string, mroPaths []string, dir string) (*StageHarness, error) {
+	callable, err := GetCallable(mroPaths, name)
+	if err != nil {
+		return nil, err
+	}
+	stage, ok := callable.(*syntax.Stage)
+	if !ok {
+		return nil, &RuntimeError{fmt.Sprintf("'%s' is not a declared stage", name)}
+	}
+	cmd, lang, err := stagecodeCommand(stage, mroPaths)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil, &PipestanceExistsError{dir}
+	}
+	if err := util.MkdirAll(dir); err != nil {
+		return nil, err
+	}
+	journalPath := path.Join(dir, "journal")
+	if err := util.Mkdir(journalPath); err != nil {
+		return nil, err
+	}
+	return &StageHarness{
+		rt:            self,
+		stage:         stage,
+		stagecodeCmd:  cmd,
+		stagecodeLang: lang,
+		fqname:        "ID." + path.Base(dir) + "." + stage.Id,
+		path:          path.Join(dir, stage.Id, "fork0"),
+		journalPath:   journalPath,
+	}, nil
+}
+
+// The directory containing the stage's metadata.
+func (self *StageHarness) GetPath() string {
+	return self.path
+}
+
+// Run the stage with the given input arguments.  An error is returned if the
+// stage could not be run.  Failures of the stage itself are reported in the
+// result.
+func (self *StageHarness) Run(args LazyArgumentMap) (*StageHarnessResult, error) {
+	if err, alarms := args.ValidateInputs(self.stage.InParams); err != nil {
+		return nil, &RuntimeError{fmt.Sprintf(
+			"Invalid arguments for %s:\n%s", self.stage.Id,
+			strings.TrimSpace(err.Error()+alarms))}
+	}
+	if err := util.MkdirAll(path.Dir(self.path)); err != nil {
+		return nil, err
+	}
+	forkMeta := NewMetadata(self.fqname, self.path)
+	if err := forkMeta.mkdirs(); err != nil {
+		return nil, err
+	}
+	result := new(StageHarnessResult)
+	invocationArgs := MakeArgumentMap(args)
+	redactSecretArgs(self.stage.InParams, invocationArgs)
+	self.invocation = &InvocationData{
+		Call:      self.stage.Id,
+		Args:      invocationArgs,
+		SweepArgs: []string{},
+	}
+	if f := self.stage.Node.Loc.File; f != nil {
+		self.invocation.IncludePaths = []string{f.FileName}
+	}
+
+	// As with mrp, the stage code gets the paths to files holding the
+	// values of secret arguments, which are removed once the stage is done.
+	secretArgs := make(LazyArgumentMap, len(args))
+	for k, v := range args {
+		secretArgs[k] = v
+	}
+	args = secretArgs
+	secrets := path.Join(self.path, secretsDir)
+	defer os.RemoveAll(secrets)
+	if err := writeSecretArgs(secrets, self.stage.InParams, args); err != nil {
+		return nil, err
+	}
+
+	// Split.
+	splitMeta := NewMetadata(self.fqname, path.Join(self.path, "split"))
+	if err := splitMeta.mkdirs(); err != nil {
+		return nil, err
+	}
+	if err := splitMeta.Write(ArgsFile, args); err != nil {
+		return nil, err
+	}
+	stageDefs := &LazyStageDefs{ChunkDefs: []*LazyChunkDef{new(LazyChunkDef)}}
+	if self.stage.Split {
+		if err := self.runJob("split", STAGE_TYPE_SPLIT, splitMeta, nil); err != nil {
+			return nil, err
+		}
+		if self.checkFailed("split", splitMeta, result) {
+			return result, nil
+		}
+		if err := splitMeta.ReadInto(StageDefsFile, stageDefs); err != nil {
+			result.fail("split", splitMeta, fmt.Sprintf(
+				"The split method did not return a dictionary {'chunks': [{}], 'join': {}}.\nError: %v", err))
+			return result, nil
+		}
+	} else if err := splitMeta.Write(StageDefsFile, stageDefs); err != nil {
+		return nil, err
+	}
+
+	// Chunks.
+	chunkOuts := make([]LazyArgumentMap, 0, len(stageDefs.ChunkDefs))
+	width := util.WidthForInt(len(stageDefs.ChunkDefs))
+	for i, chunkDef := range stageDefs.ChunkDefs {
+		phase := fmt.Sprintf("chnk%0*d", width, i)
+		chunkMeta := NewMetadata(self.fqname, path.Join(self.path, phase))
+		if err := chunkMeta.mkdirs(); err != nil {
+			return nil, err
+		}
+		if self.stage.ChunkIns != nil && chunkDef.Args != nil {
+			if err, alarms := chunkDef.Args.ValidateInputs(self.stage.ChunkIns); err != nil {
+				result.fail(phase, chunkMeta, err.Error()+alarms)
+				return result, nil
+			}
+		}
+		if chunkDef.Resources == nil {
+			chunkDef.Resources = &JobResources{}
+		}
+		if err := chunkMeta.Write(ArgsFile, chunkDef.Merge(args)); err != nil {
+			return nil, err
+		}
+		outs := makeOutArgs(self.stage.OutParams, chunkMeta.curFilesPath, false)
+		if self.stage.Split && self.stage.ChunkOuts != nil {
+			for k, v := range makeOutArgs(self.stage.ChunkOuts, chunkMeta.curFilesPath, false) {
+				outs[k] = v
+			}
+		}
+		if err := chunkMeta.Write(OutsFile, outs); err != nil {
+			return nil, err
+		}
+		if err := self.runJob("main", STAGE_TYPE_CHUNK, chunkMeta, chunkDef.Resources); err != nil {
+			return nil, err
+		}
+		if self.checkFailed(phase, chunkMeta, result) {
+			return result, nil
+		}
+		out, err := chunkMeta.read(OutsFile, -1)
+		if err != nil {
+			result.fail(phase, chunkMeta, err.Error())
+			return result, nil
+		}
+		if self.stage.Split && self.stage.ChunkOuts != nil {
+			if err, alarms := out.ValidateOutputs(
+				self.stage.ChunkOuts, self.stage.OutParams); err != nil {
+				result.fail(phase, chunkMeta, err.Error()+alarms)
+				return result, nil
+			} else {
+				result.Alarms += alarms
+			}
+		}
+		chunkOuts = append(chunkOuts, out)
+	}
+
+	// Join.
+	joinMeta := NewMetadata(self.fqname, path.Join(self.path, "join"))
+	if err := joinMeta.mkdirs(); err != nil {
+		return nil, err
+	}
+	if stageDefs.JoinDef == nil {
+		stageDefs.JoinDef = &JobResources{}
+	}
+	if err := joinMeta.Write(ArgsFile, &LazyChunkDef{
+		Resources: stageDefs.JoinDef,
+		Args:      args,
+	}); err != nil {
+		return nil, err
+	}
+	if err := joinMeta.Write(ChunkDefsFile, stageDefs.ChunkDefs); err != nil {
+		return nil, err
+	}
+	if self.stage.Split {
+		if err := joinMeta.Write(ChunkOutsFile, chunkOuts); err != nil {
+			return nil, err
+		}
+		if err := joinMeta.Write(OutsFile,
+			makeOutArgs(self.stage.OutParams, joinMeta.curFilesPath, false)); err != nil {
+			return nil, err
+		}
+		if err := self.runJob("join", STAGE_TYPE_JOIN, joinMeta, stageDefs.JoinDef); err != nil {
+			return nil, err
+		}
+		if self.checkFailed("join", joinMeta, result) {
+			return result, nil
+		}
+	} else if len(chunkOuts) > 0 {
+		if err := joinMeta.Write(OutsFile, chunkOuts[0]); err != nil {
+			return nil, err
+		}
+	}
+	outs, err := joinMeta.read(OutsFile, -1)
+	if err != nil {
+		result.fail("join", joinMeta, err.Error())
+		return result, nil
+	}
+	if outs == nil {
+		outs = make(LazyArgumentMap)
+	}
+	if err := forkMeta.Write(OutsFile, outs); err != nil {
+		return nil, err
+	}
+	result.Outs = outs
+
+	// Validate the outputs.
+	if len(self.stage.OutParams.List) > 0 {
+		if err, alarms := outs.ValidateOutputs(self.stage.OutParams); err != nil {
+			result.fail("join", forkMeta, err.Error()+alarms)
+			return result, nil
+		} else if alarms != "" {
+			result.Alarms += alarms
+			forkMeta.AppendAlarm(alarms)
+		}
+	}
+	return result, forkMeta.WriteTime(CompleteFile)
+}
+
+func (self *StageHarnessResult) fail(phase string, metadata *Metadata, msg string) {
+	self.FailedPhase = phase
+	self.FailedPath = metadata.path
+	self.Error = msg
+	metadata.WriteRaw(Errors, msg)
+}
+
+// Check whether a job failed, recording the error if it did.  Alarms raised
+// by the job are added to the result.
+func (self *StageHarness) checkFailed(phase string, metadata *Metadata, result *StageHarnessResult) bool {
+	metadata.loadCache()
+	if metadata.exists(AlarmFile) {
+		result.Alarms += metadata.readRaw(AlarmFile)
+	}
+	switch state, _ := metadata.getState(); state {
+	case Complete:
+		return false
+	case Failed:
+		result.FailedPhase = phase
+		result.FailedPath = metadata.path
+		if metadata.exists(Assert) {
+			result.Error = metadata.readRaw(Assert)
+		} else {
+			result.Error = metadata.readRaw(Errors)
+		}
+	default:
+		result.fail(phase, metadata, fmt.Sprintf(
+			"The %s job exited without completing.  See %s.",
+			phase, metadata.MetadataFilePath(StdErr)))
+	}
+	return true
+}
+
+// Run a job for one phase of the stage, and wait for it to finish.
+func (self *StageHarness) runJob(shellName, stageType string, metadata *Metadata,
+	jobDef *JobResources) error {
+	threads, memGB, special := 0, 0, ""
+	if res := self.stage.Resources; res != nil {
+		threads, memGB, special = int(res.Threads), int(res.MemGB), res.Special
+	}
+	if jobDef != nil {
+		if jobDef.Threads != 0 {
+			threads = jobDef.Threads
+		}
+		if jobDef.MemGB != 0 {
+			memGB = jobDef.MemGB
+		}
+		if jobDef.Special != "" {
+			special = jobDef.Special
+		}
+	}
+	jobManager := self.rt.LocalJobManager
+	threads, memGB = jobManager.GetSystemReqs(threads, memGB)
+	if jobDef != nil {
+		jobDef.Threads = threads
+		jobDef.MemGB = memGB
+	}
+	stackVars := "disable"
+	if self.rt.Config.StackVars {
+		stackVars = "stackvars"
+	}
+	monitor := "disable"
+	if self.rt.Config.Monitor {
+		monitor = "monitor"
+	}
+	profileMode := self.rt.Config.ProfileMode
+	jobInfo := JobInfo{
+		Name:          self.fqname,
+		Type:          "local",
+		Threads:       threads,
+		MemGB:         memGB,
+		ProfileConfig: self.rt.ProfileConfig(profileMode),
+		ProfileMode:   profileMode,
+		Stackvars:     stackVars,
+		Monitor:       monitor,
+		Invocation:    self.invocation,
+		Version: &VersionInfo{
+			Martian: self.rt.Config.MartianVersion,
+		},
+	}
+	if jobInfo.ProfileConfig != nil && jobInfo.ProfileConfig.Adapter != "" {
+		jobInfo.ProfileMode = jobInfo.ProfileConfig.Adapter
+	}
+	if err := util.Mkdir(metadata.TempDir()); err != nil {
+		return err
+	}
+	if err := metadata.Write(JobInfoFile, &jobInfo); err != nil {
+		return err
+	}
+	if special != "" {
+		util.LogInfo("runtime", "Ignoring special resource %q for local job.", special)
+	}
+
+	shellCmd, argv := self.rt.jobCommand(self.stagecodeLang, self.stagecodeCmd,
+		shellName, metadata, path.Join(self.journalPath, self.fqname))
+	jobName := self.fqname
+	if shellName == "main" {
+		jobName += "." + path.Base(metadata.path)
+	}
+	util.PrintInfo("runtime", "(run:local)       %s.%s", jobName, shellName)
+	cmd := exec.Command(shellCmd, argv...)
+	cmd.Dir = metadata.curFilesPath
+	cmd.Env = util.MergeEnv(threadEnvs(jobManager, threads, map[string]string{
+		"TMPDIR": metadata.TempDir(),
+	}))
+	stdout, err := os.Create(metadata.MetadataFilePath(StdOut))
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(metadata.MetadataFilePath(StdErr))
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return err
+		}
+		// The job failing to write its errors is reported by checkFailed.
+		util.LogError(err, "runtime", "%s.%s exited with an error.",
+			self.fqname, shellName)
+	}
+	return nil
+}
+
+// Parse stage arguments from json.
+func ParseStageArgs(data []byte) (LazyArgumentMap, error) {
+	var args LazyArgumentMap
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	if args == nil {
+		args = make(LazyArgumentMap)
+	}
+	return args, nil
+}
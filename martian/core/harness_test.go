@@ -0,0 +1,133 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const harnessMroSrc = `
+stage SUM(
+    in  float[] values,
+    out float   total,
+    src exec    "sum.sh",
+) split (
+    in  float   value,
+    out float   part,
+)
+
+stage BAD_SUM(
+    in  float[] values,
+    out float   total,
+    src exec    "bad_sum.sh",
+) split (
+    in  float   value,
+    out float   part,
+)
+`
+
+// Exec stages which implement the adapter protocol directly.  The split
+// makes two chunks, and the join either returns a valid total or a string.
+const harnessStageScript = `#!/bin/sh
+case "$1" in
+split) echo '{"chunks":[{"value":1},{"value":2}],"join":{}}' > "$2/_stage_defs" ;;
+main)  echo '{"part":1}' > "$2/_outs" ;;
+join)  echo '{"total":%s}' > "$2/_outs" ;;
+esac
+touch "$2/_complete"
+`
+
+func setupHarnessTest(t *testing.T) (*Runtime, string, func()) {
+	t.Helper()
+	d, err := ioutil.TempDir("", "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, cleanup := testRuntime(t)
+	for fn, content := range map[string]string{
+		"stages.mro": harnessMroSrc,
+		"sum.sh":     strings.Replace(harnessStageScript, "%s", "3", 1),
+		"bad_sum.sh": strings.Replace(harnessStageScript, "%s", `"three"`, 1),
+	} {
+		if err := ioutil.WriteFile(path.Join(d, fn), []byte(content), 0755); err != nil {
+			cleanup()
+			os.RemoveAll(d)
+			t.Fatal(err)
+		}
+	}
+	return rt, d, func() {
+		cleanup()
+		os.RemoveAll(d)
+	}
+}
+
+func TestStageHarness(t *testing.T) {
+	rt, d, cleanup := setupHarnessTest(t)
+	defer cleanup()
+	args, err := ParseStageArgs([]byte(`{"values": [1, 2]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	harness, err := rt.NewStageHarness("SUM", []string{d}, path.Join(d, "run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := harness.Run(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FailedPhase != "" {
+		t.Fatalf("Stage failed in %s: %s", result.FailedPhase, result.Error)
+	}
+	if total := string(result.Outs["total"]); total != "3" {
+		t.Errorf("Expected total 3, got %s", total)
+	}
+	for _, fn := range []string{
+		"split/_args", "chnk0/_args", "chnk1/_jobinfo",
+		"join/_chunk_outs", "_outs", "_complete",
+	} {
+		if _, err := os.Stat(path.Join(harness.GetPath(), fn)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := rt.NewStageHarness("SUM", []string{d}, path.Join(d, "run")); err == nil {
+		t.Error("Expected an error reusing a directory.")
+	}
+	if _, err := rt.NewStageHarness("MISSING", []string{d}, path.Join(d, "run2")); err == nil {
+		t.Error("Expected an error for an unknown stage.")
+	}
+}
+
+func TestStageHarnessInvalid(t *testing.T) {
+	rt, d, cleanup := setupHarnessTest(t)
+	defer cleanup()
+
+	harness, err := rt.NewStageHarness("BAD_SUM", []string{d}, path.Join(d, "bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := ParseStageArgs([]byte(`{"values": "one"}`))
+	if _, err := harness.Run(args); err == nil {
+		t.Error("Expected invalid arguments to be rejected.")
+	}
+
+	harness, err = rt.NewStageHarness("BAD_SUM", []string{d}, path.Join(d, "bad2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ = ParseStageArgs([]byte(`{"values": [1, 2]}`))
+	result, err := harness.Run(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FailedPhase != "join" {
+		t.Errorf("Expected output validation to fail, got %#v", result)
+	} else if !strings.Contains(result.Error, "total") {
+		t.Errorf("Expected an error about the total output, got %s", result.Error)
+	}
+}
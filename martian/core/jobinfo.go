@@ -17,11 +17,15 @@ type JobInfo struct {
 	WallClockInfo *WallClockInfo    `json:"wallclock,omitempty"`
 	Threads       int               `json:"threads,omitempty"`
 	MemGB         int               `json:"memGB,omitempty"`
+	VMemGB        int               `json:"vmemGB,omitempty"`
 	ProfileConfig *ProfileConfig    `json:"profile_config,omitempty"`
 	ProfileMode   ProfileMode       `json:"profile_mode,omitempty"`
 	Stackvars     string            `json:"stackvars_flag,omitempty"`
 	Monitor       string            `json:"monitor_flag,omitempty"`
 	Invocation    *InvocationData   `json:"invocation,omitempty"`
+	Container     *ContainerInfo    `json:"container,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	Path          []string          `json:"path,omitempty"`
 	Version       *VersionInfo      `json:"version,omitempty"`
 	ClusterEnv    map[string]string `json:"sge,omitempty"`
 }
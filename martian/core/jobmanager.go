@@ -17,6 +17,7 @@ import (
 	"runtime/trace"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -55,7 +56,7 @@ func max(a, b int) int {
 // Job managers
 //
 type JobManager interface {
-	execJob(string, []string, map[string]string, *Metadata, int, int, string, string, string, bool)
+	execJob(string, []string, map[string]string, *Metadata, int, int, int, string, string, string, bool)
 	endJob(*Metadata)
 
 	// Given a list of candidate job IDs, returns a list of jobIds which may be
@@ -84,9 +85,12 @@ type JobManager interface {
 }
 
 type LocalJobManager struct {
+	// maxCores, maxMemGB and jobSettings may be changed by reconfigure
+	// while jobs are being started, and must be accessed under configLock.
 	maxCores    int
 	maxMemGB    int
 	jobSettings *JobManagerSettings
+	configLock  sync.Mutex
 	coreSem     *ResourceSemaphore
 	memMBSem    *ResourceSemaphore
 	procsSem    *ResourceSemaphore
@@ -204,9 +208,42 @@ func NewLocalJobManager(userMaxCores int, userMaxMemGB int,
 }
 
 func (self *LocalJobManager) GetSettings() *JobManagerSettings {
+	self.configLock.Lock()
+	defer self.configLock.Unlock()
 	return self.jobSettings
 }
 
+// Get a consistent snapshot of the job settings and resource limits.
+func (self *LocalJobManager) limits() (*JobManagerSettings, int, int) {
+	self.configLock.Lock()
+	defer self.configLock.Unlock()
+	return self.jobSettings, self.maxCores, self.maxMemGB
+}
+
+// Update the job settings and resource limits, returning a description of
+// how the limits changed.  Limits which are zero are left unchanged.  Jobs
+// which are already running are not affected.
+func (self *LocalJobManager) reconfigure(settings *JobManagerSettings,
+	maxCores, maxMemGB int) []string {
+	self.configLock.Lock()
+	defer self.configLock.Unlock()
+	var changes []string
+	self.jobSettings = settings
+	if maxCores > 0 && maxCores != self.maxCores {
+		changes = append(changes, fmt.Sprintf(
+			"local cores changed from %d to %d", self.maxCores, maxCores))
+		self.maxCores = maxCores
+		self.coreSem.SetMaxSize(int64(maxCores))
+	}
+	if maxMemGB > 0 && maxMemGB != self.maxMemGB {
+		changes = append(changes, fmt.Sprintf(
+			"local memory changed from %d to %d GB", self.maxMemGB, maxMemGB))
+		self.maxMemGB = maxMemGB
+		self.memMBSem.SetMaxSize(int64(maxMemGB) * 1024)
+	}
+	return changes
+}
+
 func (self *LocalJobManager) refreshResources(localMode bool) error {
 	sysMem := sigar.Mem{}
 	if err := sysMem.Get(); err != nil {
@@ -217,10 +254,11 @@ func (self *LocalJobManager) refreshResources(localMode bool) error {
 		util.LogError(err, "jobmngr", "Error getting process tree memory usage.")
 	}
 	self.highMem.IncreaseTo(usedMem)
+	_, maxCores, maxMemGB := self.limits()
 	memDiff := self.memMBSem.UpdateFreeUsed(
 		(int64(sysMem.ActualFree)+(1024*1024-1))/(1024*1024),
 		(usedMem.Rss+(1024*1024-1))/(1024*1024))
-	if memDiff < -int64(self.maxMemGB)*1024/8 &&
+	if memDiff < -int64(maxMemGB)*1024/8 &&
 		memDiff/128 < self.lastMemDiff &&
 		(localMode || sysMem.ActualFree < 2*1024*1024*1024) {
 		util.LogInfo("jobmngr", "%.1fGB less memory than expected was free", float64(-memDiff)/1024)
@@ -237,7 +275,7 @@ func (self *LocalJobManager) refreshResources(localMode bool) error {
 			return err
 		}
 		if diff := self.coreSem.UpdateActual(int64(
-			float64(runtime.NumCPU()) - load.One + 0.9)); diff < -int64(self.maxCores)/4 &&
+			float64(runtime.NumCPU()) - load.One + 0.9)); diff < -int64(maxCores)/4 &&
 			localMode {
 			util.LogInfo("jobmngr", "%d fewer core%s than expected were free.", -diff, util.Pluralize(int(-diff)))
 		}
@@ -265,23 +303,25 @@ func (self *LocalJobManager) HandleSignal(sig os.Signal) {
 }
 
 func (self *LocalJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
-	// Sanity check and cap to self.maxCores.
+	settings, maxCores, maxMemGB := self.limits()
+
+	// Sanity check and cap to maxCores.
 	if threads == 0 {
-		threads = self.jobSettings.ThreadsPerJob
+		threads = settings.ThreadsPerJob
 	} else if threads < 0 {
-		threads = self.maxCores
+		threads = maxCores
 	}
-	if threads > self.maxCores {
+	if threads > maxCores {
 		if self.debug {
 			util.LogInfo("jobmngr", "Need %d core%s but settling for %d.", threads,
-				util.Pluralize(threads), self.maxCores)
+				util.Pluralize(threads), maxCores)
 		}
-		threads = self.maxCores
+		threads = maxCores
 	}
 
-	// Sanity check and cap to self.maxMemGB.
+	// Sanity check and cap to maxMemGB.
 	if memGB == 0 {
-		memGB = self.jobSettings.MemGBPerJob
+		memGB = settings.MemGBPerJob
 	}
 	if memGB < 0 {
 		avail := int(self.memMBSem.CurrentSize() / 1024)
@@ -298,16 +338,16 @@ func (self *LocalJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 	// TODO: Stop allowing stages to ask for more than the max.  Require
 	// stages which can adapt to the available memory to ask for a negative
 	// amount as a sentinel.
-	if memGB > self.maxMemGB {
+	if memGB > maxMemGB {
 		if self.debug {
 			util.LogInfo("jobmngr", "Need %d GB but settling for %d.", memGB,
-				self.maxMemGB)
+				maxMemGB)
 		}
 		util.LogInfo(
 			"jobmngr",
 			"Job asked for %d GB but is being given %d.  This behavior is deprecated - jobs which can adapt their memory usage should ask for -%d.",
-			memGB, self.maxMemGB, memGB)
-		memGB = self.maxMemGB
+			memGB, maxMemGB, memGB)
+		memGB = maxMemGB
 	}
 
 	return threads, memGB
@@ -336,7 +376,8 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 		// Exec the shell directly.
 		cmd := exec.Command(shellCmd, argv...)
 		cmd.Dir = metadata.curFilesPath
-		if self.maxCores < runtime.NumCPU() {
+		_, maxCores, maxMemGB := self.limits()
+		if maxCores < runtime.NumCPU() {
 			// If, and only if, the user specified a core limit less than the
 			// detected core count, make sure jobs actually don't use more
 			// threads than they're supposed to.
@@ -359,13 +400,13 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 		if err := self.coreSem.Acquire(int64(threads)); err != nil {
 			util.LogError(err, "jobmngr",
 				"%s requested %d threads, but the job manager was only configured to use %d.",
-				metadata.fqname, threads, self.maxCores)
+				metadata.fqname, threads, maxCores)
 			metadata.WriteRaw(Errors, err.Error())
 			return
 		}
 		if self.debug {
 			util.LogInfo("jobmngr", "Acquired %d core%s (%d/%d in use)", threads,
-				util.Pluralize(threads), self.coreSem.InUse(), self.maxCores)
+				util.Pluralize(threads), self.coreSem.InUse(), maxCores)
 		}
 
 		// Acquire memory.
@@ -375,14 +416,14 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 		if err := self.memMBSem.Acquire(int64(memGB) * 1024); err != nil {
 			util.LogError(err, "jobmngr",
 				"%s requested %d GB of memory, but the job manager was only configured to use %d.",
-				metadata.fqname, memGB, self.maxMemGB)
+				metadata.fqname, memGB, maxMemGB)
 			self.coreSem.Release(int64(threads))
 			metadata.WriteRaw(Errors, err.Error())
 			return
 		}
 		if self.debug {
 			util.LogInfo("jobmngr", "Acquired %d GB (%.1f/%d in use)", memGB,
-				float64(self.memMBSem.InUse())/1024, self.maxMemGB)
+				float64(self.memMBSem.InUse())/1024, maxMemGB)
 		}
 		if self.debug {
 			util.LogInfo("jobmngr", "%d goroutines", runtime.NumGoroutine())
@@ -475,13 +516,13 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 		self.coreSem.Release(int64(threads))
 		if self.debug {
 			util.LogInfo("jobmngr", "Released %d core%s (%d/%d in use)", threads,
-				util.Pluralize(threads), self.coreSem.InUse(), self.maxCores)
+				util.Pluralize(threads), self.coreSem.InUse(), maxCores)
 		}
 		// Release memory.
 		self.memMBSem.Release(int64(memGB) * 1024)
 		if self.debug {
 			util.LogInfo("jobmngr", "Released %d GB (%.1f/%d in use)", memGB,
-				float64(self.memMBSem.InUse())/1024, self.maxMemGB)
+				float64(self.memMBSem.InUse())/1024, maxMemGB)
 		}
 		if self.procsSem != nil {
 			// Release processes.
@@ -495,16 +536,20 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 }
 
 func (self *LocalJobManager) GetMaxCores() int {
+	self.configLock.Lock()
+	defer self.configLock.Unlock()
 	return self.maxCores
 }
 
 func (self *LocalJobManager) GetMaxMemGB() int {
+	self.configLock.Lock()
+	defer self.configLock.Unlock()
 	return self.maxMemGB
 }
 
 func (self *LocalJobManager) execJob(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, preflight bool) {
+	vmemGB int, special string, fqname string, shellName string, preflight bool) {
 	self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, fqname, 0, 0, preflight)
 }
 
@@ -513,13 +558,17 @@ func (self *LocalJobManager) endJob(*Metadata) {}
 type RemoteJobManager struct {
 	jobMode              string
 	jobResourcesMappings map[string]string
-	config               jobManagerConfig
 	memGBPerCore         int
-	maxJobs              int
 	jobFreqMillis        int
 	jobSem               *MaxJobsSemaphore
 	limiter              *time.Ticker
 	debug                bool
+
+	// config and maxJobs may be changed by reconfigure while jobs are being
+	// submitted, and must be accessed under configLock.
+	config     jobManagerConfig
+	maxJobs    int
+	configLock sync.Mutex
 }
 
 func NewRemoteJobManager(jobMode string, memGBPerCore int, maxJobs int, jobFreqMillis int,
@@ -574,13 +623,47 @@ func (self *RemoteJobManager) GetMaxMemGB() int {
 }
 
 func (self *RemoteJobManager) GetSettings() *JobManagerSettings {
-	return self.config.jobSettings
+	return self.getConfig().jobSettings
+}
+
+// Get a copy of the current job manager configuration.
+func (self *RemoteJobManager) getConfig() jobManagerConfig {
+	self.configLock.Lock()
+	defer self.configLock.Unlock()
+	return self.config
+}
+
+// Update the job settings, job template and the maximum number of concurrent
+// jobs, returning a description of what changed.  The job limit can only be
+// changed if there was a limit to begin with.  Jobs which have already been
+// submitted are not affected.
+func (self *RemoteJobManager) reconfigure(settings *JobManagerSettings,
+	jobTemplate string, maxJobs int) []string {
+	self.configLock.Lock()
+	defer self.configLock.Unlock()
+	var changes []string
+	self.config.jobSettings = settings
+	if jobTemplate != self.config.jobTemplate {
+		changes = append(changes, fmt.Sprintf(
+			"job template %s changed", self.config.jobTemplateFile))
+		self.config.jobTemplate = jobTemplate
+		self.config.threadingEnabled = templateHasThreading(jobTemplate)
+	}
+	if maxJobs > 0 && self.jobSem != nil && maxJobs != self.maxJobs {
+		changes = append(changes, fmt.Sprintf(
+			"max jobs changed from %d to %d", self.maxJobs, maxJobs))
+		self.maxJobs = maxJobs
+		self.jobSem.SetLimit(maxJobs)
+	}
+	return changes
 }
 
 func (self *RemoteJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
+	config := self.getConfig()
+
 	// Sanity check the thread count.
 	if threads == 0 {
-		threads = self.config.jobSettings.ThreadsPerJob
+		threads = config.jobSettings.ThreadsPerJob
 	} else if threads < 0 {
 		threads = -threads
 	}
@@ -592,7 +675,7 @@ func (self *RemoteJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 		memGB = -memGB
 	}
 	if memGB < 1 {
-		memGB = self.config.jobSettings.MemGBPerJob
+		memGB = config.jobSettings.MemGBPerJob
 	}
 
 	// Compute threads needed based on memory requirements.
@@ -601,7 +684,7 @@ func (self *RemoteJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 	}
 
 	// If threading is disabled, use only 1 thread.
-	if !self.config.threadingEnabled {
+	if !config.threadingEnabled {
 		threads = 1
 	}
 
@@ -610,13 +693,13 @@ func (self *RemoteJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 
 func (self *RemoteJobManager) execJob(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, localpreflight bool) {
+	vmemGB int, special string, fqname string, shellName string, localpreflight bool) {
 	ctx, task := trace.NewTask(context.Background(), "queueRemote")
 
 	// no limit, send the job
-	if self.maxJobs <= 0 {
+	if self.jobSem == nil {
 		defer task.End()
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName, ctx)
+		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, vmemGB, special, fqname, shellName, ctx)
 		return
 	}
 
@@ -634,7 +717,7 @@ func (self *RemoteJobManager) execJob(shellCmd string, argv []string,
 		if self.debug {
 			util.LogInfo("jobmngr", "Job sent: %s", fqname)
 		}
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName, ctx)
+		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, vmemGB, special, fqname, shellName, ctx)
 	}()
 }
 
@@ -658,9 +741,24 @@ func threadEnvs(self JobManager, threads int, envs map[string]string) map[string
 	return newEnvs
 }
 
+// If a __special is specified for this stage, and the runtime was called
+// with MRO_JOBRESOURCES defining a mapping from __special to a complex value
+// expression, then return the resources option to populate into the template.
+// Otherwise, return an empty string to revert to default behavior.
+func (self *RemoteJobManager) resourcesOpt(special string) string {
+	if len(special) > 0 {
+		if resources, ok := self.jobResourcesMappings[special]; ok {
+			return strings.Replace(
+				self.getConfig().jobResourcesOpt,
+				"__RESOURCES__", resources, 1)
+		}
+	}
+	return ""
+}
+
 func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[string]string,
-	metadata *Metadata, threads int, memGB int, special string, fqname string, shellName string,
-	ctx context.Context) {
+	metadata *Metadata, threads int, memGB int, vmemGB int, special string, fqname string,
+	shellName string, ctx context.Context) {
 
 	if self.jobFreqMillis > 0 {
 		<-(self.limiter.C)
@@ -669,6 +767,7 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		}
 	}
 	threads, memGB = self.GetSystemReqs(threads, memGB)
+	config := self.getConfig()
 
 	// figure out per-thread memory requirements for the template.  If
 	// mempercore is specified, use that as what we send.
@@ -683,18 +782,7 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		}
 	}
 
-	mappedJobResourcesOpt := ""
-	// If a __special is specified for this stage, and the runtime was called
-	// with MRO_JOBRESOURCES defining a mapping from __special to a complex value
-	// expression, then populate the resources option into the template. Otherwise,
-	// leave it blank to revert to default behavior.
-	if len(special) > 0 {
-		if resources, ok := self.jobResourcesMappings[special]; ok {
-			mappedJobResourcesOpt = strings.Replace(
-				self.config.jobResourcesOpt,
-				"__RESOURCES__", resources, 1)
-		}
-	}
+	mappedJobResourcesOpt := self.resourcesOpt(special)
 
 	argv = append(
 		util.FormatEnv(threadEnvs(self, threads, envs)),
@@ -719,10 +807,23 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		"ACCOUNT":           os.Getenv("MRO_ACCOUNT"),
 		"RESOURCES":         mappedJobResourcesOpt,
 	}
+	// Virtual memory limits are only sent if requested, so that template
+	// lines which use them are removed otherwise.
+	if vmemGB > 0 {
+		params["VMEM_GB"] = fmt.Sprintf("%d", vmemGB)
+		params["VMEM_MB"] = fmt.Sprintf("%d", vmemGB*1024)
+		params["VMEM_KB"] = fmt.Sprintf("%d", vmemGB*1024*1024)
+		params["VMEM_B"] = fmt.Sprintf("%d", vmemGB*1024*1024*1024)
+	} else {
+		params["VMEM_GB"] = ""
+		params["VMEM_MB"] = ""
+		params["VMEM_KB"] = ""
+		params["VMEM_B"] = ""
+	}
 
 	// Replace template annotations with actual values
 	args := []string{}
-	template := self.config.jobTemplate
+	template := config.jobTemplate
 	for key, val := range params {
 		if len(val) > 0 {
 			args = append(args, fmt.Sprintf("__MRO_%s__", key), val)
@@ -739,7 +840,7 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 	jobscript := r.Replace(template)
 	metadata.WriteRaw("jobscript", jobscript)
 
-	cmd := exec.CommandContext(ctx, self.config.jobCmd, self.config.jobCmdArgs...)
+	cmd := exec.CommandContext(ctx, config.jobCmd, config.jobCmdArgs...)
 	cmd.Dir = metadata.curFilesPath
 	cmd.Stdin = strings.NewReader(jobscript)
 
@@ -760,11 +861,12 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 }
 
 func (self *RemoteJobManager) checkQueue(ids []string, ctx context.Context) ([]string, string) {
-	if self.config.queueQueryCmd == "" {
+	queueQueryCmd := self.getConfig().queueQueryCmd
+	if queueQueryCmd == "" {
 		return ids, ""
 	}
 	jobPath := util.RelPath(path.Join("..", "jobmanagers"))
-	cmd := exec.CommandContext(ctx, path.Join(jobPath, self.config.queueQueryCmd))
+	cmd := exec.CommandContext(ctx, path.Join(jobPath, queueQueryCmd))
 	cmd.Dir = jobPath
 	cmd.Stdin = strings.NewReader(strings.Join(ids, "\n"))
 	var stderr bytes.Buffer
@@ -777,11 +879,11 @@ func (self *RemoteJobManager) checkQueue(ids []string, ctx context.Context) ([]s
 }
 
 func (self *RemoteJobManager) hasQueueCheck() bool {
-	return self.config.queueQueryCmd != ""
+	return self.getConfig().queueQueryCmd != ""
 }
 
 func (self *RemoteJobManager) queueCheckGrace() time.Duration {
-	return self.config.queueQueryGrace
+	return self.getConfig().queueQueryGrace
 }
 
 //
@@ -812,6 +914,7 @@ type JobManagerJson struct {
 	JobSettings *JobManagerSettings            `json:"settings"`
 	JobModes    map[string]*JobModeJson        `json:"jobmodes"`
 	ProfileMode map[ProfileMode]*ProfileConfig `json:"profiles"`
+	Container   *ContainerConfig               `json:"container,omitempty"`
 }
 
 type jobManagerConfig struct {
@@ -821,18 +924,29 @@ type jobManagerConfig struct {
 	queueQueryCmd    string
 	queueQueryGrace  time.Duration
 	jobResourcesOpt  string
+	jobTemplateFile  string
 	jobTemplate      string
 	threadingEnabled bool
 }
 
 func getJobConfig(profileMode ProfileMode) *JobManagerJson {
+	jobJson, err := readJobConfig(profileMode)
+	if err != nil {
+		util.PrintInfo("jobmngr", "%v", err)
+		os.Exit(1)
+	}
+	return jobJson
+}
+
+// Read and validate the job manager configuration file.
+func readJobConfig(profileMode ProfileMode) (*JobManagerJson, error) {
 	jobPath := util.RelPath(path.Join("..", "jobmanagers"))
 
 	// Check for existence of job manager JSON file
 	jobJsonFile := path.Join(jobPath, "config.json")
 	if _, err := os.Stat(jobJsonFile); os.IsNotExist(err) {
-		util.PrintInfo("jobmngr", "Job manager config file %s does not exist.", jobJsonFile)
-		os.Exit(1)
+		return nil, fmt.Errorf("Job manager config file %s does not exist.",
+			jobJsonFile)
 	}
 	util.LogInfo("jobmngr", "Job config = %s", jobJsonFile)
 	b, _ := ioutil.ReadFile(jobJsonFile)
@@ -840,42 +954,59 @@ func getJobConfig(profileMode ProfileMode) *JobManagerJson {
 	// Parse job manager JSON file
 	var jobJson *JobManagerJson
 	if err := json.Unmarshal(b, &jobJson); err != nil {
-		util.PrintInfo("jobmngr",
+		return nil, fmt.Errorf(
 			"Job manager config file %s does not contain valid JSON.",
 			jobJsonFile)
-		os.Exit(1)
 	}
 
 	// Validate settings fields
 	jobSettings := jobJson.JobSettings
 	if jobSettings == nil {
-		util.PrintInfo("jobmngr",
+		return nil, fmt.Errorf(
 			"Job manager config file %s should contain 'settings' field.",
 			jobJsonFile)
-		os.Exit(1)
 	}
 	if jobSettings.ThreadsPerJob <= 0 {
-		util.PrintInfo("jobmngr",
+		return nil, fmt.Errorf(
 			"Job manager config %s contains invalid default threads per job.",
 			jobJsonFile)
-		os.Exit(1)
 	}
 	if jobSettings.MemGBPerJob <= 0 {
-		util.PrintInfo("jobmngr",
+		return nil, fmt.Errorf(
 			"Job manager config %s contains invalid default memory (GB) per job.",
 			jobJsonFile)
-		os.Exit(1)
 	}
 
 	if profileMode != "" && profileMode != DisableProfile {
 		if _, ok := jobJson.ProfileMode[profileMode]; !ok {
-			util.PrintInfo("jobmngr",
+			return nil, fmt.Errorf(
 				"Invalid profile mode: %s. Valid profile modes: %s",
 				profileMode, allProfileModes(jobJson.ProfileMode))
-			os.Exit(1)
 		}
 	}
-	return jobJson
+	return jobJson, nil
+}
+
+// Describe the differences between two sets of job manager settings.
+func diffJobSettings(before, after *JobManagerSettings) []string {
+	var changes []string
+	if before.ThreadsPerJob != after.ThreadsPerJob {
+		changes = append(changes, fmt.Sprintf(
+			"default threads per job changed from %d to %d",
+			before.ThreadsPerJob, after.ThreadsPerJob))
+	}
+	if before.MemGBPerJob != after.MemGBPerJob {
+		changes = append(changes, fmt.Sprintf(
+			"default memory per job changed from %d to %d GB",
+			before.MemGBPerJob, after.MemGBPerJob))
+	}
+	if strings.Join(before.ThreadEnvs, ",") != strings.Join(after.ThreadEnvs, ",") {
+		changes = append(changes, fmt.Sprintf(
+			"thread environment variables changed from [%s] to [%s]",
+			strings.Join(before.ThreadEnvs, ", "),
+			strings.Join(after.ThreadEnvs, ", ")))
+	}
+	return changes
 }
 
 func verifyJobManager(jobMode string, jobJson *JobManagerJson, memGBPerCore int) jobManagerConfig {
@@ -924,14 +1055,12 @@ func verifyJobManager(jobMode string, jobJson *JobManagerJson, memGBPerCore int)
 		os.Exit(1)
 	}
 	util.LogInfo("jobmngr", "Job template = %s", jobTemplateFile)
-	b, _ := ioutil.ReadFile(jobTemplateFile)
-	jobTemplate := string(b)
-
-	// Check if template includes threading.
-	jobThreadingEnabled := false
-	if strings.Contains(jobTemplate, "__MRO_THREADS__") {
-		jobThreadingEnabled = true
+	jobTemplate, err := readJobTemplate(jobTemplateFile)
+	if err != nil {
+		util.PrintError(err, "jobmngr", "Could not read job manager template.")
+		os.Exit(1)
 	}
+	jobThreadingEnabled := templateHasThreading(jobTemplate)
 
 	// Check if memory reservations or mempercore are enabled
 	if !strings.Contains(jobTemplate, "__MRO_MEM_GB") && !strings.Contains(jobTemplate, "__MRO_MEM_MB") && memGBPerCore <= 0 {
@@ -969,7 +1098,18 @@ func verifyJobManager(jobMode string, jobJson *JobManagerJson, memGBPerCore int)
 		jobModeJson.QueueQuery,
 		queueGrace,
 		jobResourcesOpt,
+		jobTemplateFile,
 		jobTemplate,
 		jobThreadingEnabled,
 	}
 }
+
+func readJobTemplate(jobTemplateFile string) (string, error) {
+	b, err := ioutil.ReadFile(jobTemplateFile)
+	return string(b), err
+}
+
+// Check if a job template includes threading.
+func templateHasThreading(jobTemplate string) bool {
+	return strings.Contains(jobTemplate, "__MRO_THREADS__")
+}
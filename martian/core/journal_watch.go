@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Change notification for the pipestance journal.
+//
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Filesystems on which change notification does not see files written from
+// other hosts, or is not implemented at all.
+var unwatchableFilesystems = map[string]bool{
+	"cifs":    true,
+	"coda":    true,
+	"fhgfs":   true,
+	"fuse":    true,
+	"gfs":     true,
+	"gpfs":    true,
+	"lustre":  true,
+	"ncp":     true,
+	"nfs":     true,
+	"ocfs2":   true,
+	"panfs":   true,
+	"smb":     true,
+	"v9fs":    true,
+	"vmhgfs":  true,
+	"unknown": true,
+}
+
+// WatchJournal returns a watcher which is signaled when jobs add files to the
+// pipestance journal, or an error if the pipestance is on a filesystem where
+// that would not work reliably, in which case the runtime must poll.
+//
+// The caller should call UpdateWatch after each step of the run loop, to
+// keep the set of watched directories current.
+func (self *Pipestance) WatchJournal() (*util.DirWatcher, error) {
+	journalPath := self.node.journalPath
+	if _, _, fstype, err := GetAvailableSpace(journalPath); err != nil {
+		return nil, err
+	} else if unwatchableFilesystems[fstype] {
+		return nil, fmt.Errorf(
+			"change notification is not reliable on %s filesystems", fstype)
+	}
+	watcher, err := util.NewDirWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := self.UpdateWatch(watcher); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// UpdateWatch sets the directories watched by the given watcher to the
+// journal directory plus the metadata directories of queued or running jobs.
+// The runtime writes some metadata, such as errors for local jobs which
+// failed to start, without updating the journal.
+func (self *Pipestance) UpdateWatch(watcher *util.DirWatcher) error {
+	dirs := []string{self.node.journalPath}
+	for _, node := range self.node.getFrontierNodes() {
+		for _, metadata := range node.collectMetadatas() {
+			if state, _ := metadata.getState(); state == Queued || state == Running {
+				dirs = append(dirs, metadata.path)
+			}
+		}
+	}
+	return watcher.Watch(dirs)
+}
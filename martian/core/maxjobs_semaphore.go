@@ -107,6 +107,20 @@ func (self *MaxJobsSemaphore) Release(metadata *Metadata) {
 	}
 }
 
+// Change the maximum number of jobs.  Jobs which are already running are
+// not affected if the limit is reduced.
+func (self *MaxJobsSemaphore) SetLimit(limit int) {
+	if limit < 1 {
+		panic("Invalid max jobs limit")
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if limit > self.Limit {
+		self.cond.Broadcast()
+	}
+	self.Limit = limit
+}
+
 func (self *MaxJobsSemaphore) Current() int {
 	self.lock.Lock()
 	defer self.lock.Unlock()
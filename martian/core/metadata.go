@@ -5,8 +5,10 @@ package core
 // Martian runtime. This is where the action happens.
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -31,6 +33,7 @@ const (
 	Assert         MetadataFileName = "assert"
 	ChunkDefsFile  MetadataFileName = "chunk_defs"
 	ChunkOutsFile  MetadataFileName = "chunk_outs"
+	ChecksumsFile  MetadataFileName = "checksums"
 	CompleteFile   MetadataFileName = "complete"
 	Errors         MetadataFileName = "errors"
 	FinalState     MetadataFileName = "finalstate"
@@ -42,6 +45,8 @@ const (
 	Lock           MetadataFileName = "lock"
 	LogFile        MetadataFileName = "log"
 	MetadataZip    MetadataFileName = "metadata.zip"
+	ArchiveFile    MetadataFileName = "metadata_archive.zip"
+	MetadataDb     MetadataFileName = "metadata.db"
 	MroSourceFile  MetadataFileName = "mrosource"
 	OutsFile       MetadataFileName = "outs"
 	Perf           MetadataFileName = "perf"
@@ -56,11 +61,15 @@ const (
 	TagsFile       MetadataFileName = "tags"
 	TimestampFile  MetadataFileName = "timestamp"
 	UiPort         MetadataFileName = "uiport"
+	UiCert         MetadataFileName = "uicert"
+	UiControl      MetadataFileName = "uicontrol"
+	AuditLog       MetadataFileName = "audit"
 	UuidFile       MetadataFileName = "uuid"
 	VdrKill        MetadataFileName = "vdrkill"
 	PartialVdr     MetadataFileName = "vdrkill.partial"
 	VersionsFile   MetadataFileName = "versions"
 	DisabledFile   MetadataFileName = "disabled"
+	TargetsFile    MetadataFileName = "targets"
 )
 
 const MetadataFilePrefix string = "_"
@@ -84,6 +93,10 @@ const (
 	Ready         MetadataState = "ready"
 	Waiting       MetadataState = ""
 	ForkWaiting   MetadataState = "waiting"
+
+	// The final state of a pipestance which stopped after its target
+	// stages completed.
+	Paused MetadataState = "paused"
 )
 
 const (
@@ -142,6 +155,13 @@ type Metadata struct {
 	mutex         sync.Mutex
 	uniquifier    string
 
+	// The storage backend for the pipestance.
+	store metadataStore
+
+	// The archive for the stage, into which these metadata files may have
+	// been compacted.
+	archive *metadataArchive
+
 	// A prefix to attach when writing journal file name.
 	// Empty for chunks, or SplitPrefix or JoinPrefix.
 	journalPrefix string
@@ -161,6 +181,36 @@ type MetadataInfo struct {
 	Names []string `json:"names"`
 }
 
+// Get the state implied by the set of metadata files present, following the
+// same rules as the runtime uses for live metadata.
+func (self *MetadataInfo) State() MetadataState {
+	if self == nil {
+		return Waiting
+	}
+	has := func(name MetadataFileName) bool {
+		for _, n := range self.Names {
+			if n == string(name) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has(Errors), has(Assert):
+		return Failed
+	case has(CompleteFile):
+		return Complete
+	case has(DisabledFile):
+		return DisabledState
+	case has(LogFile):
+		return Running
+	case has(JobInfoFile):
+		return Queued
+	default:
+		return Waiting
+	}
+}
+
 func NewMetadata(fqname string, p string) *Metadata {
 	return &Metadata{
 		fqname:        fqname,
@@ -170,6 +220,7 @@ func NewMetadata(fqname string, p string) *Metadata {
 		readCache:     make(map[MetadataFileName]LazyArgumentMap),
 		curFilesPath:  path.Join(p, "files"),
 		finalFilePath: path.Join(p, "files"),
+		store:         filesMetadataStore{},
 	}
 }
 
@@ -340,6 +391,14 @@ func (self *Metadata) removeAll() error {
 	}
 	self.notRunningSince = time.Time{}
 	self.lastRefresh = time.Time{}
+	if err := self.store.removeAll(self.path); err != nil {
+		return err
+	}
+	if self.archive != nil {
+		if err := self.archive.drop(self.path); err != nil {
+			return err
+		}
+	}
 	if err := os.RemoveAll(self.curFilesPath); err != nil {
 		return err
 	}
@@ -443,7 +502,11 @@ func (self *Metadata) discoverUniquifier() string {
 
 func (self *Metadata) loadCache() {
 	self.discoverUniquify()
-	paths := self.glob()
+	names := self.store.list(self.path)
+	var archived []MetadataFileName
+	if self.archive != nil {
+		archived = self.archive.list(self.path)
+	}
 	self.mutex.Lock()
 	if len(self.contents) > 0 {
 		self.contents = make(map[MetadataFileName]bool)
@@ -451,8 +514,11 @@ func (self *Metadata) loadCache() {
 	if len(self.readCache) > 0 {
 		self.readCache = make(map[MetadataFileName]LazyArgumentMap)
 	}
-	for _, p := range paths {
-		self.contents[metadataFileNameFromPath(p)] = true
+	for _, name := range names {
+		self.contents[name] = true
+	}
+	for _, name := range archived {
+		self.contents[name] = true
 	}
 	self.notRunningSince = time.Time{}
 	self.lastRefresh = time.Time{}
@@ -481,8 +547,27 @@ func (self *Metadata) exists(name MetadataFileName) bool {
 	return ok
 }
 
+// Opens a metadata file from the store, falling back to the stage archive.
+// The size limit, if positive, applies to reading from the archive.
+func (self *Metadata) open(name MetadataFileName, limit int64) (io.ReadCloser, int64, error) {
+	r, size, err := self.store.open(self.path, name)
+	if err != nil && os.IsNotExist(err) && self.archive != nil {
+		if b, aerr := self.archive.readFile(self.path, name, limit); aerr == nil {
+			return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+		} else if !os.IsNotExist(aerr) {
+			return nil, 0, aerr
+		}
+	}
+	return r, size, err
+}
+
 func (self *Metadata) readRawBytes(name MetadataFileName) ([]byte, error) {
-	return ioutil.ReadFile(self.MetadataFilePath(name))
+	r, _, err := self.open(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
 }
 
 func (self *Metadata) readRawSafe(name MetadataFileName) (string, error) {
@@ -508,8 +593,9 @@ func (self *Metadata) saveToCache(name MetadataFileName, value LazyArgumentMap)
 	self.mutex.Unlock()
 }
 
-func (self *Metadata) openFile(name MetadataFileName) (*os.File, error) {
-	return os.Open(self.MetadataFilePath(name))
+func (self *Metadata) openFile(name MetadataFileName) (io.ReadCloser, error) {
+	r, _, err := self.open(name, 0)
+	return r, err
 }
 
 func (self *Metadata) read(name MetadataFileName, limit int64) (LazyArgumentMap, error) {
@@ -518,7 +604,7 @@ func (self *Metadata) read(name MetadataFileName, limit int64) (LazyArgumentMap,
 		return v, nil
 	}
 	p := self.MetadataFilePath(name)
-	if f, err := os.Open(p); err != nil {
+	if f, size, err := self.open(name, limit); err != nil {
 		if !os.IsNotExist(err) {
 			util.LogError(err, "runtime",
 				"Could not open %s",
@@ -526,17 +612,13 @@ func (self *Metadata) read(name MetadataFileName, limit int64) (LazyArgumentMap,
 		}
 		return nil, err
 	} else {
-		if err := func(p string, f *os.File, limit int64, v *LazyArgumentMap) error {
+		if err := func(p string, f io.ReadCloser, limit int64, v *LazyArgumentMap) error {
 			defer f.Close()
-			if limit > 0 {
-				if info, err := f.Stat(); err != nil {
-					return err
-				} else if info.Size() > limit {
-					return fmt.Errorf(
-						"Insufficient memory to read %s\n"+
-							"File is %d bytes, read size limited to %d bytes.",
-						p, info.Size(), limit)
-				}
+			if limit > 0 && size > limit {
+				return fmt.Errorf(
+					"Insufficient memory to read %s\n"+
+						"File is %d bytes, read size limited to %d bytes.",
+					p, size, limit)
 			}
 			dec := json.NewDecoder(f)
 			return dec.Decode(v)
@@ -590,6 +672,15 @@ func (self *Metadata) WriteRawBytes(name MetadataFileName, text []byte) error {
 	return err
 }
 
+// Writes a file which should only be readable by the owner of the pipestance.
+func (self *Metadata) writeRawPrivate(name MetadataFileName, text string) error {
+	fn := self.MetadataFilePath(name)
+	// WriteFile does not change the permissions of an existing file.
+	os.Remove(fn)
+	self.cache(name, self.uniquifier)
+	return ioutil.WriteFile(fn, []byte(text), 0600)
+}
+
 func (self *Metadata) appendRaw(name MetadataFileName, text string) error {
 	self.cache(name, self.uniquifier)
 	if f, err := os.OpenFile(self.MetadataFilePath(name),
@@ -673,11 +764,27 @@ func (self *Metadata) UpdateJournal(name MetadataFileName) error {
 
 func (self *Metadata) remove(name MetadataFileName) error {
 	self.uncache(name)
-	return os.Remove(self.MetadataFilePath(name))
+	return self.store.remove(self.path, name)
 }
 func (self *Metadata) _removeNoLock(name MetadataFileName) error {
 	self._uncacheNoLock(name)
-	return os.Remove(self.MetadataFilePath(name))
+	return self.store.remove(self.path, name)
+}
+
+// Moves the metadata files for a finished job from disk into the metadata
+// store, if the store is not just the files on disk.
+func (self *Metadata) ingest() error {
+	if _, ok := self.store.(filesMetadataStore); ok {
+		return nil
+	}
+	paths := self.glob()
+	names := make([]MetadataFileName, 0, len(paths))
+	for _, p := range paths {
+		if name := metadataFileNameFromPath(p); !unarchivedMetadata[name] {
+			names = append(names, name)
+		}
+	}
+	return self.store.ingest(self.path, names)
 }
 
 func (self *Metadata) clearReadCache() {
@@ -0,0 +1,436 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Rolling compaction of metadata files into per-stage archives.
+//
+
+package core
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Large pipestances create a great many small metadata files, which is
+// expensive for network filesystems.  Once every fork of a stage completes,
+// the metadata files for their splits, chunks and joins can be moved into a
+// zip archive in the stage directory.  Metadata objects transparently fall back
+// to reading from the archive for files which are not on disk.
+//
+// Entries in the archive are named by their path relative to the stage
+// directory, using the uniquified directory names rather than the symlinks
+// to them, so that the archive can be merged into the pipestance
+// metadata.zip.
+type metadataArchive struct {
+	// The stage directory containing the archive.
+	dir string
+
+	// The archive file, if it is not the usual one in dir.
+	zipPath string
+
+	mutex  sync.Mutex
+	loaded bool
+	reader *zip.ReadCloser
+	files  map[string]*zip.File
+
+	// The archived metadata file names for each directory, relative to dir.
+	names map[string][]MetadataFileName
+
+	// Set once the metadata for the stage's forks has been added, so that
+	// the archive is only written once per stage.
+	compacted bool
+
+	// The targets of symlinks in the archive.  Stage archives have none, but
+	// the pipestance metadata.zip includes the links to uniquified
+	// directories.
+	links map[string]string
+}
+
+// Metadata files which are not archived, because the runtime expects to
+// be able to remove them.
+var unarchivedMetadata = map[MetadataFileName]bool{
+	JobId:         true,
+	QueuedLocally: true,
+	Lock:          true,
+}
+
+func newMetadataArchive(dir string) *metadataArchive {
+	return &metadataArchive{dir: dir}
+}
+
+// Read metadata from a zipped pipestance's metadata.zip, without unpacking
+// it.  Such an archive must not be modified.
+func newMetadataZipReader(psPath string) *metadataArchive {
+	return &metadataArchive{
+		dir:     psPath,
+		zipPath: path.Join(psPath, MetadataZip.FileName()),
+	}
+}
+
+// The location of the archive file.
+func (self *metadataArchive) archivePath() string {
+	if self.zipPath != "" {
+		return self.zipPath
+	}
+	return path.Join(self.dir, ArchiveFile.FileName())
+}
+
+// Must be called within a lock.
+func (self *metadataArchive) _loadNoLock() error {
+	if self.loaded {
+		return nil
+	}
+	self.loaded = true
+	self.files = nil
+	self.names = nil
+	self.links = nil
+	zr, err := zip.OpenReader(self.archivePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		util.LogError(err, "runtime", "Could not read metadata archive %s",
+			self.archivePath())
+		return err
+	}
+	self.reader = zr
+	self.files = make(map[string]*zip.File, len(zr.File))
+	self.names = make(map[string][]MetadataFileName)
+	if links, err := util.ZipSymlinks(&zr.Reader); err != nil {
+		util.LogError(err, "runtime", "Could not read links in %s",
+			self.archivePath())
+	} else {
+		self.links = links
+	}
+	for _, f := range zr.File {
+		if self.links[f.Name] != "" {
+			continue
+		}
+		self.files[f.Name] = f
+		dir, name := path.Split(f.Name)
+		dir = path.Clean(dir)
+		self.names[dir] = append(self.names[dir], metadataFileNameFromPath(name))
+	}
+	return nil
+}
+
+// Must be called within a lock.
+func (self *metadataArchive) _closeNoLock() {
+	if self.reader != nil {
+		self.reader.Close()
+		self.reader = nil
+	}
+	self.loaded = false
+	self.files = nil
+	self.names = nil
+	self.links = nil
+}
+
+// Get the directory name within the archive for a metadata directory.
+func (self *metadataArchive) relDir(dir string) (string, error) {
+	rel, err := filepath.Rel(self.dir, dir)
+	if err != nil {
+		return "", err
+	} else if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is not inside %s", dir, self.dir)
+	}
+	return rel, nil
+}
+
+// Get the names of the metadata files archived for the given directory.
+func (self *metadataArchive) list(dir string) []MetadataFileName {
+	rel, err := self.relDir(dir)
+	if err != nil {
+		return nil
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self._loadNoLock() != nil {
+		return nil
+	}
+	return self.names[util.ResolveZipSymlinks(self.links, rel)]
+}
+
+// Reads an archived metadata file.  If limit is positive, files larger than
+// limit are not read.  The content is read while holding the lock, so that
+// concurrent compaction cannot close the archive out from under the reader.
+func (self *metadataArchive) readFile(dir string, name MetadataFileName, limit int64) ([]byte, error) {
+	rel, err := self.relDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err := self._loadNoLock(); err != nil {
+		return nil, err
+	}
+	fn := util.ResolveZipSymlinks(self.links, path.Join(rel, name.FileName()))
+	f := self.files[fn]
+	if f == nil {
+		return nil, os.ErrNotExist
+	}
+	if limit > 0 && f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf(
+			"Insufficient memory to read %s\n"+
+				"File is %d bytes, read size limited to %d bytes.",
+			path.Join(dir, name.FileName()), f.UncompressedSize64, limit)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Replace the archive with one containing the entries of the current archive
+// for which keep returns true, plus the given files.
+//
+// Must be called within a lock.
+func (self *metadataArchive) _rewriteNoLock(keep func(string) bool, filePaths []string) error {
+	if err := self._loadNoLock(); err != nil {
+		return err
+	}
+	zipPath := self.archivePath()
+	tmpPath := zipPath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := func() error {
+		defer f.Close()
+		zw := zip.NewWriter(f)
+		if self.reader != nil {
+			if err := util.CopyZipEntries(zw, zipPath, "", keep); err != nil {
+				return err
+			}
+		}
+		if err := util.WriteZipFiles(zw, self.dir, filePaths); err != nil {
+			return err
+		}
+		return zw.Close()
+	}(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	self._closeNoLock()
+	if err := os.Rename(tmpPath, zipPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Moves the metadata files for the given metadata objects into the archive.
+func (self *metadataArchive) add(metadatas []*Metadata) error {
+	var filePaths []string
+	added := make(map[string]bool)
+	for _, metadata := range metadatas {
+		for _, p := range metadata.glob() {
+			if unarchivedMetadata[metadataFileNameFromPath(p)] {
+				continue
+			}
+			if info, err := os.Lstat(p); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if rel, err := self.relDir(p); err != nil {
+				return err
+			} else {
+				added[rel] = true
+			}
+			filePaths = append(filePaths, p)
+		}
+	}
+	if len(filePaths) == 0 {
+		return nil
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	util.EnterCriticalSection()
+	defer util.ExitCriticalSection()
+	if err := self._rewriteNoLock(func(name string) bool {
+		return !added[name]
+	}, filePaths); err != nil {
+		return err
+	}
+	// The archive was written successfully, so the originals are no longer
+	// required.
+	for _, p := range filePaths {
+		os.Remove(p)
+	}
+	return nil
+}
+
+// Removes the archived files for the given directory.
+func (self *metadataArchive) drop(dir string) error {
+	rel, err := self.relDir(dir)
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err := self._loadNoLock(); err != nil {
+		return err
+	}
+	self.compacted = false
+	if len(self.names[rel]) == 0 {
+		return nil
+	}
+	if len(self.names) == 1 {
+		self._closeNoLock()
+		return os.Remove(self.archivePath())
+	}
+	return self._rewriteNoLock(func(name string) bool {
+		return path.Dir(name) != rel
+	}, nil)
+}
+
+// Returns true if the archive exists and has not been cleared.
+func (self *metadataArchive) exists() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self._loadNoLock()
+	return self.reader != nil
+}
+
+// Forget the contents of the archive, after its entries were copied into the
+// pipestance metadata.zip, and remove it.
+func (self *metadataArchive) clear() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self._closeNoLock()
+	self.loaded = true
+	return os.Remove(self.archivePath())
+}
+
+// Forget the contents of the archive, after the stage directory containing
+// it was removed.
+func (self *metadataArchive) reset() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self._closeNoLock()
+	self.compacted = false
+}
+
+// Returns true the first time it is called after the archive was reset, so
+// that only one caller compacts the stage.
+func (self *metadataArchive) claimCompaction() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.compacted {
+		return false
+	}
+	self.compacted = true
+	return true
+}
+
+// Moves the metadata for the split, chunks and join of a completed fork into
+// the metadata store.  Once every fork of the stage is complete, whatever
+// remains on disk is compacted into the stage's metadata archive.
+func (self *Fork) compactMetadata() {
+	if self.ingestMetadata() {
+		self.node.compactMetadata()
+	}
+}
+
+// Moves the metadata for the split, chunks and join into the metadata store,
+// if the fork is complete.
+func (self *Fork) ingestMetadata() bool {
+	self.storageLock.Lock()
+	defer self.storageLock.Unlock()
+	if self.getState() != Complete {
+		return false
+	}
+	for _, metadata := range self.collectMetadatas()[1:] {
+		if err := metadata.ingest(); err != nil {
+			util.LogError(err, "runtime",
+				"Could not store metadata for %s", metadata.fqname)
+		}
+	}
+	return true
+}
+
+// Compacts the metadata for the split, chunks and join of every fork into
+// the stage's metadata archive, once all of the forks are complete.  The
+// archive is written once per stage, since it must be rewritten in full to
+// add entries.
+func (self *Node) compactMetadata() {
+	if !self.rt.Config.CompactMetadata || self.archive == nil {
+		return
+	}
+	for _, fork := range self.forks {
+		if fork.getState() != Complete {
+			return
+		}
+	}
+	if !self.archive.claimCompaction() {
+		return
+	}
+	// Hold every fork's storage lock, in order, so that the files are not
+	// removed by storage management while they are being archived.
+	var metadatas []*Metadata
+	for _, fork := range self.forks {
+		fork.storageLock.Lock()
+		defer fork.storageLock.Unlock()
+		metadatas = append(metadatas, fork.collectMetadatas()[1:]...)
+	}
+	if err := self.archive.add(metadatas); err != nil {
+		util.LogError(err, "runtime",
+			"Could not compact metadata for %s", self.fqname)
+	} else if self.rt.Config.Debug {
+		util.LogInfo("runtime", "Compacted metadata for %s", self.fqname)
+	}
+}
+
+// ReadMetadataFile reads a metadata file, falling back to the pipestance's
+// metadata store or the archive for its stage if the file is not on disk.
+func ReadMetadataFile(p string) ([]byte, error) {
+	b, err := ioutil.ReadFile(p)
+	if err == nil || !os.IsNotExist(err) {
+		return b, err
+	}
+	if db := findMetadataDb(p); db != nil {
+		if b, err := db.readPath(p); err == nil {
+			return b, nil
+		}
+	}
+	if r, aerr := openArchivedMetadata(p); aerr == nil {
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return b, err
+}
+
+// Opens a metadata file from the archive for its stage.  The archive is in
+// the stage directory, which is at most two levels above the directory for
+// a split, chunk or join.
+func openArchivedMetadata(p string) (io.ReadCloser, error) {
+	dir, name := path.Split(p)
+	if !strings.HasPrefix(name, MetadataFilePrefix) {
+		return nil, os.ErrNotExist
+	}
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	for d, i := dir, 0; i < 3; d, i = path.Dir(d), i+1 {
+		zipPath := path.Join(d, ArchiveFile.FileName())
+		if _, err := os.Stat(zipPath); err == nil {
+			rel, err := filepath.Rel(d, path.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			return util.ReadZipFile(zipPath, rel)
+		}
+	}
+	return nil, os.ErrNotExist
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestMetadataArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testMetadataArchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	util.SetupSignalHandlers()
+	stagePath := path.Join(dir, "STAGE")
+	archive := newMetadataArchive(stagePath)
+	newChunk := func(name string) *Metadata {
+		md := NewMetadata("ID.ps.STAGE.fork0."+name,
+			path.Join(stagePath, "fork0", name))
+		md.archive = archive
+		return md
+	}
+	if err := os.MkdirAll(path.Join(stagePath, "fork0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	chunk := newChunk("chnk0")
+	if err := chunk.uniquify(); err != nil {
+		t.Fatal(err)
+	}
+	other := newChunk("chnk1")
+	if err := other.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	chunk.WriteRaw(OutsFile, `{"foo": "bar"}`)
+	chunk.WriteRaw(JobId, "1234")
+	chunk.WriteTime(CompleteFile)
+	other.WriteRaw(OutsFile, `{"foo": "baz"}`)
+
+	if err := archive.add([]*Metadata{chunk, other}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(chunk.MetadataFilePath(OutsFile)); !os.IsNotExist(err) {
+		t.Error("Expected outs to be removed after compaction.")
+	}
+	if _, err := os.Stat(chunk.MetadataFilePath(JobId)); err != nil {
+		t.Error("Expected jobid to be left in place.")
+	}
+
+	// Reload, as if reattaching.
+	chunk = newChunk("chnk0")
+	chunk.discoverUniquify()
+	chunk.loadCache()
+	if !chunk.exists(OutsFile) || !chunk.exists(CompleteFile) {
+		t.Error("Expected archived files to be listed.")
+	}
+	if s := chunk.readRaw(OutsFile); s != `{"foo": "bar"}` {
+		t.Errorf("Expected archived outs, got %q", s)
+	}
+	if outs, err := chunk.read(OutsFile, 1024); err != nil {
+		t.Error(err)
+	} else if _, ok := outs["foo"]; !ok {
+		t.Errorf("Expected foo in outs, got %v", outs)
+	}
+	chunk.clearReadCache()
+	if _, err := chunk.read(OutsFile, 4); err == nil {
+		t.Error("Expected read limit to be enforced.")
+	}
+	// Reading through the symlink should find the uniquified directory.
+	if b, err := ReadMetadataFile(path.Join(stagePath, "fork0", "chnk1",
+		OutsFile.FileName())); err != nil {
+		t.Error(err)
+	} else if string(b) != `{"foo": "baz"}` {
+		t.Errorf("Expected archived outs, got %q", b)
+	}
+	if b, err := ReadMetadataFile(path.Join(stagePath, "fork0", "chnk0",
+		OutsFile.FileName())); err != nil {
+		t.Error(err)
+	} else if string(b) != `{"foo": "bar"}` {
+		t.Errorf("Expected archived outs, got %q", b)
+	}
+
+	// Merging into the pipestance metadata zip.
+	zipPath := path.Join(dir, MetadataZip.FileName())
+	if err := createMetadataZip(zipPath, chunk.symlinks(),
+		[]*metadataArchive{archive}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := util.ReadZip(zipPath, "STAGE/fork0/chnk0/_outs"); err != nil {
+		t.Error(err)
+	} else if string(b) != `{"foo": "bar"}` {
+		t.Errorf("Expected zipped outs, got %q", b)
+	}
+
+	// Resetting a chunk removes its archived files.
+	if err := chunk.removeAll(); err != nil {
+		t.Fatal(err)
+	}
+	if names := archive.list(chunk.path); len(names) != 0 {
+		t.Errorf("Expected no archived files after reset, got %v", names)
+	}
+	if s := other.readRaw(OutsFile); s != `{"foo": "baz"}` {
+		t.Errorf("Expected other chunk to remain archived, got %q", s)
+	}
+}
+
+func TestMetadataZipReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testMetadataZipReader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	forkPath := path.Join(dir, "STAGE", "fork0")
+	chunkPath := path.Join(forkPath, "chnk0-u0123456789")
+	if err := os.MkdirAll(chunkPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outs := path.Join(chunkPath, OutsFile.FileName())
+	if err := ioutil.WriteFile(outs, []byte(`{"foo": "bar"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := path.Join(forkPath, "chnk0")
+	if err := os.Symlink("chnk0-u0123456789", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := util.CreateZip(path.Join(dir, MetadataZip.FileName()),
+		[]string{outs, link}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(path.Join(dir, "STAGE")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chunk is found through the link to its uniquified directory.
+	chunk := NewMetadata("ID.ps.STAGE.fork0.chnk0", link)
+	chunk.archive = newMetadataZipReader(dir)
+	chunk.loadCache()
+	if !chunk.exists(OutsFile) {
+		t.Error("Expected outs to be listed.")
+	}
+	if s := chunk.readRaw(OutsFile); s != `{"foo": "bar"}` {
+		t.Errorf("Incorrect outs %q", s)
+	}
+}
@@ -0,0 +1,593 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Storage backends for pipestance metadata.
+//
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The storage backend for the metadata files of a pipestance.
+//
+// Jobs always read and write their metadata as files in the node directories,
+// so metadata is always written to disk first.  Once a job is finished, its
+// metadata may be ingested into the store, after which the files on disk are
+// no longer required.  Files on disk take precedence over stored copies.
+type metadataStore interface {
+	// Get the names of the metadata files for the given directory.
+	list(dir string) []MetadataFileName
+
+	// Open a metadata file, returning a reader and the size of the file.
+	open(dir string, name MetadataFileName) (io.ReadCloser, int64, error)
+
+	// Move the given metadata files from disk into the store.
+	ingest(dir string, names []MetadataFileName) error
+
+	// Remove a metadata file.
+	remove(dir string, name MetadataFileName) error
+
+	// Remove all of the stored metadata files for a directory.  This does
+	// not remove the directory on disk.
+	removeAll(dir string) error
+
+	// Remove all of the stored metadata files for a directory and all of
+	// its subdirectories.
+	removeTree(dir string) error
+}
+
+const (
+	// The default metadata store, with one file per metadata key.
+	FilesMetadataStore = "files"
+
+	// A metadata store which keeps completed metadata in a single file,
+	// which is much easier on network filesystems for large pipestances.
+	DbMetadataStore = "db"
+)
+
+// The metadata store which keeps everything as files on disk.
+type filesMetadataStore struct{}
+
+func (filesMetadataStore) list(dir string) []MetadataFileName {
+	paths, _ := filepath.Glob(path.Join(dir, AnyFile.FileName()))
+	names := make([]MetadataFileName, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, metadataFileNameFromPath(p))
+	}
+	return names
+}
+
+func (filesMetadataStore) open(dir string, name MetadataFileName) (io.ReadCloser, int64, error) {
+	f, err := os.Open(path.Join(dir, name.FileName()))
+	if err != nil {
+		return nil, 0, err
+	}
+	if info, err := f.Stat(); err != nil {
+		f.Close()
+		return nil, 0, err
+	} else {
+		return f, info.Size(), nil
+	}
+}
+
+func (filesMetadataStore) ingest(string, []MetadataFileName) error {
+	return nil
+}
+
+func (filesMetadataStore) remove(dir string, name MetadataFileName) error {
+	return os.Remove(path.Join(dir, name.FileName()))
+}
+
+func (filesMetadataStore) removeAll(string) error {
+	return nil
+}
+
+func (filesMetadataStore) removeTree(string) error {
+	return nil
+}
+
+// Get the metadata store for a pipestance.  Pipestances which were created
+// with the database store have a metadata database in their top-level
+// directory.
+func newMetadataStore(psPath string) metadataStore {
+	if db := getMetadataDb(psPath); db != nil {
+		return db
+	}
+	return filesMetadataStore{}
+}
+
+// Create the metadata store for a new pipestance.
+func createMetadataStore(psPath, storeType string) error {
+	switch storeType {
+	case "", FilesMetadataStore:
+		return nil
+	case DbMetadataStore:
+		f, err := os.OpenFile(path.Join(psPath, MetadataDb.FileName()),
+			os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.WriteString(metadataDbMagic)
+		return err
+	default:
+		return fmt.Errorf("Unknown metadata store %q", storeType)
+	}
+}
+
+//=============================================================================
+// Single-file metadata database.
+//=============================================================================
+
+// The metadata database is an append-only log of records.  Each record is
+//
+//	op (1 byte) | key length (uvarint) | key | value length (uvarint) |
+//	value | crc32 of the preceding fields (4 bytes, big-endian)
+//
+// where the key is the path of the metadata file relative to the pipestance
+// directory.  An index of the latest record for each key is kept in memory.
+// A torn record at the end of the file, from a crash during a write, is
+// ignored, and removed when the file is next opened for writing.
+const metadataDbMagic = "MROMDB1\n"
+
+const (
+	metadataDbPut    byte = 'P'
+	metadataDbDelete byte = 'D'
+)
+
+var errMetadataDbCorrupt = errors.New("corrupt metadata database record")
+
+type metadataDbEntry struct {
+	offset int64
+	size   int64
+}
+
+type metadataDb struct {
+	// The pipestance directory.
+	root string
+
+	mutex    sync.Mutex
+	file     *os.File
+	writable bool
+
+	// The end of the last valid record in the file.
+	end int64
+
+	entries map[string]metadataDbEntry
+	dirs    map[string]map[MetadataFileName]struct{}
+}
+
+// Databases which have been opened by this process, by pipestance path, so
+// that every reader shares one index.
+var metadataDbs = struct {
+	sync.Mutex
+	dbs map[string]*metadataDb
+}{dbs: make(map[string]*metadataDb)}
+
+// Get the metadata database for the pipestance, or nil if it does not use
+// one.
+func getMetadataDb(psPath string) *metadataDb {
+	metadataDbs.Lock()
+	defer metadataDbs.Unlock()
+	if db := metadataDbs.dbs[psPath]; db != nil {
+		return db
+	}
+	if _, err := os.Stat(path.Join(psPath, MetadataDb.FileName())); err != nil {
+		return nil
+	}
+	db := &metadataDb{
+		root:    psPath,
+		entries: make(map[string]metadataDbEntry),
+		dirs:    make(map[string]map[MetadataFileName]struct{}),
+	}
+	metadataDbs.dbs[psPath] = db
+	return db
+}
+
+func (self *metadataDb) dbPath() string {
+	return path.Join(self.root, MetadataDb.FileName())
+}
+
+// Get the directory key for a metadata directory.
+func (self *metadataDb) relDir(dir string) (string, error) {
+	rel, err := filepath.Rel(self.root, dir)
+	if err != nil {
+		return "", err
+	} else if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is not inside %s", dir, self.root)
+	}
+	return rel, nil
+}
+
+// Read any records which were appended since the last scan, possibly by
+// another process.
+//
+// Must be called within a lock.
+func (self *metadataDb) _refreshNoLock() error {
+	if self.file == nil {
+		f, err := os.Open(self.dbPath())
+		if err != nil {
+			return err
+		}
+		self.file = f
+	}
+	info, err := self.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() <= self.end {
+		return nil
+	}
+	reader := bufio.NewReader(io.NewSectionReader(self.file,
+		self.end, info.Size()-self.end))
+	if self.end == 0 {
+		magic := make([]byte, len(metadataDbMagic))
+		if _, err := io.ReadFull(reader, magic); err != nil {
+			return err
+		} else if string(magic) != metadataDbMagic {
+			return fmt.Errorf("%s is not a metadata database", self.dbPath())
+		}
+		self.end = int64(len(metadataDbMagic))
+	}
+	for {
+		n, err := self._readRecordNoLock(reader)
+		if err != nil {
+			// io.EOF at a record boundary is the normal end.  Anything else
+			// is a torn or in-progress write, which will be re-read or
+			// overwritten later.
+			return nil
+		}
+		self.end += n
+	}
+}
+
+// Counts bytes read by a record parser.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Reads one record and updates the index.  Returns the size of the record.
+//
+// Must be called within a lock.
+func (self *metadataDb) _readRecordNoLock(reader *bufio.Reader) (int64, error) {
+	r := &countingReader{r: reader}
+	crc := crc32.NewIEEE()
+	op, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	crc.Write([]byte{op})
+	readField := func() ([]byte, int64, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, 0, err
+		} else if l > math.MaxInt32 {
+			return nil, 0, errMetadataDbCorrupt
+		}
+		var lb [binary.MaxVarintLen64]byte
+		crc.Write(lb[:binary.PutUvarint(lb[:], l)])
+		start := r.n
+		b := make([]byte, l)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, 0, err
+		}
+		crc.Write(b)
+		return b, start, nil
+	}
+	key, _, err := readField()
+	if err != nil {
+		return 0, errMetadataDbCorrupt
+	}
+	value, valueStart, err := readField()
+	if err != nil {
+		return 0, errMetadataDbCorrupt
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return 0, errMetadataDbCorrupt
+	} else if binary.BigEndian.Uint32(sum[:]) != crc.Sum32() {
+		return 0, errMetadataDbCorrupt
+	}
+	k := string(key)
+	dir, name := path.Split(k)
+	dir = path.Clean(dir)
+	mdName := metadataFileNameFromPath(name)
+	switch op {
+	case metadataDbPut:
+		self.entries[k] = metadataDbEntry{
+			offset: self.end + valueStart,
+			size:   int64(len(value)),
+		}
+		names := self.dirs[dir]
+		if names == nil {
+			names = make(map[MetadataFileName]struct{})
+			self.dirs[dir] = names
+		}
+		names[mdName] = struct{}{}
+	case metadataDbDelete:
+		delete(self.entries, k)
+		if names := self.dirs[dir]; names != nil {
+			delete(names, mdName)
+			if len(names) == 0 {
+				delete(self.dirs, dir)
+			}
+		}
+	default:
+		return 0, errMetadataDbCorrupt
+	}
+	return r.n, nil
+}
+
+func appendMetadataDbRecord(buf *bytes.Buffer, op byte, key string, value []byte) {
+	start := buf.Len()
+	buf.WriteByte(op)
+	var lb [binary.MaxVarintLen64]byte
+	buf.Write(lb[:binary.PutUvarint(lb[:], uint64(len(key)))])
+	buf.WriteString(key)
+	buf.Write(lb[:binary.PutUvarint(lb[:], uint64(len(value)))])
+	buf.Write(value)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf.Bytes()[start:]))
+	buf.Write(sum[:])
+}
+
+// Append records to the database.
+//
+// Must be called within a lock.
+func (self *metadataDb) _appendNoLock(records *bytes.Buffer) error {
+	if err := self._refreshNoLock(); err != nil {
+		return err
+	}
+	if !self.writable {
+		f, err := os.OpenFile(self.dbPath(), os.O_RDWR|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		self.file.Close()
+		self.file = f
+		self.writable = true
+		// Discard any torn record at the end of the file.  This is only done
+		// on open, since afterwards bytes past the end of the last record
+		// read may be a record which another process is still appending.
+		if err := self.file.Truncate(self.end); err != nil {
+			return err
+		}
+	}
+	if _, err := self.file.Write(records.Bytes()); err != nil {
+		// Reopen before the next append, so that the partial write is
+		// discarded.
+		self.file.Close()
+		self.file = nil
+		self.writable = false
+		return err
+	}
+	if err := self.file.Sync(); err != nil {
+		return err
+	}
+	// Index the new records, along with any appended by other processes.
+	return self._refreshNoLock()
+}
+
+func (self *metadataDb) list(dir string) []MetadataFileName {
+	rel, err := self.relDir(dir)
+	if err != nil {
+		return filesMetadataStore{}.list(dir)
+	}
+	self.mutex.Lock()
+	self._refreshNoLock()
+	stored := self.dirs[rel]
+	names := make([]MetadataFileName, 0, len(stored))
+	for name := range stored {
+		names = append(names, name)
+	}
+	self.mutex.Unlock()
+	if _, ok := stored[CompleteFile]; ok {
+		// Metadata is only ingested once it is complete, so there is no
+		// need to scan the directory.
+		return names
+	}
+	for _, name := range (filesMetadataStore{}).list(dir) {
+		if _, ok := stored[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Read a stored metadata file.
+func (self *metadataDb) read(rel string, name MetadataFileName) ([]byte, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	key := path.Join(rel, name.FileName())
+	entry, ok := self.entries[key]
+	if !ok {
+		if err := self._refreshNoLock(); err != nil {
+			return nil, err
+		}
+		if entry, ok = self.entries[key]; !ok {
+			return nil, os.ErrNotExist
+		}
+	}
+	b := make([]byte, entry.size)
+	if _, err := self.file.ReadAt(b, entry.offset); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (self *metadataDb) open(dir string, name MetadataFileName) (io.ReadCloser, int64, error) {
+	r, size, err := filesMetadataStore{}.open(dir, name)
+	if err == nil || !os.IsNotExist(err) {
+		return r, size, err
+	}
+	rel, rerr := self.relDir(dir)
+	if rerr != nil {
+		return nil, 0, err
+	}
+	if b, rerr := self.read(rel, name); rerr != nil {
+		return nil, 0, err
+	} else {
+		return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+	}
+}
+
+func (self *metadataDb) ingest(dir string, names []MetadataFileName) error {
+	rel, err := self.relDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	var records bytes.Buffer
+	ingested := make([]string, 0, len(names))
+	for _, name := range names {
+		p := path.Join(dir, name.FileName())
+		if b, err := ioutil.ReadFile(p); err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+		} else {
+			appendMetadataDbRecord(&records, metadataDbPut,
+				path.Join(rel, name.FileName()), b)
+			ingested = append(ingested, p)
+		}
+	}
+	if len(ingested) == 0 {
+		return nil
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err := self._appendNoLock(&records); err != nil {
+		return err
+	}
+	for _, p := range ingested {
+		os.Remove(p)
+	}
+	return nil
+}
+
+func (self *metadataDb) remove(dir string, name MetadataFileName) error {
+	err := os.Remove(path.Join(dir, name.FileName()))
+	rel, rerr := self.relDir(dir)
+	if rerr != nil {
+		return err
+	}
+	key := path.Join(rel, name.FileName())
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self._refreshNoLock()
+	if _, ok := self.entries[key]; !ok {
+		return err
+	}
+	var records bytes.Buffer
+	appendMetadataDbRecord(&records, metadataDbDelete, key, nil)
+	return self._appendNoLock(&records)
+}
+
+func (self *metadataDb) removeAll(dir string) error {
+	rel, err := self.relDir(dir)
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self._refreshNoLock()
+	names := self.dirs[rel]
+	if len(names) == 0 {
+		return nil
+	}
+	var records bytes.Buffer
+	for name := range names {
+		appendMetadataDbRecord(&records, metadataDbDelete,
+			path.Join(rel, name.FileName()), nil)
+	}
+	return self._appendNoLock(&records)
+}
+
+func (self *metadataDb) removeTree(dir string) error {
+	rel, err := self.relDir(dir)
+	if err != nil {
+		return err
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self._refreshNoLock()
+	var records bytes.Buffer
+	for d, names := range self.dirs {
+		if d != rel && !strings.HasPrefix(d, rel+"/") {
+			continue
+		}
+		for name := range names {
+			appendMetadataDbRecord(&records, metadataDbDelete,
+				path.Join(d, name.FileName()), nil)
+		}
+	}
+	if records.Len() == 0 {
+		return nil
+	}
+	return self._appendNoLock(&records)
+}
+
+// Look up a metadata file by path, for clients such as the UI which do not
+// have a Metadata object.
+func (self *metadataDb) readPath(p string) ([]byte, error) {
+	dir, name := path.Split(p)
+	if !strings.HasPrefix(name, MetadataFilePrefix) {
+		return nil, os.ErrNotExist
+	}
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(self.root)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil, err
+	} else if rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, os.ErrNotExist
+	}
+	return self.read(rel, metadataFileNameFromPath(name))
+}
+
+// Find the metadata database for the pipestance containing the given path.
+func findMetadataDb(p string) *metadataDb {
+	for d := path.Dir(p); d != "/" && d != "."; d = path.Dir(d) {
+		if _, err := os.Stat(path.Join(d, InvocationFile.FileName())); err == nil {
+			return getMetadataDb(d)
+		}
+	}
+	return nil
+}
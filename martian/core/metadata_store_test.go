@@ -0,0 +1,142 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMetadataDb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testMetadataDb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := createMetadataStore(dir, DbMetadataStore); err != nil {
+		t.Fatal(err)
+	}
+	store := newMetadataStore(dir)
+	if _, ok := store.(*metadataDb); !ok {
+		t.Fatalf("Expected a database store, got %T", store)
+	}
+	newChunk := func(store metadataStore) *Metadata {
+		md := NewMetadata("ID.ps.STAGE.fork0.chnk0",
+			path.Join(dir, "STAGE", "fork0", "chnk0"))
+		md.store = store
+		return md
+	}
+	chunk := newChunk(store)
+	if err := os.MkdirAll(chunk.path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chunk.WriteRaw(OutsFile, `{"foo": "bar"}`)
+	chunk.WriteRaw(JobId, "1234")
+	chunk.WriteRaw(StdOut, "output")
+	chunk.WriteTime(CompleteFile)
+	if err := chunk.ingest(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(chunk.MetadataFilePath(OutsFile)); !os.IsNotExist(err) {
+		t.Error("Expected outs to be removed from disk.")
+	}
+	if _, err := os.Stat(chunk.MetadataFilePath(JobId)); err != nil {
+		t.Error("Expected jobid to be left on disk.")
+	}
+
+	check := func(chunk *Metadata) {
+		t.Helper()
+		chunk.loadCache()
+		if !chunk.exists(OutsFile) || !chunk.exists(CompleteFile) {
+			t.Error("Expected stored files to be listed.")
+		}
+		if state, _ := chunk.getState(); state != Complete {
+			t.Errorf("Expected complete, got %v", state)
+		}
+		if s := chunk.readRaw(StdOut); s != "output" {
+			t.Errorf("Expected stored stdout, got %q", s)
+		}
+		if outs, err := chunk.read(OutsFile, 1024); err != nil {
+			t.Error(err)
+		} else if _, ok := outs["foo"]; !ok {
+			t.Errorf("Expected foo in outs, got %v", outs)
+		}
+	}
+	check(chunk)
+
+	// A partial record at the end, from a crash, is ignored.
+	if f, err := os.OpenFile(path.Join(dir, MetadataDb.FileName()),
+		os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Write([]byte{metadataDbPut, 10, 'S'})
+		f.Close()
+	}
+	// Read it back as another process would.
+	reopened := &metadataDb{
+		root:    dir,
+		entries: make(map[string]metadataDbEntry),
+		dirs:    make(map[string]map[MetadataFileName]struct{}),
+	}
+	check(newChunk(reopened))
+	if b, err := reopened.readPath(chunk.MetadataFilePath(StdOut)); err != nil {
+		t.Error(err)
+	} else if string(b) != "output" {
+		t.Errorf("Expected stored stdout, got %q", b)
+	}
+
+	// Removal is recorded, after the partial record is discarded.
+	chunk = newChunk(reopened)
+	chunk.loadCache()
+	if err := chunk.remove(StdOut); err != nil {
+		t.Error(err)
+	}
+	if chunk.exists(StdOut) {
+		t.Error("Expected stdout to be uncached.")
+	}
+	if err := chunk.removeAll(); err != nil {
+		t.Error(err)
+	}
+	chunk = newChunk(&metadataDb{
+		root:    dir,
+		entries: make(map[string]metadataDbEntry),
+		dirs:    make(map[string]map[MetadataFileName]struct{}),
+	})
+	chunk.loadCache()
+	if chunk.exists(OutsFile) || chunk.exists(StdOut) {
+		t.Error("Expected reset metadata to be removed from the database.")
+	}
+
+	// Once the database is open for writing, bytes after the last record
+	// may be a record which another process is still writing, so they must
+	// not be truncated by later appends.
+	dbPath := path.Join(dir, MetadataDb.FileName())
+	if f, err := os.OpenFile(dbPath, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Write([]byte{metadataDbPut, 10, 'S'})
+		f.Close()
+	}
+	before, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	appendMetadataDbRecord(&buf, metadataDbDelete, "STAGE/fork0/chnk0/_log", nil)
+	size := int64(buf.Len())
+	reopened.mutex.Lock()
+	err = reopened._appendNoLock(&buf)
+	reopened.mutex.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.Stat(dbPath); err != nil {
+		t.Fatal(err)
+	} else if after.Size() != before.Size()+size {
+		t.Errorf("Expected %d bytes after append, got %d",
+			before.Size()+size, after.Size())
+	}
+}
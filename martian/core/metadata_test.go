@@ -0,0 +1,27 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestMetadataInfoState(t *testing.T) {
+	for _, c := range []struct {
+		names  []string
+		expect MetadataState
+	}{
+		{nil, Waiting},
+		{[]string{"jobinfo"}, Queued},
+		{[]string{"jobinfo", "log"}, Running},
+		{[]string{"jobinfo", "log", "complete"}, Complete},
+		{[]string{"jobinfo", "log", "complete", "errors"}, Failed},
+		{[]string{"assert"}, Failed},
+		{[]string{"disabled"}, DisabledState},
+	} {
+		info := MetadataInfo{Names: c.names}
+		if s := info.State(); s != c.expect {
+			t.Errorf("Expected %q for %v, got %q", c.expect, c.names, s)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 
 	"github.com/martian-lang/martian/martian/util"
 )
@@ -30,8 +31,8 @@ type PipestanceSetup struct {
 
 // This takes two pipestances and creates a map that associates nodes in
 // one pipestance with the nodes in the other. Nodes are associated if
-// they have the same name.
-func MapTwoPipestances(newp *Pipestance, oldp *Pipestance) map[*Node]*Node {
+// they have the same name.  It is an error if no nodes are associated.
+func MapTwoPipestances(newp *Pipestance, oldp *Pipestance) (map[*Node]*Node, error) {
 
 	/* Actually do the mapping. */
 	m := make(map[*Node]*Node)
@@ -46,9 +47,11 @@ func MapTwoPipestances(newp *Pipestance, oldp *Pipestance) map[*Node]*Node {
 	}
 
 	if count == 0 {
-		panic("Failed to link any stages between the new and old pipeline. Sorry")
+		return nil, &RuntimeError{fmt.Sprintf(
+			"Failed to link any stages between %s and %s.",
+			newp.GetPath(), oldp.GetPath())}
 	}
-	return m
+	return m, nil
 }
 
 // Helper function used by MapTwoPipestances that does the recursive enumeration
@@ -303,6 +306,15 @@ func MRTBuildPipeline(newinfo *PipestanceSetup, oldinfo *PipestanceSetup, invali
 	oldcall, err := ioutil.ReadFile(oldinfo.Srcpath)
 	util.DieIf(err)
 
+	/* The new pipestance links to the old stage directories, so the old
+	 * metadata must be unpacked.
+	 */
+	oldZip := path.Join(oldinfo.PipestancePath, MetadataZip.FileName())
+	if _, err := os.Stat(oldZip); err == nil {
+		util.DieIf(util.UnzipIgnoreExisting(oldZip))
+		os.Remove(oldZip)
+	}
+
 	psold, err := rtold.ReattachToPipestanceWithMroSrc(oldinfo.Psid,
 		oldinfo.PipestancePath,
 		string(oldcall),
@@ -320,7 +332,8 @@ func MRTBuildPipeline(newinfo *PipestanceSetup, oldinfo *PipestanceSetup, invali
 	}
 
 	/* Compute an association between nodes in the parallel pipestances */
-	mapmap := MapTwoPipestances(psnew, psold)
+	mapmap, err := MapTwoPipestances(psnew, psold)
+	util.DieIf(err)
 
 	/* Blacklist nodes in the newpipestance that have changed, as well as dependents
 	 * of changed nodes.
@@ -57,6 +57,8 @@ type Node struct {
 	fqname             string
 	path               string
 	metadata           *Metadata
+	store              metadataStore
+	archive            *metadataArchive
 	callable           syntax.Callable
 	resources          *JobResources
 	argbindings        map[string]*Binding
@@ -79,6 +81,9 @@ type Node struct {
 	modBindingList     []*Binding
 	stagecodeLang      syntax.StageCodeType
 	stagecodeCmd       string
+	container          string
+	stageEnv           map[string]string
+	pathPrefix         []string
 	journalPath        string
 	tmpPath            string
 	mroPaths           []string
@@ -119,6 +124,43 @@ type NodeInfo struct {
 
 func (self *Node) getNode() *Node { return self }
 
+// Get information about the error which caused this node to fail, or nil
+// if it has not failed.
+func (self *Node) getErrorInfo() *NodeErrorInfo {
+	if self.state != Failed {
+		return nil
+	}
+	fqname, _, summary, log, _, errpaths := self.getFatalError()
+	errpath := ""
+	if len(errpaths) > 0 {
+		errpath = errpaths[0]
+	}
+	return &NodeErrorInfo{
+		FQname:  fqname,
+		Path:    errpath,
+		Summary: summary,
+		Log:     log,
+	}
+}
+
+// Describe the state the stage just entered, if it completed or failed.
+func (self *Node) getTransition() *StageTransition {
+	if self.kind != "stage" ||
+		(self.state != Complete && self.state != Failed) {
+		return nil
+	}
+	var alarms strings.Builder
+	for _, fork := range self.forks {
+		fork.getAlarms(&alarms)
+	}
+	return &StageTransition{
+		FQname: self.fqname,
+		State:  self.state,
+		Error:  self.getErrorInfo(),
+		Alarms: alarms.String(),
+	}
+}
+
 func (self *Node) GetPrenodes() map[string]Nodable {
 	return self.prenodes
 }
@@ -147,7 +189,12 @@ func NewNode(parent Nodable, kind string, callStm *syntax.CallStm, callables *sy
 	self.mroVersion = parent.getNode().mroVersion
 	self.envs = parent.getNode().envs
 	self.invocation = parent.getNode().invocation
+	self.store = parent.getNode().store
 	self.metadata = NewMetadata(self.fqname, self.path)
+	self.metadata.store = self.store
+	if kind == "stage" {
+		self.archive = newMetadataArchive(self.path)
+	}
 	self.volatile = callStm.Modifiers.Volatile
 	self.preflight = callStm.Modifiers.Preflight
 	if self.preflight || !self.rt.Config.NeverLocal {
@@ -603,26 +650,7 @@ func (self *Node) getState() MetadataState {
 func (self *Node) reset() error {
 	if self.rt.Config.FullStageReset {
 		util.PrintInfo("runtime", "(reset)           %s", self.fqname)
-
-		// Blow away the entire stage node.
-		if err := os.RemoveAll(self.path); err != nil {
-			util.PrintInfo("runtime", "Cannot reset the stage because its folder contents could not be deleted.\n\nPlease resolve this error in order to continue running the pipeline:")
-			return err
-		}
-		// Remove all related files from journal directory.
-		if files, err := filepath.Glob(path.Join(self.journalPath, self.fqname+"*")); err == nil {
-			for _, file := range files {
-				os.Remove(file)
-			}
-		}
-
-		// Clear chunks in the forks so they can be rebuilt on split.
-		for _, fork := range self.forks {
-			fork.reset()
-		}
-
-		// Create stage node directories.
-		if err := self.mkdirs(); err != nil {
+		if err := self.resetAll(); err != nil {
 			return err
 		}
 	} else {
@@ -638,6 +666,37 @@ func (self *Node) reset() error {
 	return nil
 }
 
+// Remove everything for a stage node, including any of its metadata which
+// was moved into the metadata store or stage archive, and recreate its
+// directories.
+func (self *Node) resetAll() error {
+	if err := self.store.removeTree(self.path); err != nil {
+		return err
+	}
+	// Blow away the entire stage node.
+	if err := os.RemoveAll(self.path); err != nil {
+		util.PrintInfo("runtime", "Cannot reset the stage because its folder contents could not be deleted.\n\nPlease resolve this error in order to continue running the pipeline:")
+		return err
+	}
+	if self.archive != nil {
+		self.archive.reset()
+	}
+	// Remove all related files from journal directory.
+	if files, err := filepath.Glob(path.Join(self.journalPath, self.fqname+"*")); err == nil {
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+
+	// Clear chunks in the forks so they can be rebuilt on split.
+	for _, fork := range self.forks {
+		fork.reset()
+	}
+
+	// Create stage node directories.
+	return self.mkdirs()
+}
+
 func (self *Node) restartLocallyQueuedJobs() error {
 	if self.rt.Config.FullStageReset {
 		// If entire stages got blown away then this isn't needed.
@@ -752,6 +811,11 @@ func (self *Node) isErrorTransient() (bool, string) {
 		}
 		if metadata.exists(Errors) {
 			errlog := metadata.readRaw(Errors)
+			if limit := self.retryLimit(metadata); limit >= 0 &&
+				self.rt.getStageRetries(self.fqname) >= limit {
+				// The retries override for the stage is used up.
+				return false, errlog
+			}
 			for _, line := range strings.Split(errlog, "\n") {
 				for _, re := range passRegexp {
 					if re.MatchString(line) {
@@ -765,6 +829,50 @@ func (self *Node) isErrorTransient() (bool, string) {
 	return true, ""
 }
 
+// Get the number of retries allowed by overrides for failures of the job
+// with the given metadata, or -1 if there is no such override.
+func (self *Node) retryLimit(metadata *Metadata) int {
+	stageType := STAGE_TYPE_CHUNK
+	for _, fork := range self.forks {
+		if metadata == fork.split_metadata {
+			stageType = STAGE_TYPE_SPLIT
+		} else if metadata == fork.join_metadata {
+			stageType = STAGE_TYPE_JOIN
+		}
+	}
+	v := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.retries", stageType),
+		nil)
+	if retries, ok := v.(float64); ok {
+		return int(retries)
+	}
+	return -1
+}
+
+// Returns true if the node has failed, and every failure is covered by a
+// retries override which has not been used up.  The failures must still be
+// transient to be retried.
+func (self *Node) hasOverrideRetries() bool {
+	if self.state != Failed {
+		return false
+	}
+	found := false
+	for _, metadata := range self.collectMetadatas() {
+		if state, _ := metadata.getState(); state != Failed {
+			continue
+		}
+		if metadata.exists(Assert) {
+			return false
+		}
+		if limit := self.retryLimit(metadata); limit < 0 ||
+			self.rt.getStageRetries(self.fqname) >= limit {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
 func (self *Node) step() bool {
 	if self.state == Running {
 		for _, fork := range self.forks {
@@ -779,6 +887,13 @@ func (self *Node) step() bool {
 	self.state = self.getState()
 	switch self.state {
 	case Failed:
+		if previousState != Failed {
+			for _, fork := range self.forks {
+				if fork.getState() == Failed {
+					fork.removeSecrets()
+				}
+			}
+		}
 		self.addFrontierNode(self)
 	case Running:
 		if self.state != previousState {
@@ -884,20 +999,6 @@ func (self *Node) serializeState() *NodeInfo {
 			To:   self.fqname,
 		})
 	}
-	var err *NodeErrorInfo
-	if self.state == Failed {
-		fqname, _, summary, log, _, errpaths := self.getFatalError()
-		errpath := ""
-		if len(errpaths) > 0 {
-			errpath = errpaths[0]
-		}
-		err = &NodeErrorInfo{
-			FQname:  fqname,
-			Path:    errpath,
-			Summary: summary,
-			Log:     log,
-		}
-	}
 	return &NodeInfo{
 		Name:          self.name,
 		Fqname:        self.fqname,
@@ -910,7 +1011,7 @@ func (self *Node) serializeState() *NodeInfo {
 		Edges:         edges,
 		StagecodeLang: self.stagecodeLang,
 		StagecodeCmd:  self.stagecodeCmd,
-		Error:         err,
+		Error:         self.getErrorInfo(),
 	}
 }
 
@@ -982,7 +1083,18 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 			self.fqname, stageType, overrideMem)
 	}
 
-	if self.local {
+	overrideSpecial := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.special", stageType),
+		special)
+	if overrideSpecialString, ok := overrideSpecial.(string); ok {
+		special = overrideSpecialString
+	} else {
+		util.PrintInfo("runtime",
+			"Invalid value for %s %s.special: %v",
+			self.fqname, stageType, overrideSpecial)
+	}
+
+	if self.isLocal(stageType) {
 		threads, memGB = self.rt.LocalJobManager.GetSystemReqs(threads, memGB)
 	} else {
 		threads, memGB = self.rt.JobManager.GetSystemReqs(threads, memGB)
@@ -992,6 +1104,46 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 	return threads, memGB, special
 }
 
+// Returns true if jobs for the given phase of this stage should be run by
+// the local job manager.  Preflight stages are not affected by overrides.
+func (self *Node) isLocal(stageType string) bool {
+	if self.preflight {
+		return self.local
+	}
+	local := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.local", stageType),
+		self.local)
+	if l, ok := local.(bool); ok {
+		return l
+	}
+	util.PrintInfo("runtime",
+		"Invalid value for %s %s.local: %v",
+		self.fqname, stageType, local)
+	return self.local
+}
+
+// Returns true if any phase of this stage may run in the local job manager.
+func (self *Node) anyLocal() bool {
+	return self.isLocal(STAGE_TYPE_SPLIT) ||
+		self.isLocal(STAGE_TYPE_CHUNK) ||
+		self.isLocal(STAGE_TYPE_JOIN)
+}
+
+// Get the virtual memory limit to request for jobs in the given phase, or 0
+// if there is none.  This can only be set through overrides.
+func (self *Node) getVMemGB(stageType string) int {
+	v := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.vmem_gb", stageType),
+		float64(0))
+	if vmem, ok := v.(float64); ok {
+		return int(vmem)
+	}
+	util.PrintInfo("runtime",
+		"Invalid value for %s %s.vmem_gb: %v",
+		self.fqname, stageType, v)
+	return 0
+}
+
 func (self *Node) getProfileMode(stageType string) ProfileMode {
 	p := self.rt.overrides.GetOverride(self,
 		fmt.Sprintf("%s.profile", stageType),
@@ -1065,10 +1217,6 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 		monitor = "monitor"
 	}
 
-	// Construct path to the shell.
-	shellCmd := ""
-	var argv []string
-	stagecodeParts := strings.Split(self.stagecodeCmd, " ")
 	runFile := path.Join(self.journalPath, fqname)
 	if metadata.uniquifier != "" {
 		runFile += ".u" + metadata.uniquifier
@@ -1085,37 +1233,19 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 		envs["TMPDIR"] = td
 	}
 
-	switch self.stagecodeLang {
-	case syntax.PythonStage:
-		if len(stagecodeParts) != 1 {
-			panic(fmt.Sprintf("Invalid python stage module specification \"%s\"", self.stagecodeCmd))
-		}
-		shellCmd = self.rt.mrjob
-		argv = []string{
-			path.Join(self.rt.adaptersPath, "python", "martian_shell.py"),
-			stagecodeParts[0],
-			shellName,
-			metadata.path,
-			metadata.curFilesPath,
-			runFile,
-		}
-	case syntax.CompiledStage:
-		shellCmd = self.rt.mrjob
-		argv = append(stagecodeParts, shellName, metadata.path, metadata.curFilesPath, runFile)
-	case syntax.ExecStage:
-		shellCmd = stagecodeParts[0]
-		argv = append(stagecodeParts[1:], shellName, metadata.path, metadata.curFilesPath, runFile)
-	default:
-		panic(fmt.Sprintf("Unknown stage code language: %v", self.stagecodeLang))
-	}
+	// Construct path to the shell.
+	shellCmd, argv := self.rt.jobCommand(self.stagecodeLang, self.stagecodeCmd,
+		shellName, metadata, runFile)
 
 	// Log the job run.
 	jobMode := self.rt.Config.JobMode
 	jobManager := self.rt.JobManager
-	if self.local {
+	local := self.isLocal(stageType)
+	if local {
 		jobMode = "local"
 		jobManager = self.rt.LocalJobManager
 	}
+	vmemGB := self.getVMemGB(stageType)
 	jobModeLabel := strings.Replace(jobMode, ".template", "", -1)
 	padding := strings.Repeat(" ", int(math.Max(0, float64(10-len(path.Base(jobModeLabel))))))
 	if self.preflight {
@@ -1131,6 +1261,7 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 		Type:          jobMode,
 		Threads:       threads,
 		MemGB:         memGB,
+		VMemGB:        vmemGB,
 		ProfileConfig: self.rt.ProfileConfig(profileMode),
 		ProfileMode:   profileMode,
 		Stackvars:     stackVars,
@@ -1141,6 +1272,21 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 	if jobInfo.ProfileConfig != nil && jobInfo.ProfileConfig.Adapter != "" {
 		jobInfo.ProfileMode = jobInfo.ProfileConfig.Adapter
 	}
+	if env, prefix, err := self.getStageEnv(stageType); err != nil {
+		util.PrintError(err, "runtime", "Could not run %s.%s.", fqname, shellName)
+		metadata.WriteRaw(Errors, err.Error())
+		return
+	} else {
+		jobInfo.Env = env
+		jobInfo.Path = prefix
+	}
+	if container, err := self.getContainer(stageType, metadata, jobInfo.Env); err != nil {
+		util.PrintError(err, "runtime", "Could not run %s.%s.", fqname, shellName)
+		metadata.WriteRaw(Errors, err.Error())
+		return
+	} else {
+		jobInfo.Container = container
+	}
 
 	func() {
 		util.EnterCriticalSection()
@@ -1148,6 +1294,59 @@ func (self *Node) runJob(shellName string, fqname, stageType string, metadata *M
 		metadata.WriteTime(QueuedLocally)
 		metadata.Write(JobInfoFile, &jobInfo)
 	}()
-	jobManager.execJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname,
-		shellName, self.preflight && self.local)
+	jobManager.execJob(shellCmd, argv, envs, metadata, threads, memGB, vmemGB, special, fqname,
+		shellName, self.preflight && local)
+}
+
+// Get the command and arguments to run a phase of a stage, following the
+// adapter protocol:
+//
+//	<shell> [shell args...] <split|main|join> <metadata_path> <files_path> <journal_prefix>
+//
+// where the shell is mrjob for python and compiled stages, and the stage
+// executable itself for exec stages.
+func (self *Runtime) jobCommand(lang syntax.StageCodeType, stagecodeCmd string,
+	shellName string, metadata *Metadata, runFile string) (string, []string) {
+	stagecodeParts := strings.Split(stagecodeCmd, " ")
+	switch lang {
+	case syntax.PythonStage:
+		if len(stagecodeParts) != 1 {
+			panic(fmt.Sprintf("Invalid python stage module specification \"%s\"", stagecodeCmd))
+		}
+		return self.mrjob, []string{
+			path.Join(self.adaptersPath, "python", "martian_shell.py"),
+			stagecodeParts[0],
+			shellName,
+			metadata.path,
+			metadata.curFilesPath,
+			runFile,
+		}
+	case syntax.CompiledStage:
+		return self.mrjob, append(stagecodeParts,
+			shellName, metadata.path, metadata.curFilesPath, runFile)
+	case syntax.ExecStage:
+		return stagecodeParts[0], append(stagecodeParts[1:],
+			shellName, metadata.path, metadata.curFilesPath, runFile)
+	default:
+		panic(fmt.Sprintf("Unknown stage code language: %v", lang))
+	}
+}
+
+// Get the command line for a stage's code, searching for it in the mro path
+// and PATH, and the language it is written in.
+func stagecodeCommand(stage *syntax.Stage, mroPaths []string) (string, syntax.StageCodeType, error) {
+	stagecodePaths := append(mroPaths, strings.Split(os.Getenv("PATH"), ":")...)
+	stagecodePath := stage.Src.Path
+	if fullPath, found := util.SearchPaths(stage.Src.Path, stagecodePaths); found {
+		// While it should have been checked at compile time (at least for
+		// python stages), it's better to have a relative path here than
+		// an empty string if the path no longer resolves.
+		stagecodePath = fullPath
+	}
+	cmd := strings.Join(append([]string{stagecodePath}, stage.Src.Args...), " ")
+	lang, err := stage.Src.Lang.Parse()
+	if err != nil {
+		return cmd, lang, fmt.Errorf("Unsupported language in stage %s: %v", stage.Id, stage.Src.Lang)
+	}
+	return cmd, lang, nil
 }
@@ -13,6 +13,12 @@
  *		    "mem_gb": 2,
  *		    "force_volatile" : true,
  * 	    },
+ *      "*.SORT_*": {
+ *		    "chunk.threads": 4,
+ *      },
+ *      "/^PIPE\\..*_JOIN$/": {
+ *		    "join.local": true,
+ *      },
  *	     "" : {
  *		    "force_volatile": false
  *      }
@@ -21,6 +27,29 @@
  * This file sets the volatile flag to false for all stages. Except any substages of FULLY.QUALIFIED
  * (for which it is true) except for FULLY_QUALIFIED.STAGE.NAME for which it is false again.
  *
+ * Rule names are partially qualified names (see below).  A name containing
+ * any of *, ? or [ is a glob pattern, matched with path.Match semantics except
+ * that * also matches across '.'.  A name enclosed in / is a regular
+ * expression.  Patterns only match stage names, not enclosing pipelines.
+ *
+ * Resource keys (threads, mem_gb, vmem_gb, special, profile, retries, local,
+ * container, env, path) may be prefixed by a phase (split., chunk. or join.),
+ * or given without a prefix to apply to all phases.  The env and path keys
+ * replace the stage's env map and path list, respectively.  The retries key
+ * limits the number of times the stage is retried; as with --autoretry, only
+ * failures which match the retry patterns are retried.  The vmem_gb key limits
+ * the virtual memory of the job, and is passed to cluster job templates as
+ * __MRO_VMEM_GB__.
+ *
+ * When looking up a value for a stage, the first of these rules which
+ * defines the key wins:
+ *   1. The exact name of the stage.
+ *   2. Glob patterns matching the stage name, longest pattern first.
+ *   3. Regular expressions matching the stage name, longest first.
+ *   4. The exact names of enclosing pipelines, innermost first, ending with
+ *      "" for the top level.
+ * Within a single rule, a phase-prefixed key takes precedence over the same
+ * key without a prefix.
  */
 
 package core
@@ -29,7 +58,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"path"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/martian-lang/martian/martian/util"
 )
@@ -55,46 +89,96 @@ func partiallyQualifiedName(n string) string {
 
 type StageOverride map[string]interface{}
 
+// An override rule whose name is a glob pattern or regular expression.
+type overrideRule struct {
+	name   string
+	regex  *regexp.Regexp
+	values StageOverride
+}
+
+func (self *overrideRule) match(pqn string) bool {
+	if self.regex != nil {
+		return self.regex.MatchString(pqn)
+	}
+	ok, _ := path.Match(self.name, pqn)
+	return ok
+}
+
 type PipestanceOverrides struct {
 	overridesbystage map[string]StageOverride
+	globs            []*overrideRule
+	regexps          []*overrideRule
+
+	// The file the overrides were read from, for Reload.
+	path string
+	lock sync.RWMutex
+}
+
+// The override keys which may be given per phase.
+var phaseOverrideTypes = map[string]reflect.Kind{
+	"threads": reflect.Float64,
+	"mem_gb":  reflect.Float64,
+	"vmem_gb": reflect.Float64,
+	"special": reflect.String,
+	"profile": reflect.String,
+	"retries": reflect.Float64,
+	"local":   reflect.Bool,
+
+	"container": reflect.String,
+	"env":       reflect.Map,
+	"path":      reflect.Slice,
 }
 
 // Specifies the expected types for elements in a stageoverride map. Note that
 // all JSON numeric types look like Float64s when we stick them in an interface.
-var LegalOverrideTypes map[string]reflect.Kind = map[string]reflect.Kind{
-	"force_volatile": reflect.Bool,
-	"join.threads":   reflect.Float64,
-	"join.mem_gb":    reflect.Float64,
-	"join.profile":   reflect.String,
-	"chunk.threads":  reflect.Float64,
-	"chunk.mem_gb":   reflect.Float64,
-	"chunk.profile":  reflect.String,
-	"split.threads":  reflect.Float64,
-	"split.mem_gb":   reflect.Float64,
-	"split.profile":  reflect.String,
-}
+var LegalOverrideTypes map[string]reflect.Kind = func() map[string]reflect.Kind {
+	types := map[string]reflect.Kind{
+		"force_volatile": reflect.Bool,
+	}
+	for key, kind := range phaseOverrideTypes {
+		types[key] = kind
+		for _, phase := range []string{
+			STAGE_TYPE_SPLIT,
+			STAGE_TYPE_CHUNK,
+			STAGE_TYPE_JOIN,
+		} {
+			types[phase+"."+key] = kind
+		}
+	}
+	return types
+}()
 
 // Read the overrides file and produce a pipestance overrides object.
 func ReadOverrides(path string) (*PipestanceOverrides, error) {
-
-	pse := new(PipestanceOverrides)
-
-	pse.overridesbystage = make(map[string]StageOverride)
-
 	if path == "" {
-		return pse, nil
+		return &PipestanceOverrides{
+			overridesbystage: make(map[string]StageOverride),
+		}, nil
 	}
 
 	fdata, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-
-	err = json.Unmarshal(fdata, &(pse.overridesbystage))
-
+	pse, err := parseOverrides(fdata)
 	if err != nil {
 		return nil, err
 	}
+	pse.path = path
+	util.Println("Loaded %v overrides from %v",
+		len(pse.overridesbystage)+len(pse.globs)+len(pse.regexps), path)
+	return pse, nil
+}
+
+func parseOverrides(fdata []byte) (*PipestanceOverrides, error) {
+	var rules map[string]StageOverride
+	if err := json.Unmarshal(fdata, &rules); err != nil {
+		return nil, err
+	}
+
+	pse := &PipestanceOverrides{
+		overridesbystage: make(map[string]StageOverride, len(rules)),
+	}
 
 	/*
 	 * Validate semantic correctness of the overrides we just loaded.  We
@@ -104,8 +188,7 @@ func ReadOverrides(path string) (*PipestanceOverrides, error) {
 	 * overrides untypes so that GetOverride can operate as a generic
 	 * funciton for all possible types.
 	 */
-
-	for _, stage_override_data := range pse.overridesbystage {
+	for name, stage_override_data := range rules {
 		for override_key, data := range stage_override_data {
 
 			val_kind, ok := LegalOverrideTypes[override_key]
@@ -120,12 +203,124 @@ func ReadOverrides(path string) (*PipestanceOverrides, error) {
 				return nil, fmt.Errorf("%v (%v) is the wrong type. Expected type is %v", override_key, data, val_kind)
 			}
 		}
+		if len(name) > 1 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
+			re, err := regexp.Compile(name[1 : len(name)-1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid override pattern %s: %v", name, err)
+			}
+			pse.regexps = append(pse.regexps, &overrideRule{
+				name:   name,
+				regex:  re,
+				values: stage_override_data,
+			})
+		} else if strings.ContainsAny(name, "*?[") {
+			if _, err := path.Match(name, ""); err != nil {
+				return nil, fmt.Errorf("Invalid override pattern %s: %v", name, err)
+			}
+			pse.globs = append(pse.globs, &overrideRule{
+				name:   name,
+				values: stage_override_data,
+			})
+		} else {
+			pse.overridesbystage[name] = stage_override_data
+		}
 	}
-
-	util.Println("Loaded %v overrides from %v", len(pse.overridesbystage), path)
+	sortRules := func(rules []*overrideRule) {
+		sort.Slice(rules, func(i, j int) bool {
+			if len(rules[i].name) != len(rules[j].name) {
+				return len(rules[i].name) > len(rules[j].name)
+			}
+			return rules[i].name < rules[j].name
+		})
+	}
+	sortRules(pse.globs)
+	sortRules(pse.regexps)
 	return pse, nil
 }
 
+// Re-read the overrides file, if there was one.  Overrides are looked up
+// when jobs are launched, so the new values apply to any job which has not
+// started yet.  Returns a description of each value which changed.
+func (self *PipestanceOverrides) Reload() ([]string, error) {
+	if self.path == "" {
+		return nil, nil
+	}
+	fdata, err := ioutil.ReadFile(self.path)
+	if err != nil {
+		return nil, err
+	}
+	pse, err := parseOverrides(fdata)
+	if err != nil {
+		return nil, err
+	}
+	self.lock.Lock()
+	old := self.byRule()
+	self.overridesbystage = pse.overridesbystage
+	self.globs = pse.globs
+	self.regexps = pse.regexps
+	self.lock.Unlock()
+	return diffOverrides(old, pse.byRule()), nil
+}
+
+// Get the overrides for each rule, keyed by the rule as written.
+func (self *PipestanceOverrides) byRule() map[string]StageOverride {
+	rules := make(map[string]StageOverride,
+		len(self.overridesbystage)+len(self.globs)+len(self.regexps))
+	for name, so := range self.overridesbystage {
+		rules[name] = so
+	}
+	for _, list := range [][]*overrideRule{self.globs, self.regexps} {
+		for _, rule := range list {
+			rules[rule.name] = rule.values
+		}
+	}
+	return rules
+}
+
+// Describe the differences between two sets of override rules.
+func diffOverrides(before, after map[string]StageOverride) []string {
+	names := make(map[string]struct{}, len(before)+len(after))
+	for name := range before {
+		names[name] = struct{}{}
+	}
+	for name := range after {
+		names[name] = struct{}{}
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	var changes []string
+	for _, name := range sortedNames {
+		keys := make([]string, 0, len(before[name])+len(after[name]))
+		for key := range before[name] {
+			keys = append(keys, key)
+		}
+		for key := range after[name] {
+			if _, ok := before[name][key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			ov, hadOld := before[name][key]
+			nv, hasNew := after[name][key]
+			if !hadOld {
+				changes = append(changes, fmt.Sprintf(
+					"%q: set %s to %v", name, key, nv))
+			} else if !hasNew {
+				changes = append(changes, fmt.Sprintf(
+					"%q: removed %s (was %v)", name, key, ov))
+			} else if ov != nv {
+				changes = append(changes, fmt.Sprintf(
+					"%q: changed %s from %v to %v", name, key, ov, nv))
+			}
+		}
+	}
+	return changes
+}
+
 func getParent(node *Node) *Node {
 	p := node.parent
 	if p == nil {
@@ -135,6 +330,54 @@ func getParent(node *Node) *Node {
 	}
 }
 
+// Find the value of an override key for a node, following the precedence
+// rules described above.  Returns the value and the name of the rule which
+// supplied it, or nil if no rule applies.
+func (self *PipestanceOverrides) find(node *Node, what string) (interface{}, string) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	keys := []string{what}
+	if i := strings.IndexByte(what, '.'); i >= 0 {
+		keys = append(keys, what[i+1:])
+	}
+	get := func(so StageOverride) interface{} {
+		for _, key := range keys {
+			if val := so[key]; val != nil {
+				return val
+			}
+		}
+		return nil
+	}
+	pqn := partiallyQualifiedName(node.fqname)
+	if so, ok := self.overridesbystage[pqn]; ok {
+		if val := get(so); val != nil {
+			return val, pqn
+		}
+	}
+	for _, rules := range [][]*overrideRule{self.globs, self.regexps} {
+		for _, rule := range rules {
+			if rule.match(pqn) {
+				if val := get(rule.values); val != nil {
+					return val, rule.name
+				}
+			}
+		}
+	}
+
+	/* Recursively search the parents of this node for a match. Use the most
+	 * closely matching node.  Here the root node is represented by the empty string.
+	 */
+	for cur := getParent(node); cur != nil; cur = getParent(cur) {
+		pqn := partiallyQualifiedName(cur.fqname)
+		if so, ok := self.overridesbystage[pqn]; ok {
+			if val := get(so); val != nil {
+				return val, pqn
+			}
+		}
+	}
+	return nil, ""
+}
+
 // Compute the value to use for a stage option when that value might be overrided.
 //
 // |node| is the Node object for the stage
@@ -143,31 +386,52 @@ func getParent(node *Node) *Node {
 //
 // |def|  is the default value to use if the value is not overridded
 func (self *PipestanceOverrides) GetOverride(node *Node, what string, def interface{}) interface{} {
+	if val, rule := self.find(node, what); val != nil {
+		util.LogInfo("override", "At [%v:%v] replace %v with %v (rule %q)",
+			what, node.fqname, def, val, rule)
+		return val
+	}
 
-	var so StageOverride
-
-	/* Recursively search this node and its parents for a match. Use the most
-	 * closely matching node.  Here the root node is represented by the empty string.
+	/* We didn't find any rule for the node which defined the key we're
+	 * looking for. Give and use the default value.
 	 */
-	for cur := node; cur != nil; cur = getParent(cur) {
-		var exists bool
-		pqn := partiallyQualifiedName(cur.fqname)
-		so, exists = self.overridesbystage[pqn]
-		if exists {
-			val := so[what]
-			if val != nil {
-				/* If we found a node that exists *AND* it actually defines val,
-				 * use it. Otherwise, backtrack another level and try again.
-				 */
-				util.LogInfo("override", "At [%v:%v] replace %v with %v",
-					what, cur.fqname, def, val)
-				return val
+	return def
+}
+
+// An override which applies to a stage.
+type OverrideExplanation struct {
+	Stage string      `json:"stage"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	Rule  string      `json:"rule"`
+}
+
+// ExplainOverrides lists, for each stage in the pipestance, the overrides
+// which apply to it and the rule which supplied each one.
+func (self *Pipestance) ExplainOverrides() []*OverrideExplanation {
+	overrides := self.node.rt.overrides
+	keys := make([]string, 0, len(LegalOverrideTypes))
+	for key := range LegalOverrideTypes {
+		if _, generic := phaseOverrideTypes[key]; !generic {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var result []*OverrideExplanation
+	for _, node := range self.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		for _, key := range keys {
+			if val, rule := overrides.find(node, key); val != nil {
+				result = append(result, &OverrideExplanation{
+					Stage: node.fqname,
+					Key:   key,
+					Value: val,
+					Rule:  rule,
+				})
 			}
 		}
 	}
-
-	/* We didn't find any parent of node that existed and defined the key we're looking
-	 * for. Give and use the default value.
-	 */
-	return def
+	return result
 }
@@ -0,0 +1,192 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestOverridePrecedence(t *testing.T) {
+	overrides, err := parseOverrides([]byte(`{
+		"": {
+			"threads": 1,
+			"force_volatile": false
+		},
+		"PIPE": {
+			"mem_gb": 2
+		},
+		"PIPE.SUB": {
+			"mem_gb": 3
+		},
+		"PIPE.SUB.SORT_READS": {
+			"chunk.threads": 8
+		},
+		"*.SORT_*": {
+			"threads": 4,
+			"join.threads": 2,
+			"mem_gb": 5
+		},
+		"PIPE.*": {
+			"threads": 3,
+			"local": true
+		},
+		"/^PIPE\\..*_READS$/": {
+			"vmem_gb": 16,
+			"threads": 6,
+			"chunk.special": "highmem"
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &Node{fqname: "ID.ps"}
+	top := &Node{fqname: "ID.ps.PIPE", parent: root}
+	sub := &Node{fqname: "ID.ps.PIPE.SUB", parent: top}
+	sort := &Node{fqname: "ID.ps.PIPE.SUB.SORT_READS", parent: sub}
+	other := &Node{fqname: "ID.ps.PIPE.OTHER", parent: top}
+
+	check := func(node *Node, key string, expect interface{}, expectRule string) {
+		t.Helper()
+		val, rule := overrides.find(node, key)
+		if val != expect || rule != expectRule {
+			t.Errorf("Expected %s for %s to be %v from %q, got %v from %q",
+				key, node.fqname, expect, expectRule, val, rule)
+		}
+	}
+	// An exact name beats everything.
+	check(sort, "chunk.threads", 8.0, "PIPE.SUB.SORT_READS")
+	// The longest glob beats shorter globs, and a phase-specific key beats
+	// a generic one within a rule.
+	check(sort, "split.threads", 4.0, "*.SORT_*")
+	check(sort, "join.threads", 2.0, "*.SORT_*")
+	// Globs beat enclosing pipelines.
+	check(sort, "chunk.mem_gb", 5.0, "*.SORT_*")
+	check(sort, "join.local", true, "PIPE.*")
+	// Regular expressions come after globs.
+	check(sort, "chunk.vmem_gb", 16.0, "/^PIPE\\..*_READS$/")
+	check(sort, "chunk.special", "highmem", "/^PIPE\\..*_READS$/")
+	check(sort, "split.special", nil, "")
+	// Otherwise, the innermost enclosing pipeline wins.
+	check(other, "chunk.mem_gb", 2.0, "PIPE")
+	check(other, "chunk.threads", 3.0, "PIPE.*")
+	check(other, "force_volatile", false, "")
+
+	if v := overrides.GetOverride(other, "chunk.vmem_gb", 0.0); v != 0.0 {
+		t.Errorf("Expected default vmem_gb, got %v", v)
+	}
+}
+
+func TestOverrideValidation(t *testing.T) {
+	for _, bad := range []string{
+		`{"A": {"chunk.bogus": 1}}`,
+		`{"A": {"bogus.threads": 1}}`,
+		`{"A": {"join.local": 1}}`,
+		`{"A": {"special": 1}}`,
+		`{"/(/": {"threads": 1}}`,
+		`{"A[": {"threads": 1}}`,
+	} {
+		if _, err := parseOverrides([]byte(bad)); err == nil {
+			t.Errorf("Expected error parsing %s", bad)
+		}
+	}
+	if _, err := parseOverrides([]byte(
+		`{"A": {"split.retries": 2, "profile": "cpu", "chunk.local": false}}`,
+	)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOverrideReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testOverrideReload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "overrides.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"PIPE.STAGE": {"chunk.mem_gb": 4, "threads": 2}}`)
+	overrides, err := ReadOverrides(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &Node{fqname: "ID.ps"}
+	top := &Node{fqname: "ID.ps.PIPE", parent: root}
+	stage := &Node{fqname: "ID.ps.PIPE.STAGE", parent: top}
+
+	write(`{"PIPE.STAGE": {"chunk.mem_gb": 8}, "*": {"local": true}}`)
+	changes, err := overrides.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		`"*": set local to true`,
+		`"PIPE.STAGE": changed chunk.mem_gb from 4 to 8`,
+		`"PIPE.STAGE": removed threads (was 2)`,
+	}
+	if len(changes) != len(expect) {
+		t.Errorf("Expected %d changes, got %v", len(expect), changes)
+	} else {
+		for i, c := range changes {
+			if c != expect[i] {
+				t.Errorf("Expected %q, got %q", expect[i], c)
+			}
+		}
+	}
+	if v := overrides.GetOverride(stage, "chunk.mem_gb", 1.0); v != 8.0 {
+		t.Errorf("Expected 8GB after reload, got %v", v)
+	}
+	if v := overrides.GetOverride(stage, "join.local", false); v != true {
+		t.Errorf("Expected local after reload, got %v", v)
+	}
+
+	// An invalid file leaves the existing overrides in place.
+	write(`{"PIPE.STAGE": {"chunk.mem_gb": "lots"}}`)
+	if _, err := overrides.Reload(); err == nil {
+		t.Error("Expected an error reloading invalid overrides.")
+	}
+	if v := overrides.GetOverride(stage, "chunk.mem_gb", 1.0); v != 8.0 {
+		t.Errorf("Expected 8GB after failed reload, got %v", v)
+	}
+}
+
+func TestRetriesOverride(t *testing.T) {
+	ps, cleanup := invokeProduceConsume(t)
+	defer cleanup()
+	overrides, err := parseOverrides([]byte(`{"PIPE.CONSUME": {"retries": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.node.rt.overrides = overrides
+	node := ps.node.find(ps.GetFQName() + ".CONSUME")
+	md := node.forks[0].split_metadata
+	if err := os.MkdirAll(md.path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	node.state = Failed
+
+	md.WriteRaw(Errors, "deterministic failure")
+	if transient, _ := node.isErrorTransient(); transient {
+		t.Error("Expected a non-transient failure not to be retried.")
+	}
+	md.WriteRaw(Errors, "signal: killed")
+	if transient, _ := node.isErrorTransient(); !transient {
+		t.Error("Expected a transient failure to be retried.")
+	}
+	if !node.hasOverrideRetries() {
+		t.Error("Expected a retry to remain.")
+	}
+	ps.node.rt.addStageRetry(node.fqname)
+	if transient, _ := node.isErrorTransient(); transient {
+		t.Error("Expected no retries to remain.")
+	}
+	if node.hasOverrideRetries() {
+		t.Error("Expected no retries to remain.")
+	}
+}
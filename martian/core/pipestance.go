@@ -7,6 +7,7 @@
 package core
 
 import (
+	"archive/zip"
 	"context"
 	"fmt"
 	"os"
@@ -14,7 +15,6 @@ import (
 	"path"
 	"path/filepath"
 	"runtime/trace"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -28,7 +28,9 @@ import (
 //=============================================================================
 
 // Similar to a pipestance, except for a single stage.  Intended for use
-// during testing and development of pipelines, e.g. with `mrs`.
+// during testing and development of pipelines, e.g. with `mrs`.  See also
+// StageHarness, used by `mrstage`, which runs a stage without a pipeline
+// around it.
 type Stagestance struct {
 	node *Node
 }
@@ -41,18 +43,11 @@ func NewStagestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.C
 		return nil, &RuntimeError{fmt.Sprintf("'%s' is not a declared stage", callStm.DecId)}
 	}
 
-	stagecodePaths := append(self.node.mroPaths, strings.Split(os.Getenv("PATH"), ":")...)
-	stagecodePath := stage.Src.Path
-	if fullPath, found := util.SearchPaths(stage.Src.Path, stagecodePaths); found {
-		// While it should have been checked at compile time (at least for
-		// python stages), it's better to have a relative path here than
-		// an empty string if the path no longer resolves.
-		stagecodePath = fullPath
-	}
-	self.node.stagecodeCmd = strings.Join(append([]string{stagecodePath}, stage.Src.Args...), " ")
 	var err error
-	if self.node.stagecodeLang, err = stage.Src.Lang.Parse(); err != nil {
-		return self, fmt.Errorf("Unsupported language in stage %s: %v", callStm.DecId, stage.Src.Lang)
+	self.node.stagecodeCmd, self.node.stagecodeLang, err = stagecodeCommand(
+		stage, self.node.mroPaths)
+	if err != nil {
+		return self, err
 	}
 	if self.node.rt.Config.StressTest {
 		switch self.node.stagecodeLang {
@@ -69,6 +64,9 @@ func NewStagestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.C
 			Special: stage.Resources.Special,
 		}
 		self.node.strictVolatile = stage.Resources.StrictVolatile
+		self.node.container = stage.Resources.Container
+		self.node.stageEnv = stage.Resources.EnvVars()
+		self.node.pathPrefix = stage.Resources.PathPrefix()
 	}
 	self.node.buildForks(self.node.argbindingList)
 	if stage.Retain != nil {
@@ -139,6 +137,9 @@ type Pipestance struct {
 	queueCheckLock   sync.Mutex
 	queueCheckActive bool
 	lastQueueCheck   time.Time
+
+	// If not nil, the only nodes which will be stepped.
+	targets map[*Node]bool
 }
 
 /* Run a script whenever a pipestance finishes */
@@ -350,11 +351,6 @@ func (self *Pipestance) GetState(ctx context.Context) MetadataState {
 			return Failed
 		}
 	}
-	for _, node := range nodes {
-		if node.state == Running {
-			return Running
-		}
-	}
 	every := true
 	for _, node := range self.allNodes() {
 		if node.state != DisabledState {
@@ -375,6 +371,16 @@ func (self *Pipestance) GetState(ctx context.Context) MetadataState {
 	if every {
 		return Complete
 	}
+	// Stages which are not targets are never started, so they may be
+	// ready to run without the pipestance running.
+	if self.TargetsComplete() {
+		return Paused
+	}
+	for _, node := range nodes {
+		if node.state == Running {
+			return Running
+		}
+	}
 	return ForkWaiting
 }
 
@@ -404,7 +410,7 @@ func (self *Pipestance) RestartRunningNodes(jobMode string, outerCtx context.Con
 	for _, node := range nodes {
 		if node.state == Running {
 			util.PrintInfo("runtime", "Found orphaned stage: %s", node.fqname)
-			if jobMode == "local" || node.local {
+			if jobMode == "local" || node.anyLocal() {
 				localNodes = append(localNodes, node)
 			}
 		}
@@ -431,7 +437,7 @@ func (self *Pipestance) RestartLocalJobs(jobMode string) error {
 				return err
 			}
 		}
-		if node.state == Running && (jobMode == "local" || node.local) {
+		if node.state == Running && (jobMode == "local" || node.anyLocal()) {
 			util.PrintInfo("runtime", "Found orphaned local stage: %s", node.fqname)
 			if err := node.restartLocalJobs(); err != nil {
 				return err
@@ -548,6 +554,27 @@ func (self *Pipestance) GetFailedNodes() []*Node {
 	return failedNodes
 }
 
+// Get information about the errors for each failed node.
+func (self *Pipestance) GetErrors() []*NodeErrorInfo {
+	var errors []*NodeErrorInfo
+	for _, node := range self.GetFailedNodes() {
+		errors = append(errors, node.getErrorInfo())
+	}
+	return errors
+}
+
+// A stage which completed or failed during a call to StepNodesNotify.
+type StageTransition struct {
+	FQname string
+	State  MetadataState
+
+	// The error, if the stage failed.
+	Error *NodeErrorInfo
+
+	// The alarms raised by the stage, if any.
+	Alarms string
+}
+
 func (self *Pipestance) GetFatalError() (string, bool, string, string, MetadataFileName, []string) {
 	nodes := self.node.getFrontierNodes()
 	for _, node := range nodes {
@@ -574,9 +601,44 @@ func (self *Pipestance) IsErrorTransient() (bool, string) {
 	return true, firstLog
 }
 
+// Returns true if the pipestance failed, and all of the failed stages have
+// retries overrides which are not yet used up.  Such failures may be retried,
+// if they are transient, even if the pipestance-level retry count is
+// exhausted.
+func (self *Pipestance) HasOverrideRetries() bool {
+	found := false
+	for _, node := range self.node.getFrontierNodes() {
+		if node.state != Failed {
+			continue
+		}
+		if !node.hasOverrideRetries() {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// Records a retry against each failed stage, for enforcing retries
+// overrides.  This should be called before restarting a failed pipestance.
+func (self *Pipestance) ConsumeStageRetries() {
+	for _, node := range self.node.getFrontierNodes() {
+		if node.state == Failed {
+			node.rt.addStageRetry(node.fqname)
+		}
+	}
+}
+
 // Process state updates for nodes.  Returns true if there was a change in
 // state which would make it productive to call StepNodes again immediately.
 func (self *Pipestance) StepNodes(ctx context.Context) bool {
+	return self.StepNodesNotify(ctx, nil)
+}
+
+// StepNodesNotify steps the pipestance as StepNodes does, and calls notify,
+// if it is not nil, for each stage which completed or failed in this step.
+func (self *Pipestance) StepNodesNotify(ctx context.Context,
+	notify func(*StageTransition)) bool {
 	r := trace.StartRegion(ctx, "StepNodes")
 	defer r.End()
 	if self.readOnly() {
@@ -603,7 +665,16 @@ func (self *Pipestance) StepNodes(ctx context.Context) bool {
 	}
 	hadProgress := false
 	for _, node := range self.node.getFrontierNodes() {
-		hadProgress = node.step() || hadProgress
+		if self.isTarget(node) {
+			if node.step() {
+				hadProgress = true
+				if notify != nil {
+					if t := node.getTransition(); t != nil {
+						notify(t)
+					}
+				}
+			}
+		}
 	}
 	for _, node := range self.allNodes() {
 		for _, m := range node.collectMetadatas() {
@@ -708,15 +779,29 @@ func (self *Pipestance) ZipMetadata(zipPath string) error {
 
 	nodes := self.allNodes()
 	metadatas := []*Metadata{}
+	var archives []*metadataArchive
 	for _, node := range nodes {
 		metadatas = append(metadatas, node.collectMetadatas()...)
+		if n := node.getNode(); n.archive != nil && n.archive.exists() {
+			archives = append(archives, n.archive)
+		}
 	}
 	filePaths := make([]string, 0, 7*len(metadatas))
 	removePaths := make([]string, 0, len(metadatas))
 	for _, metadata := range metadatas {
 		files := metadata.glob()
-		filePaths = append(filePaths, files...)
-		removePaths = append(removePaths, files...)
+		for _, file := range files {
+			switch metadataFileNameFromPath(file) {
+			case ArchiveFile:
+				// Archived metadata is copied into the zip below.
+				removePaths = append(removePaths, file)
+			case MetadataDb:
+				// The database is already a single file.
+			default:
+				filePaths = append(filePaths, file)
+				removePaths = append(removePaths, file)
+			}
+		}
 		filePaths = append(filePaths, metadata.symlinks()...)
 	}
 
@@ -724,10 +809,13 @@ func (self *Pipestance) ZipMetadata(zipPath string) error {
 	defer util.ExitCriticalSection()
 
 	// Create zip with all metadata.
-	if err := util.CreateZip(zipPath, filePaths); err != nil {
+	if err := createMetadataZip(zipPath, filePaths, archives); err != nil {
 		util.LogError(err, "runtime", "Failed to zip metadata")
 		return err
 	}
+	for _, archive := range archives {
+		archive.clear()
+	}
 
 	// Remove all metadata files.
 	for _, filePath := range removePaths {
@@ -742,6 +830,50 @@ func (self *Pipestance) ZipMetadata(zipPath string) error {
 	return nil
 }
 
+// Read metadata from the pipestance's metadata.zip, for metadata files which
+// are not on disk.  The chunks are reloaded, since their stage defs are
+// likely in the zip file.
+func (self *Pipestance) readMetadataZip() {
+	archive := newMetadataZipReader(self.GetPath())
+	self.metadata.archive = archive
+	for _, node := range self.allNodes() {
+		node.archive = archive
+		node.metadata.archive = archive
+		for _, fork := range node.forks {
+			fork.metadata.archive = archive
+			fork.split_metadata.archive = archive
+			fork.join_metadata.archive = archive
+			fork.loadChunks()
+		}
+	}
+}
+
+// Creates the metadata zip file from the given files and the contents of
+// any stage metadata archives.
+func createMetadataZip(zipPath string, filePaths []string, archives []*metadataArchive) error {
+	f, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	root := path.Dir(zipPath)
+	if err := util.WriteZipFiles(zw, root, filePaths); err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		prefix, err := filepath.Rel(root, archive.dir)
+		if err != nil {
+			return err
+		}
+		if err := util.CopyZipEntries(zw, archive.archivePath(),
+			prefix, nil); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
 func (self *Pipestance) GetPath() string {
 	return self.node.parent.getNode().path
 }
@@ -766,6 +898,12 @@ func (self *Pipestance) GetTimestamp() string {
 	return ParseTimestamp(data)
 }
 
+// Returns the invocation source recorded for the pipestance, in which the
+// values of secret parameters are redacted.
+func (self *Pipestance) GetInvocationSource() string {
+	return self.metadata.readRaw(InvocationFile)
+}
+
 func (self *Pipestance) GetVersions() (string, string, error) {
 	data := self.metadata.readRaw(VersionsFile)
 	return ParseVersions(data)
@@ -773,6 +911,9 @@ func (self *Pipestance) GetVersions() (string, string, error) {
 
 func (self *Pipestance) PostProcess() {
 	self.node.postProcess()
+	if err := self.writeChecksumManifest(); err != nil {
+		util.LogError(err, "runtime", "Failed to write output checksum manifest.")
+	}
 	self.metadata.WriteRaw(TimestampFile, self.metadata.readRaw(TimestampFile)+"\nend: "+util.Timestamp())
 	self.Immortalize(false)
 }
@@ -808,10 +949,30 @@ func (self *Pipestance) RecordUiPort(url string) error {
 	return self.metadata.WriteRaw(UiPort, url)
 }
 
+// Record the UI url including the key required for control actions such as
+// restart and kill.  The file is only readable by the pipestance owner.
+func (self *Pipestance) RecordUiControl(url string) error {
+	return self.metadata.writeRawPrivate(UiControl, url)
+}
+
+// Record the PEM-encoded certificate used by the UI, so that clients can
+// trust it even if it is self-signed.
+func (self *Pipestance) RecordUiCert(cert []byte) error {
+	return self.metadata.WriteRawBytes(UiCert, cert)
+}
+
+// Remove the files recording the UI url, credentials, and certificate.
 func (self *Pipestance) ClearUiPort() error {
+	self.metadata.remove(UiControl)
+	self.metadata.remove(UiCert)
 	return self.metadata.remove(UiPort)
 }
 
+// Add an entry to the log of control actions requested through the UI.
+func (self *Pipestance) AppendAuditLog(entry string) error {
+	return self.metadata.appendRaw(AuditLog, entry)
+}
+
 func (self *Pipestance) GetUuid() (string, error) {
 	if self.uuid != "" {
 		return self.uuid, nil
@@ -918,6 +1079,7 @@ func NewTopNode(rt *Runtime, psid string, p string, mroPaths []string, mroVersio
 	self.node.invocation = j
 	self.node.rt = rt
 	self.node.journalPath = path.Join(self.node.path, "journal")
+	self.node.store = newMetadataStore(p)
 	self.node.tmpPath = path.Join(self.node.path, "tmp")
 	self.node.fqname = "ID." + psid
 	self.node.name = psid
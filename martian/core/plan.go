@@ -0,0 +1,152 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Reporting of the stages a pipestance would run, without running them.
+//
+
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The resources which would be requested for one phase of a stage.
+type PlannedJob struct {
+	Threads int    `json:"threads"`
+	MemGB   int    `json:"mem_gb"`
+	VMemGB  int    `json:"vmem_gb,omitempty"`
+	Special string `json:"special,omitempty"`
+
+	// The job template resources option which the special value maps to,
+	// in cluster job modes.
+	Resources string `json:"resources,omitempty"`
+
+	// True if the job would be run by the local job manager.
+	Local bool `json:"local"`
+}
+
+// A fork of a stage which would be run.
+type PlannedFork struct {
+	Index int `json:"index"`
+
+	// The values of swept arguments for this fork, by the name of the
+	// top-level parameter which was swept.
+	SweepArgs map[string]interface{} `json:"sweep_args,omitempty"`
+
+	// True if the fork is disabled by a constant value.
+	Disabled bool `json:"disabled"`
+
+	// Stage outputs which may disable the fork when it runs.
+	DisabledBy []string `json:"disabled_by,omitempty"`
+}
+
+// A stage which would be run by a pipestance.
+type PlannedStage struct {
+	Fqname    string `json:"fqname"`
+	Preflight bool   `json:"preflight,omitempty"`
+	Volatile  bool   `json:"volatile,omitempty"`
+
+	// True for preflight stages when preflight checks are skipped.
+	Skipped bool `json:"skipped,omitempty"`
+
+	Forks []*PlannedFork `json:"forks"`
+
+	// The resources for the split and join, if the stage splits.
+	Split *PlannedJob `json:"split,omitempty"`
+	Join  *PlannedJob `json:"join,omitempty"`
+
+	// The resources for chunks.  For stages which split, the split may
+	// request different resources for each chunk.
+	Chunk *PlannedJob `json:"chunk"`
+}
+
+// Plan returns the stages in the pipestance in the order they would be
+// run, with the resources each would request after applying overrides and
+// job mode limits.  Nothing is read from or written to the pipestance
+// directory, so the results are only meaningful for a pipestance built with
+// PlanPipeline.
+func (self *Pipestance) Plan() []*PlannedStage {
+	var result []*PlannedStage
+	for _, node := range self.planOrder() {
+		if node.kind != "stage" {
+			continue
+		}
+		stage := &PlannedStage{
+			Fqname:    node.fqname,
+			Preflight: node.preflight,
+			Volatile:  node.volatile,
+			Skipped:   node.preflight && node.rt.Config.SkipPreflight,
+			Forks:     make([]*PlannedFork, 0, len(node.forks)),
+			Chunk:     node.planJob(STAGE_TYPE_CHUNK),
+		}
+		for _, fork := range node.forks {
+			stage.Forks = append(stage.Forks, fork.plan())
+		}
+		if len(node.forks) > 0 && node.forks[0].Split() {
+			stage.Split = node.planJob(STAGE_TYPE_SPLIT)
+			stage.Join = node.planJob(STAGE_TYPE_JOIN)
+		}
+		result = append(result, stage)
+	}
+	return result
+}
+
+// Returns all nodes, with each node after all of the nodes it depends on.
+func (self *Pipestance) planOrder() []*Node {
+	all := self.allNodes()
+	order := make([]*Node, 0, len(all))
+	visited := make(map[*Node]bool, len(all))
+	var visit func(*Node)
+	visit = func(node *Node) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+		keys := make([]string, 0, len(node.prenodes))
+		for key := range node.prenodes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			visit(node.prenodes[key].getNode())
+		}
+		order = append(order, node)
+	}
+	for _, node := range all {
+		visit(node)
+	}
+	return order
+}
+
+func (self *Node) planJob(stageType string) *PlannedJob {
+	threads, memGB, special := self.getJobReqs(nil, stageType)
+	job := &PlannedJob{
+		Threads: threads,
+		MemGB:   memGB,
+		VMemGB:  self.getVMemGB(stageType),
+		Special: special,
+	}
+	if jm, ok := self.rt.JobManager.(*RemoteJobManager); ok && !self.isLocal(stageType) {
+		job.Resources = jm.resourcesOpt(special)
+	} else {
+		job.Local = true
+	}
+	return job
+}
+
+func (self *Fork) plan() *PlannedFork {
+	fork := &PlannedFork{Index: self.index}
+	if len(self.argPermute) > 0 {
+		fork.SweepArgs = self.argPermute
+	}
+	for _, binding := range self.node.disabled {
+		if binding.mode == "reference" {
+			fork.DisabledBy = append(fork.DisabledBy, fmt.Sprintf("%s.%s",
+				binding.boundNode.getNode().fqname, binding.output))
+		} else if v, _ := binding.resolve(self.argPermute, 0); v == true {
+			fork.Disabled = true
+		}
+	}
+	return fork
+}
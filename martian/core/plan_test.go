@@ -0,0 +1,120 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	src := `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src comp    "stages/sum_squares",
+) split (
+    in  float   value,
+) using (
+    mem_gb = 2,
+)
+
+stage REPORT(
+    in  float[] values,
+    in  float   sum,
+    out bool    skip,
+    src exec    "stages/report",
+)
+
+pipeline SUM_SQUARE_PIPELINE(
+    in  float[] values,
+    in  bool    disable_sq,
+    out float   sum,
+)
+{
+    call SUM_SQUARES(
+        values = self.values,
+    ) using (
+        disabled = self.disable_sq,
+    )
+
+    call REPORT(
+        values = self.values,
+        sum    = SUM_SQUARES.sum,
+    )
+
+    call SUM_SQUARES as SUM_AGAIN(
+        values = self.values,
+    ) using (
+        disabled = REPORT.skip,
+    )
+
+    return (
+        sum = SUM_SQUARES.sum,
+    )
+}
+
+call SUM_SQUARE_PIPELINE(
+    values     = [1.0, 2.0, 3.0],
+    disable_sq = sweep(
+        true,
+        false,
+    ),
+)
+`
+	d, err := ioutil.TempDir("", "pipestance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	rt, cleanup := testRuntime(t)
+	defer cleanup()
+	psPath := path.Join(d, "test")
+	ps, err := rt.PlanPipeline(src, path.Join(d, "src.mro"), "test",
+		psPath, nil, "1.0.0", make(map[string]string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(psPath); !os.IsNotExist(err) {
+		t.Error("Expected the pipestance directory not to be created.")
+	}
+	plan := ps.Plan()
+	if len(plan) != 3 {
+		t.Fatalf("Expected 3 stages, got %d", len(plan))
+	}
+	const prefix = "ID.test.SUM_SQUARE_PIPELINE."
+	if plan[0].Fqname != prefix+"SUM_SQUARES" ||
+		plan[1].Fqname != prefix+"REPORT" ||
+		plan[2].Fqname != prefix+"SUM_AGAIN" {
+		t.Errorf("Expected stages in dependency order, got %s, %s, %s",
+			plan[0].Fqname, plan[1].Fqname, plan[2].Fqname)
+	}
+	sq := plan[0]
+	if sq.Split == nil || sq.Join == nil {
+		t.Error("Expected split and join resources.")
+	}
+	if sq.Chunk.MemGB != 2 {
+		t.Errorf("Expected 2 GB for chunks, got %d", sq.Chunk.MemGB)
+	}
+	if len(sq.Forks) != 2 {
+		t.Fatalf("Expected 2 forks, got %d", len(sq.Forks))
+	} else if !sq.Forks[0].Disabled || sq.Forks[1].Disabled {
+		t.Error("Expected only the first fork to be disabled.")
+	} else if v := sq.Forks[0].SweepArgs["disable_sq"]; v != true {
+		t.Errorf("Expected disable_sq sweep value true, got %v", v)
+	}
+	if plan[1].Split != nil {
+		t.Error("Expected no split for REPORT.")
+	}
+	for _, fork := range plan[2].Forks {
+		if fork.Disabled {
+			t.Error("Expected SUM_AGAIN not to be statically disabled.")
+		}
+		if len(fork.DisabledBy) != 1 || fork.DisabledBy[0] != prefix+"REPORT.skip" {
+			t.Errorf("Expected SUM_AGAIN to be disabled by REPORT.skip, got %v",
+				fork.DisabledBy)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Export of pipestance provenance in machine-readable formats.
+//
+// Two formats are supported: W3C PROV-JSON, and RO-Crate JSON-LD.  In both
+// cases, each completed stage fork is an activity which used its input
+// files and generated its output files.  Directories are collections of the
+// files inside them.
+//
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const (
+	ProvenanceProv    = "prov"
+	ProvenanceRoCrate = "rocrate"
+)
+
+const martianNamespace = "https://martian-lang.org/ns#"
+
+// A file or directory referenced by a pipestance.
+type provFile struct {
+	path string
+	size int64
+	ok   bool
+
+	// For directories, the files inside the directory.
+	members []string
+}
+
+// A stage fork which ran.
+type provActivity struct {
+	id        string
+	stage     string
+	fork      int
+	lang      string
+	code      string
+	hosts     []string
+	start     time.Time
+	end       time.Time
+	used      map[string][]string
+	generated map[string][]string
+}
+
+// Collected provenance information for a pipestance.
+type provGraph struct {
+	psid           string
+	pipeline       string
+	uuid           string
+	invocation     string
+	martianVersion string
+	mroVersion     string
+	activities     []*provActivity
+	files          map[string]*provFile
+}
+
+func (self *provGraph) addFiles(value []byte, target map[string][]string, arg string) {
+	for _, name := range getMaybeFileNames(value) {
+		if !filepath.IsAbs(name) {
+			continue
+		}
+		if _, ok := self.files[name]; !ok {
+			f := &provFile{path: name}
+			if info, err := os.Stat(name); err == nil {
+				f.ok = true
+				if info.IsDir() {
+					self.addMembers(f)
+				} else {
+					f.size = info.Size()
+				}
+			}
+			self.files[name] = f
+		}
+		target[arg] = append(target[arg], name)
+	}
+}
+
+// Add the files inside a directory to the graph, as members of the
+// directory.  The size of the directory is the total size of its members.
+func (self *provGraph) addMembers(dir *provFile) {
+	dir.members = []string{}
+	util.Walk(dir.path, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if _, ok := self.files[p]; !ok {
+			self.files[p] = &provFile{
+				path: p,
+				size: info.Size(),
+				ok:   true,
+			}
+		}
+		dir.members = append(dir.members, p)
+		dir.size += info.Size()
+		return nil
+	})
+	sort.Strings(dir.members)
+}
+
+func (self *Fork) getHosts() []string {
+	seen := make(map[string]struct{})
+	var hosts []string
+	for _, md := range self.collectMetadatas()[1:] {
+		if !md.exists(JobInfoFile) {
+			continue
+		}
+		var jobInfo JobInfo
+		if err := md.ReadInto(JobInfoFile, &jobInfo); err == nil && jobInfo.Host != "" {
+			if _, ok := seen[jobInfo.Host]; !ok {
+				seen[jobInfo.Host] = struct{}{}
+				hosts = append(hosts, jobInfo.Host)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (self *Pipestance) buildProvGraph() *provGraph {
+	graph := &provGraph{
+		psid:       self.GetPsid(),
+		pipeline:   self.GetPname(),
+		invocation: self.metadata.readRaw(InvocationFile),
+		files:      make(map[string]*provFile),
+	}
+	graph.uuid, _ = self.GetUuid()
+	graph.martianVersion, graph.mroVersion, _ = self.GetVersions()
+	readSize := self.node.rt.FreeMemBytes() / 2
+	for _, node := range self.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		for _, fork := range node.forks {
+			if fork.getState() != Complete {
+				continue
+			}
+			act := &provActivity{
+				id:        fork.fqname,
+				stage:     node.name,
+				fork:      fork.index,
+				lang:      node.stagecodeLang.String(),
+				code:      node.stagecodeCmd,
+				hosts:     fork.getHosts(),
+				used:      make(map[string][]string),
+				generated: make(map[string][]string),
+			}
+			act.start, act.end = fork.getWallClock()
+			if args, err := resolveBindings(node.argbindings, fork.argPermute,
+				readSize); err != nil {
+				util.LogError(err, "runtime",
+					"Error resolving arguments for %s.", fork.fqname)
+			} else {
+				for arg, value := range args {
+					graph.addFiles(value, act.used, arg)
+				}
+			}
+			if outs, err := fork.metadata.read(OutsFile, readSize); err != nil {
+				util.LogError(err, "runtime",
+					"Error reading outputs for %s.", fork.fqname)
+			} else {
+				for out, value := range outs {
+					graph.addFiles(value, act.generated, out)
+				}
+			}
+			graph.activities = append(graph.activities, act)
+		}
+	}
+	return graph
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func fileUri(p string) string {
+	return "file://" + filepath.ToSlash(p)
+}
+
+func provTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Render the graph as a W3C PROV-JSON document.
+func (self *provGraph) prov() map[string]interface{} {
+	entities := make(map[string]interface{}, len(self.files))
+	members := make(map[string]interface{})
+	for p, f := range self.files {
+		entity := map[string]interface{}{
+			"prov:type":    "martian:File",
+			"prov:label":   filepath.Base(p),
+			"martian:path": p,
+		}
+		if f.members != nil {
+			entity["prov:type"] = "prov:Collection"
+		}
+		if f.ok {
+			entity["martian:size"] = f.size
+		}
+		entities[fileUri(p)] = entity
+		for _, member := range f.members {
+			members[fmt.Sprintf("_:member%d", len(members))] = map[string]interface{}{
+				"prov:collection": fileUri(p),
+				"prov:entity":     fileUri(member),
+			}
+		}
+	}
+	martianAgent := "martian:martian"
+	agents := map[string]interface{}{
+		martianAgent: map[string]interface{}{
+			"prov:type":       "prov:SoftwareAgent",
+			"martian:version": self.martianVersion,
+		},
+	}
+	activities := make(map[string]interface{}, len(self.activities))
+	used := make(map[string]interface{})
+	generated := make(map[string]interface{})
+	associated := make(map[string]interface{})
+	for _, act := range self.activities {
+		id := "martian:" + act.id
+		activity := map[string]interface{}{
+			"prov:type":            "martian:StageFork",
+			"prov:label":           act.stage,
+			"martian:fork":         act.fork,
+			"martian:lang":         act.lang,
+			"martian:code":         act.code,
+			"martian:mroVersion":   self.mroVersion,
+			"martian:pipestanceId": self.psid,
+		}
+		if t := provTime(act.start); t != "" {
+			activity["prov:startTime"] = t
+		}
+		if t := provTime(act.end); t != "" {
+			activity["prov:endTime"] = t
+		}
+		activities[id] = activity
+		associated[fmt.Sprintf("_:assoc%d", len(associated))] = map[string]interface{}{
+			"prov:activity": id,
+			"prov:agent":    martianAgent,
+		}
+		for _, host := range act.hosts {
+			hostId := "martian:host/" + host
+			if _, ok := agents[hostId]; !ok {
+				agents[hostId] = map[string]interface{}{
+					"prov:type":  "martian:Host",
+					"prov:label": host,
+				}
+			}
+			associated[fmt.Sprintf("_:assoc%d", len(associated))] = map[string]interface{}{
+				"prov:activity": id,
+				"prov:agent":    hostId,
+			}
+		}
+		for _, arg := range sortedKeys(act.used) {
+			for _, p := range act.used[arg] {
+				used[fmt.Sprintf("_:used%d", len(used))] = map[string]interface{}{
+					"prov:activity": id,
+					"prov:entity":   fileUri(p),
+					"prov:role":     "martian:" + arg,
+				}
+			}
+		}
+		for _, out := range sortedKeys(act.generated) {
+			for _, p := range act.generated[out] {
+				generated[fmt.Sprintf("_:gen%d", len(generated))] = map[string]interface{}{
+					"prov:activity": id,
+					"prov:entity":   fileUri(p),
+					"prov:role":     "martian:" + out,
+				}
+			}
+		}
+	}
+	return map[string]interface{}{
+		"prefix": map[string]string{
+			"martian": martianNamespace,
+		},
+		"entity":            entities,
+		"activity":          activities,
+		"agent":             agents,
+		"used":              used,
+		"wasGeneratedBy":    generated,
+		"wasAssociatedWith": associated,
+		"hadMember":         members,
+	}
+}
+
+// Render the graph as an RO-Crate JSON-LD document.
+func (self *provGraph) roCrate() map[string]interface{} {
+	type ref map[string]string
+	idRef := func(id string) ref { return ref{"@id": id} }
+	refs := func(m map[string][]string) []ref {
+		var result []ref
+		for _, k := range sortedKeys(m) {
+			for _, p := range m[k] {
+				result = append(result, idRef(fileUri(p)))
+			}
+		}
+		return result
+	}
+
+	paths := make([]string, 0, len(self.files))
+	for p := range self.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	graph := make([]interface{}, 0, 4+len(paths)+len(self.activities))
+	graph = append(graph, map[string]interface{}{
+		"@id":        "ro-crate-metadata.json",
+		"@type":      "CreativeWork",
+		"conformsTo": idRef("https://w3id.org/ro/crate/1.1"),
+		"about":      idRef("./"),
+	})
+	hasPart := make([]ref, 0, len(paths))
+	for _, p := range paths {
+		hasPart = append(hasPart, idRef(fileUri(p)))
+	}
+	graph = append(graph, map[string]interface{}{
+		"@id":         "./",
+		"@type":       "Dataset",
+		"name":        self.psid,
+		"identifier":  self.uuid,
+		"description": self.invocation,
+		"hasPart":     hasPart,
+	})
+	graph = append(graph, map[string]interface{}{
+		"@id":     "#martian",
+		"@type":   "SoftwareApplication",
+		"name":    "Martian",
+		"url":     "https://martian-lang.org",
+		"version": self.martianVersion,
+	})
+	graph = append(graph, map[string]interface{}{
+		"@id":     "#pipeline",
+		"@type":   "SoftwareApplication",
+		"name":    self.pipeline,
+		"version": self.mroVersion,
+	})
+	for _, p := range paths {
+		f := self.files[p]
+		file := map[string]interface{}{
+			"@id":   fileUri(p),
+			"@type": "File",
+			"name":  filepath.Base(p),
+		}
+		if f.members != nil {
+			file["@type"] = "Dataset"
+			parts := make([]ref, 0, len(f.members))
+			for _, member := range f.members {
+				parts = append(parts, idRef(fileUri(member)))
+			}
+			file["hasPart"] = parts
+		}
+		if f.ok {
+			file["contentSize"] = f.size
+		}
+		graph = append(graph, file)
+	}
+	hosts := make(map[string]struct{})
+	for _, act := range self.activities {
+		action := map[string]interface{}{
+			"@id":        "#" + act.id,
+			"@type":      "CreateAction",
+			"name":       act.stage,
+			"instrument": []ref{idRef("#martian"), idRef("#pipeline")},
+			"object":     refs(act.used),
+			"result":     refs(act.generated),
+			"description": fmt.Sprintf("%s stage %s (fork %d)",
+				act.lang, act.code, act.fork),
+		}
+		if t := provTime(act.start); t != "" {
+			action["startTime"] = t
+		}
+		if t := provTime(act.end); t != "" {
+			action["endTime"] = t
+		}
+		if len(act.hosts) > 0 {
+			agents := make([]ref, 0, len(act.hosts))
+			for _, host := range act.hosts {
+				agents = append(agents, idRef("#host/"+host))
+				hosts[host] = struct{}{}
+			}
+			action["agent"] = agents
+		}
+		graph = append(graph, action)
+	}
+	hostNames := make([]string, 0, len(hosts))
+	for host := range hosts {
+		hostNames = append(hostNames, host)
+	}
+	sort.Strings(hostNames)
+	for _, host := range hostNames {
+		graph = append(graph, map[string]interface{}{
+			"@id":   "#host/" + host,
+			"@type": "Thing",
+			"name":  host,
+		})
+	}
+	return map[string]interface{}{
+		"@context": "https://w3id.org/ro/crate/1.1/context",
+		"@graph":   graph,
+	}
+}
+
+// ExportProvenance returns a JSON-serializable provenance document for the
+// pipestance, in either the ProvenanceProv or ProvenanceRoCrate format.
+func (self *Pipestance) ExportProvenance(format string) (interface{}, error) {
+	switch format {
+	case ProvenanceProv:
+		return self.buildProvGraph().prov(), nil
+	case ProvenanceRoCrate:
+		return self.buildProvGraph().roCrate(), nil
+	default:
+		return nil, fmt.Errorf("Unsupported provenance format %s", format)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func testProvGraph() *provGraph {
+	return &provGraph{
+		psid:           "test",
+		pipeline:       "PIPE",
+		martianVersion: "v3.1.0",
+		mroVersion:     "1.0",
+		activities: []*provActivity{
+			{
+				id:    "ID.test.PIPE.STAGE.fork0",
+				stage: "STAGE",
+				lang:  "py",
+				code:  "stages/stage",
+				hosts: []string{"node1"},
+				start: time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC),
+				end:   time.Date(2018, 3, 1, 10, 5, 0, 0, time.UTC),
+				used: map[string][]string{
+					"input": {"/data/in.txt"},
+				},
+				generated: map[string][]string{
+					"output": {"/ps/PIPE/STAGE/fork0/files/out.txt"},
+				},
+			},
+		},
+		files: map[string]*provFile{
+			"/data/in.txt": {
+				path: "/data/in.txt",
+				size: 10,
+				ok:   true,
+			},
+			"/ps/PIPE/STAGE/fork0/files/out.txt": {
+				path: "/ps/PIPE/STAGE/fork0/files/out.txt",
+			},
+		},
+	}
+}
+
+func TestProvJson(t *testing.T) {
+	doc := testProvGraph().prov()
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	entities := doc["entity"].(map[string]interface{})
+	if len(entities) != 2 {
+		t.Errorf("Expected 2 entities, got %d", len(entities))
+	}
+	if _, ok := entities["file:///data/in.txt"]; !ok {
+		t.Error("Missing input file entity.")
+	}
+	activities := doc["activity"].(map[string]interface{})
+	act, ok := activities["martian:ID.test.PIPE.STAGE.fork0"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Missing stage activity.")
+	}
+	if s := act["prov:startTime"]; s != "2018-03-01T10:00:00Z" {
+		t.Errorf("Incorrect start time %v", s)
+	}
+	if n := len(doc["used"].(map[string]interface{})); n != 1 {
+		t.Errorf("Expected 1 usage, got %d", n)
+	}
+	if n := len(doc["wasGeneratedBy"].(map[string]interface{})); n != 1 {
+		t.Errorf("Expected 1 generation, got %d", n)
+	}
+	// One association with martian, one with the host.
+	if n := len(doc["wasAssociatedWith"].(map[string]interface{})); n != 2 {
+		t.Errorf("Expected 2 associations, got %d", n)
+	}
+}
+
+func TestRoCrate(t *testing.T) {
+	doc := testProvGraph().roCrate()
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	graph := doc["@graph"].([]interface{})
+	types := make(map[string]int)
+	for _, item := range graph {
+		types[item.(map[string]interface{})["@type"].(string)]++
+	}
+	for tname, expect := range map[string]int{
+		"CreativeWork":        1,
+		"Dataset":             1,
+		"SoftwareApplication": 2,
+		"File":                2,
+		"CreateAction":        1,
+		"Thing":               1,
+	} {
+		if types[tname] != expect {
+			t.Errorf("Expected %d %s, got %d", expect, tname, types[tname])
+		}
+	}
+}
+
+func TestProvDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testProvDirectory")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "out", "sub"), 0755)
+	ioutil.WriteFile(path.Join(dir, "out", "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(path.Join(dir, "out", "sub", "b.txt"), []byte("bb"), 0644)
+
+	graph := &provGraph{files: make(map[string]*provFile)}
+	generated := make(map[string][]string)
+	graph.addFiles([]byte(`"`+path.Join(dir, "out")+`"`), generated, "out")
+	if len(generated["out"]) != 1 {
+		t.Errorf("Expected the directory to be generated, got %v", generated)
+	}
+	if len(graph.files) != 3 {
+		t.Fatalf("Expected 3 files, got %d", len(graph.files))
+	}
+	f := graph.files[path.Join(dir, "out")]
+	if len(f.members) != 2 || f.size != 3 {
+		t.Errorf("Expected 2 members totalling 3 bytes, got %v", f.members)
+	}
+
+	if n := len(graph.prov()["hadMember"].(map[string]interface{})); n != 2 {
+		t.Errorf("Expected 2 memberships, got %d", n)
+	}
+	datasets := 0
+	for _, item := range graph.roCrate()["@graph"].([]interface{}) {
+		if item.(map[string]interface{})["@type"] == "Dataset" {
+			datasets++
+		}
+	}
+	// The crate root and the directory.
+	if datasets != 2 {
+		t.Errorf("Expected 2 datasets, got %d", datasets)
+	}
+}
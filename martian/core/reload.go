@@ -0,0 +1,101 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Reloading of overrides and job manager configuration in a running mrp.
+//
+
+import (
+	"fmt"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Resource limits which may be changed by ReloadConfig.  Zero values leave
+// the current limit unchanged.
+type ResourceLimits struct {
+	// The maximum number of concurrent jobs in cluster mode.  This can only
+	// be changed if mrp was started with a limit.
+	MaxJobs int `json:"maxjobs,omitempty"`
+
+	// The cores and memory available to jobs run by the local job manager.
+	LocalCores int `json:"localcores,omitempty"`
+	LocalMemGB int `json:"localmem,omitempty"`
+}
+
+// ReloadConfig re-reads the overrides file, the job manager configuration and
+// (in cluster mode) the job template, and applies any new resource limits.  The changes apply to jobs which have
+// not yet been started.  Nothing is changed if either file is invalid.
+//
+// Returns a description of what changed, which is also logged.
+func (self *Runtime) ReloadConfig(limits ResourceLimits) ([]string, error) {
+	remote, _ := self.JobManager.(*RemoteJobManager)
+	if limits.MaxJobs > 0 && (remote == nil || remote.jobSem == nil) {
+		return nil, fmt.Errorf(
+			"The job limit can only be changed in cluster mode, " +
+				"if mrp was started with --maxjobs.")
+	}
+	if limits.MaxJobs < 0 || limits.LocalCores < 0 || limits.LocalMemGB < 0 {
+		return nil, fmt.Errorf("Resource limits may not be negative.")
+	}
+
+	self.reloadLock.Lock()
+	defer self.reloadLock.Unlock()
+	jobConfig, err := readJobConfig(self.Config.ProfileMode)
+	if err != nil {
+		return nil, err
+	}
+	var jobTemplate string
+	if remote != nil {
+		jobTemplate, err = readJobTemplate(remote.getConfig().jobTemplateFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var changes []string
+	if overrideChanges, err := self.overrides.Reload(); err != nil {
+		return nil, err
+	} else {
+		for _, c := range overrideChanges {
+			changes = append(changes, "override "+c)
+		}
+	}
+
+	self.jobConfigLock.Lock()
+	self.jobConfig = jobConfig
+	self.jobConfigLock.Unlock()
+
+	settings := jobConfig.JobSettings
+	cores, mem := limits.LocalCores, limits.LocalMemGB
+	if cores > 0 {
+		self.reloadedLimits.LocalCores = cores
+	} else if self.Config.JobMode != "local" &&
+		self.Config.LocalCores <= 0 && self.reloadedLimits.LocalCores <= 0 {
+		// In cluster mode, local jobs are limited to the default job size
+		// unless otherwise specified.
+		cores = settings.ThreadsPerJob
+	}
+	if mem > 0 {
+		self.reloadedLimits.LocalMemGB = mem
+	} else if self.Config.JobMode != "local" &&
+		self.Config.LocalMem <= 0 && self.reloadedLimits.LocalMemGB <= 0 {
+		mem = settings.MemGBPerJob
+	}
+	changes = append(changes,
+		diffJobSettings(self.JobManager.GetSettings(), settings)...)
+	if remote != nil {
+		changes = append(changes,
+			remote.reconfigure(settings, jobTemplate, limits.MaxJobs)...)
+	}
+	changes = append(changes,
+		self.LocalJobManager.reconfigure(settings, cores, mem)...)
+
+	if len(changes) == 0 {
+		util.LogInfo("reload", "Configuration reloaded with no changes.")
+	}
+	for _, c := range changes {
+		util.LogInfo("reload", "%s", c)
+	}
+	return changes, nil
+}
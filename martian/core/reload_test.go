@@ -0,0 +1,41 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRemoteReconfigure(t *testing.T) {
+	settings := &JobManagerSettings{ThreadsPerJob: 1, MemGBPerJob: 4}
+	self := &RemoteJobManager{
+		config: jobManagerConfig{
+			jobSettings:     settings,
+			jobTemplateFile: "sge.template",
+			jobTemplate:     "#!/bin/sh\n__MRO_CMD__\n",
+		},
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			self.GetSystemReqs(0, 0)
+		}
+	}()
+	newSettings := &JobManagerSettings{ThreadsPerJob: 2, MemGBPerJob: 8}
+	changes := self.reconfigure(newSettings,
+		"#!/bin/sh\n#$ -pe threads __MRO_THREADS__\n__MRO_CMD__\n", 10)
+	wg.Wait()
+	if len(changes) != 1 || changes[0] != "job template sge.template changed" {
+		t.Errorf("Unexpected changes %q", changes)
+	}
+	if threads, mem := self.GetSystemReqs(0, 0); threads != 2 || mem != 8 {
+		t.Errorf("Expected 2 threads and 8 GB, got %d, %d", threads, mem)
+	}
+	if changes := self.reconfigure(newSettings,
+		self.getConfig().jobTemplate, 10); len(changes) != 0 {
+		t.Errorf("Unexpected changes %q", changes)
+	}
+}
@@ -0,0 +1,354 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Rerunning a single job from a pipestance, for debugging.
+//
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// A JobReplay reruns one split, chunk, or join job of a pipestance with the
+// inputs recorded in its metadata directory.  The job's inputs are copied
+// into a scratch directory and it is run there, so the pipestance itself is
+// not modified.
+type JobReplay struct {
+	rt          *Runtime
+	node        *Node
+	shellName   string
+	source      *Metadata
+	metadata    *Metadata
+	journalPath string
+	jobInfo     JobInfo
+}
+
+// The result of replaying a job.
+type JobReplayResult struct {
+	// The scratch metadata directory the job ran in.
+	Path string `json:"path"`
+
+	// The final state of the job.
+	State MetadataState `json:"state"`
+
+	// The error message from the job, if it failed.
+	Error string `json:"error,omitempty"`
+
+	// Any alarms raised by the job.
+	Alarms string `json:"alarms,omitempty"`
+
+	// The outputs of the job, if it completed.
+	Outs LazyArgumentMap `json:"outs,omitempty"`
+}
+
+// NewJobReplay prepares to rerun the job whose metadata directory is given,
+// e.g. PIPESTANCE/PIPELINE/STAGE/fork0/chnk0.  The pipestance is found by
+// searching the parent directories of the metadata directory, and the mro
+// path is used to find the stage code.  The job is run in the scratch
+// directory, which must not exist.  If scratch is empty, a new temporary
+// directory is used.
+//
+// The files holding the values of the job's secret arguments are removed
+// once its fork finishes, so unless they still exist, the values must be
+// given again in secrets, keyed by parameter name.
+func (self *Runtime) NewJobReplay(metadataPath string, mroPaths []string,
+	scratch string, secrets LazyArgumentMap,
+	ctx context.Context) (*JobReplay, error) {
+	jobPath, err := filepath.Abs(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	forkPath := path.Dir(jobPath)
+	psPath := forkPath
+	for {
+		if _, err := os.Stat(path.Join(psPath, MroSourceFile.FileName())); err == nil {
+			break
+		}
+		if psPath == "/" || psPath == "." {
+			return nil, &RuntimeError{fmt.Sprintf(
+				"%s is not inside a pipestance", metadataPath)}
+		}
+		psPath = path.Dir(psPath)
+	}
+	pipestance, err := self.ReattachToPipestanceWithMroSrc(
+		path.Base(psPath), psPath, "", "", mroPaths, "", nil, false, true, ctx)
+	if err != nil {
+		return nil, err
+	}
+	pipestance.LoadMetadata(ctx)
+
+	var fork *Fork
+	for _, node := range pipestance.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		for _, f := range node.forks {
+			if f.path == forkPath {
+				fork = f
+			}
+		}
+	}
+	if fork == nil {
+		return nil, &RuntimeError{fmt.Sprintf(
+			"%s is not the metadata directory of a stage job", metadataPath)}
+	}
+	util.LogInfo("runtime", "Found %s in pipestance %s", fork.fqname, psPath)
+
+	replay := &JobReplay{
+		rt:   self,
+		node: fork.node,
+	}
+	name := path.Base(jobPath)
+	fqname := fork.fqname
+	switch name {
+	case "split":
+		replay.shellName = "split"
+		replay.source = fork.split_metadata
+	case "join":
+		replay.shellName = "join"
+		replay.source = fork.join_metadata
+	default:
+		for _, chunk := range fork.chunks {
+			if path.Base(chunk.metadata.path) == name ||
+				path.Base(chunk.metadata.finalPath) == name {
+				replay.shellName = "main"
+				replay.source = chunk.metadata
+				fqname = chunk.fqname
+				name = path.Base(chunk.metadata.finalPath)
+			}
+		}
+		if replay.source == nil {
+			return nil, &RuntimeError{fmt.Sprintf(
+				"%s is not the metadata directory of a stage job", metadataPath)}
+		}
+	}
+	if err := replay.source.ReadInto(JobInfoFile, &replay.jobInfo); err != nil {
+		return nil, &RuntimeError{fmt.Sprintf(
+			"Could not read the job info for %s: %v", metadataPath, err)}
+	}
+	if replay.jobInfo.Name != "" {
+		fqname = replay.jobInfo.Name
+	}
+
+	if scratch == "" {
+		if scratch, err = ioutil.TempDir("", "replay-"); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(scratch); err == nil {
+		return nil, &RuntimeError{fmt.Sprintf("%s already exists", scratch)}
+	} else if err := util.MkdirAll(scratch); err != nil {
+		return nil, err
+	}
+	replay.journalPath = path.Join(scratch, "journal")
+	if err := util.Mkdir(replay.journalPath); err != nil {
+		return nil, err
+	}
+	replay.metadata = NewMetadataWithJournalPath(fqname,
+		path.Join(scratch, name), replay.journalPath)
+	if err := replay.metadata.mkdirs(); err != nil {
+		return nil, err
+	}
+	return replay, replay.copyInputs(fork, secrets)
+}
+
+// Copy the job's inputs into the scratch directory, and make a fresh set of
+// output file names there.
+func (self *JobReplay) copyInputs(fork *Fork, secrets LazyArgumentMap) error {
+	if err := self.copyArgs(fork, secrets); err != nil {
+		return err
+	}
+	if self.shellName == "join" {
+		for _, name := range []MetadataFileName{ChunkDefsFile, ChunkOutsFile} {
+			if b, err := self.source.readRawBytes(name); err != nil {
+				return &RuntimeError{fmt.Sprintf(
+					"Could not read %s from %s: %v",
+					name.FileName(), self.source.path, err)}
+			} else if err := self.metadata.WriteRawBytes(name, b); err != nil {
+				return err
+			}
+		}
+	}
+	if self.shellName == "split" {
+		return nil
+	}
+	outs := makeOutArgs(fork.OutParams(), self.metadata.curFilesPath, false)
+	if self.shellName == "main" && fork.Split() {
+		for k, v := range makeOutArgs(fork.node.callable.(*syntax.Stage).ChunkOuts,
+			self.metadata.curFilesPath, false) {
+			outs[k] = v
+		}
+	}
+	return self.metadata.Write(OutsFile, outs)
+}
+
+// Copy the job's arguments into the scratch directory, writing the given
+// values for any secret arguments there.
+func (self *JobReplay) copyArgs(fork *Fork, secrets LazyArgumentMap) error {
+	var args LazyArgumentMap
+	if err := self.source.ReadInto(ArgsFile, &args); err != nil {
+		return &RuntimeError{fmt.Sprintf(
+			"Could not read %s from %s: %v",
+			ArgsFile.FileName(), self.source.path, err)}
+	}
+	params := fork.node.callable.GetInParams()
+	for id := range secrets {
+		if param := params.Table[id]; param == nil ||
+			param.GetTname() != syntax.KindSecret {
+			return &RuntimeError{fmt.Sprintf(
+				"%s is not a secret parameter of %s",
+				id, fork.node.callable.GetId())}
+		}
+	}
+	if len(secrets) > 0 {
+		given := make(LazyArgumentMap, len(secrets))
+		for id, v := range secrets {
+			given[id] = v
+		}
+		if err := writeSecretArgs(path.Join(self.metadata.path, secretsDir),
+			params, given); err != nil {
+			return err
+		}
+		if args == nil {
+			args = make(LazyArgumentMap, len(given))
+		}
+		for id, v := range given {
+			args[id] = v
+		}
+	}
+	if !secretFilesExist(params, args) {
+		return &RuntimeError{fmt.Sprintf(
+			"The values of the secret arguments of %s were removed when "+
+				"the fork finished, so they must be given again",
+			self.metadata.fqname)}
+	}
+	return self.metadata.Write(ArgsFile, args)
+}
+
+// The scratch metadata directory for the job.
+func (self *JobReplay) GetPath() string {
+	return self.metadata.path
+}
+
+// Run the job, with stdin, stdout and stderr attached to the terminal.  If a
+// debugger command is given, the stage code is run under it, e.g.
+// "gdb --args".  If profileMode is not empty, it replaces the profiling mode
+// the job originally ran with.  An error is returned if the job could not
+// be run.  Failures of the job itself are reported in the result.
+func (self *JobReplay) Run(debugger []string, profileMode ProfileMode) (*JobReplayResult, error) {
+	// Keep the settings the job ran with, but not what was recorded about
+	// how the original run went.
+	jobInfo := self.jobInfo
+	jobInfo.Type = "local"
+	jobInfo.Pid = 0
+	jobInfo.Host = ""
+	jobInfo.Cwd = ""
+	jobInfo.PythonInfo = nil
+	jobInfo.RusageInfo = nil
+	jobInfo.MemoryUsage = nil
+	jobInfo.IoStats = nil
+	jobInfo.WallClockInfo = nil
+	jobInfo.ClusterEnv = nil
+	if c := self.jobInfo.Container; c != nil {
+		// The scratch directory must also be visible in the container.
+		container := *c
+		container.Mounts = minimalMounts(append(
+			append([]string{}, c.Mounts...), path.Dir(self.metadata.path)))
+		jobInfo.Container = &container
+	}
+	if profileMode != "" {
+		jobInfo.ProfileConfig = self.rt.ProfileConfig(profileMode)
+		jobInfo.ProfileMode = profileMode
+		if jobInfo.ProfileConfig != nil && jobInfo.ProfileConfig.Adapter != "" {
+			jobInfo.ProfileMode = jobInfo.ProfileConfig.Adapter
+		}
+	}
+	if err := util.Mkdir(self.metadata.TempDir()); err != nil {
+		return nil, err
+	}
+	if err := self.metadata.Write(JobInfoFile, &jobInfo); err != nil {
+		return nil, err
+	}
+
+	shellCmd, argv := self.rt.jobCommand(self.node.stagecodeLang,
+		self.node.stagecodeCmd, self.shellName, self.metadata,
+		path.Join(self.journalPath, self.metadata.fqname))
+	if len(debugger) > 0 {
+		if self.node.stagecodeLang == syntax.ExecStage {
+			// Exec stages are not run through mrjob, so run the
+			// debugger directly.
+			argv = append(append(debugger[1:len(debugger):len(debugger)],
+				shellCmd), argv...)
+			shellCmd = debugger[0]
+		} else {
+			argv = append(debugger[:len(debugger):len(debugger)], argv...)
+		}
+	}
+	util.PrintInfo("runtime", "(run:local)       %s.%s", self.metadata.fqname, self.shellName)
+	util.LogInfo("runtime", "%s %s", shellCmd, strings.Join(argv, " "))
+
+	// The rest of the environment is inherited.  mrjob applies the stage's
+	// environment variables and PATH prefix from the job info, expanded
+	// against this environment.
+	envs := make(map[string]string, len(self.node.envs)+1)
+	for k, v := range self.node.envs {
+		envs[k] = v
+	}
+	envs["TMPDIR"] = self.metadata.TempDir()
+	cmd := exec.Command(shellCmd, argv...)
+	cmd.Dir = self.metadata.curFilesPath
+	cmd.Env = util.MergeEnv(threadEnvs(self.rt.LocalJobManager, jobInfo.Threads, envs))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	// Remove any secret values which were given for the replay.
+	if rmErr := os.RemoveAll(path.Join(self.metadata.path, secretsDir)); rmErr != nil {
+		util.LogError(rmErr, "runtime", "Could not remove secrets for %s",
+			self.metadata.fqname)
+	}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, err
+		}
+		util.LogError(err, "runtime", "%s.%s exited with an error.",
+			self.metadata.fqname, self.shellName)
+	}
+	return self.result(), nil
+}
+
+func (self *JobReplay) result() *JobReplayResult {
+	metadata := self.metadata
+	metadata.loadCache()
+	result := &JobReplayResult{Path: metadata.path}
+	result.State, _ = metadata.getState()
+	if metadata.exists(AlarmFile) {
+		result.Alarms = metadata.readRaw(AlarmFile)
+	}
+	switch result.State {
+	case Complete:
+		if self.shellName != "split" {
+			result.Outs, _ = metadata.read(OutsFile, -1)
+		}
+	case Failed:
+		if metadata.exists(Assert) {
+			result.Error = metadata.readRaw(Assert)
+		} else {
+			result.Error = metadata.readRaw(Errors)
+		}
+	default:
+		result.Error = fmt.Sprintf("The job exited without completing.  See %s.",
+			metadata.MetadataFilePath(LogFile))
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+const replaySrc = harnessMroSrc + `
+pipeline SUM_PIPE(
+    in  float[] values,
+    out float   total,
+)
+{
+    call SUM(
+        values = self.values,
+    )
+
+    return (
+        total = SUM.total,
+    )
+}
+
+call SUM_PIPE(
+    values = [1, 2],
+)
+`
+
+func TestJobReplay(t *testing.T) {
+	rt, d, cleanup := setupHarnessTest(t)
+	defer cleanup()
+	psPath := path.Join(d, "test")
+	ps, err := rt.InvokePipeline(replaySrc, path.Join(d, "pipe.mro"), "test",
+		psPath, []string{d}, "1.0.0", make(map[string]string), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.Unlock()
+
+	// Fake up a pipestance which has split SUM into two chunks.
+	forkPath := path.Join(psPath, "SUM_PIPE", "SUM", "fork0")
+	for fn, content := range map[string]string{
+		"split/_stage_defs": `{"chunks":[{"value":1},{"value":2}],"join":{}}`,
+		"chnk1/_args":       `{"values":[1,2],"value":2}`,
+		"chnk1/_jobinfo":    `{"name":"ID.test.SUM_PIPE.SUM.fork0.chnk1","threads":1}`,
+	} {
+		if err := os.MkdirAll(path.Dir(path.Join(forkPath, fn)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(forkPath, fn), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replay, err := rt.NewJobReplay(path.Join(forkPath, "chnk1"), []string{d},
+		path.Join(d, "scratch"), nil, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := replay.GetPath(); p != path.Join(d, "scratch", "chnk1") {
+		t.Errorf("Expected to run in scratch/chnk1, got %s", p)
+	}
+	result, err := replay.Run(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.State != Complete {
+		t.Errorf("Expected the chunk to complete, got %v: %s",
+			result.State, result.Error)
+	} else if part := string(result.Outs["part"]); part != "1" {
+		t.Errorf("Expected part 1, got %s", part)
+	}
+	if _, err := os.Stat(path.Join(forkPath, "chnk1", "_complete")); err == nil {
+		t.Error("Expected the pipestance to be left untouched.")
+	}
+
+	if _, err := rt.NewJobReplay(path.Join(forkPath, "chnk1"), []string{d},
+		path.Join(d, "scratch"), nil, context.Background()); err == nil {
+		t.Error("Expected an error reusing a scratch directory.")
+	}
+	if _, err := rt.NewJobReplay(path.Join(forkPath, "chnk5"), []string{d},
+		"", nil, context.Background()); err == nil {
+		t.Error("Expected an error for a missing chunk.")
+	}
+	if _, err := rt.NewJobReplay(path.Join(d, "sum.sh"), []string{d},
+		"", nil, context.Background()); err == nil {
+		t.Error("Expected an error outside of a pipestance.")
+	}
+}
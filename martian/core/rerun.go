@@ -0,0 +1,218 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Rerunning part of a pipestance, starting from a given stage.
+//
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Find a node by its fully qualified name, or by its name relative to the
+// pipestance, e.g. PIPELINE.STAGE.
+func (self *Pipestance) findNode(name string) *Node {
+	if node := self.node.find(name); node != nil {
+		return node
+	}
+	return self.node.find(self.node.parent.getNode().fqname + "." + name)
+}
+
+// Get the set of nodes which must be reset to rerun the given node: the node
+// itself, everything inside it if it is a pipeline, and everything
+// downstream of it.
+func (self *Pipestance) rerunSet(node *Node) map[*Node]bool {
+	set := make(map[*Node]bool)
+	var add func(*Node)
+	add = func(n *Node) {
+		if set[n] {
+			return
+		}
+		set[n] = true
+		for _, post := range n.postnodes {
+			// Pipelines are post-nodes of the nodes they return outputs
+			// from, but only need their own outputs reset.  Nodes inside
+			// pipelines which are downstream are post-nodes themselves.
+			add(post.getNode())
+		}
+	}
+	var addAll func(*Node)
+	addAll = func(n *Node) {
+		add(n)
+		for _, sub := range n.subnodes {
+			addAll(sub.getNode())
+		}
+	}
+	addAll(node)
+	return set
+}
+
+// RerunStages returns the fully qualified names of the stages which would be
+// reset by RerunFrom, in the order in which they would run.
+func (self *Pipestance) RerunStages(name string) ([]string, error) {
+	_, stages, err := self.planRerun(name)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(stages))
+	for _, node := range stages {
+		result = append(result, node.fqname)
+	}
+	return result, nil
+}
+
+// Get the stage nodes to reset, and the pipeline nodes whose outputs they
+// contribute to.
+func (self *Pipestance) planRerun(name string) (pipelines, stages []*Node, err error) {
+	node := self.findNode(name)
+	if node == nil {
+		return nil, nil, &RuntimeError{fmt.Sprintf(
+			"%s is not a stage or pipeline in %s", name, self.node.fqname)}
+	}
+	if self.metadata.exists(MetadataZip) {
+		return nil, nil, &RuntimeError{
+			"The pipestance metadata was zipped, so stages cannot be rerun"}
+	}
+	set := self.rerunSet(node)
+	blocked := make(map[string]bool)
+	for _, n := range self.planOrder() {
+		if n.kind == "pipeline" {
+			// Pipelines containing any reset node are reset as well, but
+			// nothing inside them is.
+			if set[n] || containsAny(n, set) {
+				pipelines = append(pipelines, n)
+			}
+			continue
+		}
+		if !set[n] {
+			continue
+		}
+		stages = append(stages, n)
+		// Inputs which were removed by volatile data removal can't be
+		// recovered without rerunning the stage which produced them.
+		for _, pre := range n.prenodes {
+			prenode := pre.getNode()
+			if set[prenode] || prenode.kind != "stage" {
+				continue
+			}
+			for _, fork := range prenode.forks {
+				if report, ok := fork.getVdrKillReport(); ok && report.Count > 0 {
+					blocked[prenode.fqname] = true
+					break
+				}
+			}
+		}
+	}
+	if len(blocked) > 0 {
+		names := make([]string, 0, len(blocked))
+		for name := range blocked {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, nil, &RuntimeError{fmt.Sprintf(
+			"Volatile outputs of %s were already removed.  Rerun from an earlier stage instead",
+			strings.Join(names, ", "))}
+	}
+	return pipelines, stages, nil
+}
+
+// Returns true if any node in the set is inside the given pipeline.
+func containsAny(pipeline *Node, set map[*Node]bool) bool {
+	for n := range set {
+		if strings.HasPrefix(n.fqname, pipeline.fqname+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// RerunFrom resets the given stage or pipeline and everything downstream of
+// it, regardless of whether they completed, so that they will run again.
+// Stages upstream of it keep their outputs.  Returns the fully qualified
+// names of the stages which were reset.
+func (self *Pipestance) RerunFrom(name string) ([]string, error) {
+	if self.readOnly() {
+		return nil, &RuntimeError{"Pipestance is in read only mode."}
+	}
+	pipelines, stages, err := self.planRerun(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range stages {
+		for _, m := range node.collectMetadatas() {
+			if state, _ := m.getState(); state == Queued || state == Running {
+				return nil, &RuntimeError{fmt.Sprintf(
+					"Cannot rerun %s while it has jobs running", node.fqname)}
+			}
+		}
+	}
+	outsPath := path.Join(self.node.parent.getNode().path, "outs")
+	result := make([]string, 0, len(stages))
+	for _, node := range stages {
+		util.LogInfo("runtime", "(rerun)           %s", node.fqname)
+		if err := removeMovedOutputs(node.path, outsPath); err != nil {
+			return result, err
+		}
+		if err := node.resetAll(); err != nil {
+			return result, err
+		}
+		node.loadMetadata()
+		result = append(result, node.fqname)
+	}
+	for _, node := range pipelines {
+		for _, fork := range node.forks {
+			if err := fork.metadata.removeAll(); err != nil {
+				return result, err
+			}
+		}
+		if err := node.mkdirs(); err != nil {
+			return result, err
+		}
+		node.loadMetadata()
+	}
+	// The final state and performance summary will be regenerated when the
+	// pipestance completes again.
+	self.metadata.remove(FinalState)
+	self.metadata.remove(Perf)
+	return result, nil
+}
+
+// When a pipestance completes, output files are moved to the outs directory
+// and replaced with symlinks.  Remove the files the symlinks under dir point
+// to, so that they are replaced when the pipestance completes again.
+func removeMovedOutputs(dir, outsPath string) error {
+	outsPath, err := filepath.Abs(outsPath)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(p), target)
+		}
+		if strings.HasPrefix(target, outsPath+"/") {
+			return os.RemoveAll(target)
+		}
+		return nil
+	})
+}
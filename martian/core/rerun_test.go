@@ -0,0 +1,147 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// A pipeline with a chain of stages FIRST -> SECOND -> INNER.STEP, and an
+// unrelated stage OTHER.
+const partialRunSrc = `
+stage STEP(
+    in  float value,
+    out float result,
+    src exec  "stages/step",
+)
+
+pipeline INNER(
+    in  float value,
+    out float value,
+)
+{
+    call STEP(
+        value = self.value,
+    )
+
+    return (
+        value = STEP.result,
+    )
+}
+
+pipeline OUTER(
+    in  float value,
+    out float value,
+)
+{
+    call STEP as FIRST(
+        value = self.value,
+    )
+
+    call STEP as SECOND(
+        value = FIRST.result,
+    )
+
+    call STEP as OTHER(
+        value = self.value,
+    )
+
+    call INNER(
+        value = SECOND.result,
+    )
+
+    return (
+        value = INNER.value,
+    )
+}
+
+call OUTER(
+    value = 1.0,
+)
+`
+
+func planPartialRun(t *testing.T) (*Pipestance, func()) {
+	t.Helper()
+	d, err := ioutil.TempDir("", "pipestance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, cleanup := testRuntime(t)
+	ps, err := rt.PlanPipeline(partialRunSrc, path.Join(d, "src.mro"), "test",
+		path.Join(d, "test"), nil, "1.0.0", make(map[string]string))
+	if err != nil {
+		cleanup()
+		os.RemoveAll(d)
+		t.Fatal(err)
+	}
+	return ps, func() {
+		cleanup()
+		os.RemoveAll(d)
+	}
+}
+
+func TestRerunStages(t *testing.T) {
+	ps, cleanup := planPartialRun(t)
+	defer cleanup()
+	const prefix = "ID.test.OUTER."
+	check := func(name string, expect ...string) {
+		t.Helper()
+		stages, err := ps.RerunStages(name)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for i, s := range expect {
+			expect[i] = prefix + s
+		}
+		if !reflect.DeepEqual(stages, expect) {
+			t.Errorf("Expected %v to rerun, got %v", expect, stages)
+		}
+	}
+	check(prefix+"SECOND", "SECOND", "INNER.STEP")
+	// The pipestance name may be omitted.
+	check("OUTER.FIRST", "FIRST", "SECOND", "INNER.STEP")
+	check("OUTER.OTHER", "OTHER")
+	check("OUTER.INNER", "INNER.STEP")
+	check("OUTER", "FIRST", "SECOND", "INNER.STEP", "OTHER")
+	if _, err := ps.RerunStages("OUTER.MISSING"); err == nil {
+		t.Error("Expected an error for an unknown stage.")
+	}
+}
+
+func TestRemoveMovedOutputs(t *testing.T) {
+	d, err := ioutil.TempDir("", "pipestance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	outs := path.Join(d, "outs")
+	files := path.Join(d, "STAGE", "fork0", "files")
+	for _, dir := range []string{outs, files} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"moved.txt", "other.txt"} {
+		if err := ioutil.WriteFile(path.Join(outs, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../../../outs/moved.txt",
+		path.Join(files, "moved.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeMovedOutputs(path.Join(d, "STAGE"), outs); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(path.Join(outs, "moved.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the moved output to be removed.")
+	}
+	if _, err := os.Stat(path.Join(outs, "other.txt")); err != nil {
+		t.Error("Expected other outputs to be kept.")
+	}
+}
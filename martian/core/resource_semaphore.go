@@ -214,3 +214,21 @@ func (self *ResourceSemaphore) UpdateFreeUsed(free, usedReservation int64) int64
 	self.mu.Unlock()
 	return actualSize - self.maxSize
 }
+
+// Change the maximum size of the semaphore, for example if the configured
+// resource limits change.  The current size is adjusted by the same amount.
+// Jobs already waiting for more than the new maximum will continue to wait
+// until the maximum is increased again.
+func (self *ResourceSemaphore) SetMaxSize(n int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	oldSize := self.curSize
+	self.curSize += n - self.maxSize
+	self.maxSize = n
+	if self.curSize > self.maxSize {
+		self.curSize = self.maxSize
+	}
+	if oldSize < self.curSize {
+		self.runJobs()
+	}
+}
@@ -266,3 +266,38 @@ func TestResourceSemaphoreActualRelease(t *testing.T) {
 		t.Errorf("Timed out.")
 	}
 }
+
+func TestResourceSemaphoreSetMaxSize(t *testing.T) {
+	sem := NewResourceSemaphore(4, "test")
+	if err := sem.Acquire(4); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		if err := sem.Acquire(2); err != nil {
+			t.Error(err)
+		}
+		close(acquired)
+	}()
+	for sem.QueueLength() == 0 {
+		runtime.Gosched()
+	}
+	sem.SetMaxSize(6)
+	select {
+	case <-acquired:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out.")
+	}
+	if sem.Available() != 0 || sem.CurrentSize() != 6 {
+		t.Errorf("Expected 0 of 6 available, got %d of %d",
+			sem.Available(), sem.CurrentSize())
+	}
+	sem.SetMaxSize(3)
+	if sem.Available() != -3 {
+		t.Errorf("Expected -3 available, got %d", sem.Available())
+	}
+	sem.Release(4)
+	if sem.Available() != 1 {
+		t.Errorf("Expected 1 available, got %d", sem.Available())
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Comparison of requested and observed job resources, for right-sizing
+// stage resource requests through overrides.
+//
+
+import (
+	"math"
+	"sort"
+)
+
+// Requested versus observed resources for one phase (split, chunk, or join)
+// of a stage, aggregated over all jobs in one or more pipestances.
+type ResourceUsage struct {
+	// The partially qualified stage name, as used for overrides.
+	Stage string `json:"stage"`
+	Phase string `json:"phase"`
+	Jobs  int    `json:"jobs"`
+
+	// The largest requested thread and memory reservation.
+	ReqThreads int `json:"requested_threads"`
+	ReqMemGB   int `json:"requested_mem_gb"`
+
+	// The highest observed cpu utilization (user + system time divided by
+	// wall time) and resident memory of any job.
+	MaxThreads float64 `json:"max_threads_used"`
+	MaxMemGB   float64 `json:"max_mem_gb_used"`
+
+	CoreHours        float64 `json:"core_hours"`
+	CpuHours         float64 `json:"cpu_hours"`
+	WastedCoreHours  float64 `json:"wasted_core_hours"`
+	MemGBHours       float64 `json:"mem_gb_hours"`
+	WastedMemGBHours float64 `json:"wasted_mem_gb_hours"`
+}
+
+func (self *ResourceUsage) addJob(info *JobInfo) {
+	if info.WallClockInfo == nil || info.WallClockInfo.Duration <= 0 {
+		return
+	}
+	hours := info.WallClockInfo.Duration / 3600
+	threads := info.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	var cpu float64
+	if ru := info.RusageInfo; ru != nil {
+		if ru.Self != nil {
+			cpu += ru.Self.UserTime + ru.Self.SystemTime
+		}
+		if ru.Children != nil {
+			cpu += ru.Children.UserTime + ru.Children.SystemTime
+		}
+	}
+	var mem ObservedMemory
+	if info.MemoryUsage != nil {
+		mem = *info.MemoryUsage
+	}
+	mem.IncreaseRusage(info.RusageInfo)
+	memGB := float64(mem.Rss) / (1024 * 1024 * 1024)
+
+	self.Jobs++
+	if threads > self.ReqThreads {
+		self.ReqThreads = threads
+	}
+	if info.MemGB > self.ReqMemGB {
+		self.ReqMemGB = info.MemGB
+	}
+	if used := cpu / info.WallClockInfo.Duration; used > self.MaxThreads {
+		self.MaxThreads = used
+	}
+	if memGB > self.MaxMemGB {
+		self.MaxMemGB = memGB
+	}
+	self.CoreHours += float64(threads) * hours
+	self.CpuHours += cpu / 3600
+	if wasted := float64(threads)*hours - cpu/3600; wasted > 0 {
+		self.WastedCoreHours += wasted
+	}
+	self.MemGBHours += float64(info.MemGB) * hours
+	if wasted := (float64(info.MemGB) - memGB) * hours; wasted > 0 {
+		self.WastedMemGBHours += wasted
+	}
+}
+
+func (self *ResourceUsage) merge(other *ResourceUsage) {
+	self.Jobs += other.Jobs
+	if other.ReqThreads > self.ReqThreads {
+		self.ReqThreads = other.ReqThreads
+	}
+	if other.ReqMemGB > self.ReqMemGB {
+		self.ReqMemGB = other.ReqMemGB
+	}
+	self.MaxThreads = math.Max(self.MaxThreads, other.MaxThreads)
+	self.MaxMemGB = math.Max(self.MaxMemGB, other.MaxMemGB)
+	self.CoreHours += other.CoreHours
+	self.CpuHours += other.CpuHours
+	self.WastedCoreHours += other.WastedCoreHours
+	self.MemGBHours += other.MemGBHours
+	self.WastedMemGBHours += other.WastedMemGBHours
+}
+
+// GetResourceUsage collects requested and observed resources for every
+// completed split, chunk, and join in the pipestance.
+func (self *Pipestance) GetResourceUsage() []*ResourceUsage {
+	var result []*ResourceUsage
+	for _, node := range self.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		usage := map[string]*ResourceUsage{
+			STAGE_TYPE_SPLIT: {
+				Stage: partiallyQualifiedName(node.fqname),
+				Phase: STAGE_TYPE_SPLIT,
+			},
+			STAGE_TYPE_CHUNK: {
+				Stage: partiallyQualifiedName(node.fqname),
+				Phase: STAGE_TYPE_CHUNK,
+			},
+			STAGE_TYPE_JOIN: {
+				Stage: partiallyQualifiedName(node.fqname),
+				Phase: STAGE_TYPE_JOIN,
+			},
+		}
+		add := func(phase string, md *Metadata) {
+			if !md.exists(CompleteFile) || !md.exists(JobInfoFile) {
+				return
+			}
+			var info JobInfo
+			if err := md.ReadInto(JobInfoFile, &info); err == nil {
+				usage[phase].addJob(&info)
+			}
+		}
+		for _, fork := range node.forks {
+			add(STAGE_TYPE_SPLIT, fork.split_metadata)
+			for _, chunk := range fork.chunks {
+				add(STAGE_TYPE_CHUNK, chunk.metadata)
+			}
+			add(STAGE_TYPE_JOIN, fork.join_metadata)
+		}
+		for _, phase := range []string{
+			STAGE_TYPE_SPLIT,
+			STAGE_TYPE_CHUNK,
+			STAGE_TYPE_JOIN,
+		} {
+			if usage[phase].Jobs > 0 {
+				result = append(result, usage[phase])
+			}
+		}
+	}
+	return result
+}
+
+// MergeResourceUsage combines the resource usage from several pipestances,
+// matching stages by partially qualified name.
+func MergeResourceUsage(usages ...[]*ResourceUsage) []*ResourceUsage {
+	byKey := make(map[string]*ResourceUsage)
+	var result []*ResourceUsage
+	for _, list := range usages {
+		for _, u := range list {
+			key := u.Stage + "/" + u.Phase
+			if existing := byKey[key]; existing != nil {
+				existing.merge(u)
+			} else {
+				c := *u
+				byKey[key] = &c
+				result = append(result, &c)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].WastedCoreHours > result[j].WastedCoreHours
+	})
+	return result
+}
+
+// RecommendOverrides computes overrides which set each stage phase's thread
+// and memory reservations to the highest observed usage plus the given
+// fractional headroom.  Overrides are only generated where they differ from
+// the largest observed request.
+func RecommendOverrides(usages []*ResourceUsage, headroom float64) map[string]StageOverride {
+	result := make(map[string]StageOverride)
+	for _, u := range usages {
+		if u.Jobs == 0 {
+			continue
+		}
+		so := result[u.Stage]
+		set := func(key string, value int) {
+			if so == nil {
+				so = make(StageOverride)
+				result[u.Stage] = so
+			}
+			so[u.Phase+"."+key] = float64(value)
+		}
+		threads := int(math.Ceil(u.MaxThreads * (1 + headroom)))
+		if threads < 1 {
+			threads = 1
+		} else if threads > u.ReqThreads &&
+			u.MaxThreads <= float64(u.ReqThreads)*(1+headroom) {
+			// Full utilization of the reservation doesn't mean a job needs
+			// more, and short jobs can appear to slightly exceed it.
+			threads = u.ReqThreads
+		}
+		if threads != u.ReqThreads {
+			set("threads", threads)
+		}
+		mem := int(math.Ceil(u.MaxMemGB * (1 + headroom)))
+		if mem < 1 {
+			mem = 1
+		}
+		if mem != u.ReqMemGB {
+			set("mem_gb", mem)
+		}
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestRecommendOverrides(t *testing.T) {
+	job := func(threads, memGB int, cpu float64, rss int64) *JobInfo {
+		return &JobInfo{
+			Threads: threads,
+			MemGB:   memGB,
+			RusageInfo: &RusageInfo{
+				Self: &Rusage{UserTime: cpu},
+			},
+			MemoryUsage:   &ObservedMemory{Rss: rss},
+			WallClockInfo: &WallClockInfo{Duration: 3600},
+		}
+	}
+	chunks := &ResourceUsage{Stage: "PIPE.STAGE", Phase: STAGE_TYPE_CHUNK}
+	chunks.addJob(job(4, 16, 3600, 2<<30))
+	chunks.addJob(job(4, 16, 1800, 5<<29))
+	join := &ResourceUsage{Stage: "PIPE.STAGE", Phase: STAGE_TYPE_JOIN}
+	join.addJob(job(1, 1, 3600, 1<<29))
+
+	other := &ResourceUsage{Stage: "PIPE.STAGE", Phase: STAGE_TYPE_CHUNK}
+	other.addJob(job(4, 16, 7200, 1<<30))
+	usage := MergeResourceUsage(
+		[]*ResourceUsage{chunks, join},
+		[]*ResourceUsage{other})
+	if len(usage) != 2 {
+		t.Fatalf("Expected 2 merged entries, got %d", len(usage))
+	}
+	merged := usage[0]
+	if merged.Phase != STAGE_TYPE_CHUNK || merged.Jobs != 3 {
+		t.Errorf("Expected 3 chunk jobs first, got %d %s jobs",
+			merged.Jobs, merged.Phase)
+	}
+	if merged.MaxThreads != 2 || merged.MaxMemGB != 2.5 {
+		t.Errorf("Expected 2 threads and 2.5GB used, got %v and %v",
+			merged.MaxThreads, merged.MaxMemGB)
+	}
+	// 12 core hours reserved, 3.5 used.
+	if merged.WastedCoreHours != 8.5 {
+		t.Errorf("Expected 8.5 wasted core hours, got %v",
+			merged.WastedCoreHours)
+	}
+
+	overrides := RecommendOverrides(usage, 0.2)
+	so := overrides["PIPE.STAGE"]
+	if so == nil {
+		t.Fatal("Expected overrides for PIPE.STAGE")
+	}
+	if v := so["chunk.threads"]; v != 3.0 {
+		t.Errorf("Expected 3 chunk threads, got %v", v)
+	}
+	if v := so["chunk.mem_gb"]; v != 3.0 {
+		t.Errorf("Expected 3GB chunk memory, got %v", v)
+	}
+	// The join request was already right.
+	if _, ok := so["join.threads"]; ok {
+		t.Error("Unexpected join thread override.")
+	}
+	if _, ok := so["join.mem_gb"]; ok {
+		t.Error("Unexpected join memory override.")
+	}
+	for key, val := range so {
+		if kind, ok := LegalOverrideTypes[key]; !ok {
+			t.Errorf("Illegal override %s", key)
+		} else if _, ok := val.(float64); !ok || kind.String() != "float64" {
+			t.Errorf("Wrong type for %s", key)
+		}
+	}
+}
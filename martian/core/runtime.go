@@ -6,6 +6,7 @@ package core // import "github.com/martian-lang/martian/martian/core"
 // pipestances.
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -90,6 +91,17 @@ func VerifyVDRMode(vdrMode string) {
 	os.Exit(1)
 }
 
+func VerifyMetadataStore(store string) {
+	validStores := []string{FilesMetadataStore, DbMetadataStore}
+	for _, validStore := range validStores {
+		if validStore == store {
+			return
+		}
+	}
+	util.PrintInfo("runtime", "Invalid metadata store: %s. Valid metadata stores: %s", store, strings.Join(validStores, ", "))
+	os.Exit(1)
+}
+
 func VerifyOnFinish(onfinish string) {
 	if _, err := exec.LookPath(onfinish); err != nil {
 		util.PrintInfo("runtime", "Invalid onfinish hook executable (%v): %v", err, onfinish)
@@ -160,6 +172,10 @@ type RuntimeOptions struct {
 	FullStageReset  bool
 	StackVars       bool
 	Zip             bool
+	CompactMetadata bool
+
+	// The metadata storage backend for new pipestances: "files" or "db".
+	MetadataStore   string
 	SkipPreflight   bool
 	Monitor         bool
 	Debug           bool
@@ -168,14 +184,18 @@ type RuntimeOptions struct {
 	Overrides       *PipestanceOverrides
 	LimitLoadavg    bool
 	NeverLocal      bool
+
+	// The algorithm used to checksum output files, or "disable".
+	ChecksumAlgorithm string
 }
 
 func DefaultRuntimeOptions() RuntimeOptions {
 	return RuntimeOptions{
-		MartianVersion: util.GetVersion(),
-		ProfileMode:    DisableProfile,
-		JobMode:        "local",
-		VdrMode:        "rolling",
+		MartianVersion:    util.GetVersion(),
+		ProfileMode:       DisableProfile,
+		JobMode:           "local",
+		VdrMode:           "rolling",
+		ChecksumAlgorithm: disableChecksum,
 	}
 }
 
@@ -192,6 +212,9 @@ func (config *RuntimeOptions) ToFlags() []string {
 		flags = append(flags, fmt.Sprintf("--profile=%v",
 			config.ProfileMode))
 	}
+	if config.ChecksumAlgorithm != "" && config.ChecksumAlgorithm != disableChecksum {
+		flags = append(flags, "--checksum="+config.ChecksumAlgorithm)
+	}
 	if config.LocalMem != 0 {
 		flags = append(flags, fmt.Sprintf("--localmem=%d",
 			config.LocalMem))
@@ -218,6 +241,12 @@ func (config *RuntimeOptions) ToFlags() []string {
 	if config.Zip {
 		flags = append(flags, "--zip")
 	}
+	if config.CompactMetadata {
+		flags = append(flags, "--compact-metadata")
+	}
+	if config.MetadataStore != "" && config.MetadataStore != FilesMetadataStore {
+		flags = append(flags, "--metadata-store="+config.MetadataStore)
+	}
 	if config.SkipPreflight {
 		flags = append(flags, "--nopreflight")
 	}
@@ -263,6 +292,18 @@ type Runtime struct {
 	LocalJobManager *LocalJobManager
 	overrides       *PipestanceOverrides
 	jobConfig       *JobManagerJson
+	jobConfigLock   sync.RWMutex
+	reloadLock      sync.Mutex
+
+	// Local resource limits set by ReloadConfig, which override those in
+	// Config.  Guarded by reloadLock.
+	reloadedLimits ResourceLimits
+
+	// The number of times failures of each stage have been retried, by
+	// fully qualified name, for enforcing retries overrides.  This persists
+	// across pipestance restarts.
+	stageRetries map[string]int
+	retryLock    sync.Mutex
 }
 
 // Deprecated: use RuntimeConfig.NewRuntime() instead
@@ -331,6 +372,21 @@ func (c *RuntimeOptions) NewRuntime() *Runtime {
 	return self
 }
 
+func (self *Runtime) getStageRetries(fqname string) int {
+	self.retryLock.Lock()
+	defer self.retryLock.Unlock()
+	return self.stageRetries[fqname]
+}
+
+func (self *Runtime) addStageRetry(fqname string) {
+	self.retryLock.Lock()
+	defer self.retryLock.Unlock()
+	if self.stageRetries == nil {
+		self.stageRetries = make(map[string]int)
+	}
+	self.stageRetries[fqname]++
+}
+
 // Compile all the MRO files in mroPaths.
 func CompileAll(mroPaths []string, checkSrcPath bool) (int, []*syntax.Ast, error) {
 	fileNames := make([]string, 0, len(mroPaths)*3)
@@ -355,7 +411,7 @@ func CompileAll(mroPaths []string, checkSrcPath bool) (int, []*syntax.Ast, error
 // public InvokeWithSource and Reattach methods.
 func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string,
 	pipestancePath string, mroPaths []string, mroVersion string,
-	envs map[string]string, readOnly bool,
+	envs map[string]string, readOnly, planOnly bool,
 	ctx context.Context) (string, *syntax.Ast, *Pipestance, error) {
 	r := trace.StartRegion(ctx, "instantiatePipeline")
 	defer r.End()
@@ -370,11 +426,14 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 		return "", nil, nil, &RuntimeError{"cannot start a pipeline without a call statement"}
 	}
 	// Make sure it's a pipeline we're calling.
-	if pipeline := ast.Callables.Table[ast.Call.DecId]; pipeline == nil {
+	pipeline := ast.Callables.Table[ast.Call.DecId]
+	if pipeline == nil {
 		return "", nil, nil, &RuntimeError{fmt.Sprintf("'%s' is not a declared pipeline", ast.Call.DecId)}
 	}
 
 	invocationData, _ := BuildDataForAst(incpaths, ast)
+	// The invocation data is recorded in every job's _jobinfo.
+	redactSecretArgs(pipeline.GetInParams(), invocationData.Args)
 
 	// Instantiate the pipeline.
 	if !readOnly {
@@ -387,6 +446,9 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 	if err != nil {
 		return "", nil, nil, err
 	}
+	if planOnly {
+		return postsrc, ast, pipestance, nil
+	}
 
 	// Lock the pipestance if not in read-only mode.
 	if !readOnly {
@@ -400,6 +462,17 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 	return postsrc, ast, pipestance, nil
 }
 
+// Builds the node graph for a pipeline invocation without creating or
+// modifying anything on disk, for inspecting what a run would do.
+func (self *Runtime) PlanPipeline(src string, srcPath string, psid string,
+	pipestancePath string, mroPaths []string, mroVersion string,
+	envs map[string]string) (*Pipestance, error) {
+	_, _, pipestance, err := self.instantiatePipeline(os.ExpandEnv(src), srcPath,
+		psid, pipestancePath, mroPaths, mroVersion, envs, true, true,
+		context.Background())
+	return pipestance, err
+}
+
 // Invokes a new pipestance.
 func (self *Runtime) InvokePipeline(src string, srcPath string, psid string,
 	pipestancePath string, mroPaths []string, mroVersion string,
@@ -414,17 +487,30 @@ func (self *Runtime) InvokePipeline(src string, srcPath string, psid string,
 	} else if len(fileNames) > 0 {
 		return nil, &PipestanceExistsError{psid}
 	}
+	if err := createMetadataStore(pipestancePath, self.Config.MetadataStore); err != nil {
+		return nil, err
+	}
 
 	// Expand env vars in invocation source and instantiate.
 	src = os.ExpandEnv(src)
 	readOnly := false
-	postsrc, _, pipestance, err := self.instantiatePipeline(src, srcPath, psid, pipestancePath, mroPaths,
-		mroVersion, envs, readOnly, context.Background())
+	postsrc, ast, pipestance, err := self.instantiatePipeline(src, srcPath, psid, pipestancePath, mroPaths,
+		mroVersion, envs, readOnly, false, context.Background())
 	if err != nil {
 		// If instantiation failed, delete the pipestance folder.
 		os.RemoveAll(pipestancePath)
 		return nil, err
 	}
+	// Do not record the values of secret parameters.
+	src, err = ast.RedactSecrets([]byte(src), srcPath)
+	if err == nil {
+		postsrc, err = ast.RedactSecrets([]byte(postsrc), srcPath)
+	}
+	if err != nil {
+		pipestance.Unlock()
+		os.RemoveAll(pipestancePath)
+		return nil, err
+	}
 
 	// Write top-level metadata files.
 	pipestance.metadata.WriteRaw(InvocationFile, src)
@@ -467,6 +553,26 @@ func (self *Runtime) ReattachToPipestanceWithMroSrc(psid string, pipestancePath
 		readOnly, MroSourceFile, ctx)
 }
 
+// Reattaches to an existing pipestance in read-only mode, for inspection.
+// The pipestance is reconstructed from its _mrosource, so MROPATH is not
+// required, and the pipestance metadata is loaded.  Zipped metadata is read
+// without unpacking it.
+func (self *Runtime) InspectPipestance(pipestancePath string,
+	ctx context.Context) (*Pipestance, error) {
+	pipestancePath, err := filepath.Abs(pipestancePath)
+	if err != nil {
+		return nil, err
+	}
+	pipestance, err := self.ReattachToPipestanceWithMroSrc(
+		path.Base(pipestancePath), pipestancePath,
+		"", "", nil, "", nil, false, true, ctx)
+	if err != nil {
+		return nil, err
+	}
+	pipestance.LoadMetadata(ctx)
+	return pipestance, nil
+}
+
 // Reattaches to an existing pipestance.
 func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 	src string, invocationPath string, mroPaths []string,
@@ -483,25 +589,39 @@ func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 			src = string(data)
 		}
 	}
+	var oldSrc []byte
 	if checkSrc {
 		// Read in the existing _invocation file.
 		data, err := ioutil.ReadFile(path.Join(pipestancePath, srcType.FileName()))
 		if err != nil {
 			return nil, &PipestancePathError{pipestancePath}
 		}
-		// Check if _invocation has changed.
-		if src != string(data) {
-			return nil, &PipestanceInvocationError{psid, invocationPath}
-		}
+		oldSrc = data
 	}
 	// Instantiate the pipestance.
 	_, ast, pipestance, err := self.instantiatePipeline(
 		src, invocationPath,
 		psid, pipestancePath, mroPaths,
-		mroVersion, envs, readOnly, ctx)
+		mroVersion, envs, readOnly, false, ctx)
 	if err != nil {
 		return nil, err
 	}
+	// Check if _invocation has changed.  It was saved with the values of
+	// secret parameters redacted, which are only known once the source is
+	// compiled.
+	if checkSrc {
+		if redacted, err := ast.RedactSecrets([]byte(src), invocationPath); err != nil {
+			if !readOnly {
+				pipestance.Unlock()
+			}
+			return nil, err
+		} else if redacted != string(oldSrc) {
+			if !readOnly {
+				pipestance.Unlock()
+			}
+			return nil, &PipestanceInvocationError{psid, invocationPath}
+		}
+	}
 	if checkSrc && srcType != MroSourceFile {
 		oldSrcFile := path.Join(pipestancePath, MroSourceFile.FileName())
 		if _, _, oldAst, err := syntax.Compile(oldSrcFile, mroPaths, false); err != nil {
@@ -526,8 +646,12 @@ func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 	}
 
 	// If _metadata exists, unzip it so the pipestance can read its metadata.
+	// Read-only pipestances read from the zip file instead, so that
+	// inspecting a pipestance does not modify it.
 	metadataPath := path.Join(pipestancePath, MetadataZip.FileName())
-	if _, err := os.Stat(metadataPath); err == nil {
+	if _, err := os.Stat(metadataPath); err == nil && readOnly {
+		pipestance.readMetadataZip()
+	} else if err == nil {
 		if err := util.UnzipIgnoreExisting(metadataPath); err != nil {
 			pipestance.Unlock()
 			return nil, err
@@ -535,6 +659,10 @@ func (self *Runtime) reattachToPipestance(psid string, pipestancePath string,
 		os.Remove(metadataPath)
 	}
 
+	if err := pipestance.loadTargets(); err != nil {
+		util.LogError(err, "runtime", "Could not read the pipestance targets.")
+	}
+
 	// If we're reattaching in local mode, restart any stages that were
 	// left in a running state from last mrp run. The actual job would
 	// have been killed by the CTRL-C or, if not, by SIGTERM when the
@@ -590,6 +718,16 @@ func (self *Runtime) GetMetadata(pipestancePath string, metadataPath string) (io
 	}
 	data, err := os.Open(metadataPath)
 	if err != nil {
+		if os.IsNotExist(err) {
+			if db := getMetadataDb(pipestancePath); db != nil {
+				if b, err := db.readPath(metadataPath); err == nil {
+					return ioutil.NopCloser(bytes.NewReader(b)), nil
+				}
+			}
+			if r, aerr := openArchivedMetadata(metadataPath); aerr == nil {
+				return r, nil
+			}
+		}
 		return nil, err
 	}
 	return data, nil
@@ -610,12 +748,25 @@ func (self *Runtime) ProfileConfig(mode ProfileMode) *ProfileConfig {
 	if mode == "" {
 		mode = self.Config.ProfileMode
 	}
+	self.jobConfigLock.RLock()
+	defer self.jobConfigLock.RUnlock()
 	if mode == "" || mode == DisableProfile || len(self.jobConfig.ProfileMode) == 0 {
 		return nil
 	}
 	return self.jobConfig.ProfileMode[mode]
 }
 
+// ContainerConfig returns the configured container runtime, or nil if there
+// is none.
+func (self *Runtime) ContainerConfig() *ContainerConfig {
+	self.jobConfigLock.RLock()
+	defer self.jobConfigLock.RUnlock()
+	if self.jobConfig == nil {
+		return nil
+	}
+	return self.jobConfig.Container
+}
+
 // FreeMemBytes returns the current amount of memory which the runtime may use
 // for tasks like reading files.
 //
@@ -177,3 +177,63 @@ call SUM_SQUARE_PIPELINE(
 		}
 	}
 }
+
+// Creates a runtime with the default options.  The test harness runs in a
+// temp dir, so a fake job manager config.json is created if there is none.
+// The returned function removes it.
+func testRuntime(t *testing.T) (*Runtime, func()) {
+	t.Helper()
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+	skip := func(err error) {
+		cleanup()
+		t.Skip(err)
+	}
+	pdir := util.RelPath("..")
+	if d, err := os.Open(pdir); err != nil {
+		skip(err)
+	} else {
+		// hold open the directory so it doesn't disappear on us.
+		cleanups = append(cleanups, func() { d.Close() })
+	}
+	t.Log("Runtime directory is ", pdir)
+	jobPath := path.Join(pdir, "jobmanagers")
+	if _, err := os.Stat(jobPath); os.IsNotExist(err) {
+		t.Log("Creating ", jobPath)
+		if err := os.MkdirAll(jobPath, 0777); err != nil {
+			skip(err)
+		}
+		if d, err := os.Open(jobPath); err != nil {
+			skip(err)
+		} else {
+			cleanups = append(cleanups, func() { d.Close() })
+		}
+		cleanups = append(cleanups, func() { os.RemoveAll(jobPath) })
+	} else if err != nil {
+		skip(err)
+	}
+	cfg := path.Join(jobPath, "config.json")
+	if _, err := os.Stat(cfg); os.IsNotExist(err) {
+		t.Log("Creating ", cfg)
+		if ioutil.WriteFile(cfg, []byte(`{
+  "settings": {
+    "threads_per_job": 1,
+    "memGB_per_job": 1,
+    "thread_envs": []
+  },
+  "jobmodes": {}
+}`), 0666); err != nil {
+			t.Log(err)
+		}
+		cleanups = append(cleanups, func() { os.Remove(cfg) })
+	} else if err != nil {
+		t.Log(err)
+	}
+	opts := DefaultRuntimeOptions()
+	util.SetupSignalHandlers()
+	return opts.NewRuntime(), cleanup
+}
@@ -0,0 +1,183 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Delivering secret arguments to stage code.
+//
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The directory, in a fork's metadata directory, which holds the values of
+// secret arguments.  It does not have the metadata file prefix so that it
+// is not archived or zipped along with the metadata.
+const secretsDir = "secrets"
+
+// Replace a secret value, or each element of an array of them, with
+// syntax.Redacted, so that it is not recorded in metadata.  Nulls are kept.
+func redactSecretValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		if bytes.Equal(v, nullBytes) {
+			return v
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(v, &decoded); err != nil {
+			return syntax.Redacted
+		}
+		return redactSecretValue(decoded)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = redactSecretValue(elem)
+		}
+		return result
+	default:
+		return syntax.Redacted
+	}
+}
+
+// Replace the values of the arguments in the given map which are bound to
+// secret parameters with syntax.Redacted.
+func redactSecretArgs(params *syntax.InParams, args map[string]interface{}) {
+	for _, param := range params.List {
+		if param.GetTname() == syntax.KindSecret {
+			if v, ok := args[param.GetId()]; ok {
+				args[param.GetId()] = redactSecretValue(v)
+			}
+		}
+	}
+}
+
+// Replace the values of secret arguments in the given bindings with the
+// paths to files containing them, which only the owner of the pipestance
+// can read.  Elements of arrays of secrets are written to separate files.
+func (self *Fork) writeSecrets(bindings LazyArgumentMap) error {
+	return writeSecretArgs(path.Join(self.metadata.path, secretsDir),
+		self.node.callable.GetInParams(), bindings)
+}
+
+// Replace the values of the arguments in the given bindings which are bound
+// to secret parameters with the paths to files in the given directory
+// containing them.
+func writeSecretArgs(dir string, params *syntax.InParams,
+	bindings LazyArgumentMap) error {
+	if bindings == nil {
+		return nil
+	}
+	for _, param := range params.List {
+		if param.GetTname() != syntax.KindSecret {
+			continue
+		}
+		raw := bindings[param.GetId()]
+		if len(raw) == 0 || bytes.Equal(raw, nullBytes) {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if err := util.MkdirAll(dir); err != nil {
+			return err
+		}
+		if err := os.Chmod(dir, 0700); err != nil {
+			return err
+		}
+		value, err := writeSecretValue(path.Join(dir, param.GetId()), value)
+		if err != nil {
+			return err
+		}
+		if b, err := json.Marshal(value); err != nil {
+			return err
+		} else {
+			bindings[param.GetId()] = b
+		}
+	}
+	return nil
+}
+
+// Write a secret value, or each element of an array of them, to a file and
+// return the file name in its place.
+func writeSecretValue(fn string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if b, err := ioutil.ReadFile(fn); err == nil && string(b) == v {
+			return fn, nil
+		}
+		// WriteFile does not change the permissions of an existing file.
+		os.Remove(fn)
+		return fn, ioutil.WriteFile(fn, []byte(v), 0600)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			if p, err := writeSecretValue(fmt.Sprintf("%s.%d", fn, i), elem); err != nil {
+				return nil, err
+			} else {
+				result[i] = p
+			}
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("Invalid value for secret %s: %v",
+			path.Base(fn), value)
+	}
+}
+
+// Check whether the files holding the values of secret arguments, as
+// given in the bindings, still exist.
+func secretFilesExist(params *syntax.InParams, bindings LazyArgumentMap) bool {
+	var exist func(value interface{}) bool
+	exist = func(value interface{}) bool {
+		switch v := value.(type) {
+		case string:
+			_, err := os.Stat(v)
+			return err == nil
+		case []interface{}:
+			for _, elem := range v {
+				if !exist(elem) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for _, param := range params.List {
+		if param.GetTname() != syntax.KindSecret {
+			continue
+		}
+		var value interface{}
+		if raw := bindings[param.GetId()]; len(raw) == 0 {
+			continue
+		} else if err := json.Unmarshal(raw, &value); err != nil || !exist(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove the files holding the values of the secret arguments.  This is
+// done when the fork completes, fails, or is killed, and when it is reset
+// after a failure, after which they are written again as the jobs which
+// need them are started.  If mrp exits without killing the fork's jobs, for
+// example if it is killed itself, they are kept for the jobs which may
+// still be running until the fork finishes after the pipestance is
+// restarted.
+func (self *Fork) removeSecrets() {
+	if err := os.RemoveAll(path.Join(self.metadata.path, secretsDir)); err != nil {
+		util.LogError(err, "runtime", "Could not remove secrets for %s", self.fqname)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+const secretMroSrc = `
+stage UPLOAD(
+    in  float[]  values,
+    in  secret   token,
+    in  secret[] keys,
+    src exec     "sum.sh",
+)
+
+pipeline UPLOAD_ALL(
+    in  secret token,
+)
+{
+    call UPLOAD(
+        values = [1],
+        token  = self.token,
+        keys   = [
+            "test-key-1",
+            null,
+        ],
+    )
+
+    return ()
+}
+
+call UPLOAD_ALL(
+    token = "test-s3cr3t-t0ken",
+)
+`
+
+func TestSecrets(t *testing.T) {
+	rt, d, cleanup := setupHarnessTest(t)
+	defer cleanup()
+	psPath := path.Join(d, "test")
+	ps, err := rt.InvokePipeline(secretMroSrc, path.Join(d, "pipe.mro"), "test",
+		psPath, []string{d}, "1.0.0", make(map[string]string), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Unlock()
+
+	for _, fn := range []MetadataFileName{InvocationFile, MroSourceFile} {
+		if b, err := ioutil.ReadFile(path.Join(psPath, fn.FileName())); err != nil {
+			t.Error(err)
+		} else if s := string(b); strings.Contains(s, "test-s3cr3t-t0ken") ||
+			strings.Contains(s, "test-key-1") {
+			t.Errorf("Expected secrets to be redacted from %s:\n%s", fn.FileName(), s)
+		} else if !strings.Contains(s, syntax.Redacted) {
+			t.Errorf("Expected %s to contain %s", fn.FileName(), syntax.Redacted)
+		}
+	}
+
+	var fork *Fork
+	for _, node := range ps.allNodes() {
+		if node.kind == "stage" {
+			fork = node.forks[0]
+		}
+	}
+	if fork == nil {
+		t.Fatal("Stage not found.")
+	}
+	bindings, err := resolveBindings(fork.node.argbindings, fork.argPermute, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.writeSecrets(bindings); err != nil {
+		t.Fatal(err)
+	}
+	checkFile := func(fn, expect string) {
+		t.Helper()
+		if info, err := os.Stat(fn); err != nil {
+			t.Error(err)
+		} else if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to be private, got mode %v", fn, info.Mode())
+		}
+		if b, err := ioutil.ReadFile(fn); err != nil {
+			t.Error(err)
+		} else if string(b) != expect {
+			t.Errorf("Expected %s to contain %q, got %q", fn, expect, b)
+		}
+	}
+	var token string
+	if err := json.Unmarshal(bindings["token"], &token); err != nil {
+		t.Error(err)
+	} else {
+		checkFile(token, "test-s3cr3t-t0ken")
+	}
+	var keys []*string
+	if err := json.Unmarshal(bindings["keys"], &keys); err != nil {
+		t.Error(err)
+	} else if len(keys) != 2 || keys[0] == nil || keys[1] != nil {
+		t.Errorf("Expected one key file and a null, got %s", bindings["keys"])
+	} else {
+		checkFile(*keys[0], "test-key-1")
+	}
+
+	if args := ps.getNode().invocation.Args; args["token"] != syntax.Redacted {
+		t.Errorf("Expected the token to be redacted from the invocation, got %v",
+			args["token"])
+	}
+	if info, err := fork.node.argbindings["keys"].serializeState(fork.argPermute, -1); err != nil {
+		t.Error(err)
+	} else if keys, ok := info.Value.([]interface{}); !ok || len(keys) != 2 ||
+		keys[0] != syntax.Redacted || keys[1] != nil {
+		t.Errorf("Expected the keys to be redacted from the state, got %v",
+			info.Value)
+	}
+	fork.writeInvocation()
+	if s := fork.metadata.readRaw(InvocationFile); strings.Contains(s, "test-s3cr3t-t0ken") ||
+		strings.Contains(s, "test-key-1") {
+		t.Errorf("Expected secrets to be redacted from the stage invocation:\n%s", s)
+	}
+
+	// Killing the fork removes the secrets.
+	fork.kill("Killed for testing.")
+	if _, err := os.Stat(path.Join(fork.metadata.path, secretsDir)); !os.IsNotExist(err) {
+		t.Errorf("Expected the secrets to be removed, got %v", err)
+	}
+
+	// If the secrets cannot be written, the fork fails.
+	if err := ioutil.WriteFile(path.Join(fork.metadata.path, secretsDir),
+		nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	fork.step()
+	if !fork.metadata.exists(Errors) {
+		t.Error("Expected the fork to fail when secrets cannot be written.")
+	} else if fork.getState() != Failed {
+		t.Errorf("Expected the fork to be failed, got %v", fork.getState())
+	}
+}
+
+func TestStageHarnessSecrets(t *testing.T) {
+	rt, d, cleanup := setupHarnessTest(t)
+	defer cleanup()
+	stageSrc := secretMroSrc[:strings.Index(secretMroSrc, "pipeline")]
+	if err := ioutil.WriteFile(path.Join(d, "upload.mro"),
+		[]byte(stageSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args, err := ParseStageArgs([]byte(`{
+		"values": [1],
+		"token": "test-s3cr3t-t0ken",
+		"keys": ["test-key-1", null]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	harness, err := rt.NewStageHarness("UPLOAD", []string{d}, path.Join(d, "run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := harness.Run(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FailedPhase != "" {
+		t.Fatalf("Stage failed in %s: %s", result.FailedPhase, result.Error)
+	}
+	for _, fn := range []string{"split/_args", "chnk0/_args", "chnk0/_jobinfo"} {
+		if b, err := ioutil.ReadFile(path.Join(harness.GetPath(), fn)); err != nil {
+			t.Error(err)
+		} else if s := string(b); strings.Contains(s, "test-s3cr3t-t0ken") ||
+			strings.Contains(s, "test-key-1") {
+			t.Errorf("Expected secrets to be kept out of %s:\n%s", fn, s)
+		} else if fn != "chnk0/_jobinfo" && !strings.Contains(s,
+			path.Join(harness.GetPath(), secretsDir, "token")) {
+			t.Errorf("Expected %s to give the path to the token:\n%s", fn, s)
+		}
+	}
+	if _, err := os.Stat(path.Join(harness.GetPath(), secretsDir)); !os.IsNotExist(err) {
+		t.Errorf("Expected the secrets to be removed, got %v", err)
+	}
+}
+
+func TestJobReplaySecrets(t *testing.T) {
+	rt, d, cleanup := setupHarnessTest(t)
+	defer cleanup()
+	psPath := path.Join(d, "test")
+	ps, err := rt.InvokePipeline(secretMroSrc, path.Join(d, "pipe.mro"), "test",
+		psPath, []string{d}, "1.0.0", make(map[string]string), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.Unlock()
+
+	// Fake up a chunk which ran with secrets which have since been removed.
+	forkPath := path.Join(psPath, "UPLOAD_ALL", "UPLOAD", "fork0")
+	removed := path.Join(forkPath, secretsDir)
+	for fn, content := range map[string]string{
+		"split/_stage_defs": `{"chunks":[{}],"join":{}}`,
+		"chnk0/_args": `{"values":[1],"token":"` + removed + `/token",` +
+			`"keys":["` + removed + `/keys.0",null]}`,
+		"chnk0/_jobinfo": `{"name":"ID.test.UPLOAD_ALL.UPLOAD.fork0.chnk0","threads":1}`,
+	} {
+		if err := os.MkdirAll(path.Dir(path.Join(forkPath, fn)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(forkPath, fn), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := rt.NewJobReplay(path.Join(forkPath, "chnk0"), []string{d},
+		path.Join(d, "scratch"), nil, context.Background()); err == nil {
+		t.Error("Expected an error when the secrets are unavailable.")
+	}
+	if _, err := rt.NewJobReplay(path.Join(forkPath, "chnk0"), []string{d},
+		path.Join(d, "scratch2"), LazyArgumentMap{
+			"values": json.RawMessage(`[2]`),
+		}, context.Background()); err == nil {
+		t.Error("Expected an error for a parameter which is not a secret.")
+	}
+	replay, err := rt.NewJobReplay(path.Join(forkPath, "chnk0"), []string{d},
+		path.Join(d, "scratch3"), LazyArgumentMap{
+			"token": json.RawMessage(`"test-s3cr3t-t0ken"`),
+			"keys":  json.RawMessage(`["test-key-1",null]`),
+		}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args map[string]interface{}
+	if b, err := ioutil.ReadFile(path.Join(replay.GetPath(), "_args")); err != nil {
+		t.Error(err)
+	} else if err := json.Unmarshal(b, &args); err != nil {
+		t.Error(err)
+	} else if token, _ := args["token"].(string); token !=
+		path.Join(replay.GetPath(), secretsDir, "token") {
+		t.Errorf("Expected the token to be written to the scratch directory, got %s", b)
+	} else if b, err := ioutil.ReadFile(token); err != nil {
+		t.Error(err)
+	} else if string(b) != "test-s3cr3t-t0ken" {
+		t.Errorf("Expected the token, got %q", b)
+	}
+	if result, err := replay.Run(nil, ""); err != nil {
+		t.Error(err)
+	} else if result.State != Complete {
+		t.Errorf("Expected the chunk to complete, got %v: %s",
+			result.State, result.Error)
+	}
+	if _, err := os.Stat(path.Join(replay.GetPath(), secretsDir)); !os.IsNotExist(err) {
+		t.Errorf("Expected the secrets to be removed, got %v", err)
+	}
+}
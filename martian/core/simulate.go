@@ -0,0 +1,285 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Scheduling simulation from pipestance performance data.
+//
+// The jobs and dependencies from critical path analysis are replayed under
+// different resource limits, taking each job's observed run time as given.
+// Jobs acquire cores and memory from ResourceSemaphores and job slots from a
+// MaxJobsSemaphore, the same as they would in mrp, in the order in which they
+// became ready.  As with the local job manager, a job which does not fit
+// blocks the jobs queued behind it.  Runtime overhead, such as the delay
+// between a job finishing and mrp noticing, is not modeled.
+//
+
+import (
+	"sort"
+	"time"
+)
+
+// Resource limits for a simulated run.  Zero values mean unlimited.
+type SimulationOptions struct {
+	Cores   int `json:"cores"`
+	MemGB   int `json:"mem_gb"`
+	MaxJobs int `json:"max_jobs"`
+
+	// The minimum time between job submissions, in milliseconds.
+	JobIntervalMs int `json:"job_interval_ms"`
+}
+
+// The predicted performance of a pipestance under different resource limits.
+type SimulationReport struct {
+	Options SimulationOptions `json:"options"`
+	Jobs    int               `json:"jobs"`
+
+	// The wall time of the actual run, and the predicted wall time.
+	ActualWallTime float64 `json:"actual_wall_seconds"`
+	WallTime       float64 `json:"wall_seconds"`
+
+	// The total time jobs spent waiting for resources after they were
+	// ready to run.
+	QueueWait float64 `json:"queue_wait_seconds"`
+
+	PeakThreads int `json:"peak_threads"`
+	PeakMemGB   int `json:"peak_mem_gb"`
+	PeakJobs    int `json:"peak_jobs"`
+
+	// The fraction of the available cores and memory reserved by jobs over
+	// the course of the run.  Only computed for limited resources.
+	CoreUtilization float64 `json:"core_utilization,omitempty"`
+	MemUtilization  float64 `json:"mem_utilization,omitempty"`
+
+	// The predicted wall time for each stage, from when its first job
+	// started to when its last job finished.
+	Stages []*SimulatedStage `json:"stages"`
+}
+
+type SimulatedStage struct {
+	Stage    string  `json:"stage"`
+	Start    float64 `json:"start_seconds"`
+	End      float64 `json:"end_seconds"`
+	WallTime float64 `json:"wall_seconds"`
+}
+
+// Simulate predicts the wall time and utilization of the pipestance if it
+// were run again with the given resource limits.
+func (self *Pipestance) Simulate(opts SimulationOptions) *SimulationReport {
+	return simulate(self.criticalPathJobs(), opts)
+}
+
+type simJob struct {
+	job      *CriticalPathJob
+	threads  int64
+	memMB    int64
+	slot     *Metadata
+	waiting  int
+	ready    float64
+	start    float64
+	end      float64
+	children []*simJob
+}
+
+func simulate(jobs []*CriticalPathJob, opts SimulationOptions) *SimulationReport {
+	report := &SimulationReport{
+		Options: opts,
+		Jobs:    len(jobs),
+		Stages:  []*SimulatedStage{},
+	}
+	if len(jobs) == 0 {
+		return report
+	}
+	var actualStart, actualEnd time.Time
+	for _, job := range jobs {
+		if actualStart.IsZero() || job.Start.Before(actualStart) {
+			actualStart = job.Start
+		}
+		if job.End.After(actualEnd) {
+			actualEnd = job.End
+		}
+	}
+	report.ActualWallTime = actualEnd.Sub(actualStart).Seconds()
+
+	var coreSem, memSem *ResourceSemaphore
+	if opts.Cores > 0 {
+		coreSem = NewResourceSemaphore(int64(opts.Cores), "threads")
+	}
+	if opts.MemGB > 0 {
+		memSem = NewResourceSemaphore(int64(opts.MemGB)*1024, "MB of memory")
+	}
+	var jobSem *MaxJobsSemaphore
+	if opts.MaxJobs > 0 {
+		jobSem = NewMaxJobsSemaphore(opts.MaxJobs)
+	}
+
+	sims := make(map[*CriticalPathJob]*simJob, len(jobs))
+	all := make([]*simJob, 0, len(jobs))
+	for _, job := range jobs {
+		sim := &simJob{
+			job:     job,
+			threads: int64(job.Threads),
+			memMB:   int64(job.MemGB) * 1024,
+			slot:    NewMetadata(job.Name, ""),
+		}
+		// Requests are capped to the limits, as GetSystemReqs does.
+		if coreSem != nil && sim.threads > int64(opts.Cores) {
+			sim.threads = int64(opts.Cores)
+		}
+		if memSem != nil && sim.memMB > int64(opts.MemGB)*1024 {
+			sim.memMB = int64(opts.MemGB) * 1024
+		}
+		sims[job] = sim
+		all = append(all, sim)
+	}
+	var queue []*simJob
+	for _, sim := range all {
+		sim.waiting = len(sim.job.deps)
+		for _, dep := range sim.job.deps {
+			parent := sims[dep]
+			parent.children = append(parent.children, sim)
+		}
+		if sim.waiting == 0 {
+			queue = append(queue, sim)
+		}
+	}
+	// Jobs which became ready at the same time are queued in the order
+	// they actually started.
+	byStart := func(q []*simJob) {
+		sort.SliceStable(q, func(i, j int) bool {
+			return q[i].job.Start.Before(q[j].job.Start)
+		})
+	}
+	byStart(queue)
+
+	var running []*simJob
+	var now, nextSubmit float64
+	threads, memMB := 0, int64(0)
+	interval := float64(opts.JobIntervalMs) / 1000
+	for len(queue) > 0 || len(running) > 0 {
+		// Start as many queued jobs as will fit, in order.
+		for len(queue) > 0 && now >= nextSubmit {
+			sim := queue[0]
+			if coreSem != nil && coreSem.Available() < sim.threads ||
+				memSem != nil && memSem.Available() < sim.memMB ||
+				jobSem != nil && jobSem.Current() >= jobSem.Limit {
+				break
+			}
+			if coreSem != nil {
+				coreSem.Acquire(sim.threads)
+			}
+			if memSem != nil {
+				memSem.Acquire(sim.memMB)
+			}
+			if jobSem != nil {
+				jobSem.Acquire(sim.slot)
+			}
+			queue = queue[1:]
+			sim.start = now
+			sim.end = now + sim.job.RunTime
+			report.QueueWait += now - sim.ready
+			running = append(running, sim)
+			threads += int(sim.threads)
+			memMB += sim.memMB
+			if threads > report.PeakThreads {
+				report.PeakThreads = threads
+			}
+			if gb := int((memMB + 1023) / 1024); gb > report.PeakMemGB {
+				report.PeakMemGB = gb
+			}
+			if len(running) > report.PeakJobs {
+				report.PeakJobs = len(running)
+			}
+			if interval > 0 {
+				nextSubmit = now + interval
+			}
+		}
+
+		// Advance to the next job completion, or the next time a job may be
+		// submitted if that is sooner and there is a job waiting for it.
+		next := -1.0
+		for _, sim := range running {
+			if next < 0 || sim.end < next {
+				next = sim.end
+			}
+		}
+		if len(queue) > 0 && nextSubmit > now && (next < 0 || nextSubmit < next) {
+			next = nextSubmit
+		}
+		if next < 0 {
+			// Nothing is running and nothing can start.  This can only
+			// happen if the dependency graph has a cycle.
+			break
+		}
+		now = next
+		var ready []*simJob
+		stillRunning := running[:0]
+		for _, sim := range running {
+			if sim.end > now {
+				stillRunning = append(stillRunning, sim)
+				continue
+			}
+			if coreSem != nil {
+				coreSem.Release(sim.threads)
+			}
+			if memSem != nil {
+				memSem.Release(sim.memMB)
+			}
+			if jobSem != nil {
+				jobSem.Release(sim.slot)
+			}
+			threads -= int(sim.threads)
+			memMB -= sim.memMB
+			for _, child := range sim.children {
+				if child.waiting--; child.waiting == 0 {
+					child.ready = now
+					ready = append(ready, child)
+				}
+			}
+		}
+		running = stillRunning
+		byStart(ready)
+		queue = append(queue, ready...)
+	}
+	report.WallTime = now
+
+	stages := make(map[string]*SimulatedStage)
+	var coreSeconds, memGBSeconds float64
+	for _, sim := range all {
+		coreSeconds += float64(sim.threads) * sim.job.RunTime
+		memGBSeconds += float64(sim.memMB) / 1024 * sim.job.RunTime
+		st := stages[sim.job.Stage]
+		if st == nil {
+			st = &SimulatedStage{
+				Stage: sim.job.Stage,
+				Start: sim.start,
+				End:   sim.end,
+			}
+			stages[sim.job.Stage] = st
+			report.Stages = append(report.Stages, st)
+		}
+		if sim.start < st.Start {
+			st.Start = sim.start
+		}
+		if sim.end > st.End {
+			st.End = sim.end
+		}
+	}
+	for _, st := range report.Stages {
+		st.WallTime = st.End - st.Start
+	}
+	sort.SliceStable(report.Stages, func(i, j int) bool {
+		return report.Stages[i].Start < report.Stages[j].Start
+	})
+	if report.WallTime > 0 {
+		if opts.Cores > 0 {
+			report.CoreUtilization = coreSeconds /
+				(float64(opts.Cores) * report.WallTime)
+		}
+		if opts.MemGB > 0 {
+			report.MemUtilization = memGBSeconds /
+				(float64(opts.MemGB) * report.WallTime)
+		}
+	}
+	return report
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	start := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	job := func(name string, threads, memGB, from, to int,
+		deps ...*CriticalPathJob) *CriticalPathJob {
+		return &CriticalPathJob{
+			Name:    name,
+			Stage:   name,
+			Threads: threads,
+			MemGB:   memGB,
+			Start:   start.Add(time.Duration(from) * time.Second),
+			End:     start.Add(time.Duration(to) * time.Second),
+			RunTime: float64(to - from),
+			deps:    deps,
+		}
+	}
+	// A runs for 10s.  B, C and D each depend on A and take 2 threads for
+	// 20s.  E depends on all three and runs for 5s.
+	newJobs := func() []*CriticalPathJob {
+		a := job("A", 1, 1, 0, 10)
+		b := job("B", 2, 4, 10, 30, a)
+		c := job("C", 2, 4, 10, 30, a)
+		d := job("D", 2, 4, 30, 50, a)
+		e := job("E", 1, 1, 50, 55, b, c, d)
+		return []*CriticalPathJob{a, b, c, d, e}
+	}
+
+	check := func(opts SimulationOptions, wall, wait float64, peak int) {
+		t.Helper()
+		report := simulate(newJobs(), opts)
+		if report.ActualWallTime != 55 {
+			t.Errorf("Expected actual wall time 55, got %v",
+				report.ActualWallTime)
+		}
+		if report.WallTime != wall {
+			t.Errorf("Expected wall time %v, got %v", wall, report.WallTime)
+		}
+		if report.QueueWait != wait {
+			t.Errorf("Expected queue wait %v, got %v", wait, report.QueueWait)
+		}
+		if report.PeakThreads != peak {
+			t.Errorf("Expected peak threads %d, got %d",
+				peak, report.PeakThreads)
+		}
+	}
+	// Unlimited: B, C and D all run at once.
+	check(SimulationOptions{}, 35, 0, 6)
+	// 4 cores, as in the actual run.
+	check(SimulationOptions{Cores: 4}, 55, 20, 4)
+	// Memory limited to 8 GB has the same effect.
+	check(SimulationOptions{MemGB: 8}, 55, 20, 4)
+	// Jobs requesting more than the limit are capped to it, so with 1 core
+	// everything runs serially.
+	check(SimulationOptions{Cores: 1}, 75, 20+40, 1)
+	// Two job slots.
+	check(SimulationOptions{MaxJobs: 2}, 55, 20, 4)
+	// Submitting one job every 5 seconds delays C by 5 and D by 10.
+	check(SimulationOptions{JobIntervalMs: 5000}, 45, 15, 6)
+
+	report := simulate(newJobs(), SimulationOptions{Cores: 6, MemGB: 12})
+	if report.PeakMemGB != 12 {
+		t.Errorf("Expected peak memory 12, got %d", report.PeakMemGB)
+	}
+	// 1*10 + 3*2*20 + 1*5 = 135 core-seconds reserved of 6*35 available.
+	if u := report.CoreUtilization; u < 0.6428 || u > 0.6429 {
+		t.Errorf("Expected core utilization 135/210, got %v", u)
+	}
+	if len(report.Stages) != 5 || report.Stages[4].Stage != "E" ||
+		report.Stages[4].Start != 30 || report.Stages[4].WallTime != 5 {
+		t.Errorf("Incorrect stage times %v", report.Stages)
+	}
+}
@@ -93,6 +93,8 @@ func NewChunk(fork *Fork, index int,
 			}
 		}
 	}
+	self.metadata.store = self.fork.node.store
+	self.metadata.archive = self.fork.node.archive
 	self.hasBeenRun = false
 	if !self.fork.Split() {
 		// If we're not splitting, just set the sole chunk's filesPath
@@ -334,6 +336,11 @@ func NewFork(nodable Nodable, index int, argPermute map[string]interface{}) *For
 	self.metadata = NewMetadata(self.fqname, self.path)
 	self.split_metadata = NewMetadata(self.fqname+".split", path.Join(self.path, "split"))
 	self.join_metadata = NewMetadata(self.fqname+".join", path.Join(self.path, "join"))
+	self.metadata.store = self.node.store
+	self.split_metadata.store = self.node.store
+	self.join_metadata.store = self.node.store
+	self.split_metadata.archive = self.node.archive
+	self.join_metadata.archive = self.node.archive
 	if self.Split() {
 		self.split_metadata.discoverUniquify()
 		self.join_metadata.finalFilePath = self.metadata.finalFilePath
@@ -344,8 +351,17 @@ func NewFork(nodable Nodable, index int, argPermute map[string]interface{}) *For
 	self.join_has_run = false
 	self.lastPrint = time.Now()
 
+	self.loadChunks()
+
+	return self
+}
+
+// Initialize the chunks from the stage defs written by the split, if any.
+func (self *Fork) loadChunks() {
 	// By default, initialize stage defs with one empty chunk.
 	self.stageDefs = &LazyStageDefs{ChunkDefs: []*LazyChunkDef{new(LazyChunkDef)}}
+	self.chunks = nil
+	self.metadatasCache = nil
 
 	if err := self.split_metadata.ReadInto(StageDefsFile, &self.stageDefs); err == nil {
 		width := util.WidthForInt(len(self.stageDefs.ChunkDefs))
@@ -355,8 +371,6 @@ func NewFork(nodable Nodable, index int, argPermute map[string]interface{}) *For
 			self.chunks = append(self.chunks, chunk)
 		}
 	}
-
-	return self
 }
 
 func (self *Fork) Split() bool {
@@ -384,6 +398,7 @@ func (self *Fork) kill(message string) {
 			chunk.metadata.WriteRaw(Errors, message)
 		}
 	}
+	self.removeSecrets()
 }
 
 func (self *Fork) reset() {
@@ -392,6 +407,7 @@ func (self *Fork) reset() {
 	}
 	self.chunks = nil
 	self.metadatasCache = nil
+	self.perfCache = nil
 	self.split_has_run = false
 	self.join_has_run = false
 	self.split_metadata.notRunningSince = time.Time{}
@@ -402,6 +418,9 @@ func (self *Fork) reset() {
 
 func (self *Fork) resetPartial() error {
 	self.lastPrint = time.Now()
+	if self.getState() == Failed {
+		self.removeSecrets()
+	}
 	if err := self.split_metadata.checkedReset(); err != nil {
 		return err
 	}
@@ -714,9 +733,11 @@ func (self *Fork) writeInvocation() {
 		argBindings, _ := resolveBindings(self.node.argbindings, self.argPermute,
 			self.node.rt.FreeMemBytes()/int64(1+len(self.node.prenodes)))
 		incpaths := self.node.invocation.IncludePaths
+		args := MakeArgumentMap(argBindings)
+		redactSecretArgs(self.node.callable.GetInParams(), args)
 		invocation, _ := BuildCallSource(incpaths,
 			self.node.name,
-			MakeArgumentMap(argBindings), nil,
+			args, nil,
 			self.node.callable)
 		self.metadata.WriteRaw(InvocationFile, invocation)
 	}
@@ -744,9 +765,11 @@ func (self *Fork) step() {
 			self.printState(state)
 		}
 
-		// Lazy-evaluate bindings, only once per step.
+		// Lazy-evaluate bindings, only once per step.  If the secret
+		// arguments cannot be written, the fork is failed and false is
+		// returned, since the stage cannot be run without them.
 		var bindings LazyArgumentMap
-		getBindings := func() LazyArgumentMap {
+		getBindings := func() (LazyArgumentMap, bool) {
 			if bindings == nil {
 				var err error
 				bindings, err = resolveBindings(self.node.argbindings, self.argPermute,
@@ -754,8 +777,15 @@ func (self *Fork) step() {
 				if err != nil {
 					util.PrintError(err, "runtime", "Error resolving argument bindings.")
 				}
+				if err := self.writeSecrets(bindings); err != nil {
+					util.PrintError(err, "runtime", "Error writing secret arguments.")
+					self.metadata.WriteRaw(Errors,
+						"Error writing secret arguments: "+err.Error())
+					bindings = nil
+					return nil, false
+				}
 			}
-			return bindings
+			return bindings, true
 		}
 		if state == DisabledState {
 			return
@@ -766,7 +796,11 @@ func (self *Fork) step() {
 				return
 			}
 			self.writeInvocation()
-			self.split_metadata.Write(ArgsFile, getBindings())
+			bindings, ok := getBindings()
+			if !ok {
+				return
+			}
+			self.split_metadata.Write(ArgsFile, bindings)
 			if self.Split() {
 				if !self.split_has_run {
 					self.split_has_run = true
@@ -819,7 +853,10 @@ func (self *Fork) step() {
 						self.metadatasCache = nil
 					}
 					if len(self.chunks) > 0 {
-						bindings := getBindings()
+						bindings, ok := getBindings()
+						if !ok {
+							return
+						}
 						for _, chunk := range self.chunks {
 							chunk.step(bindings)
 						}
@@ -849,10 +886,14 @@ func (self *Fork) step() {
 			if self.stageDefs.JoinDef == nil {
 				self.stageDefs.JoinDef = &JobResources{}
 			}
+			bindings, ok := getBindings()
+			if !ok {
+				return
+			}
 			threads, memGB, special := self.node.setJoinJobReqs(self.stageDefs.JoinDef)
 			resolvedBindings := ChunkDef{
 				Resources: self.stageDefs.JoinDef,
-				Args:      MakeArgumentMap(getBindings()),
+				Args:      MakeArgumentMap(bindings),
 			}
 			self.join_metadata.Write(ArgsFile, &resolvedBindings)
 			self.join_metadata.Write(ChunkDefsFile, self.stageDefs.ChunkDefs)
@@ -922,7 +963,12 @@ func (self *Fork) step() {
 				if msg != "" {
 					self.metadata.AppendAlarm(msg)
 				}
+				if err := self.writeStageChecksums(joinOut); err != nil {
+					self.metadata.AppendAlarm(
+						"Could not checksum output files:\n" + err.Error())
+				}
 				self.metadata.WriteTime(CompleteFile)
+				self.removeSecrets()
 				// Print alerts
 				var alarms strings.Builder
 				self.getAlarms(&alarms)
@@ -946,7 +992,10 @@ func (self *Fork) step() {
 						self.cacheParamFileMap(joinOut)
 					}()
 					self.partialVdrKill()
+					self.compactMetadata()
 				}()
+			} else {
+				go self.compactMetadata()
 			}
 		}
 
@@ -1056,6 +1105,9 @@ func (self *Fork) postProcess() {
 	// Error message accumulator
 	errors := []error{}
 
+	// Final locations of file outputs, for checksums.
+	outPaths := make(map[string]string, len(paramList))
+
 	// Calculate longest key name for alignment
 	keyWidth := 0
 	for _, param := range paramList {
@@ -1113,8 +1165,10 @@ func (self *Fork) postProcess() {
 				}
 			}
 
-			// If this param has already been moved to outs/, we're done
+			// If this param has already been moved to outs/, for example
+			// by a previous run of a stage which was rerun, we're done
 			if _, err := os.Stat(outPath); err == nil {
+				value = outPath
 				break
 			}
 
@@ -1140,6 +1194,12 @@ func (self *Fork) postProcess() {
 			value = outPath
 			break
 		}
+		if param.IsFile() && value != "null" {
+			outPath := path.Join(outsPath, param.GetOutFilename())
+			if _, err := os.Lstat(outPath); err == nil {
+				outPaths[id] = outPath
+			}
+		}
 
 		// Print out the param help and value
 		key := param.GetHelp()
@@ -1159,6 +1219,10 @@ func (self *Fork) postProcess() {
 	}
 	util.Print("\n")
 
+	if err := self.writeChecksums(path.Join(pipestancePath, "outs"), outPaths); err != nil {
+		util.Print("Could not checksum output files:\n%s\n\n", err.Error())
+	}
+
 	// Print alerts
 	var alarms strings.Builder
 	self.getAlarms(&alarms)
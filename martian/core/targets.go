@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Running a pipestance only as far as a set of target stages.
+//
+
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// SetTargets restricts the pipestance to only run the given stages or
+// pipelines, and the stages they depend on.  Other stages are left waiting,
+// so that a later run without targets will continue from where this one
+// stopped.  An empty list removes the restriction.
+//
+// Unless the pipestance is read-only, the targets are recorded in its
+// metadata, so that tools inspecting it can report that it was paused
+// rather than still waiting.
+func (self *Pipestance) SetTargets(names []string) error {
+	if err := self.setTargets(names); err != nil {
+		return err
+	}
+	if self.readOnly() {
+		return nil
+	}
+	if len(names) == 0 {
+		self.metadata.remove(TargetsFile)
+		return nil
+	}
+	return self.metadata.Write(TargetsFile, names)
+}
+
+// Restore the targets recorded by SetTargets, if any.
+func (self *Pipestance) loadTargets() error {
+	var names []string
+	if err := self.metadata.ReadInto(TargetsFile, &names); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return self.setTargets(names)
+}
+
+func (self *Pipestance) setTargets(names []string) error {
+	if len(names) == 0 {
+		self.targets = nil
+		return nil
+	}
+	set := make(map[*Node]bool)
+	var add func(*Node)
+	add = func(n *Node) {
+		if set[n] {
+			return
+		}
+		set[n] = true
+		for _, sub := range n.subnodes {
+			add(sub.getNode())
+		}
+		for _, pre := range n.prenodes {
+			add(pre.getNode())
+		}
+	}
+	for _, name := range names {
+		node := self.findNode(name)
+		if node == nil {
+			return &RuntimeError{fmt.Sprintf(
+				"%s is not a stage or pipeline in %s", name, self.node.fqname)}
+		}
+		add(node)
+	}
+	self.targets = set
+	return nil
+}
+
+// Returns true if the node is allowed to run.
+func (self *Pipestance) isTarget(node *Node) bool {
+	return self.targets == nil || self.targets[node]
+}
+
+// TargetsComplete returns true if the pipestance has targets set, and all of
+// the target stages have completed.
+func (self *Pipestance) TargetsComplete() bool {
+	if self.targets == nil {
+		return false
+	}
+	for node := range self.targets {
+		if node.kind != "stage" {
+			continue
+		}
+		if st := node.getState(); st != Complete && st != DisabledState {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetTargets(t *testing.T) {
+	ps, cleanup := planPartialRun(t)
+	defer cleanup()
+	if err := ps.SetTargets([]string{"OUTER.SECOND"}); err != nil {
+		t.Fatal(err)
+	}
+	const prefix = "ID.test.OUTER."
+	for name, expect := range map[string]bool{
+		"FIRST":      true,
+		"SECOND":     true,
+		"OTHER":      false,
+		"INNER.STEP": false,
+	} {
+		if node := ps.node.find(prefix + name); node == nil {
+			t.Errorf("Could not find %s", name)
+		} else if ps.isTarget(node) != expect {
+			t.Errorf("Expected target for %s to be %v", name, expect)
+		}
+	}
+	if ps.TargetsComplete() {
+		t.Error("Expected targets to be incomplete.")
+	}
+	if err := ps.SetTargets([]string{"OUTER.MISSING"}); err == nil {
+		t.Error("Expected an error for an unknown stage.")
+	}
+	if err := ps.SetTargets(nil); err != nil {
+		t.Error(err)
+	} else if !ps.isTarget(ps.node.find(prefix+"OTHER")) || ps.TargetsComplete() {
+		t.Error("Expected no restriction without targets.")
+	}
+}
+
+func TestLoadTargets(t *testing.T) {
+	ps, cleanup := planPartialRun(t)
+	defer cleanup()
+	if err := ps.getNode().mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Unlock()
+	if err := ps.SetTargets([]string{"OUTER.FIRST"}); err != nil {
+		t.Fatal(err)
+	}
+	ps.targets = nil
+	if err := ps.loadTargets(); err != nil {
+		t.Fatal(err)
+	}
+	const prefix = "ID.test.OUTER."
+	if !ps.isTarget(ps.node.find(prefix+"FIRST")) ||
+		ps.isTarget(ps.node.find(prefix+"OTHER")) {
+		t.Error("Expected the recorded targets to be restored.")
+	}
+	first := ps.node.find(prefix + "FIRST")
+	if err := first.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, fork := range first.forks {
+		fork.metadata.WriteTime(CompleteFile)
+	}
+	// OTHER is ready to run, but is not a target.
+	ps.LoadMetadata(context.Background())
+	if st := ps.GetState(context.Background()); st != Paused {
+		t.Errorf("Expected paused, got %q", st)
+	}
+	if err := ps.SetTargets(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.loadTargets(); err != nil {
+		t.Error(err)
+	} else if ps.targets != nil {
+		t.Error("Expected the recorded targets to be removed.")
+	}
+}
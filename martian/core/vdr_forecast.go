@@ -0,0 +1,333 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+//
+// Simulation of volatile disk recovery on an existing pipestance.
+//
+// This uses the same file-argument mapping as the real VDR implementation in
+// storage.go to determine which files would have been deleted, and when, if
+// the pipestance had been run with rolling VDR.  Nothing is deleted.
+//
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// An output argument which prevents VDR from deleting some files.
+type VdrRetention struct {
+	// The output argument which references the files.
+	Argument string `json:"argument"`
+
+	// Either "retain", if the stage declared the argument in its retain
+	// list, or "pipeline", if the argument is bound to a top-level
+	// pipeline output or retain.
+	Reason string `json:"reason"`
+
+	Bytes uint64 `json:"bytes"`
+	Count uint   `json:"count"`
+}
+
+// The simulated VDR outcome for a single fork of a stage.
+type VdrForecastFork struct {
+	Name     string `json:"name"`
+	Fork     int    `json:"fork"`
+	Volatile bool   `json:"volatile"`
+	Strict   bool   `json:"strict,omitempty"`
+
+	// The total size of files owned by the fork.
+	TotalBytes uint64 `json:"total_bytes"`
+	TotalCount uint   `json:"total_count"`
+
+	// The size of files which VDR would have deleted.
+	ReclaimableBytes uint64 `json:"reclaimable_bytes"`
+	ReclaimableCount uint   `json:"reclaimable_count"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// The time at which the last reclaimable file would have been deleted.
+	KillTime time.Time `json:"kill_time,omitempty"`
+
+	Retained []*VdrRetention `json:"retained,omitempty"`
+}
+
+// A point on the simulated disk usage timeline.
+type VdrForecastPoint struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Bytes        int64     `json:"bytes"`
+	BytesWithVdr int64     `json:"bytes_with_vdr"`
+	Description  string    `json:"description"`
+}
+
+// The result of simulating VDR on a pipestance.
+type VdrForecast struct {
+	Forks            []*VdrForecastFork  `json:"forks"`
+	TotalBytes       uint64              `json:"total_bytes"`
+	ReclaimableBytes uint64              `json:"reclaimable_bytes"`
+	PeakBytes        int64               `json:"peak_bytes"`
+	PeakBytesWithVdr int64               `json:"peak_bytes_with_vdr"`
+	Timeline         []*VdrForecastPoint `json:"timeline"`
+}
+
+type vdrForecastEvent struct {
+	timestamp time.Time
+	delta     int64
+	vdrOnly   bool
+	name      string
+}
+
+func (metadata *Metadata) getEndTime() time.Time {
+	var jobInfo JobInfo
+	if err := metadata.ReadInto(JobInfoFile, &jobInfo); err != nil ||
+		jobInfo.WallClockInfo == nil || jobInfo.WallClockInfo.End == "" {
+		return time.Time{}
+	} else {
+		t, _ := time.ParseInLocation(util.TIMEFMT, jobInfo.WallClockInfo.End, time.Local)
+		return t
+	}
+}
+
+// Get the earliest start and latest end time for jobs run by this fork.
+func (self *Fork) getWallClock() (start, end time.Time) {
+	for _, md := range self.collectMetadatas()[1:] {
+		if !md.exists(JobInfoFile) {
+			continue
+		}
+		if t := md.getStartTime(); !t.IsZero() && (start.IsZero() || t.Before(start)) {
+			start = t
+		}
+		if t := md.getEndTime(); t.After(end) {
+			end = t
+		}
+	}
+	if end.IsZero() {
+		end = start
+	}
+	return start, end
+}
+
+// Get the time at which the last fork of this node finished.
+func (self *Node) getEndTime() time.Time {
+	var end time.Time
+	for _, fork := range self.forks {
+		if _, t := fork.getWallClock(); t.After(end) {
+			end = t
+		}
+	}
+	return end
+}
+
+// Returns true if the stage lists arg in its retain parameters.
+func (self *Node) declaresRetain(arg string) bool {
+	if stage, ok := self.callable.(*syntax.Stage); ok && stage.Retain != nil {
+		for _, param := range stage.Retain.Params {
+			if param.Id == arg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Simulate VDR for this fork, without deleting anything.
+//
+// The logic mirrors partialVdrKill and vdrKill, assuming rolling VDR: for
+// non-strict volatile stages, nothing is deleted until every post-node which
+// depends on a file argument has completed.  For strict-volatile stages,
+// each file is deleted as soon as the last post-node referencing it
+// completes.  Files referenced by arguments which are retained are never
+// deleted.
+func (self *Fork) forecastVdr() (*VdrForecastFork, []*vdrForecastEvent) {
+	if st := self.getState(); st != Complete {
+		return nil, nil
+	}
+	node := self.node
+	result := &VdrForecastFork{
+		Name:     node.GetFQName(),
+		Fork:     self.index,
+		Volatile: node.rt.overrides.GetOverride(node, "force_volatile", node.volatile).(bool),
+		Strict:   node.strictVolatile,
+	}
+	result.Start, result.End = self.getWallClock()
+
+	outs, err := self.metadata.read(OutsFile, node.rt.FreeMemBytes()/2)
+	if err != nil {
+		util.LogError(err, "storage", "Error reading outs for %s.", self.fqname)
+	}
+	argToFiles := getArgsToFilesMap(self.fileArgs, outs, false, self.fqname)
+	filesToArgs := make(map[string]*vdrFileCache, len(self.fileArgs))
+	chunkFiles := make(map[string]struct{})
+	for _, md := range self.collectMetadatas()[1:] {
+		files, _ := md.enumerateFiles()
+		for _, fpath := range files {
+			addFilesToArgsMappings(fpath, false, self.fqname,
+				filesToArgs, argToFiles)
+		}
+	}
+	for _, chunk := range self.chunks {
+		files, _ := chunk.metadata.enumerateFiles()
+		for _, fpath := range files {
+			util.Walk(fpath, func(p string, _ os.FileInfo, err error) error {
+				if err == nil {
+					chunkFiles[p] = struct{}{}
+				}
+				return nil
+			})
+		}
+	}
+
+	// Determine when each argument is released, and which are retained.
+	killTime := result.End
+	argRelease := make(map[string]time.Time, len(self.fileArgs))
+	retained := make(map[string]*VdrRetention)
+	for arg, nodes := range self.fileArgs {
+		if _, ok := argToFiles[arg]; !ok {
+			// Does not reference any files.
+			continue
+		}
+		release := result.End
+		for post := range nodes {
+			// Arguments bound to top-level pipeline outputs are recorded
+			// with a nil *Node, which is not a nil Nodable.
+			if post == nil || post.getNode() == nil {
+				reason := "pipeline"
+				if node.declaresRetain(arg) {
+					reason = "retain"
+				}
+				retained[arg] = &VdrRetention{
+					Argument: arg,
+					Reason:   reason,
+				}
+			} else if t := post.getNode().getEndTime(); t.After(release) {
+				release = t
+			}
+		}
+		argRelease[arg] = release
+		if release.After(killTime) {
+			killTime = release
+		}
+	}
+
+	allowed := node.rt.overrides.GetOverride(node, "force_volatile", true).(bool)
+	fileKillTime := func(fpath string, entry *vdrFileCache) (time.Time, bool) {
+		if !allowed {
+			return time.Time{}, false
+		} else if !result.Volatile {
+			// Non-volatile stages which split still clean up their
+			// chunk files.
+			if _, ok := chunkFiles[fpath]; ok && self.Split() {
+				return killTime, true
+			}
+			return time.Time{}, false
+		}
+		t := result.End
+		for arg := range entry.args {
+			if r, ok := retained[arg]; ok {
+				r.Bytes += uint64(entry.size)
+				r.Count += uint(entry.count)
+				return time.Time{}, false
+			} else if !result.Strict {
+				t = killTime
+			} else if release := argRelease[arg]; release.After(t) {
+				t = release
+			}
+		}
+		return t, true
+	}
+
+	killBytes := make(map[time.Time]int64)
+	for fpath, entry := range filesToArgs {
+		result.TotalBytes += uint64(entry.size)
+		result.TotalCount += uint(entry.count)
+		if t, ok := fileKillTime(fpath, entry); ok {
+			result.ReclaimableBytes += uint64(entry.size)
+			result.ReclaimableCount += uint(entry.count)
+			killBytes[t] += entry.size
+			if t.After(result.KillTime) {
+				result.KillTime = t
+			}
+		}
+	}
+	if len(retained) > 0 {
+		result.Retained = make([]*VdrRetention, 0, len(retained))
+		for _, r := range retained {
+			if r.Count > 0 {
+				result.Retained = append(result.Retained, r)
+			}
+		}
+		sort.Slice(result.Retained, func(i, j int) bool {
+			return result.Retained[i].Argument < result.Retained[j].Argument
+		})
+	}
+
+	events := make([]*vdrForecastEvent, 0, 1+len(killBytes))
+	if result.TotalBytes > 0 {
+		events = append(events, &vdrForecastEvent{
+			timestamp: result.Start,
+			delta:     int64(result.TotalBytes),
+			name:      self.fqname + " alloc",
+		})
+	}
+	for t, size := range killBytes {
+		if size > 0 {
+			events = append(events, &vdrForecastEvent{
+				timestamp: t,
+				delta:     -size,
+				vdrOnly:   true,
+				name:      self.fqname + " delete",
+			})
+		}
+	}
+	return result, events
+}
+
+// ForecastVDR simulates rolling VDR on the pipestance, which is expected to
+// have completed with VDR disabled, and reports what would have been deleted
+// and the effect on peak disk usage.
+func (self *Pipestance) ForecastVDR() *VdrForecast {
+	var forecast VdrForecast
+	var events []*vdrForecastEvent
+	for _, node := range self.allNodes() {
+		if node.kind != "stage" {
+			continue
+		}
+		for _, fork := range node.forks {
+			if f, ev := fork.forecastVdr(); f != nil {
+				forecast.Forks = append(forecast.Forks, f)
+				forecast.TotalBytes += f.TotalBytes
+				forecast.ReclaimableBytes += f.ReclaimableBytes
+				events = append(events, ev...)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].timestamp.Before(events[j].timestamp)
+	})
+	forecast.Timeline = make([]*VdrForecastPoint, 0, len(events))
+	var current, currentVdr int64
+	for _, ev := range events {
+		if !ev.vdrOnly {
+			current += ev.delta
+		}
+		currentVdr += ev.delta
+		if current > forecast.PeakBytes {
+			forecast.PeakBytes = current
+		}
+		if currentVdr > forecast.PeakBytesWithVdr {
+			forecast.PeakBytesWithVdr = currentVdr
+		}
+		forecast.Timeline = append(forecast.Timeline, &VdrForecastPoint{
+			Timestamp:    ev.timestamp,
+			Bytes:        current,
+			BytesWithVdr: currentVdr,
+			Description:  ev.name,
+		})
+	}
+	return &forecast
+}
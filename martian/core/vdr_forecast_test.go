@@ -0,0 +1,214 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestMetadataGetEndTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testMetadataGetEndTime")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	md := NewMetadata("ID.test.STAGE.fork0.chnk0", dir)
+	if end := md.getEndTime(); !end.IsZero() {
+		t.Errorf("Expected zero end time without jobinfo, got %v", end)
+	}
+	if err := md.Write(JobInfoFile, &JobInfo{
+		Name: "STAGE",
+		WallClockInfo: &WallClockInfo{
+			Start: "2018-03-01 10:00:00",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if end := md.getEndTime(); !end.IsZero() {
+		t.Errorf("Expected zero end time for unfinished job, got %v", end)
+	}
+	if err := md.Write(JobInfoFile, &JobInfo{
+		Name: "STAGE",
+		WallClockInfo: &WallClockInfo{
+			Start:    "2018-03-01 10:00:00",
+			End:      "2018-03-01 10:05:30",
+			Duration: 330,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expect := time.Date(2018, 3, 1, 10, 5, 30, 0, time.Local)
+	if end := md.getEndTime(); !end.Equal(expect) {
+		t.Errorf("Expected end time %v, got %v", expect, end)
+	}
+	if start := md.getStartTime(); !start.Equal(expect.Add(-330 * time.Second)) {
+		t.Errorf("Expected start time %v, got %v",
+			expect.Add(-330*time.Second), start)
+	}
+}
+
+const vdrForecastSrc = `
+filetype txt;
+
+stage PRODUCE(
+    out txt data,
+    out txt kept,
+    src py  "stages/produce",
+) using (
+    volatile = strict,
+)
+
+stage CONSUME(
+    in  txt data,
+    out int count,
+    src py  "stages/consume",
+)
+
+pipeline PIPE(
+    out txt kept,
+    out int count,
+)
+{
+    call PRODUCE() using (
+        volatile = true,
+    )
+
+    call CONSUME(
+        data = PRODUCE.data,
+    )
+
+    return (
+        kept  = PRODUCE.kept,
+        count = CONSUME.count,
+    )
+}
+
+call PIPE()
+`
+
+// Invokes vdrForecastSrc in a temporary directory.  The stages are never run.
+func invokeProduceConsume(t *testing.T) (*Pipestance, func()) {
+	t.Helper()
+	d, err := ioutil.TempDir("", "pipestance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stage := range []string{"produce", "consume"} {
+		if err := os.MkdirAll(path.Join(d, "stages", stage), 0755); err != nil {
+			os.RemoveAll(d)
+			t.Fatal(err)
+		}
+	}
+	rt, cleanup := testRuntime(t)
+	ps, err := rt.InvokePipeline(vdrForecastSrc, path.Join(d, "src.mro"),
+		"test", path.Join(d, "test"), nil, "1.0.0", make(map[string]string), nil)
+	if err != nil {
+		cleanup()
+		os.RemoveAll(d)
+		t.Fatal(err)
+	}
+	return ps, func() {
+		ps.Unlock()
+		cleanup()
+		os.RemoveAll(d)
+	}
+}
+
+func TestForecastVDR(t *testing.T) {
+	ps, cleanup := invokeProduceConsume(t)
+	defer cleanup()
+
+	start := time.Date(2018, 3, 1, 10, 0, 0, 0, time.Local)
+	// Mark the fork of the given stage complete, having run for five
+	// minutes from the given offset and written the given files.
+	complete := func(name string, offset time.Duration,
+		outs map[string]interface{}, files map[string]int) {
+		t.Helper()
+		node := ps.node.find(ps.GetFQName() + "." + name)
+		if node == nil {
+			t.Fatalf("Stage %s not found.", name)
+		}
+		fork := node.forks[0]
+		md := fork.split_metadata
+		for _, p := range []string{md.FilesPath(), fork.metadata.FilesPath()} {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for fn, size := range files {
+			p := md.FilePath(fn)
+			if err := ioutil.WriteFile(p, make([]byte, size), 0644); err != nil {
+				t.Fatal(err)
+			}
+			outs[fn] = p
+		}
+		if err := md.Write(JobInfoFile, &JobInfo{
+			WallClockInfo: &WallClockInfo{
+				Start:    start.Add(offset).Format(util.TIMEFMT),
+				End:      start.Add(offset + 5*time.Minute).Format(util.TIMEFMT),
+				Duration: 300,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := fork.metadata.Write(OutsFile, outs); err != nil {
+			t.Fatal(err)
+		}
+		fork.metadata.WriteTime(CompleteFile)
+	}
+	complete("PRODUCE", 0, make(map[string]interface{}), map[string]int{
+		"data": 100,
+		"kept": 50,
+	})
+	complete("CONSUME", 5*time.Minute, map[string]interface{}{"count": 1}, nil)
+
+	forecast := ps.ForecastVDR()
+	if len(forecast.Forks) != 2 {
+		t.Fatalf("Expected 2 forks, got %d", len(forecast.Forks))
+	}
+	if forecast.TotalBytes != 150 {
+		t.Errorf("Expected 150 total bytes, got %d", forecast.TotalBytes)
+	}
+	if forecast.ReclaimableBytes != 100 {
+		t.Errorf("Expected 100 reclaimable bytes, got %d",
+			forecast.ReclaimableBytes)
+	}
+	if forecast.PeakBytes != 150 || forecast.PeakBytesWithVdr != 150 {
+		t.Errorf("Expected peak usage of 150 bytes, got %d and %d with vdr",
+			forecast.PeakBytes, forecast.PeakBytesWithVdr)
+	}
+	var produce *VdrForecastFork
+	for _, f := range forecast.Forks {
+		if strings.HasSuffix(f.Name, ".PRODUCE") {
+			produce = f
+		}
+	}
+	if produce == nil {
+		t.Fatal("Missing forecast for PRODUCE.")
+	}
+	// The data file is released once CONSUME completes.
+	if expect := start.Add(10 * time.Minute); !produce.KillTime.Equal(expect) {
+		t.Errorf("Expected kill time %v, got %v", expect, produce.KillTime)
+	}
+	if len(produce.Retained) != 1 {
+		t.Errorf("Expected one retained argument, got %d", len(produce.Retained))
+	} else if r := produce.Retained[0]; r.Argument != "kept" ||
+		r.Reason != "pipeline" || r.Bytes != 50 {
+		t.Errorf("Incorrect retention %v", *r)
+	}
+	if n := len(forecast.Timeline); n != 2 {
+		t.Errorf("Expected 2 timeline points, got %d", n)
+	} else if last := forecast.Timeline[1]; last.Bytes != 150 ||
+		last.BytesWithVdr != 50 {
+		t.Errorf("Expected 50 bytes remaining with vdr, got %d",
+			last.BytesWithVdr)
+	}
+}
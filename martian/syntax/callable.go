@@ -4,6 +4,10 @@
 
 package syntax
 
+import (
+	"sort"
+)
+
 type (
 	// A Callable object is a stage or pipeline which can be called.
 	Callable interface {
@@ -126,16 +130,30 @@ type (
 
 	// Stage resouce definitions.
 	Resources struct {
-		Node         AstNode
-		ThreadNode   *AstNode
-		MemNode      *AstNode
-		SpecialNode  *AstNode
-		VolatileNode *AstNode
+		Node          AstNode
+		ThreadNode    *AstNode
+		MemNode       *AstNode
+		SpecialNode   *AstNode
+		VolatileNode  *AstNode
+		ContainerNode *AstNode
+		EnvNode       *AstNode
+		PathNode      *AstNode
 
 		Special        string
 		Threads        int16
 		MemGB          int16
 		StrictVolatile bool
+
+		// The container image to run the stage code in, if any.
+		Container string
+
+		// Extra environment variables for the stage code, as a map of
+		// strings.  See EnvVars.
+		Env *ValExp
+
+		// Directories to add to the front of PATH for the stage code, as
+		// an array of strings.  See PathPrefix.
+		Path *ValExp
 	}
 
 	Pipeline struct {
@@ -236,7 +254,16 @@ func (s *Resources) getNode() *AstNode     { return &s.Node }
 func (s *Resources) File() *SourceFile     { return s.Node.Loc.File }
 func (s *Resources) inheritComments() bool { return false }
 func (s *Resources) getSubnodes() []AstNodable {
-	subs := make([]AstNodable, 0, 3)
+	subs := make([]AstNodable, 0, 9)
+	if s.ContainerNode != nil {
+		subs = append(subs, s.ContainerNode)
+	}
+	if s.EnvNode != nil {
+		subs = append(subs, s.EnvNode, s.Env)
+	}
+	if s.PathNode != nil {
+		subs = append(subs, s.PathNode, s.Path)
+	}
 	if s.ThreadNode != nil {
 		subs = append(subs, s.ThreadNode)
 	}
@@ -249,6 +276,11 @@ func (s *Resources) getSubnodes() []AstNodable {
 	if s.VolatileNode != nil {
 		subs = append(subs, s.VolatileNode)
 	}
+	// Comments are attached in order, so the resources must be listed in
+	// the order they appear in the source.
+	sort.SliceStable(subs, func(i, j int) bool {
+		return subs[i].getNode().Loc.Line < subs[j].getNode().Loc.Line
+	})
 	return subs
 }
 
@@ -332,3 +364,40 @@ func (s *SrcParam) getSubnodes() []AstNodable { return nil }
 
 func (s *ReturnStm) getNode() *AstNode { return &s.Node }
 func (s *ReturnStm) File() *SourceFile { return s.Node.Loc.File }
+
+// EnvVars returns the environment variables declared for the stage, if any.
+func (s *Resources) EnvVars() map[string]string {
+	if s == nil || s.Env == nil {
+		return nil
+	}
+	m, ok := s.Env.Value.(map[string]Exp)
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(m))
+	for k, exp := range m {
+		if v, ok := exp.ToInterface().(string); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// PathPrefix returns the directories declared to prepend to PATH for the
+// stage, if any.
+func (s *Resources) PathPrefix() []string {
+	if s == nil || s.Path == nil {
+		return nil
+	}
+	list, ok := s.Path.Value.([]Exp)
+	if !ok || len(list) == 0 {
+		return nil
+	}
+	prefix := make([]string, 0, len(list))
+	for _, exp := range list {
+		if v, ok := exp.ToInterface().(string); ok {
+			prefix = append(prefix, v)
+		}
+	}
+	return prefix
+}
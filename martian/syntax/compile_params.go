@@ -46,6 +46,14 @@ func (params *OutParams) compile(global *Ast) error {
 			params.Table[param.GetId()] = param
 		}
 
+		// Secrets can only be passed in, since stage code writes its
+		// outputs in the clear.
+		if param.GetTname() == KindSecret {
+			errs = append(errs, global.err(param,
+				"TypeError: output parameter '%s' cannot be a secret",
+				param.GetId()))
+		}
+
 		// Check that types exist.
 		if _, ok := global.TypeTable[param.GetTname()]; !ok {
 			errs = append(errs, global.err(param,
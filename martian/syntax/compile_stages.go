@@ -38,6 +38,13 @@ func (stage *Stage) compile(global *Ast) error {
 		if err := stage.ChunkIns.compile(global); err != nil {
 			errs = append(errs, err)
 		}
+		for _, param := range stage.ChunkIns.List {
+			if param.GetTname() == KindSecret {
+				errs = append(errs, global.err(param,
+					"TypeError: split parameter '%s' cannot be a secret",
+					param.GetId()))
+			}
+		}
 		if GetEnforcementLevel() > EnforceDisable {
 			for paramName := range stage.ChunkIns.Table {
 				if _, ok := stage.InParams.Table[paramName]; ok {
@@ -72,9 +79,61 @@ func (stage *Stage) compile(global *Ast) error {
 			errs = append(errs, err)
 		}
 	}
+	if stage.Resources != nil {
+		if err := stage.Resources.compile(global, stage); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+// Check that the env resource is a map of strings and the path resource is
+// an array of strings.
+func (res *Resources) compile(global *Ast, stage *Stage) error {
+	var errs ErrorList
+	if res.Env != nil {
+		if res.Env.Kind != KindMap {
+			errs = append(errs, global.err(res.Env,
+				"TypeMismatchError: env for stage %s must be a map of strings",
+				stage.Id))
+		} else if m, ok := res.Env.Value.(map[string]Exp); ok {
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if !isStringExp(m[k]) {
+					errs = append(errs, global.err(m[k],
+						"TypeMismatchError: env variable %s for stage %s must be a string",
+						k, stage.Id))
+				}
+			}
+		}
+	}
+	if res.Path != nil {
+		if res.Path.Kind != KindArray {
+			errs = append(errs, global.err(res.Path,
+				"TypeMismatchError: path for stage %s must be an array of strings",
+				stage.Id))
+		} else {
+			for _, exp := range res.Path.Value.([]Exp) {
+				if !isStringExp(exp) {
+					errs = append(errs, global.err(exp,
+						"TypeMismatchError: path entries for stage %s must be strings",
+						stage.Id))
+				}
+			}
+		}
+	}
 	return errs.If()
 }
 
+func isStringExp(exp Exp) bool {
+	v, ok := exp.(*ValExp)
+	return ok && v.Kind == KindString
+}
+
 const (
 	disabled  = "disabled"
 	local     = "local"
@@ -26,6 +26,7 @@ func (global *Ast) checkTypeMatch(paramType string, valueType string) bool {
 		paramType == valueType ||
 		(paramType == KindPath && valueType == KindString) ||
 		(paramType == KindFile && valueType == KindString) ||
+		(paramType == KindSecret && valueType == KindString) ||
 		(paramType == KindFloat && valueType == KindInt) ||
 		// Allow implicit cast between string and user file type
 		(global.isUserType(paramType) &&
@@ -288,6 +288,10 @@ func (binding *BindStm) Equals(other *BindStm) bool {
 		return other.Exp == nil
 	} else if other.Exp == nil {
 		return false
+	} else if binding.Tname == KindSecret && isValExp(binding.Exp) && isValExp(other.Exp) {
+		// Secret values are redacted in the saved source, so changing one
+		// does not change the pipeline.
+		return true
 	} else if !binding.Exp.equal(other.Exp) {
 		util.PrintInfo("compare",
 			"Binding %s values differ.",
@@ -297,6 +301,11 @@ func (binding *BindStm) Equals(other *BindStm) bool {
 	return true
 }
 
+func isValExp(exp Exp) bool {
+	_, ok := exp.(*ValExp)
+	return ok
+}
+
 func (exp *ValExp) equal(other Exp) bool {
 	if exp == nil {
 		return other == nil
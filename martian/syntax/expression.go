@@ -29,6 +29,11 @@ const (
 
 	// A file path.
 	KindPath = "path"
+
+	// A string, such as a password, which must not be recorded in logs or
+	// metadata.  Stage code receives the path to a file containing the
+	// value.
+	KindSecret = "secret"
 )
 
 type (
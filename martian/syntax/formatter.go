@@ -517,36 +517,64 @@ func (self *Resources) format(printer *printer) {
 	printer.printComments(&self.Node, INDENT)
 	printer.WriteString(") using (\n")
 	// Pad depending on which arguments are present.
-	// mem_gb   = x,
-	// special  = y
-	// threads  = y,
-	// volatile = z,
-	var memPad, threadPad string
-	if self.VolatileNode != nil {
-		memPad = "  "
-		threadPad = " "
-	} else if self.SpecialNode != nil || self.ThreadNode != nil {
-		memPad = " "
+	// container = v,
+	// env       = w,
+	// mem_gb    = x,
+	// special   = y,
+	// volatile  = z,
+	width := 0
+	for _, res := range [...]struct {
+		node *AstNode
+		name string
+	}{
+		{self.ContainerNode, "container"},
+		{self.EnvNode, "env"},
+		{self.MemNode, "mem_gb"},
+		{self.PathNode, "path"},
+		{self.SpecialNode, "special"},
+		{self.ThreadNode, "threads"},
+		{self.VolatileNode, "volatile"},
+	} {
+		if res.node != nil && len(res.name) > width {
+			width = len(res.name)
+		}
 	}
-	if self.MemNode != nil {
-		printer.printComments(self.MemNode, INDENT)
+	start := func(node *AstNode, name string) {
+		printer.printComments(node, INDENT)
 		printer.WriteString(INDENT)
-		printer.Printf("mem_gb%s = %d,\n", memPad, self.MemGB)
+		printer.WriteString(name)
+		printer.WriteString(strings.Repeat(" ", width-len(name)))
+		printer.WriteString(" = ")
+	}
+	if self.ContainerNode != nil {
+		start(self.ContainerNode, "container")
+		printer.Printf("\"%s\",\n", self.Container)
+	}
+	if self.EnvNode != nil {
+		start(self.EnvNode, "env")
+		self.Env.format(printer, INDENT)
+		printer.WriteString(",\n")
+	}
+	if self.MemNode != nil {
+		start(self.MemNode, "mem_gb")
+		printer.Printf("%d,\n", self.MemGB)
+	}
+	if self.PathNode != nil {
+		start(self.PathNode, "path")
+		self.Path.format(printer, INDENT)
+		printer.WriteString(",\n")
 	}
 	if self.SpecialNode != nil {
-		printer.printComments(self.SpecialNode, INDENT)
-		printer.WriteString(INDENT)
-		printer.Printf("special%s = \"%s\",\n", threadPad, self.Special)
+		start(self.SpecialNode, "special")
+		printer.Printf("\"%s\",\n", self.Special)
 	}
 	if self.ThreadNode != nil {
-		printer.printComments(self.ThreadNode, INDENT)
-		printer.WriteString(INDENT)
-		printer.Printf("threads%s = %d,\n", threadPad, self.Threads)
+		start(self.ThreadNode, "threads")
+		printer.Printf("%d,\n", self.Threads)
 	}
 	if self.VolatileNode != nil {
-		printer.printComments(self.VolatileNode, INDENT)
-		printer.WriteString(INDENT)
-		printer.WriteString("volatile = strict,\n")
+		start(self.VolatileNode, "volatile")
+		printer.WriteString("strict,\n")
 	}
 }
 
@@ -187,11 +187,27 @@ stage MERGE_JSON(
     in  json json2,
     out json result,
     src py   "stages/merge_json",
+) using (
+    # Run in a known python environment.
+    container = "python:2.7",
+    mem_gb    = 2,
 )
 
 stage MERGE_JSON2(
     in  json[] input,
     src py     "stages/merge_json",
+) using (
+    env     = {
+        "PYTHONPATH": "/opt/json/lib",
+        "USE_UJSON": "1",
+    },
+    mem_gb  = 1,
+    # Pick up the newer tools.
+    path    = [
+        "/opt/json/bin",
+        "/opt/tools/bin",
+    ],
+    threads = 2,
 )
 
 stage MAP_EXAMPLE(
@@ -88,25 +88,27 @@ const AS = 57377
 const THREADS = 57378
 const MEM_GB = 57379
 const SPECIAL = 57380
-const ID = 57381
-const LITSTRING = 57382
-const NUM_FLOAT = 57383
-const NUM_INT = 57384
-const DOT = 57385
-const PY = 57386
-const EXEC = 57387
-const COMPILED = 57388
-const MAP = 57389
-const INT = 57390
-const STRING = 57391
-const FLOAT = 57392
-const PATH = 57393
-const BOOL = 57394
-const TRUE = 57395
-const FALSE = 57396
-const NULL = 57397
-const DEFAULT = 57398
-const INCLUDE_DIRECTIVE = 57399
+const CONTAINER = 57381
+const ENV = 57382
+const ID = 57383
+const LITSTRING = 57384
+const NUM_FLOAT = 57385
+const NUM_INT = 57386
+const DOT = 57387
+const PY = 57388
+const EXEC = 57389
+const COMPILED = 57390
+const MAP = 57391
+const INT = 57392
+const STRING = 57393
+const FLOAT = 57394
+const PATH = 57395
+const BOOL = 57396
+const TRUE = 57397
+const FALSE = 57398
+const NULL = 57399
+const DEFAULT = 57400
+const INCLUDE_DIRECTIVE = 57401
 
 var mmToknames = [...]string{
 	"$end",
@@ -147,6 +149,8 @@ var mmToknames = [...]string{
 	"THREADS",
 	"MEM_GB",
 	"SPECIAL",
+	"CONTAINER",
+	"ENV",
 	"ID",
 	"LITSTRING",
 	"NUM_FLOAT",
@@ -173,214 +177,224 @@ const mmEofCode = 1
 const mmErrCode = 2
 const mmInitialStackSize = 16
 
-//line grammar.y:725
+//line grammar.y:748
 
 //line yacctab:1
 var mmExca = [...]int{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 44,
-	13, 111,
-	35, 111,
-	-2, 70,
-	-1, 45,
-	13, 113,
-	35, 113,
-	-2, 71,
 	-1, 46,
-	13, 120,
-	35, 120,
-	-2, 72,
+	13, 116,
+	35, 116,
+	-2, 73,
+	-1, 47,
+	13, 118,
+	35, 118,
+	-2, 74,
+	-1, 48,
+	13, 125,
+	35, 125,
+	-2, 75,
 }
 
 const mmPrivate = 57344
 
-const mmLast = 607
+const mmLast = 680
 
 var mmAct = [...]int{
 
-	96, 117, 140, 65, 171, 63, 55, 150, 138, 22,
-	106, 4, 38, 39, 14, 16, 81, 123, 91, 92,
-	212, 43, 102, 103, 104, 40, 27, 47, 113, 112,
-	33, 36, 31, 28, 30, 37, 25, 34, 8, 11,
-	12, 7, 35, 29, 32, 23, 48, 223, 184, 54,
-	222, 26, 24, 224, 64, 200, 141, 56, 18, 191,
-	68, 173, 170, 48, 75, 155, 128, 41, 22, 19,
-	204, 67, 183, 52, 95, 15, 225, 201, 202, 203,
-	143, 22, 99, 8, 11, 12, 7, 90, 93, 94,
-	172, 218, 152, 172, 177, 53, 152, 105, 80, 79,
-	75, 114, 166, 147, 145, 127, 149, 131, 130, 7,
-	80, 162, 206, 134, 135, 146, 129, 27, 163, 133,
-	5, 33, 36, 31, 28, 30, 37, 25, 34, 89,
-	151, 80, 193, 35, 29, 32, 23, 152, 107, 154,
-	158, 100, 26, 24, 157, 7, 159, 194, 80, 8,
-	11, 12, 7, 179, 169, 57, 186, 153, 180, 174,
-	6, 178, 168, 181, 17, 167, 137, 185, 59, 60,
-	61, 62, 76, 189, 17, 188, 50, 160, 49, 192,
-	161, 217, 181, 42, 195, 216, 215, 214, 98, 72,
-	71, 70, 205, 69, 230, 229, 75, 1, 228, 118,
-	213, 211, 196, 119, 227, 226, 221, 97, 27, 210,
-	220, 207, 33, 36, 31, 28, 30, 37, 25, 34,
-	197, 190, 175, 148, 35, 29, 32, 23, 122, 120,
-	121, 118, 182, 26, 24, 119, 136, 111, 110, 97,
-	27, 91, 92, 124, 33, 36, 31, 28, 30, 37,
-	25, 34, 109, 108, 198, 164, 35, 29, 32, 23,
-	122, 120, 121, 118, 139, 26, 24, 119, 187, 144,
-	156, 97, 27, 91, 92, 124, 33, 36, 31, 28,
-	30, 37, 25, 34, 51, 58, 74, 88, 35, 29,
-	32, 23, 122, 120, 121, 118, 21, 26, 24, 119,
-	132, 115, 142, 97, 27, 91, 92, 124, 33, 36,
-	31, 28, 30, 37, 25, 34, 3, 116, 77, 13,
-	35, 29, 32, 23, 122, 120, 121, 118, 126, 26,
-	24, 119, 176, 208, 165, 97, 27, 91, 92, 124,
-	33, 36, 31, 28, 30, 37, 25, 34, 199, 78,
-	66, 10, 35, 29, 32, 23, 122, 120, 121, 9,
-	20, 26, 24, 101, 2, 0, 0, 0, 27, 91,
-	92, 124, 33, 36, 31, 28, 30, 37, 25, 34,
-	0, 0, 0, 0, 35, 29, 32, 23, 0, 0,
-	0, 0, 0, 26, 24, 87, 82, 83, 85, 84,
-	86, 219, 0, 0, 0, 0, 97, 27, 0, 0,
-	0, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 209, 0,
-	0, 0, 26, 24, 27, 0, 0, 0, 33, 36,
-	31, 28, 30, 37, 25, 34, 0, 0, 130, 0,
-	35, 29, 32, 23, 0, 0, 0, 27, 0, 26,
-	24, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 125, 0,
-	0, 0, 26, 24, 27, 0, 0, 0, 33, 36,
-	31, 28, 30, 37, 25, 34, 0, 0, 0, 0,
-	35, 29, 32, 23, 0, 0, 97, 27, 0, 26,
-	24, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 73, 0,
-	0, 0, 26, 24, 27, 0, 0, 0, 33, 36,
-	31, 28, 30, 37, 25, 34, 0, 0, 0, 0,
-	35, 29, 32, 23, 0, 0, 0, 27, 0, 26,
-	24, 33, 36, 31, 28, 30, 37, 25, 34, 0,
-	0, 0, 0, 35, 29, 32, 23, 0, 0, 0,
-	27, 0, 26, 24, 33, 36, 31, 44, 45, 46,
-	25, 34, 0, 0, 0, 0, 35, 29, 32, 23,
-	0, 0, 0, 0, 0, 26, 24,
+	118, 98, 119, 142, 67, 173, 65, 57, 152, 140,
+	22, 108, 4, 40, 41, 14, 16, 83, 125, 93,
+	94, 217, 45, 104, 105, 106, 42, 29, 49, 115,
+	114, 35, 38, 33, 30, 32, 39, 26, 36, 8,
+	11, 12, 7, 37, 31, 34, 25, 27, 23, 120,
+	50, 233, 56, 121, 28, 24, 231, 66, 230, 232,
+	58, 186, 143, 70, 193, 175, 50, 77, 172, 157,
+	130, 22, 8, 11, 12, 7, 43, 97, 15, 19,
+	124, 122, 123, 69, 22, 101, 54, 185, 145, 236,
+	92, 95, 96, 93, 94, 126, 226, 174, 154, 211,
+	107, 174, 154, 77, 116, 202, 91, 179, 55, 168,
+	133, 5, 82, 81, 149, 82, 136, 137, 82, 131,
+	209, 59, 135, 18, 147, 82, 148, 203, 204, 205,
+	206, 207, 129, 153, 61, 62, 63, 64, 8, 11,
+	12, 7, 156, 160, 208, 7, 164, 159, 7, 161,
+	195, 181, 102, 165, 109, 6, 182, 171, 196, 17,
+	188, 180, 176, 170, 169, 162, 183, 139, 163, 17,
+	187, 78, 52, 51, 44, 155, 191, 225, 190, 224,
+	223, 222, 194, 221, 220, 183, 219, 197, 100, 74,
+	73, 72, 71, 244, 243, 210, 242, 241, 240, 77,
+	239, 238, 237, 218, 216, 229, 215, 212, 199, 192,
+	177, 150, 1, 138, 120, 113, 228, 198, 121, 112,
+	111, 110, 99, 29, 234, 235, 90, 35, 38, 33,
+	30, 32, 39, 26, 36, 21, 200, 166, 189, 37,
+	31, 34, 25, 27, 23, 124, 122, 123, 120, 184,
+	28, 24, 121, 146, 158, 53, 99, 29, 93, 94,
+	126, 35, 38, 33, 30, 32, 39, 26, 36, 3,
+	60, 76, 13, 37, 31, 34, 25, 27, 23, 124,
+	122, 123, 120, 141, 28, 24, 121, 134, 144, 79,
+	99, 29, 93, 94, 126, 35, 38, 33, 30, 32,
+	39, 26, 36, 128, 178, 213, 167, 37, 31, 34,
+	25, 27, 23, 124, 122, 123, 120, 201, 28, 24,
+	121, 80, 117, 68, 99, 29, 93, 94, 126, 35,
+	38, 33, 30, 32, 39, 26, 36, 10, 9, 20,
+	103, 37, 31, 34, 25, 27, 23, 124, 122, 123,
+	120, 2, 28, 24, 121, 0, 0, 0, 99, 29,
+	93, 94, 126, 35, 38, 33, 30, 32, 39, 26,
+	36, 0, 0, 0, 0, 37, 31, 34, 25, 27,
+	23, 124, 122, 123, 0, 0, 28, 24, 0, 0,
+	0, 0, 0, 29, 93, 94, 126, 35, 38, 33,
+	30, 32, 39, 26, 36, 0, 0, 0, 0, 37,
+	31, 34, 25, 27, 23, 0, 0, 151, 0, 132,
+	28, 24, 89, 84, 85, 87, 86, 88, 29, 0,
+	0, 0, 35, 38, 33, 30, 32, 39, 26, 36,
+	0, 0, 0, 0, 37, 31, 34, 25, 27, 23,
+	154, 0, 227, 0, 0, 28, 24, 99, 29, 0,
+	0, 0, 35, 38, 33, 30, 32, 39, 26, 36,
+	0, 0, 0, 0, 37, 31, 34, 25, 27, 23,
+	0, 214, 0, 0, 0, 28, 24, 29, 0, 0,
+	0, 35, 38, 33, 30, 32, 39, 26, 36, 0,
+	0, 0, 0, 37, 31, 34, 25, 27, 23, 132,
+	0, 0, 0, 0, 28, 24, 0, 0, 29, 0,
+	0, 0, 35, 38, 33, 30, 32, 39, 26, 36,
+	0, 0, 0, 0, 37, 31, 34, 25, 27, 23,
+	0, 127, 0, 0, 0, 28, 24, 29, 0, 0,
+	0, 35, 38, 33, 30, 32, 39, 26, 36, 0,
+	0, 0, 0, 37, 31, 34, 25, 27, 23, 0,
+	0, 99, 29, 0, 28, 24, 35, 38, 33, 30,
+	32, 39, 26, 36, 0, 0, 0, 0, 37, 31,
+	34, 25, 27, 23, 0, 75, 0, 0, 0, 28,
+	24, 29, 0, 0, 0, 35, 38, 33, 30, 32,
+	39, 26, 36, 0, 0, 0, 0, 37, 31, 34,
+	25, 27, 23, 0, 0, 0, 29, 0, 28, 24,
+	35, 38, 33, 30, 32, 39, 26, 36, 0, 0,
+	0, 0, 37, 31, 34, 25, 27, 23, 0, 0,
+	0, 29, 0, 28, 24, 35, 38, 33, 46, 47,
+	48, 26, 36, 0, 0, 0, 0, 37, 31, 34,
+	25, 27, 23, 0, 0, 0, 0, 0, 28, 24,
 }
 var mmPact = [...]int{
 
-	63, -1000, 18, 129, 33, 29, -1000, -1000, 537, -1000,
-	-1000, 537, 537, 129, 33, 27, 33, -1000, 170, -1000,
-	560, 20, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, 165, 163,
-	33, -1000, -1000, 60, -1000, -1000, -1000, -1000, 537, -1000,
-	-1000, 141, -1000, 537, -1000, 39, 39, -1000, -1000, 183,
-	181, 180, 179, 514, 159, 65, -1000, 348, 115, -35,
-	-35, -35, 487, -1000, -1000, 178, -1000, 127, -1000, -22,
-	348, -1000, -1000, -1000, -1000, -1000, -1000, -1000, 3, 123,
-	244, -1000, -1000, 243, 229, 228, -14, -15, 284, 464,
-	81, 26, -1000, -1000, -1000, -1000, 437, 86, -1000, -1000,
-	-1000, -1000, 537, 537, 227, 153, -1000, -1000, 252, 40,
-	-1000, -1000, -1000, -1000, -1000, -1000, 79, 90, 214, 97,
-	145, 56, 122, 33, -1000, -1000, -1000, 316, 168, -1000,
-	-1000, -1000, 102, 247, 76, 152, 149, -1000, -1000, -1000,
-	53, 52, -1000, -1000, 213, -1000, 68, 33, 148, 144,
-	220, -1000, 32, -1000, 316, -1000, 143, -1000, -1000, 39,
-	-1000, 212, -1000, -1000, 50, -1000, 116, 134, -1000, 188,
-	211, -1000, -1000, 246, -1000, -1000, -1000, 41, 39, 98,
-	-1000, -1000, 202, -1000, -1000, 414, 200, -1000, 316, 6,
-	-1000, 177, 176, 175, 171, 77, -1000, -1000, 387, -1000,
-	-1000, -1000, -1000, 197, 8, 5, 13, 45, -1000, -1000,
-	196, -1000, 195, 189, 186, 185, -1000, -1000, -1000, -1000,
-	-1000,
+	52, -1000, 19, 118, 98, 37, -1000, -1000, 606, -1000,
+	-1000, 606, 606, 118, 98, 34, 98, -1000, 161, -1000,
+	631, 21, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	160, 159, 98, -1000, -1000, 73, -1000, -1000, -1000, -1000,
+	606, -1000, -1000, 107, -1000, 606, -1000, 51, 51, -1000,
+	-1000, 182, 181, 180, 179, 581, 158, 79, -1000, 373,
+	92, -36, -36, -36, 552, -1000, -1000, 178, -1000, 138,
+	-1000, -23, 373, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	5, 139, 212, -1000, -1000, 211, 210, 206, -15, -16,
+	305, 527, 108, 28, -1000, -1000, -1000, -1000, 498, 122,
+	-1000, -1000, -1000, -1000, 606, 606, 204, 154, -1000, -1000,
+	271, 46, -1000, -1000, -1000, -1000, -1000, -1000, 99, 101,
+	202, 408, 163, 60, 125, 98, -1000, -1000, -1000, 339,
+	156, -1000, -1000, -1000, 137, 229, 83, 151, 150, -1000,
+	-1000, -1000, 59, 56, -1000, -1000, 201, -1000, 81, 98,
+	148, 142, 237, -1000, 45, -1000, 339, -1000, 147, -1000,
+	-1000, 51, -1000, 200, -1000, -1000, 55, -1000, 134, 145,
+	-1000, 203, 199, -1000, -1000, 228, -1000, -1000, -1000, 91,
+	51, 85, -1000, -1000, 198, -1000, -1000, 467, 197, -1000,
+	339, 7, -1000, 176, 174, 173, 171, 170, 169, 167,
+	82, -1000, -1000, 438, -1000, -1000, -1000, -1000, 196, 14,
+	12, 17, 9, 38, 38, 58, -1000, -1000, 193, -1000,
+	192, 191, 189, 188, 187, 185, 184, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000,
 }
 var mmPgo = [...]int{
 
-	0, 364, 0, 287, 16, 7, 363, 4, 360, 10,
-	160, 359, 351, 316, 350, 349, 348, 334, 333, 332,
-	6, 3, 328, 318, 2, 1, 317, 17, 8, 302,
-	11, 300, 286, 285, 5, 284, 270, 269, 268, 197,
+	0, 351, 1, 226, 17, 8, 340, 5, 339, 11,
+	155, 338, 337, 269, 323, 321, 317, 306, 305, 304,
+	7, 4, 303, 289, 3, 2, 0, 18, 9, 288,
+	12, 287, 271, 270, 6, 255, 254, 253, 238, 212,
 }
 var mmR1 = [...]int{
 
 	0, 39, 39, 39, 39, 39, 39, 1, 1, 13,
 	13, 10, 10, 10, 12, 11, 37, 37, 38, 38,
-	38, 38, 38, 17, 17, 16, 16, 3, 3, 9,
-	9, 20, 20, 14, 14, 21, 21, 15, 15, 15,
-	15, 15, 15, 23, 5, 7, 4, 4, 4, 4,
-	4, 4, 4, 6, 6, 6, 22, 22, 22, 36,
-	19, 19, 18, 18, 31, 31, 30, 30, 30, 8,
-	8, 8, 8, 35, 35, 33, 33, 33, 33, 34,
-	34, 32, 32, 32, 28, 28, 29, 29, 24, 24,
-	26, 26, 26, 26, 26, 26, 26, 26, 26, 26,
-	26, 27, 27, 25, 25, 25, 2, 2, 2, 2,
+	38, 38, 38, 38, 38, 38, 17, 17, 16, 16,
+	3, 3, 9, 9, 20, 20, 14, 14, 21, 21,
+	15, 15, 15, 15, 15, 15, 23, 5, 7, 4,
+	4, 4, 4, 4, 4, 4, 6, 6, 6, 22,
+	22, 22, 36, 19, 19, 18, 18, 31, 31, 30,
+	30, 30, 8, 8, 8, 8, 35, 35, 33, 33,
+	33, 33, 34, 34, 32, 32, 32, 28, 28, 29,
+	29, 24, 24, 26, 26, 26, 26, 26, 26, 26,
+	26, 26, 26, 26, 27, 27, 25, 25, 25, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
-	2,
+	2, 2, 2, 2, 2, 2,
 }
 var mmR2 = [...]int{
 
 	0, 2, 3, 2, 1, 2, 1, 3, 2, 2,
 	1, 3, 1, 1, 11, 10, 0, 4, 0, 5,
-	5, 5, 5, 0, 4, 0, 3, 3, 1, 0,
-	3, 0, 2, 6, 5, 0, 2, 4, 5, 6,
-	5, 6, 7, 4, 1, 1, 1, 1, 1, 1,
-	1, 1, 1, 1, 1, 1, 0, 6, 5, 4,
-	0, 4, 0, 3, 2, 1, 6, 8, 5, 0,
-	2, 2, 2, 0, 2, 4, 4, 4, 4, 0,
-	2, 4, 8, 7, 3, 1, 5, 3, 1, 1,
-	3, 4, 2, 2, 3, 4, 1, 1, 1, 1,
-	1, 1, 1, 3, 1, 3, 1, 1, 1, 1,
+	5, 5, 5, 5, 5, 5, 0, 4, 0, 3,
+	3, 1, 0, 3, 0, 2, 6, 5, 0, 2,
+	4, 5, 6, 5, 6, 7, 4, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 0,
+	6, 5, 4, 0, 4, 0, 3, 2, 1, 6,
+	8, 5, 0, 2, 2, 2, 0, 2, 4, 4,
+	4, 4, 0, 2, 4, 8, 7, 3, 1, 5,
+	3, 1, 1, 3, 4, 2, 2, 3, 4, 1,
+	1, 1, 1, 1, 1, 1, 3, 1, 3, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-	1,
+	1, 1, 1, 1, 1, 1,
 }
 var mmChk = [...]int{
 
-	-1000, -39, -1, -13, -30, 57, -10, 23, 20, -11,
-	-12, 21, 22, -13, -30, 57, -30, -10, 25, 40,
-	-8, -3, -2, 39, 46, 30, 45, 20, 27, 37,
-	28, 26, 38, 24, 31, 36, 25, 29, -2, -2,
-	-30, 40, 13, -2, 27, 28, 29, 7, 43, 13,
-	13, -35, 13, 35, -2, -20, -20, 14, -33, 27,
-	28, 29, 30, -34, -2, -21, -14, 32, -21, 10,
-	10, 10, 10, 14, -32, -2, 13, -23, -15, 34,
-	33, -4, 48, 49, 51, 50, 52, 47, -3, 14,
-	-27, 53, 54, -27, -27, -25, -2, 19, 10, -34,
-	14, -6, 44, 45, 46, -4, -9, 15, 9, 9,
-	9, 9, 43, 43, -24, 17, -26, -25, 11, 15,
-	41, 42, 40, -27, 55, 14, -22, 24, 40, -9,
-	11, -2, -31, -30, -2, -2, 9, 13, -28, 12,
-	-24, 16, -29, 40, -37, 25, 25, 13, 9, 9,
-	-5, -2, 40, 12, -5, 9, -36, -30, 18, -28,
-	9, 12, 9, 16, 8, -17, 26, 13, 13, -20,
-	9, -7, 40, 9, -5, 9, -19, 26, 13, 9,
-	14, -24, 12, 40, 16, -24, 13, -38, -20, -21,
-	9, 9, -7, 16, 13, -34, 14, 9, 8, -16,
-	14, 36, 37, 38, 29, -21, 14, 9, -18, 14,
-	9, -24, 14, -2, 10, 10, 10, 10, 14, 14,
-	-25, 9, 42, 42, 40, 31, 9, 9, 9, 9,
-	9,
+	-1000, -39, -1, -13, -30, 59, -10, 23, 20, -11,
+	-12, 21, 22, -13, -30, 59, -30, -10, 25, 42,
+	-8, -3, -2, 41, 48, 39, 30, 40, 47, 20,
+	27, 37, 28, 26, 38, 24, 31, 36, 25, 29,
+	-2, -2, -30, 42, 13, -2, 27, 28, 29, 7,
+	45, 13, 13, -35, 13, 35, -2, -20, -20, 14,
+	-33, 27, 28, 29, 30, -34, -2, -21, -14, 32,
+	-21, 10, 10, 10, 10, 14, -32, -2, 13, -23,
+	-15, 34, 33, -4, 50, 51, 53, 52, 54, 49,
+	-3, 14, -27, 55, 56, -27, -27, -25, -2, 19,
+	10, -34, 14, -6, 46, 47, 48, -4, -9, 15,
+	9, 9, 9, 9, 45, 45, -24, 17, -26, -25,
+	11, 15, 43, 44, 42, -27, 57, 14, -22, 24,
+	42, -9, 11, -2, -31, -30, -2, -2, 9, 13,
+	-28, 12, -24, 16, -29, 42, -37, 25, 25, 13,
+	9, 9, -5, -2, 42, 12, -5, 9, -36, -30,
+	18, -28, 9, 12, 9, 16, 8, -17, 26, 13,
+	13, -20, 9, -7, 42, 9, -5, 9, -19, 26,
+	13, 9, 14, -24, 12, 42, 16, -24, 13, -38,
+	-20, -21, 9, 9, -7, 16, 13, -34, 14, 9,
+	8, -16, 14, 36, 37, 38, 39, 40, 53, 29,
+	-21, 14, 9, -18, 14, 9, -24, 14, -2, 10,
+	10, 10, 10, 10, 10, 10, 14, 14, -25, 9,
+	44, 44, 42, 42, -26, -26, 31, 9, 9, 9,
+	9, 9, 9, 9, 9,
 }
 var mmDef = [...]int{
 
-	0, -2, 0, 4, 6, 0, 10, 69, 0, 12,
+	0, -2, 0, 4, 6, 0, 10, 72, 0, 12,
 	13, 0, 0, 1, 3, 0, 5, 9, 0, 8,
-	0, 0, 28, 106, 107, 108, 109, 110, 111, 112,
-	113, 114, 115, 116, 117, 118, 119, 120, 0, 0,
-	2, 7, 73, 0, -2, -2, -2, 11, 0, 31,
-	31, 0, 79, 0, 27, 35, 35, 68, 74, 0,
-	0, 0, 0, 0, 0, 0, 32, 0, 0, 0,
-	0, 0, 0, 66, 80, 0, 79, 0, 36, 0,
-	0, 29, 46, 47, 48, 49, 50, 51, 52, 0,
-	0, 101, 102, 0, 0, 0, 104, 0, 0, 0,
-	56, 0, 53, 54, 55, 29, 0, 0, 75, 76,
-	77, 78, 0, 0, 0, 0, 88, 89, 0, 0,
-	96, 97, 98, 99, 100, 67, 16, 0, 0, 0,
-	0, 0, 0, 65, 103, 105, 81, 0, 0, 92,
-	85, 93, 0, 0, 23, 0, 0, 31, 43, 37,
-	0, 0, 44, 30, 0, 34, 60, 64, 0, 0,
-	0, 90, 0, 94, 0, 15, 0, 18, 31, 35,
-	38, 0, 45, 40, 0, 33, 0, 0, 79, 0,
-	0, 84, 91, 0, 95, 87, 25, 0, 35, 0,
-	39, 41, 0, 14, 62, 0, 0, 83, 0, 0,
-	17, 0, 0, 0, 0, 0, 58, 42, 0, 59,
-	82, 86, 24, 0, 0, 0, 0, 0, 57, 61,
-	0, 26, 0, 0, 0, 0, 63, 19, 20, 21,
-	22,
+	0, 0, 31, 109, 110, 111, 112, 113, 114, 115,
+	116, 117, 118, 119, 120, 121, 122, 123, 124, 125,
+	0, 0, 2, 7, 76, 0, -2, -2, -2, 11,
+	0, 34, 34, 0, 82, 0, 30, 38, 38, 71,
+	77, 0, 0, 0, 0, 0, 0, 0, 35, 0,
+	0, 0, 0, 0, 0, 69, 83, 0, 82, 0,
+	39, 0, 0, 32, 49, 50, 51, 52, 53, 54,
+	55, 0, 0, 104, 105, 0, 0, 0, 107, 0,
+	0, 0, 59, 0, 56, 57, 58, 32, 0, 0,
+	78, 79, 80, 81, 0, 0, 0, 0, 91, 92,
+	0, 0, 99, 100, 101, 102, 103, 70, 16, 0,
+	0, 0, 0, 0, 0, 68, 106, 108, 84, 0,
+	0, 95, 88, 96, 0, 0, 26, 0, 0, 34,
+	46, 40, 0, 0, 47, 33, 0, 37, 63, 67,
+	0, 0, 0, 93, 0, 97, 0, 15, 0, 18,
+	34, 38, 41, 0, 48, 43, 0, 36, 0, 0,
+	82, 0, 0, 87, 94, 0, 98, 90, 28, 0,
+	38, 0, 42, 44, 0, 14, 65, 0, 0, 86,
+	0, 0, 17, 0, 0, 0, 0, 0, 0, 0,
+	0, 61, 45, 0, 62, 85, 89, 27, 0, 0,
+	0, 0, 0, 0, 0, 0, 60, 64, 0, 29,
+	0, 0, 0, 0, 0, 0, 0, 66, 19, 20,
+	21, 22, 23, 24, 25,
 }
 var mmTok1 = [...]int{
 
@@ -393,7 +407,7 @@ var mmTok2 = [...]int{
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
 	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
-	52, 53, 54, 55, 56, 57,
+	52, 53, 54, 55, 56, 57, 58, 59,
 }
 var mmTok3 = [...]int{
 	0,
@@ -943,6 +957,39 @@ mmdefault:
 	case 22:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
 		//line grammar.y:229
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
+				mmDollar[1].res.ContainerNode = &n
+				mmDollar[1].res.Container = mmDollar[4].intern.unquote(mmDollar[4].val)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 23:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:236
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
+				mmDollar[1].res.EnvNode = &n
+				mmDollar[1].res.Env = mmDollar[4].vexp
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 24:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:243
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
+				mmDollar[1].res.PathNode = &n
+				mmDollar[1].res.Path = mmDollar[4].vexp
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 25:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+		//line grammar.y:250
 		{
 			{
 				n := NewAstNode(mmDollar[2].loc, mmDollar[2].srcfile)
@@ -951,17 +998,17 @@ mmdefault:
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 23:
+	case 26:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:239
+		//line grammar.y:260
 		{
 			{
 				mmVAL.stretains = nil
 			}
 		}
-	case 24:
+	case 27:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:241
+		//line grammar.y:262
 		{
 			{
 				mmVAL.stretains = &RetainParams{
@@ -970,17 +1017,17 @@ mmdefault:
 				}
 			}
 		}
-	case 25:
+	case 28:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:251
+		//line grammar.y:272
 		{
 			{
 				mmVAL.retains = nil
 			}
 		}
-	case 26:
+	case 29:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:253
+		//line grammar.y:274
 		{
 			{
 				mmVAL.retains = append(mmDollar[1].retains, &RetainParam{
@@ -989,18 +1036,18 @@ mmdefault:
 				})
 			}
 		}
-	case 27:
+	case 30:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:264
+		//line grammar.y:285
 		{
 			{
 				idd := append(mmDollar[1].val, '.')
 				mmVAL.val = append(idd, mmDollar[3].val...)
 			}
 		}
-	case 28:
+	case 31:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:269
+		//line grammar.y:290
 		{
 			{
 				// set capacity == length so append doesn't overwrite
@@ -1008,42 +1055,42 @@ mmdefault:
 				mmVAL.val = mmDollar[1].val[:len(mmDollar[1].val):len(mmDollar[1].val)]
 			}
 		}
-	case 29:
+	case 32:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:278
+		//line grammar.y:299
 		{
 			{
 				mmVAL.arr = 0
 			}
 		}
-	case 30:
+	case 33:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:280
+		//line grammar.y:301
 		{
 			{
 				mmVAL.arr++
 			}
 		}
-	case 31:
+	case 34:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:285
+		//line grammar.y:306
 		{
 			{
 				mmVAL.i_params = &InParams{Table: make(map[string]*InParam)}
 			}
 		}
-	case 32:
+	case 35:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:287
+		//line grammar.y:308
 		{
 			{
 				mmDollar[1].i_params.List = append(mmDollar[1].i_params.List, mmDollar[2].inparam)
 				mmVAL.i_params = mmDollar[1].i_params
 			}
 		}
-	case 33:
+	case 36:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:295
+		//line grammar.y:316
 		{
 			{
 				mmVAL.inparam = &InParam{
@@ -1055,9 +1102,9 @@ mmdefault:
 				}
 			}
 		}
-	case 34:
+	case 37:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:303
+		//line grammar.y:324
 		{
 			{
 				mmVAL.inparam = &InParam{
@@ -1068,26 +1115,26 @@ mmdefault:
 				}
 			}
 		}
-	case 35:
+	case 38:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:313
+		//line grammar.y:334
 		{
 			{
 				mmVAL.o_params = &OutParams{Table: make(map[string]*OutParam)}
 			}
 		}
-	case 36:
+	case 39:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:315
+		//line grammar.y:336
 		{
 			{
 				mmDollar[1].o_params.List = append(mmDollar[1].o_params.List, mmDollar[2].outparam)
 				mmVAL.o_params = mmDollar[1].o_params
 			}
 		}
-	case 37:
+	case 40:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:323
+		//line grammar.y:344
 		{
 			{
 				mmVAL.outparam = &OutParam{
@@ -1098,9 +1145,9 @@ mmdefault:
 				}
 			}
 		}
-	case 38:
+	case 41:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:330
+		//line grammar.y:351
 		{
 			{
 				mmVAL.outparam = &OutParam{
@@ -1112,9 +1159,9 @@ mmdefault:
 				}
 			}
 		}
-	case 39:
+	case 42:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:338
+		//line grammar.y:359
 		{
 			{
 				mmVAL.outparam = &OutParam{
@@ -1127,9 +1174,9 @@ mmdefault:
 				}
 			}
 		}
-	case 40:
+	case 43:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:347
+		//line grammar.y:368
 		{
 			{
 				mmVAL.outparam = &OutParam{
@@ -1140,9 +1187,9 @@ mmdefault:
 				}
 			}
 		}
-	case 41:
+	case 44:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:354
+		//line grammar.y:375
 		{
 			{
 				mmVAL.outparam = &OutParam{
@@ -1154,9 +1201,9 @@ mmdefault:
 				}
 			}
 		}
-	case 42:
+	case 45:
 		mmDollar = mmS[mmpt-7 : mmpt+1]
-		//line grammar.y:362
+		//line grammar.y:383
 		{
 			{
 				mmVAL.outparam = &OutParam{
@@ -1169,9 +1216,9 @@ mmdefault:
 				}
 			}
 		}
-	case 43:
+	case 46:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:374
+		//line grammar.y:395
 		{
 			{
 				stagecodeParts := strings.Split(mmDollar[3].intern.unquote(mmDollar[3].val), " ")
@@ -1183,9 +1230,9 @@ mmdefault:
 				}
 			}
 		}
-	case 56:
+	case 59:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:409
+		//line grammar.y:430
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{
@@ -1195,9 +1242,9 @@ mmdefault:
 				}
 			}
 		}
-	case 57:
+	case 60:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:417
+		//line grammar.y:438
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{
@@ -1207,9 +1254,9 @@ mmdefault:
 				}
 			}
 		}
-	case 58:
+	case 61:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:423
+		//line grammar.y:444
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{
@@ -1219,9 +1266,9 @@ mmdefault:
 				}
 			}
 		}
-	case 59:
+	case 62:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:432
+		//line grammar.y:453
 		{
 			{
 				mmVAL.retstm = &ReturnStm{
@@ -1230,17 +1277,17 @@ mmdefault:
 				}
 			}
 		}
-	case 60:
+	case 63:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:440
+		//line grammar.y:461
 		{
 			{
 				mmVAL.plretains = nil
 			}
 		}
-	case 61:
+	case 64:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:442
+		//line grammar.y:463
 		{
 			{
 				mmVAL.plretains = &PipelineRetains{
@@ -1249,41 +1296,41 @@ mmdefault:
 				}
 			}
 		}
-	case 62:
+	case 65:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:449
+		//line grammar.y:470
 		{
 			{
 				mmVAL.reflist = nil
 			}
 		}
-	case 63:
+	case 66:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:451
+		//line grammar.y:472
 		{
 			{
 				mmVAL.reflist = append(mmDollar[1].reflist, mmDollar[2].rexp)
 			}
 		}
-	case 64:
+	case 67:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:455
+		//line grammar.y:476
 		{
 			{
 				mmVAL.calls = append(mmDollar[1].calls, mmDollar[2].call)
 			}
 		}
-	case 65:
+	case 68:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:457
+		//line grammar.y:478
 		{
 			{
 				mmVAL.calls = []*CallStm{mmDollar[1].call}
 			}
 		}
-	case 66:
+	case 69:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line grammar.y:462
+		//line grammar.y:483
 		{
 			{
 				id := mmDollar[3].intern.Get(mmDollar[3].val)
@@ -1296,9 +1343,9 @@ mmdefault:
 				}
 			}
 		}
-	case 67:
+	case 70:
 		mmDollar = mmS[mmpt-8 : mmpt+1]
-		//line grammar.y:471
+		//line grammar.y:492
 		{
 			{
 				mmVAL.call = &CallStm{
@@ -1310,50 +1357,50 @@ mmdefault:
 				}
 			}
 		}
-	case 68:
+	case 71:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:479
+		//line grammar.y:500
 		{
 			{
 				mmDollar[1].call.Modifiers.Bindings = mmDollar[4].bindings
 				mmVAL.call = mmDollar[1].call
 			}
 		}
-	case 69:
+	case 72:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:487
+		//line grammar.y:508
 		{
 			{
 				mmVAL.modifiers = new(Modifiers)
 			}
 		}
-	case 70:
+	case 73:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:489
+		//line grammar.y:510
 		{
 			{
 				mmVAL.modifiers.Local = true
 			}
 		}
-	case 71:
+	case 74:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:491
+		//line grammar.y:512
 		{
 			{
 				mmVAL.modifiers.Preflight = true
 			}
 		}
-	case 72:
+	case 75:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:493
+		//line grammar.y:514
 		{
 			{
 				mmVAL.modifiers.Volatile = true
 			}
 		}
-	case 73:
+	case 76:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:498
+		//line grammar.y:519
 		{
 			{
 				mmVAL.bindings = &BindStms{
@@ -1362,18 +1409,18 @@ mmdefault:
 				}
 			}
 		}
-	case 74:
+	case 77:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:503
+		//line grammar.y:524
 		{
 			{
 				mmDollar[1].bindings.List = append(mmDollar[1].bindings.List, mmDollar[2].binding)
 				mmVAL.bindings = mmDollar[1].bindings
 			}
 		}
-	case 75:
+	case 78:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:511
+		//line grammar.y:532
 		{
 			{
 				mmVAL.binding = &BindStm{
@@ -1383,9 +1430,9 @@ mmdefault:
 				}
 			}
 		}
-	case 76:
+	case 79:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:517
+		//line grammar.y:538
 		{
 			{
 				mmVAL.binding = &BindStm{
@@ -1395,9 +1442,9 @@ mmdefault:
 				}
 			}
 		}
-	case 77:
+	case 80:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:523
+		//line grammar.y:544
 		{
 			{
 				mmVAL.binding = &BindStm{
@@ -1407,9 +1454,9 @@ mmdefault:
 				}
 			}
 		}
-	case 78:
+	case 81:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:529
+		//line grammar.y:550
 		{
 			{
 				mmVAL.binding = &BindStm{
@@ -1419,9 +1466,9 @@ mmdefault:
 				}
 			}
 		}
-	case 79:
+	case 82:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line grammar.y:537
+		//line grammar.y:558
 		{
 			{
 				mmVAL.bindings = &BindStms{
@@ -1430,18 +1477,18 @@ mmdefault:
 				}
 			}
 		}
-	case 80:
+	case 83:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:542
+		//line grammar.y:563
 		{
 			{
 				mmDollar[1].bindings.List = append(mmDollar[1].bindings.List, mmDollar[2].binding)
 				mmVAL.bindings = mmDollar[1].bindings
 			}
 		}
-	case 81:
+	case 84:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:550
+		//line grammar.y:571
 		{
 			{
 				mmVAL.binding = &BindStm{
@@ -1451,9 +1498,9 @@ mmdefault:
 				}
 			}
 		}
-	case 82:
+	case 85:
 		mmDollar = mmS[mmpt-8 : mmpt+1]
-		//line grammar.y:556
+		//line grammar.y:577
 		{
 			{
 				mmVAL.binding = &BindStm{
@@ -1468,9 +1515,9 @@ mmdefault:
 				}
 			}
 		}
-	case 83:
+	case 86:
 		mmDollar = mmS[mmpt-7 : mmpt+1]
-		//line grammar.y:567
+		//line grammar.y:588
 		{
 			{
 				mmVAL.binding = &BindStm{
@@ -1485,58 +1532,58 @@ mmdefault:
 				}
 			}
 		}
-	case 84:
+	case 87:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:581
+		//line grammar.y:602
 		{
 			{
 				mmVAL.exps = append(mmDollar[1].exps, mmDollar[3].exp)
 			}
 		}
-	case 85:
+	case 88:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:583
+		//line grammar.y:604
 		{
 			{
 				mmVAL.exps = []Exp{mmDollar[1].exp}
 			}
 		}
-	case 86:
+	case 89:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line grammar.y:588
+		//line grammar.y:609
 		{
 			{
 				mmDollar[1].kvpairs[unquote(mmDollar[3].val)] = mmDollar[5].exp
 				mmVAL.kvpairs = mmDollar[1].kvpairs
 			}
 		}
-	case 87:
+	case 90:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:593
+		//line grammar.y:614
 		{
 			{
 				mmVAL.kvpairs = map[string]Exp{unquote(mmDollar[1].val): mmDollar[3].exp}
 			}
 		}
-	case 88:
+	case 91:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:598
+		//line grammar.y:619
 		{
 			{
 				mmVAL.exp = mmDollar[1].vexp
 			}
 		}
-	case 89:
+	case 92:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:600
+		//line grammar.y:621
 		{
 			{
 				mmVAL.exp = mmDollar[1].rexp
 			}
 		}
-	case 90:
+	case 93:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:604
+		//line grammar.y:625
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1546,9 +1593,9 @@ mmdefault:
 				}
 			}
 		}
-	case 91:
+	case 94:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:610
+		//line grammar.y:631
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1558,9 +1605,9 @@ mmdefault:
 				}
 			}
 		}
-	case 92:
+	case 95:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:616
+		//line grammar.y:637
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1570,9 +1617,9 @@ mmdefault:
 				}
 			}
 		}
-	case 93:
+	case 96:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line grammar.y:622
+		//line grammar.y:643
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1582,9 +1629,9 @@ mmdefault:
 				}
 			}
 		}
-	case 94:
+	case 97:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:628
+		//line grammar.y:649
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1594,9 +1641,9 @@ mmdefault:
 				}
 			}
 		}
-	case 95:
+	case 98:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line grammar.y:634
+		//line grammar.y:655
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1606,9 +1653,9 @@ mmdefault:
 				}
 			}
 		}
-	case 96:
+	case 99:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:640
+		//line grammar.y:661
 		{
 			{ // Lexer guarantees parseable float strings.
 				f := parseFloat(mmDollar[1].val)
@@ -1619,9 +1666,9 @@ mmdefault:
 				}
 			}
 		}
-	case 97:
+	case 100:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:649
+		//line grammar.y:670
 		{
 			{ // Lexer guarantees parseable int strings.
 				i := parseInt(mmDollar[1].val)
@@ -1632,9 +1679,9 @@ mmdefault:
 				}
 			}
 		}
-	case 98:
+	case 101:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:658
+		//line grammar.y:679
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1644,9 +1691,9 @@ mmdefault:
 				}
 			}
 		}
-	case 100:
+	case 103:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:665
+		//line grammar.y:686
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1655,9 +1702,9 @@ mmdefault:
 				}
 			}
 		}
-	case 101:
+	case 104:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:673
+		//line grammar.y:694
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1667,9 +1714,9 @@ mmdefault:
 				}
 			}
 		}
-	case 102:
+	case 105:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:679
+		//line grammar.y:700
 		{
 			{
 				mmVAL.vexp = &ValExp{
@@ -1679,9 +1726,9 @@ mmdefault:
 				}
 			}
 		}
-	case 103:
+	case 106:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:687
+		//line grammar.y:708
 		{
 			{
 				mmVAL.rexp = &RefExp{
@@ -1692,9 +1739,9 @@ mmdefault:
 				}
 			}
 		}
-	case 104:
+	case 107:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line grammar.y:694
+		//line grammar.y:715
 		{
 			{
 				mmVAL.rexp = &RefExp{
@@ -1705,9 +1752,9 @@ mmdefault:
 				}
 			}
 		}
-	case 105:
+	case 108:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line grammar.y:701
+		//line grammar.y:722
 		{
 			{
 				mmVAL.rexp = &RefExp{
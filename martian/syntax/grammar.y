@@ -82,7 +82,7 @@ import (
 %token <val> FILETYPE STAGE PIPELINE CALL SPLIT USING RETAIN
 %token <val> LOCAL PREFLIGHT VOLATILE DISABLED STRICT
 %token IN OUT SRC AS
-%token <val> THREADS MEM_GB SPECIAL
+%token <val> THREADS MEM_GB SPECIAL CONTAINER ENV
 %token <val> ID LITSTRING NUM_FLOAT NUM_INT DOT
 %token <val> PY EXEC COMPILED
 %token <val> MAP INT STRING FLOAT PATH BOOL TRUE FALSE NULL DEFAULT
@@ -225,6 +225,27 @@ resource_list
             $1.Special = $<intern>4.unquote($4)
             $$ = $1
         }}
+    | resource_list CONTAINER EQUALS LITSTRING COMMA
+        {{
+            n := NewAstNode($<loc>2, $<srcfile>2)
+            $1.ContainerNode = &n
+            $1.Container = $<intern>4.unquote($4)
+            $$ = $1
+        }}
+    | resource_list ENV EQUALS val_exp COMMA
+        {{
+            n := NewAstNode($<loc>2, $<srcfile>2)
+            $1.EnvNode = &n
+            $1.Env = $4
+            $$ = $1
+        }}
+    | resource_list PATH EQUALS val_exp COMMA
+        {{
+            n := NewAstNode($<loc>2, $<srcfile>2)
+            $1.PathNode = &n
+            $1.Path = $4
+            $$ = $1
+        }}
     | resource_list VOLATILE EQUALS STRICT COMMA
         {{
             n := NewAstNode($<loc>2, $<srcfile>2)
@@ -708,7 +729,9 @@ ref_exp
 id
     : ID
     | COMPILED
+    | CONTAINER
     | DISABLED
+    | ENV
     | EXEC
     | FILETYPE
     | LOCAL
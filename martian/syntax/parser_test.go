@@ -7,7 +7,9 @@
 package syntax
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -780,6 +782,62 @@ stage SUM_SQUARES(
 	}
 }
 
+func TestResourcesEnv(t *testing.T) {
+	t.Parallel()
+	if ast := testGood(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    env = {
+        "NUMPY_VERSION": "1.14",
+        "OMP_NUM_THREADS": "2",
+    },
+    path = ["/opt/numpy/bin"],
+)
+`); ast != nil {
+		if len(ast.Stages) != 1 {
+			t.Fatalf("Incorrect stage count %d", len(ast.Stages))
+		} else if res := ast.Stages[0].Resources; res == nil {
+			t.Fatal("No resources.")
+		} else {
+			if env := res.EnvVars(); len(env) != 2 ||
+				env["NUMPY_VERSION"] != "1.14" ||
+				env["OMP_NUM_THREADS"] != "2" {
+				t.Errorf("Incorrect env %v", env)
+			}
+			if p := res.PathPrefix(); len(p) != 1 || p[0] != "/opt/numpy/bin" {
+				t.Errorf("Incorrect path %v", p)
+			}
+		}
+	}
+}
+
+func TestBadResourcesEnv(t *testing.T) {
+	t.Parallel()
+	testBadCompile(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    env = {
+        "OMP_NUM_THREADS": 2,
+    },
+)
+`)
+	testBadCompile(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    path = "/opt/numpy/bin",
+)
+`)
+}
+
 func TestStrictVolatile(t *testing.T) {
 	t.Parallel()
 	if ast := testGood(t, `
@@ -1559,3 +1617,99 @@ func BenchmarkParseAndCompile(b *testing.B) {
 		}
 	}
 }
+
+const secretSrc = `
+stage UPLOAD(
+    in  file     data,
+    in  secret   token,
+    in  secret[] keys,
+    src py       "stages/upload",
+)
+
+pipeline UPLOAD_ALL(
+    in  secret token,
+    in  file   data,
+)
+{
+    call UPLOAD(
+        data  = self.data,
+        token = self.token,
+        keys  = ["key-1", "key-2"],
+    )
+
+    return ()
+}
+
+call UPLOAD_ALL(
+    token = "%s",
+    data  = "/data/x.txt",
+)
+`
+
+func TestSecret(t *testing.T) {
+	t.Parallel()
+	ast := testGood(t, fmt.Sprintf(secretSrc, "hunter2"))
+	if ast == nil {
+		return
+	}
+	src := fmt.Sprintf(secretSrc, "hunter2")
+	redacted, err := ast.RedactSecrets([]byte(src), "secret.mro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "key-1", "key-2"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("Expected %s to be redacted:\n%s", secret, redacted)
+		}
+	}
+	if !strings.Contains(redacted, "/data/x.txt") {
+		t.Errorf("Expected other values to be kept:\n%s", redacted)
+	}
+	if other := testGood(t, redacted); other == nil {
+		return
+	} else if !ast.EquivalentCall(other) {
+		t.Error("Expected calls differing only by secret values to be equivalent.")
+	} else if again, err := other.RedactSecrets([]byte(redacted),
+		"secret.mro"); err != nil {
+		t.Error(err)
+	} else if again != redacted {
+		t.Errorf("Expected redacting again to be stable, got\n%s", again)
+	}
+}
+
+func TestBadSecret(t *testing.T) {
+	t.Parallel()
+	// Secrets cannot be passed to string parameters.
+	testBadCompile(t, `
+stage SHOW(
+    in  string token,
+    src py     "stages/show",
+)
+
+pipeline LEAK(
+    in  secret token,
+)
+{
+    call SHOW(
+        token = self.token,
+    )
+
+    return ()
+}
+`)
+	// Nor can they be outputs.
+	testBadCompile(t, `
+stage MAKE_TOKEN(
+    out secret token,
+    src py     "stages/make_token",
+)
+`)
+	testBadCompile(t, `
+stage SPLIT_TOKEN(
+    in  int    count,
+    src py     "stages/split_token",
+) split (
+    in  secret token,
+)
+`)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Removing the values of secret parameters from source.
+
+package syntax
+
+import (
+	"path/filepath"
+)
+
+// The text which replaces the values of secret parameters.
+const Redacted = "<redacted>"
+
+// Identifies a binding by the pipeline containing the call, which is empty
+// for the top-level call, the call, and the bound parameter.
+type bindingKey struct {
+	pipeline, call, param string
+}
+
+// RedactSecrets returns the given source, with any literal values bound to
+// secret parameters replaced by Redacted, so that it can be recorded.  The
+// AST, which must have been compiled, determines which parameters are
+// secret.  The source must be the source the AST was compiled from, or a
+// part of it, such as the invocation file.  Includes are not followed.
+//
+// If no literal values are bound to secret parameters, the source is
+// returned unmodified.  Otherwise it is reformatted.
+func (ast *Ast) RedactSecrets(src []byte, filename string) (string, error) {
+	secret := make(map[bindingKey]bool)
+	addCall := func(pipeline string, call *CallStm) {
+		if call == nil || call.Bindings == nil {
+			return
+		}
+		for _, binding := range call.Bindings.List {
+			if binding.Tname == KindSecret && isValExp(binding.Exp) {
+				secret[bindingKey{pipeline, call.Id, binding.Id}] = true
+			}
+		}
+	}
+	addCall("", ast.Call)
+	for _, pipeline := range ast.Pipelines {
+		for _, call := range pipeline.Calls {
+			addCall(pipeline.Id, call)
+		}
+	}
+	if len(secret) == 0 {
+		return string(src), nil
+	}
+
+	absPath, _ := filepath.Abs(filename)
+	parsed, err := yaccParse(src, &SourceFile{
+		FileName: filename,
+		FullPath: absPath,
+	}, makeStringIntern())
+	if err != nil {
+		return "", err
+	}
+	redactCall := func(pipeline string, call *CallStm) {
+		if call == nil || call.Bindings == nil {
+			return
+		}
+		for _, binding := range call.Bindings.List {
+			if secret[bindingKey{pipeline, call.Id, binding.Id}] {
+				binding.Exp = redactExp(binding.Exp)
+			}
+		}
+	}
+	redactCall("", parsed.Call)
+	for _, pipeline := range parsed.Pipelines {
+		for _, call := range pipeline.Calls {
+			redactCall(pipeline.Id, call)
+		}
+	}
+	return parsed.format(true), nil
+}
+
+// Replace the string literals in the given expression, including those in
+// arrays, with Redacted.
+func redactExp(exp Exp) Exp {
+	v, ok := exp.(*ValExp)
+	if !ok {
+		return exp
+	}
+	switch v.Kind {
+	case KindString:
+		return &ValExp{Node: v.Node, Kind: KindString, Value: Redacted}
+	case KindArray:
+		values := v.Value.([]Exp)
+		redacted := make([]Exp, len(values))
+		for i, e := range values {
+			redacted[i] = redactExp(e)
+		}
+		return &ValExp{Node: v.Node, Kind: KindArray, Value: redacted}
+	}
+	return exp
+}
@@ -45,6 +45,8 @@ var rules = [...]rule{
 	{regexp.MustCompile(`^threads\b`), THREADS},
 	{regexp.MustCompile(`^mem_?gb\b`), MEM_GB},
 	{regexp.MustCompile(`^special\b`), SPECIAL},
+	{regexp.MustCompile(`^container\b`), CONTAINER},
+	{regexp.MustCompile(`^env\b`), ENV},
 	{regexp.MustCompile(`^retain\b`), RETAIN},
 	{regexp.MustCompile(`^sweep\b`), SWEEP},
 	{regexp.MustCompile(`^split\b`), SPLIT},
@@ -30,6 +30,7 @@ var builtinTypes = [...]*BuiltinType{
 	{KindPath},
 	{KindFile},
 	{KindMap},
+	{KindSecret},
 }
 
 func (*UserType) getDec() {}
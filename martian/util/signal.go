@@ -23,6 +23,14 @@ type HandlerObject interface {
 	HandleSignal(sig os.Signal)
 }
 
+// Handler objects which also implement this interface are notified of
+// SIGHUP, instead of the process being terminated.  If any such object is
+// registered, SIGHUP is handled even if it was ignored when the process
+// started (for example by nohup).
+type ReloadHandlerObject interface {
+	HandleReload()
+}
+
 type SignalHandler struct {
 	criticalSection sync.RWMutex
 	mutex           sync.Mutex
@@ -58,6 +66,9 @@ func RegisterSignalHandler(object HandlerObject) {
 	signalHandler.mutex.Lock()
 	signalHandler.objects[object] = true
 	signalHandler.mutex.Unlock()
+	if _, ok := object.(ReloadHandlerObject); ok {
+		signal.Notify(signalHandler.sigchan, syscall.SIGHUP)
+	}
 }
 
 func UnregisterSignalHandler(object HandlerObject) {
@@ -74,6 +85,27 @@ func newSignalHandler() *SignalHandler {
 	}
 }
 
+// Notify registered reload handlers.  Returns false if there were none.
+func (self *SignalHandler) reload() bool {
+	self.mutex.Lock()
+	var handlers []ReloadHandlerObject
+	for object := range self.objects {
+		if h, ok := object.(ReloadHandlerObject); ok {
+			handlers = append(handlers, h)
+		}
+	}
+	self.mutex.Unlock()
+	if len(handlers) == 0 {
+		return false
+	}
+	Println("%s Caught signal %v, reloading configuration.",
+		Timestamp(), syscall.SIGHUP)
+	for _, h := range handlers {
+		h.HandleReload()
+	}
+	return true
+}
+
 // After a call to SetupSignalHandlers, these signals will be handled
 // by waiting for all pending critical sections to complete, running
 // all registered handlers, and then exiting with return code 1
@@ -97,15 +129,22 @@ func (self *SignalHandler) Notify() {
 // Kill this process cleanly, after waiting for critical sections
 // and handlers to complete.
 func Suicide(success bool) {
+	if success {
+		SuicideWithCode(0)
+	} else {
+		SuicideWithCode(1)
+	}
+}
+
+// Kill this process cleanly, like Suicide, exiting with the given status.
+func SuicideWithCode(code int) {
 	Println("%s Shutting down.", Timestamp())
 	if signalHandler == nil {
 		os.Exit(1)
 	}
-	if success {
-		signalHandler.sigchan <- syscall.Signal(-1)
-	} else {
-		signalHandler.sigchan <- syscall.Signal(-2)
-	}
+	// Exit requests are sent as negative signal numbers, which are never
+	// delivered by the OS.
+	signalHandler.sigchan <- syscall.Signal(-1 - code)
 }
 
 // Initializes the global signal handler.
@@ -116,7 +155,12 @@ func SetupSignalHandlers() {
 
 	go func() {
 		sig := <-sigchan
-		if sig != syscall.Signal(-1) && sig != syscall.Signal(-2) {
+		for sig == syscall.SIGHUP && signalHandler.reload() {
+			sig = <-sigchan
+		}
+		exit, requested := sig.(syscall.Signal)
+		requested = requested && exit < 0
+		if !requested {
 			Println("%s Caught signal %v", Timestamp(), sig)
 		}
 
@@ -126,8 +170,8 @@ func SetupSignalHandlers() {
 		for object := range signalHandler.objects {
 			object.HandleSignal(sig)
 		}
-		if sig == syscall.Signal(-1) {
-			os.Exit(0)
+		if requested {
+			os.Exit(-1 - int(exit))
 		} else {
 			os.Exit(1)
 		}
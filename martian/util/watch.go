@@ -0,0 +1,35 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Generic directory change notification.
+
+//go:build !linux
+// +build !linux
+
+package util
+
+import (
+	"errors"
+)
+
+// A DirWatcher signals when files are created in, written to, or moved into
+// any of a set of watched directories.
+type DirWatcher struct {
+	// C receives a value when a watched directory has changed since the last
+	// receive.  Changes are coalesced.
+	C <-chan struct{}
+}
+
+// NewDirWatcher returns an error on platforms without change notification.
+func NewDirWatcher() (*DirWatcher, error) {
+	return nil, errors.New("directory change notification is not supported on this platform")
+}
+
+// Watch sets the directories being watched.
+func (self *DirWatcher) Watch(dirs []string) error {
+	return nil
+}
+
+// Close stops watching.
+func (self *DirWatcher) Close() error {
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Linux directory change notification, using inotify.
+
+package util
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// A DirWatcher signals when files are created in, written to, or moved into
+// any of a set of watched directories.
+type DirWatcher struct {
+	// C receives a value when a watched directory has changed since the last
+	// receive.  Changes are coalesced.
+	C <-chan struct{}
+
+	c       chan struct{}
+	fd      int
+	file    *os.File
+	mutex   sync.Mutex
+	watches map[string]int
+}
+
+const dirWatchMask = unix.IN_CREATE | unix.IN_MOVED_TO |
+	unix.IN_CLOSE_WRITE | unix.IN_ONLYDIR
+
+// NewDirWatcher returns a watcher with no watched directories.
+func NewDirWatcher() (*DirWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	c := make(chan struct{}, 1)
+	self := &DirWatcher{
+		C:       c,
+		c:       c,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[string]int),
+	}
+	go self.run()
+	return self, nil
+}
+
+// Watch sets the directories being watched.  Directories which were watched
+// but are not in dirs are no longer watched.  Directories which do not exist
+// are skipped.
+func (self *DirWatcher) Watch(dirs []string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	want := make(map[string]struct{}, len(dirs))
+	var firstErr error
+	for _, dir := range dirs {
+		want[dir] = struct{}{}
+		if _, ok := self.watches[dir]; ok {
+			continue
+		}
+		wd, err := unix.InotifyAddWatch(self.fd, dir, dirWatchMask)
+		if err != nil {
+			if err != syscall.ENOENT && err != syscall.ENOTDIR && firstErr == nil {
+				firstErr = &os.PathError{
+					Op:   "inotify_add_watch",
+					Path: dir,
+					Err:  err,
+				}
+			}
+			continue
+		}
+		self.watches[dir] = wd
+	}
+	for dir, wd := range self.watches {
+		if _, ok := want[dir]; !ok {
+			delete(self.watches, dir)
+			if !self._watchingNoLock(wd) {
+				unix.InotifyRmWatch(self.fd, uint32(wd))
+			}
+		}
+	}
+	return firstErr
+}
+
+// Returns true if any directory is watched with the given descriptor.  The
+// same directory may be watched through more than one path, in which case
+// the kernel returns the same descriptor for each.
+//
+// Must be called within a lock.
+func (self *DirWatcher) _watchingNoLock(wd int) bool {
+	for _, w := range self.watches {
+		if w == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops watching.  The C channel is not closed.
+func (self *DirWatcher) Close() error {
+	return self.file.Close()
+}
+
+func (self *DirWatcher) signal() {
+	select {
+	case self.c <- struct{}{}:
+	default:
+	}
+}
+
+func (self *DirWatcher) run() {
+	var buf [4096]byte
+	for {
+		n, err := self.file.Read(buf[:])
+		if err != nil {
+			return
+		}
+		changed := false
+		for i := 0; i+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[i]))
+			if ev.Mask&unix.IN_IGNORED != 0 {
+				// The directory was removed.  Forget about it so that it
+				// can be watched again if it is recreated.
+				self.mutex.Lock()
+				for dir, wd := range self.watches {
+					if wd == int(ev.Wd) {
+						delete(self.watches, dir)
+					}
+				}
+				self.mutex.Unlock()
+			} else if ev.Mask&(dirWatchMask|unix.IN_Q_OVERFLOW) != 0 {
+				changed = true
+			}
+			i += unix.SizeofInotifyEvent + int(ev.Len)
+		}
+		if changed {
+			self.signal()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDirWatcher(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "watch_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	watched := path.Join(d, "watched")
+	other := path.Join(d, "other")
+	for _, dir := range []string{watched, other} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watcher, err := NewDirWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	if err := watcher.Watch([]string{
+		watched,
+		path.Join(d, "missing"),
+	}); err != nil {
+		t.Error(err)
+	}
+	expect := func(changed bool) {
+		t.Helper()
+		select {
+		case <-watcher.C:
+			if !changed {
+				t.Error("Unexpected change notification.")
+			}
+		case <-time.After(500 * time.Millisecond):
+			if changed {
+				t.Error("Expected change notification.")
+			}
+		}
+	}
+	expect(false)
+	if err := ioutil.WriteFile(path.Join(other, "a"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(false)
+	if err := os.Rename(path.Join(other, "a"), path.Join(watched, "a")); err != nil {
+		t.Fatal(err)
+	}
+	expect(true)
+
+	// Switch which directory is watched.
+	if err := watcher.Watch([]string{other}); err != nil {
+		t.Error(err)
+	}
+	if err := ioutil.WriteFile(path.Join(watched, "b"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(false)
+	if err := ioutil.WriteFile(path.Join(other, "b"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(true)
+
+	// A removed and recreated directory is watched again.
+	if err := os.RemoveAll(other); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := os.Mkdir(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.Watch([]string{other}); err != nil {
+		t.Error(err)
+	}
+	if err := ioutil.WriteFile(path.Join(other, "c"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(true)
+}
@@ -56,6 +56,53 @@ func findFileInZip(zr *zip.ReadCloser, filePath string) *zip.File {
 	return nil
 }
 
+// ZipSymlinks reads the targets of the symlinks in a zip archive, by entry
+// name.
+func ZipSymlinks(zr *zip.Reader) (map[string]string, error) {
+	var links map[string]string
+	for _, f := range zr.File {
+		if f.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if r, err := f.Open(); err != nil {
+			return links, err
+		} else {
+			target, err := ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return links, err
+			}
+			if links == nil {
+				links = make(map[string]string)
+			}
+			links[f.Name] = string(target)
+		}
+	}
+	return links, nil
+}
+
+// ResolveZipSymlinks follows the given symlinks, as returned by ZipSymlinks,
+// in a path within a zip archive, returning the name of the entry or
+// directory to which it refers.
+func ResolveZipSymlinks(links map[string]string, filePath string) string {
+	// Bound the number of links followed, in case of cycles.
+	for i := 0; i < 40 && len(links) > 0; i++ {
+		resolved := false
+		for dir := filePath; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if target, ok := links[dir]; ok {
+				filePath = path.Join(path.Dir(dir), target,
+					strings.TrimPrefix(filePath, dir))
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			break
+		}
+	}
+	return filePath
+}
+
 // Wraps a file within a zip archive, along with the archive itself,
 // as an io.ReadCloser
 type zipFileReader struct {
@@ -231,6 +278,15 @@ func CreateZip(zipPath string, filePaths []string) error {
 	defer f.Close()
 
 	zw := zip.NewWriter(f)
+	if err := WriteZipFiles(zw, path.Dir(zipPath), filePaths); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// WriteZipFiles adds the given files to a zip archive, named relative to
+// the given root directory.  Symlinks are stored as links.
+func WriteZipFiles(zw *zip.Writer, root string, filePaths []string) error {
 	for _, filePath := range filePaths {
 		info, err := os.Lstat(filePath)
 		if err != nil {
@@ -240,7 +296,7 @@ func CreateZip(zipPath string, filePaths []string) error {
 			continue
 		}
 
-		relPath, _ := filepath.Rel(path.Dir(zipPath), filePath)
+		relPath, _ := filepath.Rel(root, filePath)
 		header, err := zip.FileInfoHeader(info)
 		if err != nil {
 			return err
@@ -263,5 +319,45 @@ func CreateZip(zipPath string, filePaths []string) error {
 			}
 		}
 	}
-	return zw.Close()
+	return nil
+}
+
+// CopyZipEntries copies the entries of the zip archive at zipPath into
+// another archive, adding the given prefix to their names.  If keep is not
+// nil, only entries for which it returns true are copied.
+func CopyZipEntries(zw *zip.Writer, zipPath, prefix string,
+	keep func(name string) bool) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if keep != nil && !keep(f.Name) {
+			continue
+		}
+		header := f.FileHeader
+		header.Name = path.Join(prefix, f.Name)
+		header.CRC32 = 0
+		header.CompressedSize64 = 0
+		header.UncompressedSize64 = 0
+		header.CompressedSize = 0
+		header.UncompressedSize = 0
+		out, err := zw.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		if err := func() error {
+			in, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			_, err = io.Copy(out, in)
+			return err
+		}(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -11,7 +11,7 @@ syn keyword filetype  filetype nextgroup=parType skipwhite
 syn keyword parameter in out  nextgroup=parType skipwhite contained
 syn keyword src       src nextgroup=srctype skipwhite contained
 syn keyword srctype   py comp exe nextgroup=mroString contained skipwhite
-syn keyword restype   mem_gb threads special volatile nextgroup=assign contained skipwhite
+syn keyword restype   mem_gb threads special volatile container env path nextgroup=assign contained skipwhite
 syn keyword modifier  local preflight volatile nextgroup=modifier,callTarg skipwhite contained
 syn keyword boundMod  local preflight volatile disabled nextgroup=assign contained skipwhite
 syn keyword sweep     sweep nextgroup=sweepArray contained